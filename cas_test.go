@@ -0,0 +1,66 @@
+package gokv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestCASAndLock(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17371)
+	cli.Set(ctx, "k", "v1", 0)
+	if n, err := cli.Do(ctx, "CAS", "k", "v0", "v2").Int(); err != nil || n != 0 {
+		t.Errorf("cas with an unexpected value %d %v", n, err)
+	}
+	if n, err := cli.Do(ctx, "CAS", "k", "v1", "v2", "EX", 100).Int(); err != nil || n != 1 {
+		t.Errorf("cas %d %v", n, err)
+	}
+	if v := cli.Get(ctx, "k").Val(); v != "v2" {
+		t.Errorf("value after cas %q", v)
+	}
+	if ttl := cli.TTL(ctx, "k").Val(); ttl <= 0 || ttl > 100*time.Second {
+		t.Errorf("ttl after cas %v", ttl)
+	}
+	if n, _ := cli.Do(ctx, "CAS", "missing", "", "v").Int(); n != 0 {
+		t.Errorf("cas of a missing key %d", n)
+	}
+	cli.RPush(ctx, "list", "a")
+	if n, _ := cli.Do(ctx, "CAD", "list", "a").Int(); n != 0 {
+		t.Errorf("cad of a list %d", n)
+	}
+	if n, _ := cli.Do(ctx, "CAD", "k", "v1").Int(); n != 0 {
+		t.Errorf("cad with an unexpected value %d", n)
+	}
+	if n, _ := cli.Do(ctx, "CAD", "k", "v2").Int(); n != 1 || cli.Exists(ctx, "k").Val() != 0 {
+		t.Errorf("cad %d", n)
+	}
+
+	// the tokens increase with every acquisition, another owner waits for the release
+	t1, err := cli.Do(ctx, "LOCK", "sched", "a", "EX", 10).Int64()
+	if err != nil || t1 <= 0 {
+		t.Fatalf("lock %d %v", t1, err)
+	}
+	if err := cli.Do(ctx, "LOCK", "sched", "b", "EX", 10).Err(); err != redis.Nil {
+		t.Errorf("lock held by another owner %v", err)
+	}
+	t2, _ := cli.Do(ctx, "LOCK", "sched", "a", "EX", 10).Int64()
+	if t2 <= t1 {
+		t.Errorf("renew token %d after %d", t2, t1)
+	}
+	cli.Do(ctx, "CAD", "sched", "a")
+	t3, _ := cli.Do(ctx, "LOCK", "sched", "b", "PX", 1000).Int64()
+	if t3 <= t2 {
+		t.Errorf("token %d after release, last %d", t3, t2)
+	}
+	// an expired lock is free
+	time.Sleep(2100 * time.Millisecond)
+	if t4, err := cli.Do(ctx, "LOCK", "sched", "a").Int64(); err != nil || t4 <= t3 {
+		t.Errorf("lock after expired %d %v", t4, err)
+	}
+	if err := cli.Do(ctx, "LOCK", "sched", "a", "EX").Err(); err == nil {
+		t.Errorf("lock with a wrong expire")
+	}
+}
@@ -0,0 +1,176 @@
+package gokv
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/logger"
+)
+
+// changeFeedFile the file the applied changes are appended to, a full file is
+// renamed to changes-<the raft index of its last change>.jsonl
+const changeFeedFile = "changes.jsonl"
+
+// changeRecord an applied submit of the change feed, written as a json line.
+// the value of a set is decoded, the values of the other ops are the raw bytes of the submit
+type changeRecord struct {
+	Index uint64 `json:"index"`
+	// Time the unix milliseconds the change is applied at
+	Time     int64  `json:"ts"`
+	DB       int    `json:"db"`
+	OP       string `json:"op"`
+	Key      string `json:"key,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Type     string `json:"type,omitempty"`
+	ExpireAt uint64 `json:"expire_at,omitempty"`
+	// Base64 the key and the value are base64 encoded, they are not all utf-8
+	Base64 bool `json:"base64,omitempty"`
+}
+
+// changeFeed appends the submits applied by the node to a local file rotated by size.
+// entries applied again after a restart are appended again, consumers dedupe them by index
+type changeFeed struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+
+	f    *os.File
+	bw   *bufio.Writer
+	size int64
+	// last the index of the last change in the file
+	last uint64
+}
+
+func newChangeFeed(cfg ChangeFeedConfig) (*changeFeed, error) {
+	feed := &changeFeed{
+		dir:      cfg.Path,
+		maxSize:  int64(cfg.MaxSize) << 20,
+		maxFiles: cfg.MaxFiles,
+	}
+	return feed, feed.open()
+}
+
+func (feed *changeFeed) open() error {
+	f, err := os.OpenFile(path.Join(feed.dir, changeFeedFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	feed.f, feed.bw, feed.size = f, bufio.NewWriter(f), info.Size()
+	return nil
+}
+
+func changeRecordOf(index uint64, now int64, st *Submit) *changeRecord {
+	var r = &changeRecord{Index: index, Time: now, DB: st.DB, OP: st.OP.String()}
+	var key, val = st.Key, st.Value
+	switch st.OP {
+	case CommitOPSet:
+		v := codec.Decode(st.Value)
+		r.Type, r.ExpireAt = typeName(v.Type()), v.ExpireAt()
+		// the value of a composite type is the meta, its elements are sub keys
+		val = nil
+		if v.IsString() {
+			val = v.StringVal()
+		}
+	case CommitOPSwapDB:
+		key = []byte(strconv.FormatInt(codec.Bytes2Int64(st.Key), 10))
+		val = []byte(strconv.FormatInt(codec.Bytes2Int64(st.Value), 10))
+	}
+	enc := newTextEncoder(key, val)
+	r.Key, r.Value, r.Base64 = enc.text(key), enc.text(val), enc.base64
+	return r
+}
+
+// write append the submits applied at index
+func (feed *changeFeed) write(ctx context.Context, index uint64, submits []*Submit) {
+	if feed == nil {
+		return
+	}
+	var now = time.Now().UnixMilli()
+	var records = make([]*changeRecord, 0, len(submits))
+	for _, st := range submits {
+		records = append(records, changeRecordOf(index, now, st))
+	}
+	feed.append(ctx, index, records...)
+}
+
+// snapshot append a snapshot mark, the store is replaced by the snapshot at index,
+// consumers export the keys again
+func (feed *changeFeed) snapshot(ctx context.Context, index uint64) {
+	if feed == nil {
+		return
+	}
+	feed.append(ctx, index, &changeRecord{Index: index, Time: time.Now().UnixMilli(), OP: "snapshot"})
+}
+
+func (feed *changeFeed) append(ctx context.Context, index uint64, records ...*changeRecord) {
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			logger.Errorf(ctx, "marshal change at index %d error:%v", index, err)
+			continue
+		}
+		feed.bw.Write(data)
+		feed.bw.WriteByte('\n')
+		feed.size += int64(len(data)) + 1
+	}
+	feed.last = index
+	if err := feed.bw.Flush(); err != nil {
+		logger.Errorf(ctx, "write change feed at index %d error:%v", index, err)
+	}
+	if feed.maxSize > 0 && feed.size >= feed.maxSize {
+		if err := feed.rotate(); err != nil {
+			logger.Errorf(ctx, "rotate change feed at index %d error:%v", index, err)
+		}
+	}
+}
+
+// rotate rename the full file and remove the oldest files beyond max files
+func (feed *changeFeed) rotate() error {
+	if err := feed.f.Close(); err != nil {
+		return err
+	}
+	name := path.Join(feed.dir, fmt.Sprintf("changes-%020d.jsonl", feed.last))
+	if err := os.Rename(path.Join(feed.dir, changeFeedFile), name); err != nil {
+		return err
+	}
+	if err := feed.open(); err != nil {
+		return err
+	}
+	if feed.maxFiles <= 0 {
+		return nil
+	}
+	files, err := filepath.Glob(path.Join(feed.dir, "changes-*.jsonl"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for len(files) > feed.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+func (feed *changeFeed) Close() error {
+	if feed == nil {
+		return nil
+	}
+	feed.bw.Flush()
+	return feed.f.Close()
+}
@@ -0,0 +1,237 @@
+package gokv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// defaultUser the user of all clients, there are no ACL users
+const defaultUser = "default"
+
+// readCommands the commands served while the writes are held by CLIENT PAUSE WRITE
+var readCommands = map[string]bool{
+	"ping": true, "get": true, "mget": true, "exists": true, "touch": true, "strlen": true, "getrange": true, "substr": true,
+	"getbit": true, "bitcount": true, "bitpos": true,
+	"scard": true, "sismember": true, "smismember": true, "smembers": true, "sinter": true, "sunion": true, "sdiff": true,
+	"srandmember": true, "sscan": true,
+	"xrange": true, "xrevrange": true, "xlen": true, "xread": true, "xpending": true,
+	"llen": true, "lrange": true, "lindex": true,
+	"zcard": true, "zscore": true, "zrange": true, "zrevrange": true,
+	"hget": true, "hmget": true, "hgetall": true, "hkeys": true, "hvals": true, "hlen": true, "hexists": true,
+	"pfcount": true, "geopos": true, "geohash": true, "geodist": true,
+	"ttl": true, "type": true, "randomkey": true, "dbsize": true, "keys": true, "scan": true,
+	"select": true, "dump": true, "getrev": true, "history": true, "kvwatch": true, "kvunwatch": true,
+	"command": true, "monitor": true, "config": true, "slowlog": true, "latency": true, "info": true, "sentinel": true,
+}
+
+// clientReader count the bytes read from a client connection
+type clientReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c clientReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// clientWriter count the bytes written to a client connection
+type clientWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c clientWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// flags the flags of CLIENT LIST, M the upstream master, b blocked, O monitor, e no-evict, N none
+func (c *Client) flags() string {
+	var flags string
+	if c.conn == nil {
+		flags += "M"
+	}
+	if c.blocked != nil {
+		flags += "b"
+	}
+	if c.monitor {
+		flags += "O"
+	}
+	if c.noEvict {
+		flags += "e"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	return flags
+}
+
+// localAddr the local address of the connection, empty for the pseudo client of the upstream
+func (c *Client) localAddr() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.LocalAddr().String()
+}
+
+// info the line of the client in CLIENT LIST, it runs on the receive loop
+func (c *Client) info(now time.Time) string {
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d tot-net-in=%d tot-net-out=%d cmd=%s user=%s\n",
+		c.id, c.addr, c.localAddr(), c.name,
+		int64(now.Sub(c.created).Seconds()), int64(now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastActive))).Seconds()),
+		c.flags(), c.db, atomic.LoadInt64(&c.netIn), atomic.LoadInt64(&c.netOut), c.lastCmd, defaultUser)
+}
+
+// clientPause the commands held by CLIENT PAUSE until the timer or CLIENT UNPAUSE
+type clientPause struct {
+	until time.Time
+	timer *time.Timer
+	// writes only the writes are held
+	writes bool
+	queue  []heldMessage
+}
+
+type heldMessage struct {
+	client *Client
+	msg    Message
+}
+
+// holds whether the command of the client is held, the commands after a held one are held in order.
+// CLIENT is served to unpause
+func (p *clientPause) holds(client *Client, name string) bool {
+	if client.held > 0 {
+		return true
+	}
+	if name == "client" {
+		return false
+	}
+	return !p.writes || !readCommands[name]
+}
+
+func (n *Server) hold(client *Client, msg Message) {
+	client.held++
+	n.pause.queue = append(n.pause.queue, heldMessage{client: client, msg: msg})
+}
+
+// unpause serve the held commands in order, it runs on the receive loop
+func (n *Server) unpause(ctx context.Context) {
+	p := n.pause
+	if p == nil {
+		return
+	}
+	p.timer.Stop()
+	n.pause = nil
+	for _, h := range p.queue {
+		h.client.held--
+		if err := n.handleCmd(ctx, h.msg); err != nil {
+			logger.Errorf(ctx, "handle paused cmd error:%v", err)
+		}
+	}
+}
+
+// client CLIENT subcommands, it runs on the receive loop. it returns whether the client kills itself
+func (n *Server) client(ctx context.Context, client *Client, cmd *protocol.ClientCmd) (killSelf bool) {
+	now := time.Now()
+	switch cmd.Sub {
+	case protocol.ClientList:
+		var sb strings.Builder
+		for _, c := range n.sortedClients() {
+			if len(cmd.IDs) > 0 && !containsID(cmd.IDs, c.id) {
+				continue
+			}
+			sb.WriteString(c.info(now))
+		}
+		cmd.Info = sb.String()
+	case protocol.ClientInfo:
+		cmd.Info = client.info(now)
+	case protocol.ClientID:
+		cmd.N = int64(client.id)
+	case protocol.ClientSetName:
+		client.name = string(cmd.Name)
+	case protocol.ClientGetName:
+		cmd.Name = []byte(client.name)
+	case protocol.ClientNoEvict:
+		client.noEvict = cmd.NoEvict
+	case protocol.ClientPause:
+		n.pauseClients(cmd.Timeout, cmd.PauseWrite)
+	case protocol.ClientUnpause:
+		n.unpause(ctx)
+	case protocol.ClientKill:
+		f := cmd.Kill
+		for _, c := range n.sortedClients() {
+			// the pseudo client of the upstream is stopped by the replication only
+			if c.conn == nil {
+				continue
+			}
+			if (f.ID != 0 && c.id != f.ID) || (f.Addr != "" && c.addr.String() != f.Addr) ||
+				(f.LAddr != "" && c.localAddr() != f.LAddr) || (f.User != "" && f.User != defaultUser) {
+				continue
+			}
+			if c == client {
+				if f.SkipMe {
+					continue
+				}
+				// the client is closed after the reply
+				killSelf = true
+			} else {
+				c.conn.Close()
+			}
+			logger.Infof(ctx, "client %d %s is killed", c.id, c.addr)
+			cmd.N++
+		}
+		if cmd.KillAddr && cmd.N == 0 {
+			cmd.Err = kverror.ErrNoSuchClient
+		}
+	}
+	return killSelf
+}
+
+// pauseClients hold the commands of all clients or the writes for timeout,
+// a pause in effect is extended and holds all commands if either does
+func (n *Server) pauseClients(timeout time.Duration, writes bool) {
+	until := time.Now().Add(timeout)
+	if p := n.pause; p != nil {
+		p.writes = p.writes && writes
+		if until.After(p.until) {
+			p.until = until
+			p.timer.Reset(timeout)
+		}
+		return
+	}
+	p := &clientPause{until: until, writes: writes}
+	p.timer = time.AfterFunc(timeout, func() { n.unpauseChan <- p })
+	n.pause = p
+}
+
+// sortedClients the connected clients in the order of their ids
+func (n *Server) sortedClients() []*Client {
+	n.RLock()
+	var clients = make([]*Client, 0, len(n.clients))
+	for _, c := range n.clients {
+		clients = append(clients, c)
+	}
+	n.RUnlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
+
+func containsID(ids []uint64, id uint64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package gokv_test
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17751)
+	other := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17751", MaxRetries: -1, PoolSize: 1})
+	defer other.Close()
+
+	if err := other.Do(ctx, "CLIENT", "SETNAME", "worker 1").Err(); err == nil {
+		t.Error("setname with a space")
+	}
+	other.Do(ctx, "CLIENT", "SETNAME", "worker-1")
+	if name, _ := other.ClientGetName(ctx).Result(); name != "worker-1" {
+		t.Errorf("client getname %q", name)
+	}
+	id, err := other.ClientID(ctx).Result()
+	if err != nil || id <= 0 {
+		t.Fatalf("client id %d %v", id, err)
+	}
+	other.Set(ctx, "k", "v", 0)
+
+	list, err := cli.ClientList(ctx).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := regexp.MustCompile(`(?m)^id=` + strconv.FormatInt(id, 10) + ` .*$`).FindString(list)
+	for _, expect := range []string{"name=worker-1 ", "flags=N ", "db=0 ", "cmd=set ", "user=default"} {
+		if !strings.Contains(line, expect) {
+			t.Errorf("client list line %q missing %q", line, expect)
+		}
+	}
+	if n := regexp.MustCompile(`tot-net-in=(\d+)`).FindStringSubmatch(line); len(n) < 2 || n[1] == "0" {
+		t.Errorf("client list bytes in %q", line)
+	}
+	if info, _ := other.Do(ctx, "CLIENT", "INFO").Text(); !strings.HasPrefix(info, "id="+strconv.FormatInt(id, 10)+" ") || !strings.Contains(info, "cmd=client ") {
+		t.Errorf("client info %q", info)
+	}
+
+	// writes are held by pause write, reads are served
+	if err := cli.ClientPause(ctx, 300*time.Millisecond).Err(); err != nil {
+		t.Fatal(err)
+	}
+	cli.Do(ctx, "CLIENT", "PAUSE", 300, "WRITE")
+	start := time.Now()
+	if v, _ := other.Get(ctx, "k").Result(); v != "v" {
+		t.Errorf("get while paused %q", v)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("a pause all is not held %v", d)
+	}
+	cli.Do(ctx, "CLIENT", "PAUSE", 10000, "WRITE")
+	if v, _ := other.Get(ctx, "k").Result(); v != "v" {
+		t.Errorf("get while writes are paused %q", v)
+	}
+	done := make(chan error)
+	go func() { done <- other.Set(ctx, "k", "v2", 0).Err() }()
+	select {
+	case <-done:
+		t.Error("a write is not held")
+	case <-time.After(200 * time.Millisecond):
+	}
+	cli.Do(ctx, "CLIENT", "UNPAUSE")
+	if err := <-done; err != nil {
+		t.Errorf("held write %v", err)
+	}
+
+	// kill by id and by addr
+	if n, _ := cli.ClientKillByFilter(ctx, "ID", strconv.FormatInt(id, 10)).Result(); n != 1 {
+		t.Errorf("killed %d", n)
+	}
+	if err := other.Ping(ctx).Err(); err == nil {
+		t.Error("killed client is connected")
+	}
+	if err := cli.ClientKill(ctx, "127.0.0.1:1").Err(); err == nil || err.Error() != "ERR No such client" {
+		t.Errorf("kill a missing addr %v", err)
+	}
+	if n, _ := cli.ClientKillByFilter(ctx, "USER", "nobody").Result(); n != 0 {
+		t.Errorf("killed %d of a missing user", n)
+	}
+}
@@ -19,7 +19,6 @@ import (
 	"flag"
 	"os"
 	"os/signal"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/yixinin/gokv"
@@ -30,6 +29,8 @@ import (
 var nodeID = flag.Uint64("node", 1, "current node id")
 var confFile = flag.String("conf", "conf/kvs.toml", "config file path")
 var debug = flag.Bool("debug", false, "debug log")
+var rdbFile = flag.String("rdb", "", "import a redis rdb file into the fresh node before starting")
+var exportFile = flag.String("export", "", "export the keys of the stopped node as json lines to the file, - for stdout")
 
 func main() {
 	flag.Parse()
@@ -37,11 +38,14 @@ func main() {
 	// load config
 	cfg := gokv.LoadConfig(*confFile, *nodeID)
 
-	if strings.ToLower(cfg.ServerCfg.LogLevel) == "debug" || *debug {
-		logger.SetLevel(logrus.DebugLevel)
-	} else {
-		logger.SetLevel(logrus.InfoLevel)
+	level, err := logrus.ParseLevel(cfg.ServerCfg.LogLevel)
+	if err != nil {
+		level = logrus.InfoLevel
 	}
+	if *debug {
+		level = logrus.DebugLevel
+	}
+	logger.SetLevel(level)
 
 	if cfg.ServerCfg.LogPath != "" {
 		//todo
@@ -57,6 +61,18 @@ func main() {
 	signal.Notify(ch, os.Interrupt)
 	var ctx, cancel = context.WithCancel(context.Background())
 	defer cancel()
+	if *exportFile != "" {
+		if err := gokv.NewRaftKv(*nodeID, cfg).Export(ctx, *exportFile); err != nil {
+			logger.Errorf(ctx, "export to %s failed: %v", *exportFile, err)
+		}
+		return
+	}
+	if *rdbFile != "" {
+		if err := gokv.NewRaftKv(*nodeID, cfg).ImportRDB(ctx, *rdbFile); err != nil {
+			logger.Errorf(ctx, "import rdb %s failed: %v", *rdbFile, err)
+			return
+		}
+	}
 	// start kv
 	kv := gokv.NewRaftKv(*nodeID, cfg)
 	go kv.Run(ctx)
@@ -11,6 +11,18 @@ func EncodeInt(i int64, ex ...uint64) Value {
 	return defaultEncoder.EncodeInt(i, ex...)
 }
 
+func EncodeString(s []byte, ex ...uint64) Value {
+	return defaultEncoder.EncodeString(s, ex...)
+}
+
+func EncodeMeta(t uint8, size int64, ex ...uint64) Value {
+	return defaultEncoder.EncodeMeta(t, size, ex...)
+}
+
+func EncodeMetaExt(t uint8, size int64, ext []byte, ex ...uint64) Value {
+	return defaultEncoder.EncodeMetaExt(t, size, ext, ex...)
+}
+
 func Decode(data []byte) Value {
 	return defaultDecoder.Decode(data)
 }
@@ -23,11 +23,11 @@ func (d bytesDecoder) Decode(data []byte) Value {
 	case BoolType:
 		v.b = data[HeaderSize] == 1
 		v.t = BoolType
-	case IntType:
+	case IntType, SetType, StreamType, ListType, ZSetType, HashType:
 		var i int64
 		binary.Read(bytes.NewBuffer(data[HeaderSize:]), binary.BigEndian, &i)
 		v.i = i
-		v.t = IntType
+		v.t = data[0]
 	case FloatType:
 		var f float64
 		binary.Read(bytes.NewBuffer(data[HeaderSize:]), binary.BigEndian, &f)
@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc64"
+)
+
+// the serialized value of dump/restore:
+//
+//	magic | version | uvarint len(meta) | meta | (uvarint len(elem) | elem | uvarint len(val) | val)* | crc64
+//
+// meta is the raw value with its type and expire time, elem and val are the element keys
+// of a composite value without the key prefix and their values.
+const (
+	DumpVersion = 1
+	dumpCRCSize = 8
+)
+
+var dumpMagic = []byte("GOKV")
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// DumpElem an element key suffix and its value of a dumped composite value
+type DumpElem struct {
+	Elem []byte
+	Val  []byte
+}
+
+// EncodeDump serialize a raw value with its elements
+func EncodeDump(meta []byte, elems []DumpElem) []byte {
+	var size = len(dumpMagic) + 1 + binary.MaxVarintLen64 + len(meta) + dumpCRCSize
+	for _, e := range elems {
+		size += 2*binary.MaxVarintLen64 + len(e.Elem) + len(e.Val)
+	}
+	var b = make([]byte, 0, size)
+	b = append(b, dumpMagic...)
+	b = append(b, DumpVersion)
+	b = AppendBytes(b, meta)
+	for _, e := range elems {
+		b = AppendBytes(b, e.Elem)
+		b = AppendBytes(b, e.Val)
+	}
+	var crc = make([]byte, dumpCRCSize)
+	binary.BigEndian.PutUint64(crc, crc64.Checksum(b, crcTable))
+	return append(b, crc...)
+}
+
+// AppendBytes append data prefixed by its uvarint length to b
+func AppendBytes(b, data []byte) []byte {
+	var n = make([]byte, binary.MaxVarintLen64)
+	b = append(b, n[:binary.PutUvarint(n, uint64(len(data)))]...)
+	return append(b, data...)
+}
+
+// ReadBytes read the data appended by AppendBytes at the head of b, rest is the bytes after it
+func ReadBytes(b []byte) (data, rest []byte, ok bool) {
+	n, l := binary.Uvarint(b)
+	if l <= 0 || uint64(len(b)-l) < n {
+		return nil, nil, false
+	}
+	return b[l : l+int(n)], b[l+int(n):], true
+}
+
+// DecodeDump parse a serialized value, ok is false if the version or checksum is wrong
+func DecodeDump(b []byte) (meta []byte, elems []DumpElem, ok bool) {
+	var head = len(dumpMagic) + 1
+	if len(b) < head+dumpCRCSize || !bytes.Equal(b[:len(dumpMagic)], dumpMagic) || b[len(dumpMagic)] != DumpVersion {
+		return nil, nil, false
+	}
+	body, crc := b[:len(b)-dumpCRCSize], b[len(b)-dumpCRCSize:]
+	if crc64.Checksum(body, crcTable) != binary.BigEndian.Uint64(crc) {
+		return nil, nil, false
+	}
+	var next = func() (data []byte, ok bool) {
+		data, body, ok = ReadBytes(body)
+		return data, ok
+	}
+	body = body[head:]
+	if meta, ok = next(); !ok || len(meta) < HeaderSize {
+		return nil, nil, false
+	}
+	for len(body) > 0 {
+		var e DumpElem
+		if e.Elem, ok = next(); !ok {
+			return nil, nil, false
+		}
+		if e.Val, ok = next(); !ok {
+			return nil, nil, false
+		}
+		elems = append(elems, e)
+	}
+	return meta, elems, true
+}
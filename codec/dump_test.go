@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	meta := EncodeMeta(SetType, 2, 1700000000).Raw()
+	elems := []DumpElem{{Elem: []byte("a"), Val: nil}, {Elem: []byte("b"), Val: []byte("x")}}
+	b := EncodeDump(meta, elems)
+
+	m, es, ok := DecodeDump(b)
+	if !ok {
+		t.Fatal("decode dump failed")
+	}
+	if !bytes.Equal(m, meta) || len(es) != 2 {
+		t.Fatalf("decode dump: %q %v", m, es)
+	}
+	for i := range es {
+		if !bytes.Equal(es[i].Elem, elems[i].Elem) || !bytes.Equal(es[i].Val, elems[i].Val) {
+			t.Errorf("elem %d: %q %q", i, es[i].Elem, es[i].Val)
+		}
+	}
+	if v := Decode(m); v.Type() != SetType || v.Len() != 2 || v.ExpireAt() != 1700000000 {
+		t.Errorf("decode meta: %v %v %v", v.Type(), v.Len(), v.ExpireAt())
+	}
+
+	// corrupted, truncated and foreign payloads
+	for _, p := range [][]byte{
+		append(append([]byte{}, b[:10]...), append([]byte{b[10] ^ 1}, b[11:]...)...),
+		b[:len(b)-1],
+		b[:5],
+		[]byte("\x00\x03bar\x0a\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+		nil,
+	} {
+		if _, _, ok := DecodeDump(p); ok {
+			t.Errorf("decode %q should fail", p)
+		}
+	}
+}
@@ -70,6 +70,9 @@ func (e byesEncoder) EncodeInt(i int64, ex ...uint64) Value {
 		e: 0,
 		t: IntType,
 	}
+	if len(ex) > 0 {
+		v.e = ex[0]
+	}
 	bytesBuffer := bytes.NewBuffer(make([]byte, 0, NumberSize))
 	binary.Write(bytesBuffer, binary.BigEndian, i)
 	data := bytesBuffer.Bytes()
@@ -85,3 +88,34 @@ func (e byesEncoder) EncodeInt(i int64, ex ...uint64) Value {
 	copy(v.data[HeaderSize:], data)
 	return v
 }
+
+// EncodeString encode bytes as a binary safe string value, no number detection
+func (e byesEncoder) EncodeString(b []byte, ex ...uint64) Value {
+	v := Value{
+		e: 0,
+		t: StrType,
+	}
+	if len(ex) > 0 {
+		v.e = ex[0]
+	}
+	v.data = make([]byte, HeaderSize+len(b))
+	v.data[0] = v.t
+	binary.BigEndian.PutUint64(v.data[TypeSize:HeaderSize], v.e)
+	copy(v.data[HeaderSize:], b)
+	return v
+}
+
+// EncodeMeta encode the meta value of a composite type with its element count
+func (e byesEncoder) EncodeMeta(t uint8, size int64, ex ...uint64) Value {
+	v := e.EncodeInt(size, ex...)
+	v.t = t
+	v.data[0] = t
+	return v
+}
+
+// EncodeMetaExt encode the meta value of a composite type with extra meta bytes after the element count
+func (e byesEncoder) EncodeMetaExt(t uint8, size int64, ext []byte, ex ...uint64) Value {
+	v := e.EncodeMeta(t, size, ex...)
+	v.data = append(v.data, ext...)
+	return v
+}
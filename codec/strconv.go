@@ -1,6 +1,10 @@
 package codec
 
-import "strconv"
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
 
 func Atoi(b []byte) (int, error) {
 	return strconv.Atoi(BytesToString(b))
@@ -17,3 +21,37 @@ func ParseUint(b []byte, base int, bitSize int) (uint64, error) {
 func ParseFloat(b []byte, bitSize int) (float64, error) {
 	return strconv.ParseFloat(BytesToString(b), bitSize)
 }
+
+// LongDoublePrec the mantissa bits of x87 long double, which redis uses for float increments
+const LongDoublePrec = 64
+
+// longDoubleMaxExp the binary exponent of long double, larger values overflow to infinity
+const longDoubleMaxExp = 16384
+
+// IsLongDoubleInf whether f is infinite as a long double
+func IsLongDoubleInf(f *big.Float) bool {
+	return f.IsInf() || f.MantExp(nil) > longDoubleMaxExp
+}
+
+// ParseLongDouble parse a finite float with long double precision
+func ParseLongDouble(b []byte) (*big.Float, bool) {
+	f, _, err := big.ParseFloat(BytesToString(b), 10, LongDoublePrec, big.ToNearestEven)
+	if err != nil || IsLongDoubleInf(f) {
+		return nil, false
+	}
+	return f, true
+}
+
+// FormatLongDouble format float like redis ld2string in human friendly mode:
+// 17 digits after the dot, trailing zeroes removed
+func FormatLongDouble(f *big.Float) []byte {
+	s := f.Text('f', 17)
+	if strings.IndexByte(s, '.') >= 0 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return []byte(s)
+}
@@ -0,0 +1,36 @@
+package codec
+
+import "testing"
+
+func TestIncrLongDouble(t *testing.T) {
+	var cases = []struct {
+		val, incr, except string
+	}{
+		{"10.50", "0.1", "10.6"},
+		{"5.0e3", "2.0e2", "5200"},
+		{"0.1", "0.2", "0.3"},
+		{"1", "-1", "0"},
+		{"-0.5", "0.25", "-0.25"},
+		{"1e20", "1", "100000000000000000000"},
+	}
+	for _, c := range cases {
+		v, ok1 := ParseLongDouble([]byte(c.val))
+		incr, ok2 := ParseLongDouble([]byte(c.incr))
+		if !ok1 || !ok2 {
+			t.Fatalf("parse %s %s failed", c.val, c.incr)
+		}
+		if s := string(FormatLongDouble(v.Add(v, incr))); s != c.except {
+			t.Errorf("%s + %s = %s, except %s", c.val, c.incr, s, c.except)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "inf", "-inf", "nan", "1.5.5", " 1", "1e5000"} {
+		if _, ok := ParseLongDouble([]byte(s)); ok {
+			t.Errorf("parse %q should fail", s)
+		}
+	}
+	max, _ := ParseLongDouble([]byte("1.1e4932"))
+	if IsLongDoubleInf(max) || !IsLongDoubleInf(max.Add(max, max)) {
+		t.Errorf("the sum of %s overflows a long double", max.Text('g', 5))
+	}
+}
@@ -77,10 +77,14 @@ func (v Value) Valid() bool {
 		if len(v.data) != HeaderSize+1 {
 			return false
 		}
-	case IntType, FloatType:
+	case IntType, FloatType, SetType, ZSetType, HashType:
 		if len(v.data) != HeaderSize+8 {
 			return false
 		}
+	case StreamType, ListType:
+		if len(v.data) < HeaderSize+8 {
+			return false
+		}
 	}
 	return true
 }
@@ -98,7 +102,7 @@ func (v Value) Expired(now uint64) bool {
 
 func (v Value) Type() uint8 {
 	switch v.t {
-	case BoolType, IntType, FloatType, StrType:
+	case BoolType, IntType, FloatType, StrType, SetType, StreamType, ListType, ZSetType, HashType:
 		return v.t
 	default:
 		return NIL
@@ -120,7 +124,7 @@ func (v Value) String() string {
 	case IntType:
 		return strconv.FormatInt(v.i, 10)
 	case FloatType:
-		return strconv.FormatFloat(v.f, 'f', '-', 64)
+		return strconv.FormatFloat(v.f, 'f', -1, 64)
 	}
 	return string(v.data[HeaderSize:])
 }
@@ -131,6 +135,28 @@ func (v Value) Bool() (bool, bool) {
 func (v Value) Int() (int64, bool) {
 	return v.i, v.t == IntType
 }
+
+// IsString whether the value is a string, numbers are strings too
+func (v Value) IsString() bool {
+	return !IsComposite(v.t)
+}
+
+// Ext the extra meta bytes of a composite value after the element count
+func (v Value) Ext() []byte {
+	if !IsComposite(v.t) || len(v.data) < HeaderSize+NumberSize {
+		return nil
+	}
+	return v.data[HeaderSize+NumberSize:]
+}
+
+// Len the element count of a composite value
+func (v Value) Len() int64 {
+	if !IsComposite(v.t) {
+		return 0
+	}
+	return v.i
+}
+
 func (v Value) Float() (float64, bool) {
 	return v.f, v.t == FloatType
 }
@@ -158,7 +184,21 @@ const (
 	IntType   uint8 = 0b00000010
 	FloatType uint8 = 0b00000011
 	StrType   uint8 = 0b00000100
+
+	// composite types, the value is a meta which holds the element count,
+	// elements are stored in their own keys
+	SetType    uint8 = 0b00010001
+	StreamType uint8 = 0b00010010
+	ListType   uint8 = 0b00010011
+	ZSetType   uint8 = 0b00010100
+	HashType   uint8 = 0b00010101
 )
+
+// IsComposite whether t is a composite type
+func IsComposite(t uint8) bool {
+	return t&0b00010000 != 0
+}
+
 const (
 	MinNumByte   = '0'
 	MaxNumByte   = '9'
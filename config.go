@@ -20,8 +20,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+	"github.com/yixinin/gokv/kvstore"
 )
 
 const defaultConfigStr = `
@@ -31,6 +34,7 @@ const defaultConfigStr = `
 data-path = "Data/raft-kvs"
 log-path = "Logs/raft-kvs"
 log-level = "debug"
+databases = 16
 
 [cluster]
 [[cluster.nodes]]
@@ -60,8 +64,40 @@ type ServerConfig struct {
 	LogPath  string `toml:"log-path,omitempty" json:"log-path"`
 	LogLevel string `toml:"log-level,omitempty" json:"log-level"`
 	DataPath string `toml:"data-path,omitempty" json:"data-path"`
+	// Databases the number of databases for select
+	Databases int `toml:"databases,omitempty" json:"databases"`
+	// WatchHistory the number of recent changes kept for KVWATCH FROM
+	WatchHistory int `toml:"watch-history,omitempty" json:"watch-history"`
+	// RevisionRetention the number of raft indexes the old revisions of string keys are kept for,
+	// revisions are recorded only if it is set. it must be the same on all nodes
+	RevisionRetention uint64 `toml:"revision-retention,omitempty" json:"revision-retention"`
+
+	// the settings below can be changed by CONFIG SET at runtime
+
+	// GCBatchSize the number of keys gc scans in each database a round
+	GCBatchSize int `toml:"gc-batch-size,omitempty" json:"gc-batch-size"`
+	// RequestTimeout the milliseconds to wait for a raft proposal or read index
+	RequestTimeout int `toml:"request-timeout,omitempty" json:"request-timeout"`
+	// Timeout close the clients idle for the seconds, disabled if 0
+	Timeout int `toml:"timeout,omitempty" json:"timeout"`
+	// MaxClients the max number of connected clients
+	MaxClients int `toml:"max-clients,omitempty" json:"max-clients"`
+	// SlowlogSlowerThan log the commands slower than the microseconds, all commands if 0 and
+	// disabled if negative, nil if unset
+	SlowlogSlowerThan *int `toml:"slowlog-log-slower-than,omitempty" json:"slowlog-log-slower-than"`
+	// SlowlogMaxLen the number of slow commands kept
+	SlowlogMaxLen int `toml:"slowlog-max-len,omitempty" json:"slowlog-max-len"`
 }
 
+// defaultWatchHistory the default number of recent changes kept for KVWATCH FROM
+const defaultWatchHistory = 4096
+
+const (
+	defaultMaxClients        = 10000
+	defaultSlowlogSlowerThan = 10000
+	defaultSlowlogMaxLen     = 128
+)
+
 // ClusterNode  cluster node
 type ClusterNode struct {
 	NodeID        uint64 `toml:"node-id,omitempty" json:"node-id"`
@@ -69,6 +105,8 @@ type ClusterNode struct {
 	HTTPPort      uint32 `toml:"http-port,omitempty" json:"http-port"`
 	HeartbeatPort uint32 `toml:"heartbeat-port,omitempty" json:"heartbeat-port"`
 	ReplicatePort uint32 `toml:"replicate-port,omitempty" json:"replicate-port"`
+	// AdminPort the http port of /metrics, disabled if 0
+	AdminPort uint32 `toml:"admin-port,omitempty" json:"admin-port"`
 }
 
 // ClusterConfig  cluster configs
@@ -76,10 +114,34 @@ type ClusterConfig struct {
 	Nodes []*ClusterNode `toml:"nodes,omitempty" json:"nodes"`
 }
 
+// UpstreamConfig the redis master the leader replicates from, replication is disabled if addr is empty
+type UpstreamConfig struct {
+	Addr     string `toml:"addr,omitempty" json:"addr"`
+	Username string `toml:"username,omitempty" json:"username"`
+	Password string `toml:"password,omitempty" json:"-"`
+}
+
+// ChangeFeedConfig the feed of the applied changes written to path, the feed is disabled if path is empty
+type ChangeFeedConfig struct {
+	Path string `toml:"path,omitempty" json:"path"`
+	// MaxSize the size in MB to rotate the feed file at
+	MaxSize int `toml:"max-size,omitempty" json:"max-size"`
+	// MaxFiles the number of rotated files to keep, all are kept if 0
+	MaxFiles int `toml:"max-files,omitempty" json:"max-files"`
+}
+
+// defaultChangeFeedSize the default size in MB to rotate the change feed at
+const defaultChangeFeedSize = 64
+
 // Config kvs config
 type Config struct {
-	ServerCfg  ServerConfig  `toml:"server,omitempty" json:"server"`
-	ClusterCfg ClusterConfig `toml:"cluster,omitempty" json:"cluster"`
+	ServerCfg   ServerConfig     `toml:"server,omitempty" json:"server"`
+	ClusterCfg  ClusterConfig    `toml:"cluster,omitempty" json:"cluster"`
+	UpstreamCfg UpstreamConfig   `toml:"upstream,omitempty" json:"upstream"`
+	FeedCfg     ChangeFeedConfig `toml:"changefeed,omitempty" json:"changefeed"`
+
+	// file the file the config is loaded from, CONFIG REWRITE writes to it
+	file string
 }
 
 func initDir(dir string) error {
@@ -116,9 +178,52 @@ func (c *Config) Validate(nodeID uint64) {
 		panic(fmt.Sprintf("init data dir(%s) failed: %v", c.ServerCfg.DataPath, err))
 	}
 
+	if c.ServerCfg.Databases <= 0 || c.ServerCfg.Databases > kvstore.MaxDatabases {
+		panic(fmt.Sprintf("invalid databases %d", c.ServerCfg.Databases))
+	}
+
+	if c.ServerCfg.WatchHistory <= 0 {
+		c.ServerCfg.WatchHistory = defaultWatchHistory
+	}
+
+	if c.ServerCfg.LogLevel != "" {
+		if _, err := logrus.ParseLevel(c.ServerCfg.LogLevel); err != nil {
+			panic(fmt.Sprintf("invalid log level %s", c.ServerCfg.LogLevel))
+		}
+	}
+	if c.ServerCfg.GCBatchSize <= 0 {
+		c.ServerCfg.GCBatchSize = GC_EPOCH
+	}
+	if c.ServerCfg.RequestTimeout <= 0 {
+		c.ServerCfg.RequestTimeout = int(DefaultRequestTimeout / time.Millisecond)
+	}
+	if c.ServerCfg.Timeout < 0 {
+		c.ServerCfg.Timeout = 0
+	}
+	if c.ServerCfg.MaxClients <= 0 {
+		c.ServerCfg.MaxClients = defaultMaxClients
+	}
+	if c.ServerCfg.SlowlogSlowerThan == nil {
+		var slowerThan = defaultSlowlogSlowerThan
+		c.ServerCfg.SlowlogSlowerThan = &slowerThan
+	}
+	if c.ServerCfg.SlowlogMaxLen <= 0 {
+		c.ServerCfg.SlowlogMaxLen = defaultSlowlogMaxLen
+	}
+
 	if len(c.ClusterCfg.Nodes) == 0 {
 		panic("cluster nodes is empty")
 	}
+
+	if c.FeedCfg.Path != "" {
+		c.FeedCfg.Path = path.Join(c.FeedCfg.Path, fmt.Sprintf("node%d", nodeID))
+		if err := initDir(c.FeedCfg.Path); err != nil {
+			panic(fmt.Sprintf("init change feed dir(%s) failed: %v", c.FeedCfg.Path, err))
+		}
+		if c.FeedCfg.MaxSize <= 0 {
+			c.FeedCfg.MaxSize = defaultChangeFeedSize
+		}
+	}
 }
 
 // FindClusterNode find cluster node by NodeID
@@ -150,6 +255,7 @@ func LoadConfig(filePath string, nodeID uint64) *Config {
 		if err != nil {
 			panic(fmt.Sprintf("fail to decode config file(%v): %v", filePath, err))
 		}
+		c.file = filePath
 	}
 	c.Validate(nodeID)
 	return c
@@ -0,0 +1,116 @@
+package gokv_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yixinin/gokv"
+)
+
+func TestConfig(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17711)
+
+	if v, _ := cli.ConfigGet(ctx, "max*").Result(); fmt.Sprint(v) != "[max-clients 10000]" {
+		t.Errorf("config get max* %v", v)
+	}
+	if err := cli.ConfigSet(ctx, "gc-batch-size", "abc").Err(); err == nil || !strings.Contains(err.Error(), "couldn't be parsed into an integer") {
+		t.Errorf("set invalid integer %v", err)
+	}
+	if err := cli.ConfigSet(ctx, "log-level", "verbose").Err(); err == nil {
+		t.Error("set invalid log level")
+	}
+	if err := cli.ConfigSet(ctx, "no-such-setting", "1").Err(); err == nil || !strings.Contains(err.Error(), "Unknown option") {
+		t.Errorf("set unknown setting %v", err)
+	}
+	if err := cli.ConfigSet(ctx, "LOG-LEVEL", "warn").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := cli.ConfigGet(ctx, "loglevel").Result(); fmt.Sprint(v) != "[loglevel warning]" {
+		t.Errorf("config get loglevel %v", v)
+	}
+	if err := cli.ConfigRewrite(ctx).Err(); err == nil {
+		t.Error("rewrite without a config file")
+	}
+
+	// the clients over max-clients are rejected
+	if err := cli.ConfigSet(ctx, "max-clients", "1").Err(); err != nil {
+		t.Fatal(err)
+	}
+	cli2 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17711", MaxRetries: -1})
+	defer cli2.Close()
+	if err := cli2.Ping(ctx).Err(); err == nil || err.Error() != "ERR max number of clients reached" {
+		t.Errorf("ping over max clients %v", err)
+	}
+	cli.ConfigSet(ctx, "max-clients", "100")
+
+	// the idle clients are closed
+	cli.ConfigSet(ctx, "timeout", "1")
+	conn, err := net.Dial("tcp", "127.0.0.1:17711")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || os.IsTimeout(err) {
+		t.Errorf("idle client is not closed %v", err)
+	}
+}
+
+func TestConfigRewrite(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gokv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "kvs.toml")
+	os.WriteFile(file, []byte(fmt.Sprintf(`# kvs
+[server]
+data-path = %q
+log-path = %q
+# idle seconds
+timeout = 0
+databases = 16
+
+[[cluster.nodes]]
+node-id=1
+host="127.0.0.1"
+http-port=17721
+heartbeat-port=17821
+replicate-port=17921
+`, dir, dir)), 0644)
+
+	ctx := context.Background()
+	kv := gokv.NewRaftKv(1, gokv.LoadConfig(file, 1))
+	kv.Run(ctx)
+	go gokv.NewServer(kv).Run(ctx, 17721)
+	cli := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17721"})
+	defer cli.Close()
+	for i := 0; i < 100 && cli.Ping(ctx).Err() != nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	cli.ConfigSet(ctx, "timeout", "300")
+	cli.ConfigSet(ctx, "log-level", "error")
+	cli.ConfigSet(ctx, "slowlog-log-slower-than", "0")
+	if err := cli.ConfigRewrite(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(file)
+	for _, expect := range []string{"# kvs\n", "# idle seconds\ntimeout = 300\n", "databases = 16\nlog-level = \"error\"\n", "gc-batch-size = 100\n", "\n[[cluster.nodes]]\n"} {
+		if !strings.Contains(string(data), expect) {
+			t.Errorf("rewritten config missing %q:\n%s", expect, data)
+		}
+	}
+	cfg := gokv.LoadConfig(file, 1)
+	if cfg.ServerCfg.Timeout != 300 || cfg.ServerCfg.LogLevel != "error" || *cfg.ServerCfg.SlowlogSlowerThan != 0 {
+		t.Errorf("reload rewritten config %s", cfg)
+	}
+}
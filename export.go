@@ -0,0 +1,231 @@
+package gokv
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// exportRecord a live key of the export, written as a json line
+type exportRecord struct {
+	DB   int    `json:"db"`
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	// Value a string, the elements of a list or a set, the members of a zset, the fields of a hash
+	// or the entries of a stream
+	Value interface{} `json:"value"`
+	// TTL the seconds to live when exported, ExpireAt the unix seconds the key expires at
+	TTL      uint64 `json:"ttl,omitempty"`
+	ExpireAt uint64 `json:"expire_at,omitempty"`
+	// Base64 the key and the values are base64 encoded, they are not all utf-8
+	Base64 bool `json:"base64,omitempty"`
+}
+
+type exportMember struct {
+	Member string `json:"member"`
+	// Score a number, or "+inf" and "-inf" which json can not represent
+	Score interface{} `json:"score"`
+}
+
+type exportEntry struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+// textEncoder encode bytes as json strings, as base64 if any of them is not utf-8
+type textEncoder struct {
+	base64 bool
+}
+
+func newTextEncoder(bs ...[]byte) textEncoder {
+	for _, b := range bs {
+		if !utf8.Valid(b) {
+			return textEncoder{base64: true}
+		}
+	}
+	return textEncoder{}
+}
+
+func (e textEncoder) text(b []byte) string {
+	if e.base64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return string(b)
+}
+
+func (e textEncoder) texts(bs [][]byte) []string {
+	var ss = make([]string, 0, len(bs))
+	for _, b := range bs {
+		ss = append(ss, e.text(b))
+	}
+	return ss
+}
+
+// Export write every live key of the node as json lines to file, or to stdout if file is "-".
+// the node must not be running, the keys are read from a snapshot of the store
+func (s *RaftKv) Export(ctx context.Context, file string) error {
+	var w io.Writer = os.Stdout
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	s.initLeveldb(ctx)
+	defer s.fs.Close()
+	defer s.Stop(ctx)
+
+	bw := bufio.NewWriter(w)
+	index, n, err := s.export(ctx, bw)
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	logger.Infof(ctx, "exported %d keys at index %d to %s", n, index, file)
+	return nil
+}
+
+// export write the live keys of a consistent snapshot, the snapshot is taken at the applied index
+func (s *RaftKv) export(ctx context.Context, w io.Writer) (index uint64, n int, err error) {
+	s.applyMu.Lock()
+	snap, err := s.dbs.ReadSnapshot(ctx)
+	index = s.applied
+	s.applyMu.Unlock()
+	if err != nil {
+		return index, 0, err
+	}
+	defer snap.Close(ctx)
+
+	var now = uint64(time.Now().Unix())
+	enc := json.NewEncoder(w)
+	for db := 0; db < snap.Databases(); db++ {
+		ctx := kvstore.WithDB(ctx, db)
+		var werr error
+		err := snap.Range(ctx, nil, []byte{internalKeyPrefix}, false, func(key, data []byte) bool {
+			v := codec.Decode(data)
+			if v.Expired(now) {
+				return true
+			}
+			var r *exportRecord
+			if r, werr = exportKey(ctx, snap, key, v); werr != nil {
+				return false
+			}
+			r.DB = db
+			if ex := v.ExpireAt(); ex > 0 {
+				r.TTL, r.ExpireAt = ex-now, ex
+			}
+			if werr = enc.Encode(r); werr != nil {
+				return false
+			}
+			n++
+			return true
+		})
+		if err == nil {
+			err = werr
+		}
+		if err != nil {
+			return index, n, err
+		}
+	}
+	return index, n, nil
+}
+
+// exportKey read the value of key and its elements
+func exportKey(ctx context.Context, kv kvstore.Kvstore, key []byte, v codec.Value) (*exportRecord, error) {
+	var r = &exportRecord{Type: typeName(v.Type())}
+	var elems = func(prefix []byte, f func(elem, data []byte)) error {
+		return kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, data []byte) bool {
+			f(k[len(prefix):], data)
+			return true
+		})
+	}
+	switch v.Type() {
+	case codec.ListType, codec.SetType:
+		var vals [][]byte
+		err := elems(subKeyPrefix(subKeyTag(v.Type()), key), func(elem, data []byte) {
+			if v.Type() == codec.ListType {
+				vals = append(vals, data)
+			} else {
+				vals = append(vals, elem)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := newTextEncoder(append(vals, key)...)
+		r.Key, r.Value, r.Base64 = enc.text(key), enc.texts(vals), enc.base64
+	case codec.ZSetType:
+		var members []protocol.ZMember
+		var texts = [][]byte{key}
+		err := elems(zsetScorePrefix(key), func(elem, _ []byte) {
+			members = append(members, protocol.ZMember{Member: elem[8:], Score: scoreFromSortable(elem[:8])})
+			texts = append(texts, elem[8:])
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := newTextEncoder(texts...)
+		var vals = make([]exportMember, 0, len(members))
+		for _, m := range members {
+			var score interface{} = m.Score
+			if math.IsInf(m.Score, 1) {
+				score = "+inf"
+			} else if math.IsInf(m.Score, -1) {
+				score = "-inf"
+			}
+			vals = append(vals, exportMember{Member: enc.text(m.Member), Score: score})
+		}
+		r.Key, r.Value, r.Base64 = enc.text(key), vals, enc.base64
+	case codec.HashType:
+		var texts = [][]byte{key}
+		err := elems(subKeyPrefix(hashKeyTag, key), func(elem, data []byte) {
+			texts = append(texts, elem, data)
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := newTextEncoder(texts...)
+		var vals = make(map[string]string, len(texts)/2)
+		for i := 1; i+1 < len(texts); i += 2 {
+			vals[enc.text(texts[i])] = enc.text(texts[i+1])
+		}
+		r.Key, r.Value, r.Base64 = enc.text(key), vals, enc.base64
+	case codec.StreamType:
+		var entries []protocol.StreamEntry
+		var texts = [][]byte{key}
+		err := elems(subKey(streamKeyTag, key, []byte{streamEntryTag}), func(elem, data []byte) {
+			fields := decodeStreamFields(data)
+			entries = append(entries, protocol.StreamEntry{ID: protocol.StreamIDFromBytes(elem), Fields: fields})
+			texts = append(texts, fields...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := newTextEncoder(texts...)
+		var vals = make([]exportEntry, 0, len(entries))
+		for _, e := range entries {
+			vals = append(vals, exportEntry{ID: e.ID.String(), Fields: enc.texts(e.Fields)})
+		}
+		r.Key, r.Value, r.Base64 = enc.text(key), vals, enc.base64
+	default:
+		val := v.StringVal()
+		enc := newTextEncoder(key, val)
+		r.Key, r.Value, r.Base64 = enc.text(key), enc.text(val), enc.base64
+	}
+	return r, nil
+}
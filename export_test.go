@@ -0,0 +1,121 @@
+package gokv_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yixinin/gokv"
+)
+
+func readLines(t *testing.T, file string) []map[string]interface{} {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []map[string]interface{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatalf("invalid line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestExportAndChangeFeed(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "gokv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &gokv.Config{}
+	cfg.ServerCfg.DataPath = dir
+	cfg.ServerCfg.LogPath = dir
+	cfg.ServerCfg.Databases = 16
+	cfg.FeedCfg.Path = path.Join(dir, "changes")
+	cfg.ClusterCfg.Nodes = []*gokv.ClusterNode{{NodeID: 1, Host: "127.0.0.1", HTTPPort: 17341, HeartbeatPort: 17441, ReplicatePort: 17541}}
+	cfg.Validate(1)
+	kv := gokv.NewRaftKv(1, cfg)
+	kv.Run(ctx)
+	go gokv.NewServer(kv).Run(ctx, 17341)
+	cli := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17341"})
+	defer cli.Close()
+	for i := 0; i < 100 && cli.Set(ctx, "str", "v", time.Hour).Err() != nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cli.Set(ctx, "bin", "\xff\x00", 0)
+	cli.RPush(ctx, "list", "a", "b")
+	cli.SAdd(ctx, "set", "x")
+	cli.ZAdd(ctx, "zset", &redis.Z{Score: 1.5, Member: "m"})
+	cli.HSet(ctx, "hash", "f", "v")
+	cli.XAdd(ctx, &redis.XAddArgs{Stream: "stream", ID: "1-1", Values: []string{"f", "v"}})
+	cli.Del(ctx, "set")
+	db1 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17341", DB: 1})
+	defer db1.Close()
+	db1.Set(ctx, "k1", "1", 0)
+	kv.Stop(ctx)
+
+	// the change feed has the applied submits in order of the raft index
+	changes := readLines(t, path.Join(cfg.FeedCfg.Path, "changes.jsonl"))
+	var last float64
+	var set, del bool
+	for _, c := range changes {
+		if c["index"].(float64) < last {
+			t.Errorf("change %v is out of order", c)
+		}
+		last = c["index"].(float64)
+		if c["op"] == "set" && c["key"] == "str" {
+			set = c["value"] == "v" && c["type"] == "string" && c["expire_at"].(float64) > 0
+		}
+		if c["op"] == "del" && c["key"] == "set" {
+			del = true
+		}
+	}
+	if !set || !del {
+		t.Errorf("changes %v", changes)
+	}
+
+	file := path.Join(dir, "export.jsonl")
+	if err := gokv.NewRaftKv(1, cfg).Export(ctx, file); err != nil {
+		t.Fatal(err)
+	}
+	var keys = make(map[string]map[string]interface{})
+	for _, r := range readLines(t, file) {
+		keys[r["key"].(string)] = r
+	}
+	if len(keys) != 7 {
+		t.Fatalf("exported %v", keys)
+	}
+	if r := keys["str"]; r["type"] != "string" || r["value"] != "v" || r["ttl"].(float64) <= 0 {
+		t.Errorf("str %v", r)
+	}
+	// the key of a binary value is base64 encoded too
+	if r := keys["Ymlu"]; r["base64"] != true || r["value"] != "/wA=" {
+		t.Errorf("bin %v", r)
+	}
+	if r := keys["list"]; r["type"] != "list" || len(r["value"].([]interface{})) != 2 {
+		t.Errorf("list %v", r)
+	}
+	if r := keys["zset"]; r["type"] != "zset" || r["value"].([]interface{})[0].(map[string]interface{})["score"] != 1.5 {
+		t.Errorf("zset %v", r)
+	}
+	if r := keys["hash"]; r["type"] != "hash" || r["value"].(map[string]interface{})["f"] != "v" {
+		t.Errorf("hash %v", r)
+	}
+	if r := keys["stream"]; r["type"] != "stream" || r["value"].([]interface{})[0].(map[string]interface{})["id"] != "1-1" {
+		t.Errorf("stream %v", r)
+	}
+	if r := keys["k1"]; r["db"] != 1.0 || r["value"] != "1" {
+		t.Errorf("db 1 k1 %v", r)
+	}
+}
@@ -0,0 +1,233 @@
+// Package geo implements the 52 bits geohash scores of redis GEO commands
+// and the cells to scan for a search around a point.
+package geo
+
+import (
+	"math"
+)
+
+const (
+	LonMin = -180.0
+	LonMax = 180.0
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	// Step the bits of each coordinate in a score
+	Step = 26
+
+	// EarthRadius the earth radius in meters redis uses
+	EarthRadius = 6372797.560856
+	mercatorMax = 20037726.37
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Area the coordinates range of a geohash cell
+type Area struct {
+	LonMin, LonMax float64
+	LatMin, LatMax float64
+}
+
+// Valid whether the coordinates can be indexed
+func Valid(lon, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// spread spread the low 32 bits of v to the even bits
+func spread(v uint64) uint64 {
+	v &= 0xffffffff
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+// squash the reverse of spread
+func squash(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v>>4) & 0x00ff00ff00ff00ff
+	v = (v | v>>8) & 0x0000ffff0000ffff
+	v = (v | v>>16) & 0x00000000ffffffff
+	return v
+}
+
+// encode the geohash of step bits per coordinate, latitude bits are the even ones
+func encode(lon, lat float64, step uint, latMin, latMax float64) uint64 {
+	var max = uint64(1)<<step - 1
+	latOffset := uint64((lat - latMin) / (latMax - latMin) * float64(uint64(1)<<step))
+	lonOffset := uint64((lon - LonMin) / (LonMax - LonMin) * float64(uint64(1)<<step))
+	// the max coordinates belong to the last cell
+	if latOffset > max {
+		latOffset = max
+	}
+	if lonOffset > max {
+		lonOffset = max
+	}
+	return spread(latOffset) | spread(lonOffset)<<1
+}
+
+func decodeArea(bits uint64, step uint) Area {
+	latBits, lonBits := float64(squash(bits)), float64(squash(bits>>1))
+	var scale = float64(uint64(1) << step)
+	return Area{
+		LonMin: LonMin + lonBits/scale*(LonMax-LonMin),
+		LonMax: LonMin + (lonBits+1)/scale*(LonMax-LonMin),
+		LatMin: LatMin + latBits/scale*(LatMax-LatMin),
+		LatMax: LatMin + (latBits+1)/scale*(LatMax-LatMin),
+	}
+}
+
+// Encode the score of a point
+func Encode(lon, lat float64) uint64 {
+	return encode(lon, lat, Step, LatMin, LatMax)
+}
+
+// Decode the center of the cell of a score
+func Decode(bits uint64) (lon, lat float64) {
+	area := decodeArea(bits, Step)
+	lon = math.Max(LonMin, math.Min(LonMax, (area.LonMin+area.LonMax)/2))
+	lat = math.Max(LatMin, math.Min(LatMax, (area.LatMin+area.LatMax)/2))
+	return lon, lat
+}
+
+// Hash the standard 11 characters geohash of a score, which uses the full latitude range
+func Hash(bits uint64) []byte {
+	lon, lat := Decode(bits)
+	bits = encode(lon, lat, Step, -90, 90)
+	var hash = make([]byte, 11)
+	for i := range hash {
+		var idx uint64
+		if i < 10 {
+			idx = bits >> (52 - (i+1)*5) & 0x1f
+		}
+		hash[i] = base32[idx]
+	}
+	return hash
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
+
+// Distance the haversine distance in meters
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := radians(lat1), radians(lon1)
+	lat2r, lon2r := radians(lat2), radians(lon2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// InBox the distance from the center lon1,lat1 if lon2,lat2 is in the box of width and height meters
+func InBox(width, height, lon1, lat1, lon2, lat2 float64) (float64, bool) {
+	if EarthRadius*math.Abs(radians(lat2)-radians(lat1)) > height/2 {
+		return 0, false
+	}
+	if Distance(lon2, lat2, lon1, lat2) > width/2 {
+		return 0, false
+	}
+	return Distance(lon1, lat1, lon2, lat2), true
+}
+
+// estimateStep the largest step whose cells are not smaller than radius meters
+func estimateStep(radius, lat float64) uint {
+	if radius == 0 {
+		return Step
+	}
+	var step = 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	// make sure the radius is included in most of the base cases
+	step -= 2
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > Step {
+		step = Step
+	}
+	return uint(step)
+}
+
+// boundingBox the coordinates range of a box of width and height meters around a point
+func boundingBox(lon, lat, width, height float64) Area {
+	latDelta := degrees(height / 2 / EarthRadius)
+	lonDelta := math.Max(
+		degrees(width/2/EarthRadius/math.Cos(radians(lat+latDelta))),
+		degrees(width/2/EarthRadius/math.Cos(radians(lat-latDelta))),
+	)
+	if lat+latDelta >= 90 || lat-latDelta <= -90 || math.IsNaN(lonDelta) || lonDelta < 0 || lonDelta > 180 {
+		// the box contains a pole, all longitudes are in range
+		lonDelta = 180
+	}
+	return Area{
+		LonMin: lon - lonDelta,
+		LonMax: lon + lonDelta,
+		LatMin: math.Max(LatMin, lat-latDelta),
+		LatMax: math.Min(LatMax, lat+latDelta),
+	}
+}
+
+// Ranges the score ranges [min, max) to scan for the points in a box of width and height meters
+// around lon,lat, and within radius meters which is the half diagonal of the box.
+// the cell of the point and its neighbours are used, the step is decreased until they cover the box.
+func Ranges(lon, lat, width, height, radius float64) [][2]uint64 {
+	bounds := boundingBox(lon, lat, width, height)
+	step := estimateStep(radius, lat)
+	var area Area
+	var cw, ch float64
+	for ; ; step-- {
+		area = decodeArea(encode(lon, lat, step, LatMin, LatMax), step)
+		cw, ch = area.LonMax-area.LonMin, area.LatMax-area.LatMin
+		if step == 1 || (area.LatMin-ch <= bounds.LatMin && area.LatMax+ch >= bounds.LatMax &&
+			area.LonMin-cw <= bounds.LonMin && area.LonMax+cw >= bounds.LonMax) {
+			break
+		}
+	}
+	var shift = 2 * (Step - step)
+	var seen = make(map[uint64]bool, 9)
+	var ranges = make([][2]uint64, 0, 9)
+	for dy := -1; dy <= 1; dy++ {
+		// skip the neighbours out of the box
+		if step >= 2 && ((dy < 0 && area.LatMin < bounds.LatMin) || (dy > 0 && area.LatMax > bounds.LatMax)) {
+			continue
+		}
+		clat := (area.LatMin+area.LatMax)/2 + float64(dy)*ch
+		if clat < LatMin || clat > LatMax {
+			continue
+		}
+		for dx := -1; dx <= 1; dx++ {
+			if step >= 2 && ((dx < 0 && area.LonMin < bounds.LonMin) || (dx > 0 && area.LonMax > bounds.LonMax)) {
+				continue
+			}
+			clon := (area.LonMin+area.LonMax)/2 + float64(dx)*cw
+			if clon < LonMin {
+				clon += 360
+			} else if clon > LonMax {
+				clon -= 360
+			}
+			bits := encode(clon, clat, step, LatMin, LatMax)
+			if seen[bits] {
+				continue
+			}
+			seen[bits] = true
+			ranges = append(ranges, [2]uint64{bits << shift, (bits + 1) << shift})
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,70 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// the values of the redis documentation examples
+func TestEncode(t *testing.T) {
+	var cases = []struct {
+		lon, lat float64
+		score    uint64
+		hash     string
+	}{
+		{13.361389, 38.115556, 3479099956230698, "sqc8b49rny0"},
+		{15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0"},
+	}
+	for _, c := range cases {
+		score := Encode(c.lon, c.lat)
+		if score != c.score {
+			t.Errorf("encode %v,%v: %d, except %d", c.lon, c.lat, score, c.score)
+		}
+		if h := string(Hash(score)); h != c.hash {
+			t.Errorf("hash %v,%v: %s, except %s", c.lon, c.lat, h, c.hash)
+		}
+		lon, lat := Decode(score)
+		if math.Abs(lon-c.lon) > 1e-5 || math.Abs(lat-c.lat) > 1e-5 {
+			t.Errorf("decode %v,%v: %v,%v", c.lon, c.lat, lon, lat)
+		}
+	}
+	lon1, lat1 := Decode(3479099956230698)
+	lon2, lat2 := Decode(3479447370796909)
+	if d := fmt.Sprintf("%.4f", Distance(lon1, lat1, lon2, lat2)); d != "166274.1516" {
+		t.Errorf("distance %s", d)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	// points around the center are in the ranges of every search that covers them
+	var centers = [][2]float64{{13.36, 38.11}, {179.99, 0}, {-179.99, -60}, {0, 84}, {100, -84.9}}
+	for _, c := range centers {
+		for _, radius := range []float64{10, 1000, 100000, 1000000, 5000000} {
+			ranges := Ranges(c[0], c[1], 2*radius, 2*radius, radius)
+			for i := 0; i < 360; i += 15 {
+				for _, f := range []float64{0, 0.5, 0.99} {
+					brng := radians(float64(i))
+					d := radius * f / EarthRadius
+					lat1 := radians(c[1])
+					lat := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(brng))
+					lon := radians(c[0]) + math.Atan2(math.Sin(brng)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat))
+					plon, plat := math.Remainder(degrees(lon), 360), degrees(lat)
+					if !Valid(plon, plat) {
+						continue
+					}
+					score := Encode(plon, plat)
+					var found bool
+					for _, r := range ranges {
+						if score >= r[0] && score < r[1] {
+							found = true
+						}
+					}
+					if !found {
+						t.Errorf("center %v radius %v: point %v,%v is not covered", c, radius, plon, plat)
+					}
+				}
+			}
+		}
+	}
+}
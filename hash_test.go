@@ -0,0 +1,88 @@
+package gokv_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHash(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18181)
+	if n, err := cli.HSet(ctx, "h", "f1", "v1", "f2", "v2", "f1", "v3").Result(); err != nil || n != 2 {
+		t.Fatalf("hset %d %v", n, err)
+	}
+	if n := cli.HSet(ctx, "h", "f2", "v4", "f3", "").Val(); n != 1 {
+		t.Errorf("hset of an existing field %d", n)
+	}
+	if v := cli.HGet(ctx, "h", "f1").Val(); v != "v3" {
+		t.Errorf("hget %q", v)
+	}
+	if v := cli.HMGet(ctx, "h", "f2", "nof", "f3").Val(); !reflect.DeepEqual(v, []interface{}{"v4", nil, ""}) {
+		t.Errorf("hmget %v", v)
+	}
+	if v := cli.HGetAll(ctx, "h").Val(); !reflect.DeepEqual(v, map[string]string{"f1": "v3", "f2": "v4", "f3": ""}) {
+		t.Errorf("hgetall %v", v)
+	}
+	if v := cli.HKeys(ctx, "h").Val(); !reflect.DeepEqual(v, []string{"f1", "f2", "f3"}) {
+		t.Errorf("hkeys %v", v)
+	}
+	if v := cli.HVals(ctx, "h").Val(); !reflect.DeepEqual(v, []string{"v3", "v4", ""}) {
+		t.Errorf("hvals %v", v)
+	}
+	if n := cli.HLen(ctx, "h").Val(); n != 3 {
+		t.Errorf("hlen %d", n)
+	}
+	if !cli.HExists(ctx, "h", "f3").Val() || cli.HExists(ctx, "h", "nof").Val() {
+		t.Error("hexists")
+	}
+	if ok := cli.HSetNX(ctx, "h", "f1", "x").Val(); ok || cli.HGet(ctx, "h", "f1").Val() != "v3" {
+		t.Errorf("hsetnx of an existing field %v", ok)
+	}
+	if ok := cli.HSetNX(ctx, "h", "f4", "v").Val(); !ok || cli.HLen(ctx, "h").Val() != 4 {
+		t.Errorf("hsetnx %v", ok)
+	}
+	if v, err := cli.HMSet(ctx, "h2", "a", "1").Result(); err != nil || !v {
+		t.Errorf("hmset %v %v", v, err)
+	}
+	if v := cli.Type(ctx, "h").Val(); v != "hash" {
+		t.Errorf("type %q", v)
+	}
+
+	// the hash is deleted with its last field
+	if n := cli.HDel(ctx, "h", "f1", "f2", "nof").Val(); n != 2 {
+		t.Errorf("hdel %d", n)
+	}
+	cli.HDel(ctx, "h", "f3", "f4")
+	if n := cli.Exists(ctx, "h").Val(); n != 0 {
+		t.Errorf("exists after the last field is deleted %d", n)
+	}
+	if v := cli.HGetAll(ctx, "h").Val(); len(v) != 0 {
+		t.Errorf("hgetall of a missing key %v", v)
+	}
+
+	// a hash replaced by another type or expired has no fields left
+	cli.Set(ctx, "h2", "s", 0)
+	if err := cli.HGet(ctx, "h2", "a").Err(); err == nil || err.Error() != "WRONGTYPE Operation against a key holding the wrong kind of value" {
+		t.Errorf("hget of a string %v", err)
+	}
+	cli.Del(ctx, "h2")
+	cli.HSet(ctx, "h2", "b", "2")
+	if v := cli.HGetAll(ctx, "h2").Val(); !reflect.DeepEqual(v, map[string]string{"b": "2"}) {
+		t.Errorf("hgetall of a hash set again %v", v)
+	}
+	cli.Expire(ctx, "h2", time.Second)
+	time.Sleep(2100 * time.Millisecond)
+	cli.HSet(ctx, "h2", "c", "3")
+	if v := cli.HGetAll(ctx, "h2").Val(); !reflect.DeepEqual(v, map[string]string{"c": "3"}) {
+		t.Errorf("hgetall of an expired hash set again %v", v)
+	}
+
+	// the fields move with the key
+	cli.Rename(ctx, "h2", "h3")
+	cli.Copy(ctx, "h3", "h4", 0, false)
+	if v := cli.HGet(ctx, "h4", "c").Val(); v != "3" || cli.HLen(ctx, "h3").Val() != 1 {
+		t.Errorf("hget of the copy %q", v)
+	}
+}
@@ -0,0 +1,334 @@
+// Package hll implements the HyperLogLog of redis, values are serialized in the same format as redis
+// so they can be moved between gokv and redis as plain strings.
+//
+// the layout is a 16 bytes header followed by the registers:
+//
+//	"HYLL" | encoding 1 byte | 3 unused bytes | cached cardinality 8 bytes little endian
+//
+// dense registers are 6 bits each, sparse registers are run length encoded with the opcodes
+//
+//	ZERO  00xxxxxx           1-64 zero registers
+//	XZERO 01xxxxxx yyyyyyyy  1-16384 zero registers
+//	VAL   1vvvvvxx           1-4 registers of value 1-32
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	P         = 14
+	Registers = 1 << P
+	Q         = 64 - P
+	Bits      = 6
+	regMax    = 1<<Bits - 1
+	pMask     = Registers - 1
+
+	HeaderSize = 16
+	DenseSize  = HeaderSize + (Registers*Bits+7)/8
+
+	Dense  = 0
+	Sparse = 1
+
+	// SparseMaxBytes sparse values larger than it are promoted to dense
+	SparseMaxBytes = 3000
+
+	sparseValMax    = 32
+	sparseValRunMax = 4
+	zeroRunMax      = 64
+	xzeroRunMax     = 16384
+
+	alphaInf = 0.721347520444481703680
+	seed     = 0xadc83b19
+)
+
+var magic = []byte("HYLL")
+
+// ErrInvalid the value is not a HyperLogLog
+var ErrInvalid = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+
+// ErrCorrupted the value has a HyperLogLog header but broken registers
+var ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+
+// HLL the decoded registers of a HyperLogLog
+type HLL struct {
+	regs     [Registers]uint8
+	encoding uint8
+	card     uint64
+	cached   bool
+}
+
+// New an empty sparse HyperLogLog
+func New() *HLL {
+	return &HLL{
+		encoding: Sparse,
+		cached:   true,
+	}
+}
+
+// Decode decode a serialized HyperLogLog
+func Decode(b []byte) (*HLL, error) {
+	if len(b) < HeaderSize || string(b[:4]) != string(magic) || b[4] > Sparse {
+		return nil, ErrInvalid
+	}
+	h := &HLL{
+		encoding: b[4],
+	}
+	if b[15]&0x80 == 0 {
+		h.card = binary.LittleEndian.Uint64(b[8:])
+		h.cached = true
+	}
+	if h.encoding == Dense {
+		if len(b) != DenseSize {
+			return nil, ErrInvalid
+		}
+		for i := 0; i < Registers; i++ {
+			h.regs[i] = denseGet(b[HeaderSize:], i)
+		}
+		return h, nil
+	}
+	if !h.decodeSparse(b[HeaderSize:]) {
+		return nil, ErrCorrupted
+	}
+	return h, nil
+}
+
+func (h *HLL) decodeSparse(p []byte) bool {
+	var idx int
+	for i := 0; i < len(p); i++ {
+		var run, val int
+		switch {
+		case p[i]&0xc0 == 0:
+			run = int(p[i]&0x3f) + 1
+		case p[i]&0xc0 == 0x40:
+			if i+1 >= len(p) {
+				return false
+			}
+			run = (int(p[i]&0x3f)<<8 | int(p[i+1])) + 1
+			i++
+		default:
+			val = int(p[i]>>2&0x1f) + 1
+			run = int(p[i]&0x3) + 1
+		}
+		if idx+run > Registers {
+			return false
+		}
+		for j := 0; j < run; j++ {
+			h.regs[idx+j] = uint8(val)
+		}
+		idx += run
+	}
+	return idx == Registers
+}
+
+func denseGet(p []byte, i int) uint8 {
+	pos := i * Bits
+	b, fb := pos/8, uint(pos&7)
+	v := uint(p[b]) >> fb
+	if b+1 < len(p) {
+		v |= uint(p[b+1]) << (8 - fb)
+	}
+	return uint8(v & regMax)
+}
+
+func denseSet(p []byte, i int, val uint8) {
+	pos := i * Bits
+	b, fb := pos/8, uint(pos&7)
+	p[b] &^= regMax << fb
+	p[b] |= val << fb
+	if b+1 < len(p) {
+		p[b+1] &^= regMax >> (8 - fb)
+		p[b+1] |= val >> (8 - fb)
+	}
+}
+
+// Sparse whether the HyperLogLog is sparse encoded
+func (h *HLL) Sparse() bool {
+	return h.encoding == Sparse
+}
+
+// Add add an element, reports whether a register is changed
+func (h *HLL) Add(elem []byte) bool {
+	hash := murmurHash64A(elem, seed)
+	idx := hash & pMask
+	hash >>= P
+	hash |= 1 << Q
+	var count uint8 = 1
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	if count <= h.regs[idx] {
+		return false
+	}
+	h.regs[idx] = count
+	h.cached = false
+	return true
+}
+
+// Merge merge the registers of o, the result is dense if o is dense
+func (h *HLL) Merge(o *HLL) {
+	for i := range h.regs {
+		if o.regs[i] > h.regs[i] {
+			h.regs[i] = o.regs[i]
+			h.cached = false
+		}
+	}
+	if o.encoding == Dense {
+		h.encoding = Dense
+	}
+}
+
+// Count the estimated cardinality, the cached one is used if it is valid
+func (h *HLL) Count() uint64 {
+	if h.cached {
+		return h.card
+	}
+	h.card = h.count()
+	h.cached = true
+	return h.card
+}
+
+// count the improved estimator of Otmar Ertl which redis uses
+func (h *HLL) count() uint64 {
+	var histo [64]int
+	for _, r := range h.regs {
+		histo[r]++
+	}
+	const m = float64(Registers)
+	z := m * tau((m-float64(histo[Q+1]))/m)
+	for j := Q; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histo[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	var y, z = 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	var y, z = 1.0, 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// Encode serialize the HyperLogLog, a sparse one is promoted to dense
+// when a register exceeds the sparse value range or the size exceeds SparseMaxBytes
+func (h *HLL) Encode() []byte {
+	if h.encoding == Sparse {
+		if b, ok := h.encodeSparse(); ok {
+			return b
+		}
+		h.encoding = Dense
+	}
+	b := make([]byte, DenseSize)
+	h.header(b)
+	for i, r := range h.regs {
+		denseSet(b[HeaderSize:], i, r)
+	}
+	return b
+}
+
+func (h *HLL) header(b []byte) {
+	copy(b, magic)
+	b[4] = h.encoding
+	if h.cached {
+		binary.LittleEndian.PutUint64(b[8:], h.card)
+	} else {
+		b[15] |= 0x80
+	}
+}
+
+func (h *HLL) encodeSparse() ([]byte, bool) {
+	b := make([]byte, HeaderSize, HeaderSize+64)
+	h.header(b)
+	for i := 0; i < Registers; {
+		val := h.regs[i]
+		if val > sparseValMax {
+			return nil, false
+		}
+		run := 1
+		for i+run < Registers && h.regs[i+run] == val {
+			run++
+		}
+		i += run
+		for run > 0 {
+			var n int
+			switch {
+			case val != 0:
+				n = min(run, sparseValRunMax)
+				b = append(b, 0x80|(val-1)<<2|uint8(n-1))
+			case run <= zeroRunMax:
+				n = run
+				b = append(b, uint8(n-1))
+			default:
+				n = min(run, xzeroRunMax)
+				b = append(b, 0x40|uint8((n-1)>>8), uint8(n-1))
+			}
+			run -= n
+		}
+		if len(b) > SparseMaxBytes {
+			return nil, false
+		}
+	}
+	return b, true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// murmurHash64A the MurmurHash2 64 bits variant redis hashes elements with
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(key))*m
+	for len(key) >= 8 {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
@@ -0,0 +1,94 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEmpty(t *testing.T) {
+	b := New().Encode()
+	// the empty value redis creates, a single XZERO opcode covering all registers
+	if s := string(b); s != "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff" {
+		t.Fatalf("empty hll %q", s)
+	}
+	h, err := Decode(b)
+	if err != nil || h.Count() != 0 {
+		t.Fatalf("decode empty hll: %v %d", err, h.Count())
+	}
+}
+
+func TestCount(t *testing.T) {
+	for _, n := range []int{1, 10, 100, 1000, 10000, 100000} {
+		h := New()
+		for i := 0; i < n; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+		}
+		b := h.Encode()
+		if n <= 100 && !h.Sparse() {
+			t.Errorf("%d elements should be sparse", n)
+		}
+		if n >= 10000 && h.Sparse() {
+			t.Errorf("%d elements should be dense", n)
+		}
+		d, err := Decode(b)
+		if err != nil {
+			t.Fatalf("decode %d elements: %v", n, err)
+		}
+		if d.regs != h.regs {
+			t.Fatalf("registers of %d elements changed after decode", n)
+		}
+		if d.cached {
+			t.Errorf("cache of %d elements should be invalid", n)
+		}
+		count := d.Count()
+		if e := math.Abs(float64(count)-float64(n)) / float64(n); e > 0.03 {
+			t.Errorf("count %d elements: %d", n, count)
+		}
+		if c, err := Decode(d.Encode()); err != nil || !c.cached || c.Count() != count {
+			t.Errorf("cached count of %d elements: %v", n, err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 500; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i + 250)))
+	}
+	a.Merge(b)
+	if e := math.Abs(float64(a.Count())-750) / 750; e > 0.03 {
+		t.Errorf("merged count: %d", a.Count())
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, s := range []string{"", "HYLL", "abcdefghijklmnopq", "HYLL\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"} {
+		if _, err := Decode([]byte(s)); err != ErrInvalid {
+			t.Errorf("decode %q: %v", s, err)
+		}
+	}
+	// the XZERO run covers one register less
+	if _, err := Decode([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xfe")); err != ErrCorrupted {
+		t.Errorf("decode short sparse: %v", err)
+	}
+}
+
+func TestMurmurHash64A(t *testing.T) {
+	// values of the C implementation in redis with the hll seed
+	var cases = []struct {
+		key  string
+		hash uint64
+	}{
+		{"", 15627466953755236146},
+		{"a", 6039968161137406375},
+		{"hello", 1109414937308947456},
+		{"hello world!!", 8531191611569099882},
+	}
+	for _, c := range cases {
+		if h := murmurHash64A([]byte(c.key), seed); h != c.hash {
+			t.Errorf("hash %q: %d, except %d", c.key, h, c.hash)
+		}
+	}
+}
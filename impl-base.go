@@ -2,6 +2,7 @@ package gokv
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 
 	"github.com/yixinin/gokv/codec"
@@ -21,30 +22,25 @@ func NewBaseImpl(kv kvstore.Kvstore) *_baseImpl {
 }
 
 func (s *_baseImpl) Set(ctx context.Context, cmd *protocol.SetCmd) *Submit {
-	if cmd.DEL {
-		return s.Delete(ctx, cmd.BaseCmd)
-	}
-
-	if cmd.NX || cmd.KEEPEX {
-		switch data, err := s.kv.Get(ctx, cmd.Key); err {
-		case nil:
-			val := codec.Decode(data)
-			if cmd.NX {
-				if !val.Expired(cmd.Now) {
-					cmd.Err = kverror.ErrNIL
-					return nil
-				}
-			}
-
-			if cmd.KEEPEX && !val.Expired(cmd.Now) {
-				cmd.EX = val.ExpireAt()
-			}
-		case kverror.ErrNotFound:
-			// do nothing
-		default:
+	if cmd.NX || cmd.XX || cmd.KEEPEX || cmd.GET {
+		v, ok, err := getLive(ctx, s.kv, cmd.Key, cmd.Now)
+		if err != nil {
 			cmd.Err = err
 			return nil
 		}
+		if cmd.GET && ok && !v.IsString() {
+			cmd.Err = kverror.ErrKeyOPType
+			return nil
+		}
+		if cmd.GET && ok {
+			cmd.Old = append([]byte{}, v.StringVal()...)
+		}
+		if (cmd.NX && ok) || (cmd.XX && !ok) {
+			return nil
+		}
+		if cmd.KEEPEX && ok {
+			cmd.EX = v.ExpireAt()
+		}
 	}
 	return NewSetSubmit(cmd.Key, cmd.Val, cmd.EX)
 }
@@ -60,6 +56,10 @@ func (s *_baseImpl) Get(ctx context.Context, cmd *protocol.GetCmd) *Submit {
 		cmd.Err = kverror.ErrNIL
 		return NewExDelSubmit(cmd.Key)
 	}
+	if !v.IsString() {
+		cmd.Err = kverror.ErrKeyOPType
+		return nil
+	}
 	cmd.Val = v.StringVal()
 	return nil
 }
@@ -89,6 +89,9 @@ func (s *_baseImpl) Keys(ctx context.Context, cmd *protocol.KeysCmd) []*Submit {
 		return nil
 	}
 	s.kv.Scan(ctx, func(key, data []byte) {
+		if isInternalKey(key) {
+			return
+		}
 		if codec.Decode(data).Expired(cmd.Now) {
 			exdels = append(exdels, NewExDelSubmit(key))
 			return
@@ -124,6 +127,9 @@ func (s *_baseImpl) Scan(ctx context.Context, cmd *protocol.ScanCmd) []*Submit {
 	}
 
 	cmd.Cursor = s.kv.Scan(ctx, func(key, data []byte) {
+		if isInternalKey(key) {
+			return
+		}
 		if codec.Decode(data).Expired(cmd.Now) {
 			exdels = append(exdels, NewExDelSubmit(key))
 			return
@@ -132,3 +138,180 @@ func (s *_baseImpl) Scan(ctx context.Context, cmd *protocol.ScanCmd) []*Submit {
 	}, int(cmd.Cursor), limit, cmd.Prefix)
 	return exdels
 }
+
+func (s *_baseImpl) Del(ctx context.Context, cmd *protocol.DelCmd) []*Submit {
+	var submits = make([]*Submit, 0, len(cmd.Keys))
+	for _, key := range cmd.Keys {
+		data, err := s.kv.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, kverror.ErrNotFound) {
+				continue
+			}
+			cmd.Err = err
+			return nil
+		}
+		if !codec.Decode(data).Expired(cmd.Now) {
+			cmd.Count++
+		}
+		submits = append(submits, NewDelSubmit(key))
+	}
+	return submits
+}
+
+func (s *_baseImpl) Exists(ctx context.Context, cmd *protocol.ExistsCmd) []*Submit {
+	var exdels = make([]*Submit, 0, 1)
+	for _, key := range cmd.Keys {
+		data, err := s.kv.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, kverror.ErrNotFound) {
+				continue
+			}
+			cmd.Err = err
+			return nil
+		}
+		if codec.Decode(data).Expired(cmd.Now) {
+			exdels = append(exdels, NewExDelSubmit(key))
+			continue
+		}
+		cmd.Count++
+	}
+	return exdels
+}
+
+func (s *_baseImpl) MGet(ctx context.Context, cmd *protocol.MGetCmd) []*Submit {
+	var exdels = make([]*Submit, 0, 1)
+	for i, key := range cmd.Keys {
+		data, err := s.kv.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, kverror.ErrNotFound) {
+				continue
+			}
+			cmd.Err = err
+			return nil
+		}
+		v := codec.Decode(data)
+		if v.Expired(cmd.Now) {
+			exdels = append(exdels, NewExDelSubmit(key))
+			continue
+		}
+		if !v.IsString() {
+			continue
+		}
+		cmd.Vals[i] = append([]byte{}, v.StringVal()...)
+	}
+	return exdels
+}
+
+// MSet set all keys in one submit batch, msetnx sets nothing if any key exists when it is applied
+func (s *_baseImpl) MSet(ctx context.Context, cmd *protocol.MSetCmd) []*Submit {
+	if cmd.NX {
+		var data = make([][]byte, 0, len(cmd.Vals))
+		for _, val := range cmd.Vals {
+			data = append(data, codec.EncodeString(val).Raw())
+		}
+		return []*Submit{NewMSetNXSubmit(cmd.Keys, data, cmd.Now)}
+	}
+	var submits = make([]*Submit, 0, len(cmd.Keys))
+	for i, key := range cmd.Keys {
+		submits = append(submits, NewSetSubmit(key, cmd.Vals[i]))
+	}
+	return submits
+}
+
+// NewMSetNXSubmit set the keys to the encoded values if none of them exists at now when applied,
+// the value is encoded by encodeMSetNX
+func NewMSetNXSubmit(keys, data [][]byte, now uint64) *Submit {
+	return &Submit{
+		OP:    CommitOPMSetNX,
+		Key:   keys[0],
+		Value: encodeMSetNX(keys, data, now),
+	}
+}
+
+// encodeMSetNX now | (len(key) | key | len(data) | data)...
+func encodeMSetNX(keys, data [][]byte, now uint64) []byte {
+	var buf = codec.Uint642Bytes(now)
+	var size = make([]byte, 4)
+	for i, key := range keys {
+		binary.BigEndian.PutUint32(size, uint32(len(key)))
+		buf = append(append(buf, size...), key...)
+		binary.BigEndian.PutUint32(size, uint32(len(data[i])))
+		buf = append(append(buf, size...), data[i]...)
+	}
+	return buf
+}
+
+func decodeMSetNX(b []byte) (keys, data [][]byte, now uint64, ok bool) {
+	if len(b) < 8 {
+		return nil, nil, 0, false
+	}
+	now = binary.BigEndian.Uint64(b)
+	b = b[8:]
+	var next = func() ([]byte, bool) {
+		if len(b) < 4 || uint64(len(b)-4) < uint64(binary.BigEndian.Uint32(b)) {
+			return nil, false
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		v := b[4 : 4+size]
+		b = b[4+size:]
+		return v, true
+	}
+	for len(b) > 0 {
+		key, ok := next()
+		if !ok {
+			return nil, nil, 0, false
+		}
+		val, ok := next()
+		if !ok {
+			return nil, nil, 0, false
+		}
+		keys, data = append(keys, key), append(data, val)
+	}
+	return keys, data, now, len(keys) > 0
+}
+
+// msetNX resolve a MSETNX submit to the sets it makes when applied, ok is false if any key exists
+func (s *_baseImpl) msetNX(ctx context.Context, st *Submit) (submits []*Submit, ok bool, err error) {
+	keys, data, now, ok := decodeMSetNX(st.Value)
+	if !ok {
+		return nil, false, nil
+	}
+	for _, key := range keys {
+		_, live, err := getLive(ctx, s.kv, key, now)
+		if err != nil || live {
+			return nil, false, err
+		}
+	}
+	submits = make([]*Submit, 0, len(keys))
+	for i, key := range keys {
+		submit := NewSetRawSubmit(key, data[i])
+		submit.DB = st.DB
+		submits = append(submits, submit)
+	}
+	return submits, true, nil
+}
+
+// getLive get the unexpired value of key, ok reports whether the key exists
+func getLive(ctx context.Context, kv kvstore.Kvstore, key []byte, now uint64) (v codec.Value, ok bool, err error) {
+	data, err := kv.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return v, false, nil
+		}
+		return v, false, err
+	}
+	v = codec.Decode(data)
+	if v.Expired(now) {
+		return v, false, nil
+	}
+	return v, true, nil
+}
+
+// getString get the unexpired string value of key, composite values are wrong type
+func getString(ctx context.Context, kv kvstore.Kvstore, key []byte, now uint64) (v codec.Value, ok bool, err error) {
+	v, ok, err = getLive(ctx, kv, key, now)
+	if ok && !v.IsString() {
+		return v, false, kverror.ErrKeyOPType
+	}
+	return v, ok, err
+}
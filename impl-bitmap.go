@@ -0,0 +1,311 @@
+package gokv
+
+import (
+	"context"
+	"math/big"
+	"math/bits"
+
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// _bitmapImpl bit operations on the raw bytes of string values
+type _bitmapImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewBitmapImpl(kv kvstore.Kvstore) *_bitmapImpl {
+	return &_bitmapImpl{
+		kv: kv,
+	}
+}
+
+func getBit(buf []byte, off uint64) byte {
+	if off>>3 >= uint64(len(buf)) {
+		return 0
+	}
+	return (buf[off>>3] >> (7 - off&7)) & 1
+}
+
+func setBit(buf []byte, off uint64, bit byte) {
+	if bit == 1 {
+		buf[off>>3] |= 1 << (7 - off&7)
+	} else {
+		buf[off>>3] &^= 1 << (7 - off&7)
+	}
+}
+
+// growBuf copy buf to a new slice which can hold at least size bytes
+func growBuf(buf []byte, size uint64) []byte {
+	if uint64(len(buf)) > size {
+		size = uint64(len(buf))
+	}
+	nbuf := make([]byte, size)
+	copy(nbuf, buf)
+	return nbuf
+}
+
+func (b *_bitmapImpl) SetBit(ctx context.Context, cmd *protocol.SetBitCmd) *Submit {
+	v, ok, err := getString(ctx, b.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var buf []byte
+	if ok {
+		buf = v.StringVal()
+	}
+	cmd.Bit = int64(getBit(buf, cmd.Offset))
+	if ok && byte(cmd.Bit) == cmd.Val {
+		return nil
+	}
+	buf = growBuf(buf, cmd.Offset>>3+1)
+	setBit(buf, cmd.Offset, cmd.Val)
+	if !ok {
+		return NewSetSubmit(cmd.Key, buf)
+	}
+	return NewSetSubmit(cmd.Key, buf, v.ExpireAt())
+}
+
+func (b *_bitmapImpl) GetBit(ctx context.Context, cmd *protocol.SetBitCmd) *Submit {
+	v, ok, err := getString(ctx, b.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if ok {
+		cmd.Bit = int64(getBit(v.StringVal(), cmd.Offset))
+	}
+	return nil
+}
+
+// bitRange convert the start/end of bitcount/bitpos to a bit range [start, end]
+func bitRange(cmd *protocol.BitCountCmd, size int64) (int64, int64, bool) {
+	if !cmd.HasStart {
+		return 0, size*8 - 1, size > 0
+	}
+	var end int64 = -1
+	if cmd.HasEnd {
+		end = cmd.End
+	}
+	if cmd.BitMode {
+		return strRange(size*8, cmd.Start, end)
+	}
+	start, end, ok := strRange(size, cmd.Start, end)
+	return start * 8, end*8 + 7, ok
+}
+
+func (b *_bitmapImpl) BitCount(ctx context.Context, cmd *protocol.BitCountCmd) *Submit {
+	v, ok, err := getString(ctx, b.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	buf := v.StringVal()
+	start, end, ok := bitRange(cmd, int64(len(buf)))
+	if !ok {
+		return nil
+	}
+	// count the unaligned head and tail bit by bit, full bytes by popcount
+	for ; start <= end && start&7 != 0; start++ {
+		cmd.Val += int64(getBit(buf, uint64(start)))
+	}
+	for ; start <= end && end&7 != 7; end-- {
+		cmd.Val += int64(getBit(buf, uint64(end)))
+	}
+	for i := start >> 3; i <= end>>3 && start <= end; i++ {
+		cmd.Val += int64(bits.OnesCount8(buf[i]))
+	}
+	return nil
+}
+
+func (b *_bitmapImpl) BitPos(ctx context.Context, cmd *protocol.BitCountCmd) *Submit {
+	v, ok, err := getString(ctx, b.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Val = -1
+	if !ok {
+		if cmd.Bit == 0 {
+			cmd.Val = 0
+		}
+		return nil
+	}
+	buf := v.StringVal()
+	start, end, ok := bitRange(cmd, int64(len(buf)))
+	if !ok {
+		return nil
+	}
+	// skip the bytes which could not contain the bit
+	var skip byte = 0xff
+	if cmd.Bit == 1 {
+		skip = 0
+	}
+	for i := start; i <= end; i++ {
+		if i&7 == 0 && i+7 <= end && buf[i>>3] == skip {
+			i += 7
+			continue
+		}
+		if getBit(buf, uint64(i)) == cmd.Bit {
+			cmd.Val = i
+			return nil
+		}
+	}
+	// looking for clear bits without an end, the string is padded with zeros on the right
+	if cmd.Bit == 0 && !cmd.HasEnd && !cmd.BitMode {
+		cmd.Val = end + 1
+	}
+	return nil
+}
+
+func (b *_bitmapImpl) BitOp(ctx context.Context, cmd *protocol.BitOpCmd) *Submit {
+	var srcs = make([][]byte, 0, len(cmd.Keys))
+	var maxLen int
+	for _, key := range cmd.Keys {
+		v, ok, err := getString(ctx, b.kv, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		var buf []byte
+		if ok {
+			buf = v.StringVal()
+		}
+		if len(buf) > maxLen {
+			maxLen = len(buf)
+		}
+		srcs = append(srcs, buf)
+	}
+	cmd.Len = int64(maxLen)
+	if maxLen == 0 {
+		return NewDelSubmit(cmd.Dest)
+	}
+
+	var res = make([]byte, maxLen)
+	copy(res, srcs[0])
+	if cmd.Op == protocol.BitOpNot {
+		for i := range res {
+			res[i] = ^res[i]
+		}
+		return NewSetSubmit(cmd.Dest, res)
+	}
+	for _, src := range srcs[1:] {
+		for i := range res {
+			var c byte
+			if i < len(src) {
+				c = src[i]
+			}
+			switch cmd.Op {
+			case protocol.BitOpAnd:
+				res[i] &= c
+			case protocol.BitOpOr:
+				res[i] |= c
+			case protocol.BitOpXor:
+				res[i] ^= c
+			}
+		}
+	}
+	return NewSetSubmit(cmd.Dest, res)
+}
+
+func (b *_bitmapImpl) BitField(ctx context.Context, cmd *protocol.BitFieldCmd) *Submit {
+	v, ok, err := getString(ctx, b.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var buf []byte
+	if ok {
+		buf = v.StringVal()
+	}
+	var changed bool
+	cmd.Vals = make([]*int64, 0, len(cmd.Ops))
+	for _, op := range cmd.Ops {
+		old := getBitField(buf, op)
+		if op.Op == "get" {
+			cmd.Vals = append(cmd.Vals, &old)
+			continue
+		}
+		nv := big.NewInt(op.Val)
+		if op.Op == "incrby" {
+			nv.Add(nv, big.NewInt(old))
+		}
+		val, fit := fitBitField(op, nv)
+		if !fit {
+			cmd.Vals = append(cmd.Vals, nil)
+			continue
+		}
+		// copy on first write, the origin buf is backed by the stored value
+		if need := (op.Offset+op.Bits-1)>>3 + 1; !changed || need > uint64(len(buf)) {
+			buf = growBuf(buf, need)
+			changed = true
+		}
+		setBitField(buf, op, val)
+		if op.Op == "set" {
+			cmd.Vals = append(cmd.Vals, &old)
+		} else {
+			cmd.Vals = append(cmd.Vals, &val)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if !ok {
+		return NewSetSubmit(cmd.Key, buf)
+	}
+	return NewSetSubmit(cmd.Key, buf, v.ExpireAt())
+}
+
+func getBitField(buf []byte, op protocol.BitFieldOp) int64 {
+	var raw uint64
+	for i := uint64(0); i < op.Bits; i++ {
+		raw = raw<<1 | uint64(getBit(buf, op.Offset+i))
+	}
+	if op.Signed && op.Bits < 64 && raw&(1<<(op.Bits-1)) != 0 {
+		return int64(raw) - 1<<op.Bits
+	}
+	return int64(raw)
+}
+
+func setBitField(buf []byte, op protocol.BitFieldOp, val int64) {
+	raw := uint64(val)
+	for i := uint64(0); i < op.Bits; i++ {
+		setBit(buf, op.Offset+i, byte(raw>>(op.Bits-1-i))&1)
+	}
+}
+
+// fitBitField apply the overflow policy to make v fit in the bitfield type
+func fitBitField(op protocol.BitFieldOp, v *big.Int) (int64, bool) {
+	var min, max = new(big.Int), new(big.Int)
+	if op.Signed {
+		max.Lsh(big.NewInt(1), uint(op.Bits-1))
+		min.Neg(max)
+		max.Sub(max, big.NewInt(1))
+	} else {
+		max.Lsh(big.NewInt(1), uint(op.Bits))
+		max.Sub(max, big.NewInt(1))
+	}
+	if v.Cmp(min) >= 0 && v.Cmp(max) <= 0 {
+		return v.Int64(), true
+	}
+	switch op.Overflow {
+	case protocol.OverflowSat:
+		if v.Cmp(min) < 0 {
+			return min.Int64(), true
+		}
+		return max.Int64(), true
+	case protocol.OverflowFail:
+		return 0, false
+	}
+	// wrap
+	m := new(big.Int).Lsh(big.NewInt(1), uint(op.Bits))
+	r := new(big.Int).Mod(v, m)
+	if r.Cmp(max) > 0 {
+		r.Sub(r, m)
+	}
+	return r.Int64(), true
+}
@@ -0,0 +1,137 @@
+package gokv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+const (
+	// compareAbsent the key matches if it is absent or expired
+	compareAbsent byte = 1 << iota
+	// compareValue the key matches if it is a string of the expected value
+	compareValue
+)
+
+// compare the condition of a CAS/CAD submit. it is checked at now of the leader instead
+// of the clock of the applying node, so all nodes agree on the result
+type compare struct {
+	flags    byte
+	now      uint64
+	expected []byte
+	// data the encoded value set by CAS
+	data []byte
+}
+
+// encodeCompare flags | now | len(expected) | expected | data
+func encodeCompare(c compare) []byte {
+	var buf = make([]byte, 13, 13+len(c.expected)+len(c.data))
+	buf[0] = c.flags
+	binary.BigEndian.PutUint64(buf[1:], c.now)
+	binary.BigEndian.PutUint32(buf[9:], uint32(len(c.expected)))
+	buf = append(buf, c.expected...)
+	return append(buf, c.data...)
+}
+
+func decodeCompare(b []byte) (c compare, ok bool) {
+	if len(b) < 13 {
+		return c, false
+	}
+	c.flags = b[0]
+	c.now = binary.BigEndian.Uint64(b[1:])
+	size := int(binary.BigEndian.Uint32(b[9:]))
+	if len(b)-13 < size {
+		return c, false
+	}
+	c.expected, c.data = b[13:13+size], b[13+size:]
+	return c, true
+}
+
+// NewCASSubmit set key to the encoded value of c if it matches c
+func NewCASSubmit(key []byte, c compare) *Submit {
+	return &Submit{
+		OP:    CommitOPCAS,
+		Key:   key,
+		Value: encodeCompare(c),
+	}
+}
+
+// NewCADSubmit delete key if it matches c
+func NewCADSubmit(key []byte, c compare) *Submit {
+	return &Submit{
+		OP:    CommitOPCAD,
+		Key:   key,
+		Value: encodeCompare(c),
+	}
+}
+
+// _casImpl the conditional writes are compared when they are applied rather than when they are
+// submitted, so a write is never based on a stale read of a former leader
+type _casImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewCASImpl(kv kvstore.Kvstore) *_casImpl {
+	return &_casImpl{
+		kv: kv,
+	}
+}
+
+func (s *_casImpl) CAS(ctx context.Context, cmd *protocol.CASCmd) *Submit {
+	return NewCASSubmit(cmd.Key, compare{
+		flags:    compareValue,
+		now:      cmd.Now,
+		expected: cmd.Expected,
+		data:     codec.EncodeString(cmd.Val, cmd.EX).Raw(),
+	})
+}
+
+func (s *_casImpl) CAD(ctx context.Context, cmd *protocol.CADCmd) *Submit {
+	return NewCADSubmit(cmd.Key, compare{
+		flags:    compareValue,
+		now:      cmd.Now,
+		expected: cmd.Expected,
+	})
+}
+
+// Lock acquire the lock if it is free or renew it if it is held by the owner
+func (s *_casImpl) Lock(ctx context.Context, cmd *protocol.LockCmd) *Submit {
+	return NewCASSubmit(cmd.Key, compare{
+		flags:    compareAbsent | compareValue,
+		now:      cmd.Now,
+		expected: cmd.Owner,
+		data:     codec.EncodeString(cmd.Owner, cmd.EX).Raw(),
+	})
+}
+
+// compare resolve a CAS/CAD submit to the set or delete it makes when applied,
+// ok is false if the key does not match
+func (s *_casImpl) compare(ctx context.Context, st *Submit) (resolved *Submit, ok bool, err error) {
+	c, ok := decodeCompare(st.Value)
+	if !ok {
+		return nil, false, nil
+	}
+	v, live, err := getLive(ctx, s.kv, st.Key, c.now)
+	if err != nil {
+		return nil, false, err
+	}
+	if live {
+		ok = c.flags&compareValue != 0 && v.IsString() && bytes.Equal(v.StringVal(), c.expected)
+	} else {
+		ok = c.flags&compareAbsent != 0
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	if st.OP == CommitOPCAS {
+		resolved = NewSetRawSubmit(st.Key, c.data)
+	} else {
+		resolved = NewDelSubmit(st.Key)
+	}
+	resolved.DB = st.DB
+	return resolved, true, nil
+}
@@ -0,0 +1,271 @@
+package gokv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/rdb"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+type _dumpImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewDumpImpl(kv kvstore.Kvstore) *_dumpImpl {
+	return &_dumpImpl{
+		kv: kv,
+	}
+}
+
+// dump serialize the value of key and its expire time in the DUMP format of redis. streams, which
+// redis can not restore from gokv, are serialized with their element keys in the format of gokv
+func (s *_dumpImpl) dump(ctx context.Context, key []byte, v codec.Value) ([]byte, error) {
+	if v.Type() != codec.StreamType {
+		e, err := s.rdbEntry(ctx, key, v)
+		if err != nil {
+			return nil, err
+		}
+		e.ExpireAt = int64(v.ExpireAt()) * 1000
+		return rdb.EncodeDump(e), nil
+	}
+	var elems []codec.DumpElem
+	prefix := subKeyPrefix(subKeyTag(v.Type()), key)
+	err := s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, data []byte) bool {
+		elems = append(elems, codec.DumpElem{Elem: k[len(prefix):], Val: data})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codec.EncodeDump(v.Raw(), elems), nil
+}
+
+// rdbEntry read the value of key and its elements as a key of a rdb file
+func (s *_dumpImpl) rdbEntry(ctx context.Context, key []byte, v codec.Value) (*rdb.Entry, error) {
+	var e = &rdb.Entry{Key: key}
+	var elems = func(prefix []byte, f func(elem, data []byte)) error {
+		return s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, data []byte) bool {
+			f(k[len(prefix):], data)
+			return true
+		})
+	}
+	var err error
+	switch v.Type() {
+	case codec.ListType:
+		e.Type = rdb.List
+		err = elems(subKeyPrefix(subKeyTag(v.Type()), key), func(_, data []byte) {
+			e.Elems = append(e.Elems, data)
+		})
+	case codec.SetType:
+		e.Type = rdb.Set
+		err = elems(subKeyPrefix(subKeyTag(v.Type()), key), func(elem, _ []byte) {
+			e.Elems = append(e.Elems, elem)
+		})
+	case codec.HashType:
+		e.Type = rdb.Hash
+		err = elems(subKeyPrefix(subKeyTag(v.Type()), key), func(elem, data []byte) {
+			e.Elems = append(e.Elems, elem, data)
+		})
+	case codec.ZSetType:
+		e.Type = rdb.ZSet
+		err = elems(zsetScorePrefix(key), func(elem, _ []byte) {
+			e.Members = append(e.Members, rdb.Member{Member: elem[8:], Score: scoreFromSortable(elem[:8])})
+		})
+	default:
+		e.Type = rdb.String
+		e.Value = v.StringVal()
+	}
+	return e, err
+}
+
+func (s *_dumpImpl) Dump(ctx context.Context, cmd *protocol.DumpCmd) *Submit {
+	v, ok, err := getLive(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		if v.Expired(cmd.Now) {
+			return NewExDelSubmit(cmd.Key)
+		}
+		return nil
+	}
+	cmd.Payload, cmd.Err = s.dump(ctx, cmd.Key, v)
+	return nil
+}
+
+// Restore write the dumped value and its element keys in one batch, the payload is either
+// in the DUMP format of redis or in the format of gokv
+func (s *_dumpImpl) Restore(ctx context.Context, cmd *protocol.RestoreCmd) []*Submit {
+	meta, elems, ok := codec.DecodeDump(cmd.Payload)
+	var e *rdb.Entry
+	if !ok {
+		var err error
+		if e, err = rdb.DecodeDump(cmd.Payload); err != nil {
+			cmd.Err = kverror.ErrDumpPayload
+			return nil
+		}
+		if !rdbSupported(e.Type) {
+			cmd.Err = fmt.Errorf("ERR DUMP payload of a %s is not supported", e.Type)
+			return nil
+		}
+	}
+	if !cmd.Replace {
+		_, exists, err := getLive(ctx, s.kv, cmd.Key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if exists {
+			cmd.Err = kverror.ErrBusyKey
+			return nil
+		}
+	}
+	var v codec.Value
+	var ex uint64
+	if e == nil {
+		v = codec.Decode(meta)
+		ex = cmd.ExpireAt(v.ExpireAt())
+		v.SetExpireAt(ex)
+	} else {
+		ex = cmd.ExpireAt((uint64(e.ExpireAt) + 999) / 1000)
+	}
+	if ex > 0 && cmd.Now >= ex {
+		// the key is expired once restored
+		if cmd.Replace {
+			return []*Submit{NewDelSubmit(cmd.Key)}
+		}
+		return nil
+	}
+	if e != nil {
+		e.Key = cmd.Key
+		submits, err := rdbSubmits(e, ex)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		return append([]*Submit{NewDelSubmit(cmd.Key)}, submits...)
+	}
+	var submits = make([]*Submit, 0, 2+len(elems))
+	submits = append(submits, NewDelSubmit(cmd.Key), NewSetRawSubmit(cmd.Key, v.Raw()))
+	if codec.IsComposite(v.Type()) {
+		tag := subKeyTag(v.Type())
+		for _, e := range elems {
+			submits = append(submits, NewSubSetSubmit(subKey(tag, cmd.Key, e.Elem), e.Val))
+		}
+	}
+	return submits
+}
+
+// Migrate restore the keys to the target instance and delete the migrated ones unless COPY.
+// like redis it blocks the server until the target replies or times out
+func (s *_dumpImpl) Migrate(ctx context.Context, cmd *protocol.MigrateCmd) []*Submit {
+	var reqs = make([][][]byte, 0, len(cmd.Keys)+2)
+	if cmd.Password != nil {
+		if cmd.Username != nil {
+			reqs = append(reqs, [][]byte{[]byte("AUTH"), cmd.Username, cmd.Password})
+		} else {
+			reqs = append(reqs, [][]byte{[]byte("AUTH"), cmd.Password})
+		}
+	}
+	reqs = append(reqs, [][]byte{[]byte("SELECT"), []byte(strconv.FormatInt(cmd.DB, 10))})
+	var head = len(reqs)
+
+	var keys = make([][]byte, 0, len(cmd.Keys))
+	for _, key := range cmd.Keys {
+		v, ok, err := getLive(ctx, s.kv, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if !ok {
+			continue
+		}
+		payload, err := s.dump(ctx, key, v)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		var ttl int64
+		if ex := v.ExpireAt(); ex > 0 {
+			ttl = int64(ex-cmd.Now) * 1000
+		}
+		req := [][]byte{[]byte("RESTORE"), key, []byte(strconv.FormatInt(ttl, 10)), payload}
+		if cmd.Replace {
+			req = append(req, []byte("REPLACE"))
+		}
+		reqs = append(reqs, req)
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		cmd.NoKey = true
+		return nil
+	}
+
+	replies, err := request(net.JoinHostPort(cmd.Host, cmd.Port), cmd.Timeout, reqs)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	for _, e := range replies[:head] {
+		if e != nil {
+			cmd.Err = fmt.Errorf("ERR Target instance replied with error: %s", e)
+			return nil
+		}
+	}
+	var dels = make([]*Submit, 0, len(keys))
+	for i, key := range keys {
+		if e := replies[head+i]; e != nil {
+			if cmd.Err == nil {
+				cmd.Err = fmt.Errorf("ERR Target instance replied with error: %s", e)
+			}
+			continue
+		}
+		if !cmd.Copy {
+			dels = append(dels, NewDelSubmit(key))
+		}
+	}
+	return dels
+}
+
+// request send the requests to addr in one pipeline, replies are the error replies of each request
+func request(addr string, timeout time.Duration, reqs [][][]byte) (replies []error, err error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, kverror.ErrMigrateConnect
+	}
+	defer conn.Close()
+	bw := bufio.NewWriter(conn)
+	wr := protocol.NewWriter(bw)
+	for _, req := range reqs {
+		if err := wr.WriteArgs(req...); err != nil {
+			return nil, kverror.ErrMigrateIO
+		}
+	}
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := bw.Flush(); err != nil {
+		return nil, kverror.ErrMigrateIO
+	}
+	rd := protocol.NewReader(conn)
+	replies = make([]error, len(reqs))
+	for i := range reqs {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		_, err := rd.ReadRequest(protocol.SliceParser)
+		if err != nil {
+			if e, ok := err.(protocol.RedisError); ok {
+				replies[i] = e
+				continue
+			}
+			return nil, kverror.ErrMigrateIO
+		}
+	}
+	return replies, nil
+}
@@ -0,0 +1,217 @@
+package gokv
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/yixinin/gokv/geo"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// _geoImpl geo indexes are sorted sets with the 52 bits geohash of members as scores,
+// searches scan the score ranges of the geohash cells around the center
+type _geoImpl struct {
+	kv   kvstore.Kvstore
+	zset *_zsetImpl
+}
+
+func NewGeoImpl(kv kvstore.Kvstore, zset *_zsetImpl) *_geoImpl {
+	return &_geoImpl{
+		kv:   kv,
+		zset: zset,
+	}
+}
+
+func (s *_geoImpl) GeoPos(ctx context.Context, cmd *protocol.GeoPosCmd) *Submit {
+	m, expired, err := s.zset.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	for i, member := range cmd.Members {
+		score, ok, err := s.zset.score(ctx, cmd.Key, member)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if ok {
+			lon, lat := geo.Decode(uint64(score))
+			cmd.Pos[i] = &[2]float64{lon, lat}
+		}
+	}
+	return nil
+}
+
+func (s *_geoImpl) GeoHash(ctx context.Context, cmd *protocol.GeoHashCmd) *Submit {
+	m, expired, err := s.zset.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	for i, member := range cmd.Members {
+		score, ok, err := s.zset.score(ctx, cmd.Key, member)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if ok {
+			cmd.Hashes[i] = geo.Hash(uint64(score))
+		}
+	}
+	return nil
+}
+
+func (s *_geoImpl) GeoDist(ctx context.Context, cmd *protocol.GeoDistCmd) *Submit {
+	m, expired, err := s.zset.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	score1, ok1, err := s.zset.score(ctx, cmd.Key, cmd.Member1)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	score2, ok2, err := s.zset.score(ctx, cmd.Key, cmd.Member2)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if ok1 && ok2 {
+		lon1, lat1 := geo.Decode(uint64(score1))
+		lon2, lat2 := geo.Decode(uint64(score2))
+		dist := geo.Distance(lon1, lat1, lon2, lat2) / cmd.Unit
+		cmd.Dist = &dist
+	}
+	return nil
+}
+
+// search find the members in the radius or box of cmd, expired reports whether the index is expired
+func (s *_geoImpl) search(ctx context.Context, cmd *protocol.GeoSearchCmd) (expired bool, err error) {
+	m, expired, err := s.zset.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil || m == nil {
+		return expired, err
+	}
+	if cmd.FromMember != nil {
+		score, ok, err := s.zset.score(ctx, cmd.Key, cmd.FromMember)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, kverror.ErrGeoMember
+		}
+		cmd.Lon, cmd.Lat = geo.Decode(uint64(score))
+	}
+	var width, height, radius = 2 * cmd.Radius, 2 * cmd.Radius, cmd.Radius
+	if cmd.ByBox {
+		width, height = cmd.Width, cmd.Height
+		radius = math.Sqrt(width*width+height*height) / 2
+	}
+	var enough = func() bool {
+		return cmd.Any && int64(len(cmd.Results)) >= cmd.Count
+	}
+	for _, r := range geo.Ranges(cmd.Lon, cmd.Lat, width, height, radius) {
+		err := s.zset.scoreRange(ctx, cmd.Key, float64(r[0]), float64(r[1]), func(zm protocol.ZMember) bool {
+			lon, lat := geo.Decode(uint64(zm.Score))
+			var dist float64
+			var ok bool
+			if cmd.ByBox {
+				dist, ok = geo.InBox(width, height, cmd.Lon, cmd.Lat, lon, lat)
+			} else {
+				dist = geo.Distance(cmd.Lon, cmd.Lat, lon, lat)
+				ok = dist <= radius
+			}
+			if ok {
+				cmd.Results = append(cmd.Results, protocol.GeoResult{
+					Member: zm.Member,
+					Dist:   dist / cmd.Unit,
+					Score:  uint64(zm.Score),
+					Lon:    lon,
+					Lat:    lat,
+				})
+			}
+			return !enough()
+		})
+		if err != nil {
+			return false, err
+		}
+		if enough() {
+			break
+		}
+	}
+	switch cmd.Sort {
+	case protocol.GeoSortAsc:
+		sort.SliceStable(cmd.Results, func(i, j int) bool {
+			return cmd.Results[i].Dist < cmd.Results[j].Dist
+		})
+	case protocol.GeoSortDesc:
+		sort.SliceStable(cmd.Results, func(i, j int) bool {
+			return cmd.Results[i].Dist > cmd.Results[j].Dist
+		})
+	}
+	if cmd.Count > 0 && int64(len(cmd.Results)) > cmd.Count {
+		cmd.Results = cmd.Results[:cmd.Count]
+	}
+	return false, nil
+}
+
+func (s *_geoImpl) GeoSearch(ctx context.Context, cmd *protocol.GeoSearchCmd) *Submit {
+	expired, err := s.search(ctx, cmd)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	return nil
+}
+
+// GeoSearchStore replace the destination with the found members in one batch
+func (s *_geoImpl) GeoSearchStore(ctx context.Context, cmd *protocol.GeoSearchCmd) []*Submit {
+	expired, err := s.search(ctx, cmd)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, 2*len(cmd.Results)+3)
+	if expired {
+		submits = append(submits, NewExDelSubmit(cmd.Key))
+	}
+	submits = append(submits, NewDelSubmit(cmd.Store))
+	if len(cmd.Results) == 0 {
+		return submits
+	}
+	var m = &zsetMeta{}
+	for _, r := range cmd.Results {
+		var score = float64(r.Score)
+		if cmd.StoreDist {
+			score = r.Dist
+		}
+		submits = append(submits, zsetSetSubmits(cmd.Store, r.Member, score)...)
+		m.Len++
+	}
+	cmd.Stored = m.Len
+	return append(submits, m.submit(cmd.Store))
+}
@@ -1,231 +1,301 @@
 package gokv
 
-// import (
-// 	"context"
-// 	"fmt"
-// 	"strings"
-// 	"time"
-
-// 	"github.com/yixinin/gokv/codec"
-// 	"github.com/yixinin/gokv/kverror"
-// 	"github.com/yixinin/gokv/kvstore"
-// )
-
-// type HashIface interface {
-// 	HDel(key string, fields ...string) error
-// 	HExists(key, field string) (bool, error)
-// 	HGet(key, field string) (string, error)
-// 	HGetAll(key string) (map[string]string, error)
-// 	HIncrBy(key, field string, incr int64) (int64, error)
-// 	HIncrByFloat(key, field string, incr float64) (float64, error)
-// 	HKeys(key string) ([]string, error)
-// 	HLen(key string) (int, error)
-// 	HMGet(key string, fields ...string) ([]string, error)
-// 	HMSet(key string, fields map[string]interface{}) (string, error)
-// 	HSet(key, field string, value interface{}) (bool, error)
-// 	HSetNX(key, field string, value interface{}) (bool, error)
-// 	HVals(key string) ([]string, error)
-// }
-
-// const SplitC = ':'
-// const HashKeySplitC = ','
-
-// func sliceEq(s1, s2 []byte) bool {
-// 	if len(s1) != len(s2) {
-// 		return false
-// 	}
-// 	for i := range s1 {
-// 		if s1[i] != s2[i] {
-// 			return false
-// 		}
-// 	}
-// 	return true
-// }
-// func readFields(hkval []byte) []string {
-// 	var fields = make([]string, 0, 2)
-// 	var i, prev int
-// 	for i < len(hkval) {
-// 		if hkval[i] == HashKeySplitC {
-// 			fields = append(fields, string(hkval[prev:i]))
-// 			i++
-// 			prev = i
-// 		}
-// 		i++
-// 	}
-// 	if prev < i {
-// 		fields = append(fields, string(hkval[prev:i]))
-// 	}
-// 	return fields
-// }
-// func genFields(key string, fields []string) string {
-// 	s := strings.Join(fields, ",")
-// 	return fmt.Sprintf("h:%s:%s", key, s)
-// }
-
-// type _hashImpl struct {
-// 	cmd kvstore.Kvstore
-// }
-
-// func (h *_hashImpl) hCheckKey(ctx context.Context, key string) error {
-// 	hkval, err := h.cmd.Get(ctx, key)
-// 	switch err {
-// 	case nil:
-// 		if len(hkval) <= len(key)+2 || hkval[len(key)+2] != SplitC {
-// 			return kverror.ErrKeyOPType
-// 		}
-// 		if hkval[0] != 'h' || hkval[1] != ':' {
-// 			return kverror.ErrKeyOPType
-// 		}
-// 		if !sliceEq(hkval[2:2+len(key)], codec.StringToBytes(key)) {
-// 			return kverror.ErrKeyOPType
-// 		}
-// 		return nil
-// 	case kverror.ErrNotFound:
-// 		return nil
-// 	default:
-// 		return err
-// 	}
-// }
-
-// func (h *_hashImpl) hCheckKeyForUpdate(ctx context.Context, key, field string) error {
-// 	var bKey = codec.StringToBytes(key)
-// 	hkval, err := h.cmd.Get(ctx, key)
-// 	switch err {
-// 	case nil:
-// 		if len(hkval) <= len(key)+2 || hkval[len(key)+2] != SplitC {
-// 			return kverror.ErrKeyOPType
-// 		}
-// 		if hkval[0] != 'h' || hkval[1] != ':' {
-// 			return kverror.ErrKeyOPType
-// 		}
-// 		if !sliceEq(hkval[2:2+len(key)], bKey) {
-// 			return kverror.ErrKeyOPType
-// 		}
-// 		fields := readFields(hkval[2+len(key)+1:])
-// 		for _, f := range fields {
-// 			if f == field {
-// 				return nil
-// 			}
-// 		}
-// 		fields = append(fields, field)
-// 		return h.cmd.Set(ctx, key, genFields(key, fields))
-// 	case kverror.ErrNotFound:
-// 		val := genFields(key, []string{field})
-// 		return h.cmd.Set(ctx, key, val)
-// 	default:
-// 		return err
-// 	}
-// }
-
-// func (h *_hashImpl) hGetAllKeys(ctx context.Context, key string) ([]string, []string, error) {
-// 	var bKey = []byte(key)
-// 	hkval, err := h.cmd.Get(ctx, key)
-// 	if err != nil {
-// 		return nil, nil, err
-// 	}
-
-// 	if len(hkval) <= len(key)+2 || hkval[len(key)+2] != SplitC {
-// 		return nil, nil, kverror.ErrKeyOPType
-// 	}
-// 	if hkval[0] != 'h' || hkval[1] != ':' {
-// 		return nil, nil, kverror.ErrKeyOPType
-// 	}
-// 	if !sliceEq(hkval[2:2+len(key)], bKey) {
-// 		return nil, nil, kverror.ErrKeyOPType
-// 	}
-// 	fields := readFields(hkval[2+len(key)+1:])
-// 	var keys = make([]string, 0, len(fields))
-// 	for _, f := range fields {
-// 		keys = append(keys, genHashFieldKey(key, f))
-// 	}
-// 	return keys, fields, nil
-// }
-
-// func genHashFieldKey(key, field string) string {
-// 	return fmt.Sprintf("h:%s:%s", key, field)
-// }
-// func (h *_hashImpl) HSet(ctx context.Context, key, field, val string) error {
-// 	if err := h.hCheckKeyForUpdate(ctx, key, field); err != nil {
-// 		return err
-// 	}
-// 	fkey := genHashFieldKey(key, field)
-// 	return h.cmd.Set(ctx, fkey, val)
-// }
-
-// func (h *_hashImpl) HGet(ctx context.Context, key, field string) (string, error) {
-// 	if err := h.hCheckKey(ctx, key); err != nil {
-// 		return "", err
-// 	}
-// 	fkey := genHashFieldKey(key, field)
-// 	data, err := h.cmd.Get(ctx, fkey)
-// 	if err != nil {
-// 		return "", err
-// 	}
-// 	v := codec.Decode(data)
-// 	if err := h.checkExpire(ctx, key, v.ExpireAt()); err != nil {
-// 		return "", err
-// 	}
-// 	return v.String(), nil
-// }
-// func (h *_hashImpl) checkExpire(ctx context.Context, key string, expireAt uint64) error {
-// 	var unixNow = uint64(time.Now().Unix())
-// 	if expireAt != 0 && expireAt <= unixNow {
-// 		go func(ctx context.Context) {
-// 			defer recover()
-// 			keys, _, _ := h.hGetAllKeys(ctx, key)
-// 			for _, k := range keys {
-// 				_ = h.cmd.Delete(ctx, k)
-// 			}
-// 			_ = h.cmd.Delete(ctx, key)
-// 		}(context.Background())
-// 		return kverror.ErrNotFound
-// 	}
-// 	return nil
-// }
-
-// func (h *_hashImpl) HGetAll(ctx context.Context, key string) (map[string]string, error) {
-// 	keys, fields, err := h.hGetAllKeys(ctx, key)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	var m = make(map[string]string, len(key))
-// 	var newKeys = make([]string, 0, len(keys))
-// 	for i, key := range keys {
-// 		data, err := h.cmd.Get(ctx, key)
-// 		if err == kverror.ErrNotFound {
-// 			continue
-// 		}
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		m[fields[i]] = codec.Decode(data).String()
-// 		newKeys = append(newKeys, string(key))
-// 	}
-// 	if len(newKeys) < len(keys) {
-// 		_ = h.cmd.Set(ctx, key, genFields(key, newKeys))
-// 	}
-// 	return m, nil
-// }
-
-// func (h *_hashImpl) HDel(ctx context.Context, key string, field ...string) error {
-// 	keys, _, err := h.hGetAllKeys(ctx, key)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	var waitDeletes = make(map[string]struct{}, len(keys))
-// 	for _, f := range field {
-// 		waitDeletes[string(genHashFieldKey(key, f))] = struct{}{}
-// 	}
-// 	var newKeys = make([]string, 0, len(keys))
-// 	for _, key := range keys {
-// 		if _, ok := waitDeletes[string(key)]; ok {
-// 			_ = h.cmd.Delete(ctx, key)
-// 			continue
-// 		}
-// 		newKeys = append(newKeys, string(key))
-// 	}
-// 	if len(newKeys) < len(keys) {
-// 		_ = h.cmd.Set(ctx, key, genFields(key, newKeys))
-// 	}
-// 	return nil
-// }
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strconv"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// _hashImpl hashes keep a meta with the field count at key and one internal key per field,
+// the value of the field is stored as is
+type _hashImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewHashImpl(kv kvstore.Kvstore) *_hashImpl {
+	return &_hashImpl{
+		kv: kv,
+	}
+}
+
+type hashMeta struct {
+	Len int64
+	ex  uint64
+}
+
+func (m *hashMeta) submit(key []byte) *Submit {
+	if m.Len == 0 {
+		return NewDelSubmit(key)
+	}
+	return NewSetRawSubmit(key, codec.EncodeMeta(codec.HashType, m.Len, m.ex).Raw())
+}
+
+// getHash get the live hash meta, nil if key does not exist
+func (s *_hashImpl) getHash(ctx context.Context, key []byte, now uint64) (m *hashMeta, expired bool, err error) {
+	v, ok, expired, err := getMeta(ctx, s.kv, key, now, codec.HashType)
+	if err != nil || !ok {
+		return nil, expired, err
+	}
+	return &hashMeta{
+		Len: v.Len(),
+		ex:  v.ExpireAt(),
+	}, false, nil
+}
+
+// field get the value of field, ok is false if it is not a field of the hash
+func (s *_hashImpl) field(ctx context.Context, key, field []byte) (val []byte, ok bool, err error) {
+	data, err := s.kv.Get(ctx, subKey(hashKeyTag, key, field))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// fields iterate the fields of a hash in order
+func (s *_hashImpl) fields(ctx context.Context, key []byte, f func(field, val []byte)) error {
+	prefix := subKeyPrefix(hashKeyTag, key)
+	return s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, data []byte) bool {
+		f(k[len(prefix):], data)
+		return true
+	})
+}
+
+// hashSetSubmits the submits to store a hash of the fields and values, the key must not exist
+func hashSetSubmits(key []byte, fields, vals [][]byte, ex uint64) []*Submit {
+	var submits = make([]*Submit, 0, len(fields)+1)
+	var seen = make(map[string]struct{}, len(fields))
+	for i, field := range fields {
+		seen[codec.BytesToString(field)] = struct{}{}
+		submits = append(submits, NewSubSetSubmit(subKey(hashKeyTag, key, field), vals[i]))
+	}
+	m := &hashMeta{Len: int64(len(seen)), ex: ex}
+	return append(submits, m.submit(key))
+}
+
+// HSet hset/hmset/hsetnx, the meta is written with the fields in one submit batch
+func (s *_hashImpl) HSet(ctx context.Context, cmd *protocol.HSetCmd) []*Submit {
+	m, expired, err := s.getHash(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.Fields)+2)
+	if m == nil {
+		if expired {
+			submits = append(submits, NewDelSubmit(cmd.Key))
+		}
+		m = &hashMeta{}
+	}
+	// fields added by former pairs of the same command
+	var added = make(map[string]bool, len(cmd.Fields))
+	for i, field := range cmd.Fields {
+		exist := added[string(field)]
+		if !exist && m.Len > 0 {
+			_, exist, err = s.field(ctx, cmd.Key, field)
+			if err != nil {
+				cmd.Err = err
+				return nil
+			}
+		}
+		if cmd.NX && exist {
+			return nil
+		}
+		if !exist {
+			added[string(field)] = true
+			m.Len++
+			cmd.Count++
+		}
+		submits = append(submits, NewSubSetSubmit(subKey(hashKeyTag, cmd.Key, field), cmd.Vals[i]))
+	}
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_hashImpl) HGet(ctx context.Context, cmd *protocol.HGetCmd) *Submit {
+	m, expired, err := s.getHash(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	cmd.Vals = make([][]byte, len(cmd.Fields))
+	for i, field := range cmd.Fields {
+		cmd.Vals[i], _, err = s.field(ctx, cmd.Key, field)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *_hashImpl) HDel(ctx context.Context, cmd *protocol.SAddCmd) []*Submit {
+	m, expired, err := s.getHash(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if m == nil {
+		if expired {
+			return []*Submit{NewExDelSubmit(cmd.Key)}
+		}
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.Members)+1)
+	for _, field := range cmd.Members {
+		_, ok, err := s.field(ctx, cmd.Key, field)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if !ok {
+			continue
+		}
+		submits = append(submits, NewSubDelSubmit(subKey(hashKeyTag, cmd.Key, field)))
+		m.Len--
+		cmd.Count++
+	}
+	if cmd.Count == 0 {
+		return nil
+	}
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_hashImpl) HLen(ctx context.Context, cmd *protocol.SCardCmd) *Submit {
+	m, expired, err := s.getHash(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m != nil {
+		cmd.Count = m.Len
+	}
+	return nil
+}
+
+func (s *_hashImpl) HExists(ctx context.Context, cmd *protocol.SIsMemberCmd) *Submit {
+	m, expired, err := s.getHash(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Exists = make([]bool, len(cmd.Members))
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	_, cmd.Exists[0], cmd.Err = s.field(ctx, cmd.Key, cmd.Members[0])
+	return nil
+}
+
+// HGetAll hgetall/hkeys/hvals, the fields are ordered by their bytes
+func (s *_hashImpl) HGetAll(ctx context.Context, cmd *protocol.HGetAllCmd) *Submit {
+	m, expired, err := s.getHash(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	cmd.Err = s.fields(ctx, cmd.Key, func(field, val []byte) {
+		cmd.Fields = append(cmd.Fields, field)
+		cmd.Vals = append(cmd.Vals, val)
+	})
+	return nil
+}
+
+// incrField the submits to set field to the value made by incr from the current one,
+// exist is false if the field is missing
+func (s *_hashImpl) incrField(ctx context.Context, key, field []byte, now uint64, incr func(old []byte, exist bool) ([]byte, error)) ([]*Submit, error) {
+	m, expired, err := s.getHash(ctx, key, now)
+	if err != nil {
+		return nil, err
+	}
+	var submits = make([]*Submit, 0, 3)
+	var old []byte
+	var exist bool
+	if m == nil {
+		if expired {
+			submits = append(submits, NewDelSubmit(key))
+		}
+		m = &hashMeta{}
+	} else {
+		old, exist, err = s.field(ctx, key, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	val, err := incr(old, exist)
+	if err != nil {
+		return nil, err
+	}
+	submits = append(submits, NewSubSetSubmit(subKey(hashKeyTag, key, field), val))
+	if exist {
+		return submits, nil
+	}
+	m.Len++
+	return append(submits, m.submit(key)), nil
+}
+
+func (s *_hashImpl) HIncrBy(ctx context.Context, cmd *protocol.HIncrByCmd) []*Submit {
+	submits, err := s.incrField(ctx, cmd.Key, cmd.Field, cmd.Now, func(old []byte, exist bool) ([]byte, error) {
+		if !exist {
+			return strconv.AppendInt(nil, cmd.Val, 10), nil
+		}
+		i, ok := intValue(codec.EncodeString(old))
+		if !ok {
+			return nil, kverror.ErrHashNotInteger
+		}
+		sum, ok := addInt64(i, cmd.Val)
+		if !ok {
+			return nil, kverror.ErrIncrOverflow
+		}
+		cmd.Val = sum
+		return strconv.AppendInt(nil, sum, 10), nil
+	})
+	cmd.Err = err
+	return submits
+}
+
+func (s *_hashImpl) HIncrByFloat(ctx context.Context, cmd *protocol.HIncrByFloatCmd) []*Submit {
+	submits, err := s.incrField(ctx, cmd.Key, cmd.Field, cmd.Now, func(old []byte, exist bool) ([]byte, error) {
+		if !exist {
+			cmd.Val = codec.FormatLongDouble(cmd.Incr)
+			return cmd.Val, nil
+		}
+		f, ok := codec.ParseLongDouble(old)
+		if !ok {
+			return nil, kverror.ErrHashNotFloat
+		}
+		sum := new(big.Float).SetPrec(codec.LongDoublePrec).Add(f, cmd.Incr)
+		if codec.IsLongDoubleInf(sum) {
+			return nil, kverror.ErrIncrNaN
+		}
+		cmd.Val = codec.FormatLongDouble(sum)
+		return cmd.Val, nil
+	})
+	cmd.Err = err
+	return submits
+}
@@ -0,0 +1,111 @@
+package gokv
+
+import (
+	"context"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/hll"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// _hllImpl HyperLogLogs are string values in the redis format,
+// the cached cardinality is only refreshed by writes so PFCOUNT stays a read
+type _hllImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewHLLImpl(kv kvstore.Kvstore) *_hllImpl {
+	return &_hllImpl{
+		kv: kv,
+	}
+}
+
+// getHLL get the live HyperLogLog of key and its expire time, nil if key does not exist
+func (s *_hllImpl) getHLL(ctx context.Context, key []byte, now uint64) (h *hll.HLL, ex uint64, expired bool, err error) {
+	v, ok, err := getLive(ctx, s.kv, key, now)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if !ok {
+		return nil, 0, v.Expired(now), nil
+	}
+	if !v.IsString() {
+		return nil, 0, false, kverror.ErrKeyOPType
+	}
+	if v.Type() != codec.StrType {
+		return nil, 0, false, hll.ErrInvalid
+	}
+	h, err = hll.Decode(v.Bytes())
+	return h, v.ExpireAt(), false, err
+}
+
+func (s *_hllImpl) PFAdd(ctx context.Context, cmd *protocol.PFAddCmd) *Submit {
+	h, ex, _, err := s.getHLL(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if h == nil {
+		h = hll.New()
+		cmd.Updated = true
+	}
+	for _, elem := range cmd.Elems {
+		if h.Add(elem) {
+			cmd.Updated = true
+		}
+	}
+	if !cmd.Updated {
+		return nil
+	}
+	return NewSetSubmit(cmd.Key, h.Encode(), ex)
+}
+
+func (s *_hllImpl) PFCount(ctx context.Context, cmd *protocol.PFCountCmd) []*Submit {
+	var submits = make([]*Submit, 0, 1)
+	var union = hll.New()
+	for _, key := range cmd.Keys {
+		h, _, expired, err := s.getHLL(ctx, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if expired {
+			submits = append(submits, NewExDelSubmit(key))
+		}
+		if h == nil {
+			continue
+		}
+		if len(cmd.Keys) == 1 {
+			cmd.Count = h.Count()
+			return submits
+		}
+		union.Merge(h)
+	}
+	cmd.Count = union.Count()
+	return submits
+}
+
+// PFMerge merge the sources into the destination, which is written by one submit
+func (s *_hllImpl) PFMerge(ctx context.Context, cmd *protocol.PFMergeCmd) *Submit {
+	h, ex, _, err := s.getHLL(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if h == nil {
+		h = hll.New()
+	}
+	for _, key := range cmd.Srcs {
+		src, _, _, err := s.getHLL(ctx, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if src != nil {
+			h.Merge(src)
+		}
+	}
+	return NewSetSubmit(cmd.Key, h.Encode(), ex)
+}
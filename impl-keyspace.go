@@ -0,0 +1,248 @@
+package gokv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/rand"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// randomKeyTries the number of expired keys randomkey skips before giving up
+const randomKeyTries = 16
+
+type _keyspaceImpl struct {
+	kv  kvstore.Kvstore
+	dbs *kvstore.DBStore
+}
+
+func NewKeyspaceImpl(kv kvstore.Kvstore, dbs *kvstore.DBStore) *_keyspaceImpl {
+	return &_keyspaceImpl{
+		kv:  kv,
+		dbs: dbs,
+	}
+}
+
+// validDB whether db is a database index
+func (s *_keyspaceImpl) validDB(db int64) bool {
+	return db >= 0 && db < int64(s.dbs.Databases())
+}
+
+func (s *_keyspaceImpl) Type(ctx context.Context, cmd *protocol.TypeCmd) *Submit {
+	v, ok, err := getLive(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		cmd.Type = "none"
+		if v.Expired(cmd.Now) {
+			return NewExDelSubmit(cmd.Key)
+		}
+		return nil
+	}
+	cmd.Type = typeName(v.Type())
+	return nil
+}
+
+// copySubmits the submits replacing dst with the value of src and all its element keys
+func (s *_keyspaceImpl) copySubmits(ctx context.Context, src, dst []byte, v codec.Value) ([]*Submit, error) {
+	var submits = []*Submit{NewDelSubmit(dst), NewSetRawSubmit(dst, v.Raw())}
+	if !codec.IsComposite(v.Type()) {
+		return submits, nil
+	}
+	tag := subKeyTag(v.Type())
+	srcPrefix, dstPrefix := subKeyPrefix(tag, src), subKeyPrefix(tag, dst)
+	err := s.kv.Range(ctx, srcPrefix, prefixEnd(srcPrefix), false, func(key, data []byte) bool {
+		sk := append(append(make([]byte, 0, len(dstPrefix)+len(key)-len(srcPrefix)), dstPrefix...), key[len(srcPrefix):]...)
+		submits = append(submits, NewSubSetSubmit(sk, data))
+		return true
+	})
+	return submits, err
+}
+
+// Rename move the value and element keys of a key in one batch
+func (s *_keyspaceImpl) Rename(ctx context.Context, cmd *protocol.RenameCmd) []*Submit {
+	v, ok, err := getLive(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		cmd.Err = kverror.ErrNoSuchKey
+		return nil
+	}
+	if bytes.Equal(cmd.Key, cmd.Dst) {
+		cmd.Renamed = !cmd.NX
+		return nil
+	}
+	if cmd.NX {
+		_, exists, err := getLive(ctx, s.kv, cmd.Dst, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if exists {
+			return nil
+		}
+	}
+	submits, err := s.copySubmits(ctx, cmd.Key, cmd.Dst, v)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Renamed = true
+	return append(submits, NewDelSubmit(cmd.Key))
+}
+
+// Copy copy a key with its element keys, a copy to another database is applied by one submit
+func (s *_keyspaceImpl) Copy(ctx context.Context, cmd *protocol.CopyCmd) []*Submit {
+	var db = kvstore.DBFromContext(ctx)
+	if cmd.DB >= 0 {
+		if !s.validDB(cmd.DB) {
+			cmd.Err = kverror.ErrDBIndex
+			return nil
+		}
+		db = int(cmd.DB)
+	}
+	if db == kvstore.DBFromContext(ctx) && bytes.Equal(cmd.Key, cmd.Dst) {
+		cmd.Err = kverror.ErrSameObject
+		return nil
+	}
+	v, ok, err := getLive(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil || !ok {
+		cmd.Err = err
+		return nil
+	}
+	if !cmd.Replace {
+		_, exists, err := getLive(kvstore.WithDB(ctx, db), s.kv, cmd.Dst, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if exists {
+			return nil
+		}
+	}
+	if db != kvstore.DBFromContext(ctx) {
+		cmd.Copied = true
+		return []*Submit{NewCopySubmit(cmd.Key, db, cmd.Dst)}
+	}
+	submits, err := s.copySubmits(ctx, cmd.Key, cmd.Dst, v)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Copied = true
+	return submits
+}
+
+// Move move a key to another database if it does not exist there
+func (s *_keyspaceImpl) Move(ctx context.Context, cmd *protocol.MoveCmd) []*Submit {
+	if !s.validDB(cmd.DB) {
+		cmd.Err = kverror.ErrDBIndex
+		return nil
+	}
+	if int(cmd.DB) == kvstore.DBFromContext(ctx) {
+		cmd.Err = kverror.ErrSameObject
+		return nil
+	}
+	_, ok, err := getLive(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil || !ok {
+		cmd.Err = err
+		return nil
+	}
+	_, exists, err := getLive(kvstore.WithDB(ctx, int(cmd.DB)), s.kv, cmd.Key, cmd.Now)
+	if err != nil || exists {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Moved = true
+	return []*Submit{NewCopySubmit(cmd.Key, int(cmd.DB), cmd.Key), NewDelSubmit(cmd.Key)}
+}
+
+// SwapDB swap two databases, which only swaps their key ranges
+func (s *_keyspaceImpl) SwapDB(ctx context.Context, cmd *protocol.SwapDBCmd) *Submit {
+	if !s.validDB(cmd.DB1) || !s.validDB(cmd.DB2) {
+		cmd.Err = kverror.ErrDBIndex
+		return nil
+	}
+	return NewSwapDBSubmit(int(cmd.DB1), int(cmd.DB2))
+}
+
+// RandomKey seek a random position between the first and the last key,
+// keys after longer gaps are more likely to be picked
+func (s *_keyspaceImpl) RandomKey(ctx context.Context, cmd *protocol.RandomKeyCmd) []*Submit {
+	var limit = []byte{internalKeyPrefix}
+	var edge = func(reverse bool) (key []byte, err error) {
+		err = s.kv.Range(ctx, nil, limit, reverse, func(k, _ []byte) bool {
+			key = k
+			return false
+		})
+		return key, err
+	}
+	first, err := edge(false)
+	if err != nil || first == nil {
+		cmd.Err = err
+		return nil
+	}
+	last, err := edge(true)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var exdels = make([]*Submit, 0, 1)
+	for i := 0; i < randomKeyTries; i++ {
+		var key []byte
+		var v codec.Value
+		err := s.kv.Range(ctx, randomBetween(first, last), limit, false, func(k, data []byte) bool {
+			key, v = k, codec.Decode(data)
+			return false
+		})
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if key == nil {
+			break
+		}
+		if v.Expired(cmd.Now) {
+			exdels = append(exdels, NewExDelSubmit(key))
+			continue
+		}
+		cmd.Found = key
+		break
+	}
+	return exdels
+}
+
+// randomBetween a random key in [lo, hi] by the first 8 bytes of them
+func randomBetween(lo, hi []byte) []byte {
+	var a, b [8]byte
+	copy(a[:], lo)
+	copy(b[:], hi)
+	x, y := binary.BigEndian.Uint64(a[:]), binary.BigEndian.Uint64(b[:])
+	var n = x
+	if y > x {
+		if y-x == ^uint64(0) {
+			n = rand.Uint64()
+		} else {
+			n = x + rand.Uint64()%(y-x+1)
+		}
+	}
+	var key = make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return bytes.TrimRight(key, "\x00")
+}
+
+// Flush delete all keys of the selected or all databases by range deletes
+func (s *_keyspaceImpl) Flush(ctx context.Context, cmd *protocol.FlushCmd) *Submit {
+	if cmd.All {
+		return NewFlushAllSubmit()
+	}
+	return NewFlushSubmit([]byte{})
+}
@@ -0,0 +1,264 @@
+package gokv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+const (
+	leaseGrant byte = iota + 1
+	leaseKeepAlive
+	leaseAttach
+	leaseRevoke
+	// leaseExpire revoke the lease if it has expired at now
+	leaseExpire
+)
+
+// leaseOP a lease submit, it is resolved when applied so a lease revoked or expired
+// concurrently is never kept alive nor attached
+type leaseOP struct {
+	action byte
+	id     uint64
+	// now the time of the leader, ttl the granted seconds
+	now, ttl uint64
+	// data the value of the key attached
+	data []byte
+}
+
+// encodeLeaseOP action | id | now | ttl | data
+func encodeLeaseOP(op leaseOP) []byte {
+	var buf = make([]byte, 25, 25+len(op.data))
+	buf[0] = op.action
+	binary.BigEndian.PutUint64(buf[1:], op.id)
+	binary.BigEndian.PutUint64(buf[9:], op.now)
+	binary.BigEndian.PutUint64(buf[17:], op.ttl)
+	return append(buf, op.data...)
+}
+
+func decodeLeaseOP(b []byte) (op leaseOP, ok bool) {
+	if len(b) < 25 {
+		return op, false
+	}
+	op.action = b[0]
+	op.id = binary.BigEndian.Uint64(b[1:])
+	op.now = binary.BigEndian.Uint64(b[9:])
+	op.ttl = binary.BigEndian.Uint64(b[17:])
+	op.data = b[25:]
+	return op, true
+}
+
+// NewLeaseSubmit a lease op, key is the key attached or the lease key
+func NewLeaseSubmit(key []byte, op leaseOP) *Submit {
+	return &Submit{
+		OP:    CommitOPLease,
+		Key:   key,
+		Value: encodeLeaseOP(op),
+	}
+}
+
+func leaseKey(id uint64) []byte {
+	return append([]byte{internalKeyPrefix, leaseKeyTag}, codec.Uint642Bytes(id)...)
+}
+
+func leaseAttachKey(id uint64, key []byte) []byte {
+	return subKey(leaseAttachTag, codec.Uint642Bytes(id), key)
+}
+
+func keyLeaseKey(key []byte) []byte {
+	return subKeyPrefix(keyLeaseTag, key)
+}
+
+// encodeLease ttl | expire at
+func encodeLease(ttl, expireAt uint64) []byte {
+	return append(codec.Uint642Bytes(ttl), codec.Uint642Bytes(expireAt)...)
+}
+
+// _leaseImpl keys attached to a lease are deleted together when the lease is revoked or expires,
+// the leases are kept per database, the id of a lease is the raft index it is granted at
+type _leaseImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewLeaseImpl(kv kvstore.Kvstore) *_leaseImpl {
+	return &_leaseImpl{
+		kv: kv,
+	}
+}
+
+// getLease the ttl and expire time of a lease, ok is false if it is not granted or has expired at now
+func (s *_leaseImpl) getLease(ctx context.Context, id, now uint64) (ttl, expireAt uint64, ok bool, err error) {
+	data, err := s.kv.Get(ctx, leaseKey(id))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return 0, 0, false, nil
+		}
+		return 0, 0, false, err
+	}
+	if len(data) != 16 {
+		return 0, 0, false, nil
+	}
+	ttl, expireAt = binary.BigEndian.Uint64(data), binary.BigEndian.Uint64(data[8:])
+	return ttl, expireAt, expireAt > now, nil
+}
+
+// Attach attach the key set by st to the lease of cmd
+func (s *_leaseImpl) Attach(ctx context.Context, cmd *protocol.SetCmd, st *Submit) *Submit {
+	_, _, ok, err := s.getLease(ctx, cmd.Lease, cmd.Now)
+	if err != nil || !ok {
+		cmd.Err = err
+		if err == nil {
+			cmd.Err = kverror.ErrLeaseNotFound
+		}
+		return nil
+	}
+	return NewLeaseSubmit(st.Key, leaseOP{action: leaseAttach, id: cmd.Lease, now: cmd.Now, data: st.Value})
+}
+
+// Lease the submit of grant, keepalive and revoke, ttl and keys are read locally
+func (s *_leaseImpl) Lease(ctx context.Context, cmd *protocol.LeaseCmd) *Submit {
+	switch cmd.Sub {
+	case protocol.LeaseGrant:
+		return NewLeaseSubmit(leaseKey(0), leaseOP{action: leaseGrant, now: cmd.Now, ttl: uint64(cmd.TTL)})
+	case protocol.LeaseKeepAlive:
+		return NewLeaseSubmit(leaseKey(cmd.ID), leaseOP{action: leaseKeepAlive, id: cmd.ID, now: cmd.Now})
+	case protocol.LeaseRevoke:
+		return NewLeaseSubmit(leaseKey(cmd.ID), leaseOP{action: leaseRevoke, id: cmd.ID, now: cmd.Now})
+	}
+	_, expireAt, ok, err := s.getLease(ctx, cmd.ID, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	switch cmd.Sub {
+	case protocol.LeaseTTL:
+		cmd.TTL = -2
+		if ok {
+			cmd.TTL = int64(expireAt - cmd.Now)
+		}
+	case protocol.LeaseKeys:
+		if !ok {
+			cmd.Err = kverror.ErrLeaseNotFound
+			return nil
+		}
+		prefix := subKeyPrefix(leaseAttachTag, codec.Uint642Bytes(cmd.ID))
+		cmd.Keys = [][]byte{}
+		cmd.Err = s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, _ []byte) bool {
+			cmd.Keys = append(cmd.Keys, append([]byte{}, k[len(prefix):]...))
+			return true
+		})
+	}
+	return nil
+}
+
+// resolveLease the submits a lease op makes when it is applied at index, ok is false if the lease
+// is not granted or has expired
+func (s *_leaseImpl) resolveLease(ctx context.Context, st *Submit, index uint64) (submits []*Submit, ok bool, err error) {
+	op, ok := decodeLeaseOP(st.Value)
+	if !ok {
+		return nil, false, nil
+	}
+	if op.action == leaseGrant {
+		submits = []*Submit{NewSubSetSubmit(leaseKey(index), encodeLease(op.ttl, op.now+op.ttl))}
+	} else {
+		ttl, expireAt, live, err := s.getLease(ctx, op.id, op.now)
+		if err != nil {
+			return nil, false, err
+		}
+		switch op.action {
+		case leaseKeepAlive:
+			if !live {
+				return nil, false, nil
+			}
+			submits = []*Submit{NewSubSetSubmit(leaseKey(op.id), encodeLease(ttl, op.now+ttl))}
+		case leaseAttach:
+			if !live {
+				return nil, false, nil
+			}
+			submits = []*Submit{
+				NewSetRawSubmit(st.Key, op.data),
+				NewSubSetSubmit(leaseAttachKey(op.id, st.Key), []byte{}),
+				NewSubSetSubmit(keyLeaseKey(st.Key), codec.Uint642Bytes(op.id)),
+			}
+		case leaseRevoke, leaseExpire:
+			// a lease kept alive before it is expired by gc is not revoked
+			if expireAt == 0 || (op.action == leaseExpire && live) {
+				return nil, false, nil
+			}
+			if submits, err = s.revokeSubmits(ctx, op.id); err != nil {
+				return nil, false, err
+			}
+		default:
+			return nil, false, nil
+		}
+	}
+	for _, sub := range submits {
+		sub.DB = st.DB
+	}
+	return submits, true, nil
+}
+
+// revokeSubmits delete the lease and the keys attached to it
+func (s *_leaseImpl) revokeSubmits(ctx context.Context, id uint64) (submits []*Submit, err error) {
+	prefix := subKeyPrefix(leaseAttachTag, codec.Uint642Bytes(id))
+	err = s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, _ []byte) bool {
+		// the attach key is removed when the key is deleted
+		submits = append(submits, NewDelSubmit(append([]byte{}, k[len(prefix):]...)))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(submits, NewSubDelSubmit(leaseKey(id))), nil
+}
+
+// detachLease detach key from its lease when the key is written or deleted
+func (s *_leaseImpl) detachLease(ctx context.Context, key []byte) error {
+	if isInternalKey(key) {
+		return nil
+	}
+	id, err := s.kv.Get(ctx, keyLeaseKey(key))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := s.kv.Delete(ctx, leaseAttachKey(binary.BigEndian.Uint64(id), key)); err != nil {
+		return err
+	}
+	return s.kv.Delete(ctx, keyLeaseKey(key))
+}
+
+// expireLeases revoke the leases of a database expired at now, each in its own entry
+func (t *RaftKv) expireLeases(ctx context.Context, now uint64) {
+	var submits []*Submit
+	var batch = t.settings.GCBatch()
+	var prefix = []byte{internalKeyPrefix, leaseKeyTag}
+	err := t.db.Range(ctx, prefix, prefixEnd(prefix), false, func(k, data []byte) bool {
+		if len(data) == 16 && binary.BigEndian.Uint64(data[8:]) <= now {
+			id := binary.BigEndian.Uint64(k[len(prefix):])
+			submits = append(submits, NewLeaseSubmit(leaseKey(id), leaseOP{action: leaseExpire, id: id, now: now}))
+		}
+		return len(submits) < batch
+	})
+	if err != nil {
+		logger.Errorf(ctx, "scan leases error:%v", err)
+		return
+	}
+	submit, _ := t.StartSubmit(ctx)
+	for _, st := range submits {
+		if logger.EnableDebug() {
+			logger.Debugf(ctx, "gc expire lease %q", st.Key)
+		}
+		if ok, _ := submit(st); ok {
+			t.metrics.expiredLeases.Inc()
+		}
+	}
+}
@@ -1 +1,298 @@
 package gokv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// listInitHead the index of the first element of a new list, lists grow to both sides of it
+const listInitHead uint64 = 1 << 63
+
+// _listImpl lists keep a meta with the length and the head index at key,
+// the element at position i is stored at the internal key of index head+i
+type _listImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewListImpl(kv kvstore.Kvstore) *_listImpl {
+	return &_listImpl{
+		kv: kv,
+	}
+}
+
+type listMeta struct {
+	Len  int64
+	Head uint64
+	ex   uint64
+}
+
+func (m *listMeta) submit(key []byte) *Submit {
+	if m.Len == 0 {
+		return NewDelSubmit(key)
+	}
+	return NewSetRawSubmit(key, codec.EncodeMetaExt(codec.ListType, m.Len, codec.Uint642Bytes(m.Head), m.ex).Raw())
+}
+
+func listElemKey(key []byte, idx uint64) []byte {
+	return subKey(listKeyTag, key, codec.Uint642Bytes(idx))
+}
+
+// getList get the live list meta, nil if key does not exist
+func (s *_listImpl) getList(ctx context.Context, key []byte, now uint64) (m *listMeta, expired bool, err error) {
+	v, ok, expired, err := getMeta(ctx, s.kv, key, now, codec.ListType)
+	if err != nil || !ok {
+		return nil, expired, err
+	}
+	return &listMeta{
+		Len:  v.Len(),
+		Head: binary.BigEndian.Uint64(v.Ext()),
+		ex:   v.ExpireAt(),
+	}, false, nil
+}
+
+func (s *_listImpl) elem(ctx context.Context, key []byte, idx uint64) ([]byte, error) {
+	data, err := s.kv.Get(ctx, listElemKey(key, idx))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// elems the elements at positions [start, stop] of a list
+func (s *_listImpl) elems(ctx context.Context, key []byte, m *listMeta, start, stop int64) ([][]byte, error) {
+	var vals = make([][]byte, 0, stop-start+1)
+	err := s.kv.Range(ctx, listElemKey(key, m.Head+uint64(start)), listElemKey(key, m.Head+uint64(stop)+1), false, func(_, data []byte) bool {
+		vals = append(vals, data)
+		return true
+	})
+	return vals, err
+}
+
+// push append vals to one side of the list m, the meta is not submitted
+func push(key []byte, m *listMeta, left bool, vals [][]byte) []*Submit {
+	var submits = make([]*Submit, 0, len(vals))
+	for _, val := range vals {
+		if left {
+			m.Head--
+			submits = append(submits, NewSubSetSubmit(listElemKey(key, m.Head), val))
+		} else {
+			submits = append(submits, NewSubSetSubmit(listElemKey(key, m.Head+uint64(m.Len)), val))
+		}
+		m.Len++
+	}
+	return submits
+}
+
+// pop remove at most count elements from one side of the list m, the meta is not submitted
+func (s *_listImpl) pop(ctx context.Context, key []byte, m *listMeta, left bool, count int64) ([][]byte, []*Submit, error) {
+	if count > m.Len {
+		count = m.Len
+	}
+	var vals = make([][]byte, 0, count)
+	var submits = make([]*Submit, 0, count)
+	for i := int64(0); i < count; i++ {
+		var idx = m.Head + uint64(m.Len) - 1
+		if left {
+			idx = m.Head
+		}
+		val, err := s.elem(ctx, key, idx)
+		if err != nil {
+			return nil, nil, err
+		}
+		vals = append(vals, val)
+		submits = append(submits, NewSubDelSubmit(listElemKey(key, idx)))
+		if left {
+			m.Head++
+		}
+		m.Len--
+	}
+	return vals, submits, nil
+}
+
+func (s *_listImpl) Push(ctx context.Context, cmd *protocol.PushCmd) []*Submit {
+	m, expired, err := s.getList(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.Vals)+2)
+	if m == nil {
+		if cmd.X {
+			if expired {
+				return []*Submit{NewExDelSubmit(cmd.Key)}
+			}
+			return nil
+		}
+		if expired {
+			submits = append(submits, NewDelSubmit(cmd.Key))
+		}
+		m = &listMeta{Head: listInitHead}
+	}
+	submits = append(submits, push(cmd.Key, m, cmd.Left, cmd.Vals)...)
+	cmd.Len = m.Len
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_listImpl) Pop(ctx context.Context, cmd *protocol.PopCmd) []*Submit {
+	m, expired, err := s.getList(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if m == nil {
+		if expired {
+			return []*Submit{NewExDelSubmit(cmd.Key)}
+		}
+		return nil
+	}
+	if cmd.Count == 0 {
+		cmd.Vals = [][]byte{}
+		return nil
+	}
+	vals, submits, err := s.pop(ctx, cmd.Key, m, cmd.Left, cmd.Count)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Vals = vals
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_listImpl) LLen(ctx context.Context, cmd *protocol.SCardCmd) *Submit {
+	m, expired, err := s.getList(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m != nil {
+		cmd.Count = m.Len
+	}
+	return nil
+}
+
+func (s *_listImpl) LRange(ctx context.Context, cmd *protocol.LRangeCmd) *Submit {
+	m, expired, err := s.getList(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	start, stop, ok := strRange(m.Len, cmd.Start, cmd.Stop)
+	if !ok {
+		return nil
+	}
+	cmd.Vals, cmd.Err = s.elems(ctx, cmd.Key, m, start, stop)
+	return nil
+}
+
+func (s *_listImpl) LIndex(ctx context.Context, cmd *protocol.LIndexCmd) *Submit {
+	m, expired, err := s.getList(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	var index = cmd.Index
+	if index < 0 {
+		index += m.Len
+	}
+	if index < 0 || index >= m.Len {
+		return nil
+	}
+	cmd.Val, cmd.Err = s.elem(ctx, cmd.Key, m.Head+uint64(index))
+	return nil
+}
+
+// LMove pop an element of source and push it to destination in one batch,
+// both metas are the same one when source is destination
+func (s *_listImpl) LMove(ctx context.Context, cmd *protocol.LMoveCmd) []*Submit {
+	src, srcExpired, err := s.getList(ctx, cmd.Src, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, 5)
+	if src == nil {
+		if srcExpired {
+			submits = append(submits, NewExDelSubmit(cmd.Src))
+		}
+		return submits
+	}
+	var dst = src
+	var same = codec.BytesEq(cmd.Src, cmd.Dst)
+	if !same {
+		var dstExpired bool
+		dst, dstExpired, err = s.getList(ctx, cmd.Dst, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if dst == nil {
+			if dstExpired {
+				submits = append(submits, NewDelSubmit(cmd.Dst))
+			}
+			dst = &listMeta{Head: listInitHead}
+		}
+	}
+	vals, sts, err := s.pop(ctx, cmd.Src, src, cmd.FromLeft, 1)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Val = vals[0]
+	submits = append(submits, sts...)
+	submits = append(submits, push(cmd.Dst, dst, cmd.ToLeft, vals)...)
+	if !same {
+		submits = append(submits, src.submit(cmd.Src))
+	}
+	return append(submits, dst.submit(cmd.Dst))
+}
+
+// BPop pop an element from the first non-empty list, cmd.Key is nil if all lists are empty
+func (s *_listImpl) BPop(ctx context.Context, cmd *protocol.BPopCmd) []*Submit {
+	var submits = make([]*Submit, 0, 4)
+	for _, key := range cmd.Keys {
+		m, expired, err := s.getList(ctx, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if m == nil {
+			if expired {
+				submits = append(submits, NewExDelSubmit(key))
+			}
+			continue
+		}
+		vals, sts, err := s.pop(ctx, key, m, cmd.Left, 1)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		cmd.Key, cmd.Val = key, vals[0]
+		submits = append(submits, sts...)
+		return append(submits, m.submit(key))
+	}
+	return submits
+}
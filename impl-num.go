@@ -2,6 +2,9 @@ package gokv
 
 import (
 	"context"
+	"math"
+	"math/big"
+	"strconv"
 
 	"github.com/yixinin/gokv/codec"
 	"github.com/yixinin/gokv/kverror"
@@ -26,37 +29,78 @@ func (n *_numImpl) Incr(ctx context.Context, cmd *protocol.IncrByCmd) *Submit {
 		return nil
 	}
 	oldV := codec.Decode(data)
+	if !oldV.Expired(cmd.Now) && !oldV.IsString() {
+		cmd.Err = kverror.ErrKeyOPType
+		return nil
+	}
 	// set new
-	if oldV.Expired(cmd.Now) || err == kverror.ErrNotFound {
+	if err == kverror.ErrNotFound || oldV.Expired(cmd.Now) {
 		return NewSetRawSubmit(cmd.Key, codec.EncodeInt(cmd.Val).Raw())
 	}
 
 	// incr
-	sumB := bytesAdd(data[9:], codec.Int642Bytes(cmd.Val))
+	i, ok := intValue(oldV)
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return nil
+	}
+	sum, ok := addInt64(i, cmd.Val)
+	if !ok {
+		cmd.Err = kverror.ErrIncrOverflow
+		return nil
+	}
+	cmd.Val = sum
+	return NewSetRawSubmit(cmd.Key, codec.EncodeInt(sum, oldV.ExpireAt()).Raw())
+}
 
-	cmd.Val = codec.Bytes2Int64(sumB)
-	return NewSetRawSubmit(cmd.Key, data)
+func (n *_numImpl) IncrByFloat(ctx context.Context, cmd *protocol.IncrByFloatCmd) *Submit {
+	data, err := n.kv.Get(ctx, cmd.Key)
+	if err != nil && err != kverror.ErrNotFound {
+		cmd.Err = err
+		return nil
+	}
+	oldV := codec.Decode(data)
+	if !oldV.Expired(cmd.Now) && !oldV.IsString() {
+		cmd.Err = kverror.ErrKeyOPType
+		return nil
+	}
+	if err == kverror.ErrNotFound || oldV.Expired(cmd.Now) {
+		cmd.Val = codec.FormatLongDouble(cmd.Incr)
+		return NewSetSubmit(cmd.Key, cmd.Val)
+	}
+
+	f, ok := codec.ParseLongDouble(oldV.StringVal())
+	if !ok {
+		cmd.Err = kverror.ErrNotFloat
+		return nil
+	}
+	sum := new(big.Float).SetPrec(codec.LongDoublePrec).Add(f, cmd.Incr)
+	if codec.IsLongDoubleInf(sum) {
+		cmd.Err = kverror.ErrIncrNaN
+		return nil
+	}
+	cmd.Val = codec.FormatLongDouble(sum)
+	return NewSetSubmit(cmd.Key, cmd.Val, oldV.ExpireAt())
+}
+
+// intValue get the int64 of a value, only int and numeric string values are valid
+func intValue(v codec.Value) (int64, bool) {
+	switch v.Type() {
+	case codec.IntType:
+		return v.Int()
+	case codec.StrType:
+		// like redis string2ll, no sign prefix or leading zeros
+		s := codec.BytesToString(v.Bytes())
+		i, err := strconv.ParseInt(s, 10, 64)
+		return i, err == nil && strconv.FormatInt(i, 10) == s
+	}
+	return 0, false
 }
 
-func bytesAdd(b1, b2 []byte) []byte {
-	if len(b1) != len(b2) || len(b1) == 0 {
-		panic("cannot add bytes with ne size")
-	}
-	var overflow bool
-	var b1i byte
-	for i := len(b1) - 1; i >= 0; i-- {
-		preOverflow := overflow
-		b1i = b1[i]
-		b1[i] = b1[i] + b2[i]
-		if preOverflow {
-			b1[i]++
-		}
-		if b1i == 0 || b2[i] == 0 {
-			overflow = b1[i] < b1i || b1[i] < b2[i]
-		} else {
-			overflow = b1[i] <= b1i || b1[i] <= b2[i]
-		}
-
-	}
-	return b1
+// addInt64 add two int64, returns false if overflow
+func addInt64(a, b int64) (int64, bool) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, false
+	}
+	return a + b, true
 }
@@ -0,0 +1,310 @@
+package gokv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// _revisionImpl the writes of string keys are kept as revisions at the internal keys of their raft
+// index, the value of a revision is the stored value, or empty if the key is deleted or is not a
+// string since the revision. revisions older than the compacted revision of the database are removed
+type _revisionImpl struct {
+	kv kvstore.Kvstore
+	// enabled revisions are recorded, it must be the same on all nodes
+	enabled bool
+}
+
+func NewRevisionImpl(kv kvstore.Kvstore, enabled bool) *_revisionImpl {
+	return &_revisionImpl{
+		kv:      kv,
+		enabled: enabled,
+	}
+}
+
+// revisionPrefix the prefix of the revisions of all keys of a database
+var revisionPrefix = []byte{internalKeyPrefix, revisionKeyTag}
+
+// isRevisionKey whether key keeps the revisions of the database, they are kept by FLUSHDB
+func isRevisionKey(key []byte) bool {
+	return bytes.HasPrefix(key, revisionPrefix) || bytes.Equal(key, revisionCompactKey)
+}
+
+func revisionKey(key []byte, rev uint64) []byte {
+	return subKey(revisionKeyTag, key, codec.Uint642Bytes(rev))
+}
+
+// compactedRevision the revision the database is compacted at
+func (s *_revisionImpl) compactedRevision(ctx context.Context) (uint64, error) {
+	data, err := s.kv.Get(ctx, revisionCompactKey)
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// latestRevision the value of key at the latest revision not after rev, ok is false if there is none
+func (s *_revisionImpl) latestRevision(ctx context.Context, key []byte, rev uint64) (val []byte, ok bool, err error) {
+	prefix := subKeyPrefix(revisionKeyTag, key)
+	err = s.kv.Range(ctx, prefix, revisionKey(key, rev+1), true, func(_, data []byte) bool {
+		val, ok = data, true
+		return false
+	})
+	return val, ok, err
+}
+
+// addRevision record the value of key written at index, nil if key is deleted
+func (s *_revisionImpl) addRevision(ctx context.Context, key, data []byte, index uint64) error {
+	if !s.enabled || isInternalKey(key) {
+		return nil
+	}
+	if data != nil && codec.Decode(data).IsString() {
+		return s.kv.Set(ctx, revisionKey(key, index), data)
+	}
+	// a key which was not a string has no value to record
+	last, ok, err := s.latestRevision(ctx, key, index)
+	if err != nil || !ok || len(last) == 0 {
+		return err
+	}
+	return s.kv.Set(ctx, revisionKey(key, index), []byte{})
+}
+
+// checkRevision the revision must be kept and applied
+func (s *_revisionImpl) checkRevision(ctx context.Context, rev, applied uint64) error {
+	if !s.enabled {
+		return kverror.ErrRevisionDisabled
+	}
+	if rev > applied {
+		return kverror.ErrFutureRevision
+	}
+	compacted, err := s.compactedRevision(ctx)
+	if err != nil {
+		return err
+	}
+	if rev < compacted {
+		return kverror.ErrRevisionCompacted
+	}
+	return nil
+}
+
+func (s *_revisionImpl) GetRev(ctx context.Context, cmd *protocol.GetRevCmd, applied uint64) {
+	if cmd.Err = s.checkRevision(ctx, cmd.Rev, applied); cmd.Err != nil {
+		return
+	}
+	data, ok, err := s.latestRevision(ctx, cmd.Key, cmd.Rev)
+	if err != nil {
+		cmd.Err = err
+		return
+	}
+	if ok && len(data) > 0 {
+		cmd.Val = codec.Decode(data).StringVal()
+	}
+}
+
+func (s *_revisionImpl) History(ctx context.Context, cmd *protocol.HistoryCmd) {
+	if !s.enabled {
+		cmd.Err = kverror.ErrRevisionDisabled
+		return
+	}
+	prefix := subKeyPrefix(revisionKeyTag, cmd.Key)
+	cmd.Revs = []protocol.Revision{}
+	cmd.Err = s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, data []byte) bool {
+		r := protocol.Revision{Rev: binary.BigEndian.Uint64(k[len(prefix):])}
+		if len(data) > 0 {
+			r.Val = codec.Decode(data).StringVal()
+		}
+		cmd.Revs = append(cmd.Revs, r)
+		return true
+	})
+}
+
+// compactSubmits the submits removing at most limit revisions older than rev, the latest revision
+// not after rev of a key is kept if it has a value. done is true if all are removed, then the
+// compacted revision of the database is moved to rev
+func (s *_revisionImpl) compactSubmits(ctx context.Context, rev uint64, limit int) (submits []*Submit, done bool, err error) {
+	if !s.enabled {
+		return nil, true, kverror.ErrRevisionDisabled
+	}
+	compacted, err := s.compactedRevision(ctx)
+	if err != nil || rev <= compacted {
+		return nil, true, err
+	}
+	var prefix = []byte{internalKeyPrefix, revisionKeyTag}
+	// key the revision key prefix of the current key, prev its latest revision not after rev
+	var key, prev []byte
+	var prevEmpty bool
+	var del = func(k []byte) bool {
+		submits = append(submits, NewSubDelSubmit(k))
+		return len(submits) < limit
+	}
+	// finish remove the latest revision of the current key if it has no value
+	var finish = func() bool {
+		if prev != nil && prevEmpty {
+			return del(prev)
+		}
+		return true
+	}
+	done = true
+	err = s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(k, data []byte) bool {
+		if !bytes.Equal(key, k[:len(k)-8]) {
+			if !finish() {
+				done = false
+				return false
+			}
+			key, prev = k[:len(k)-8], nil
+		}
+		if binary.BigEndian.Uint64(k[len(k)-8:]) > rev {
+			return true
+		}
+		if prev != nil && !del(prev) {
+			done = false
+			return false
+		}
+		prev, prevEmpty = k, len(data) == 0
+		return true
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if done && finish() {
+		submits = append(submits, NewSubSetSubmit(revisionCompactKey, codec.Uint642Bytes(rev)))
+	} else {
+		done = false
+	}
+	return submits, done, nil
+}
+
+// flush delete the keys of the database of ctx with prefix. the revisions are kept and the
+// deleted keys are recorded at index, all keys are deleted if the revisions are disabled
+func (s *_revisionImpl) flush(ctx context.Context, prefix []byte, index uint64) error {
+	if !s.enabled {
+		return s.kv.DeletePrefix(ctx, prefix)
+	}
+	var err error
+	var rangeErr = s.kv.Range(ctx, prefix, prefixEnd(prefix), false, func(key, _ []byte) bool {
+		if isRevisionKey(key) {
+			return true
+		}
+		if !isInternalKey(key) {
+			if err = s.addRevision(ctx, key, nil, index); err != nil {
+				return false
+			}
+		}
+		err = s.kv.Delete(ctx, key)
+		return err == nil
+	})
+	if rangeErr != nil {
+		return rangeErr
+	}
+	return err
+}
+
+// swapRevisions keep the revisions with their database after the mapping of db1 and db2 is swapped,
+// the revisions swapped with the data are exchanged back, and the swapped values are recorded at index
+func (s *_revisionImpl) swapRevisions(ctx context.Context, db1, db2 int, index uint64) error {
+	if !s.enabled || db1 == db2 {
+		return nil
+	}
+	ctx1, ctx2 := kvstore.WithDB(ctx, db1), kvstore.WithDB(ctx, db2)
+	revs1, err := s.takeRevisions(ctx1)
+	if err != nil {
+		return err
+	}
+	revs2, err := s.takeRevisions(ctx2)
+	if err != nil {
+		return err
+	}
+	for _, r := range []struct {
+		ctx  context.Context
+		revs []codec.DumpElem
+	}{{ctx1, revs2}, {ctx2, revs1}} {
+		for _, rev := range r.revs {
+			if err := s.kv.Set(r.ctx, rev.Elem, rev.Val); err != nil {
+				return err
+			}
+		}
+		if err := s.recordAll(r.ctx, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// takeRevisions read and delete the revisions of the database of ctx
+func (s *_revisionImpl) takeRevisions(ctx context.Context) (revs []codec.DumpElem, err error) {
+	var collect = func(k, data []byte) bool {
+		revs = append(revs, codec.DumpElem{Elem: append([]byte{}, k...), Val: append([]byte{}, data...)})
+		return true
+	}
+	if err := s.kv.Range(ctx, revisionPrefix, prefixEnd(revisionPrefix), false, collect); err != nil {
+		return nil, err
+	}
+	data, err := s.kv.Get(ctx, revisionCompactKey)
+	if err == nil {
+		collect(revisionCompactKey, data)
+	} else if !errors.Is(err, kverror.ErrNotFound) {
+		return nil, err
+	}
+	for _, rev := range revs {
+		if err := s.kv.Delete(ctx, rev.Elem); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+// recordAll record the value of every key of the database of ctx at index, the keys with
+// revisions which no longer exist are recorded as deleted
+func (s *_revisionImpl) recordAll(ctx context.Context, index uint64) error {
+	var err error
+	var rangeErr = s.kv.Range(ctx, nil, []byte{internalKeyPrefix}, false, func(key, data []byte) bool {
+		// the keys with the same value in both databases are unchanged
+		var last []byte
+		var ok bool
+		if last, ok, err = s.latestRevision(ctx, key, index); err != nil || ok && bytes.Equal(last, data) {
+			return err == nil
+		}
+		err = s.addRevision(ctx, key, data, index)
+		return err == nil
+	})
+	if rangeErr != nil {
+		return rangeErr
+	}
+	if err != nil {
+		return err
+	}
+	// the revision keys are subKeyPrefix(revisionKeyTag, key) with the revision appended
+	var keys [][]byte
+	rangeErr = s.kv.Range(ctx, revisionPrefix, prefixEnd(revisionPrefix), false, func(k, _ []byte) bool {
+		key := k[len(revisionPrefix)+4 : len(k)-8]
+		if len(keys) == 0 || !bytes.Equal(keys[len(keys)-1], key) {
+			keys = append(keys, append([]byte{}, key...))
+		}
+		return true
+	})
+	if rangeErr != nil {
+		return rangeErr
+	}
+	for _, key := range keys {
+		_, err := s.kv.Get(ctx, key)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, kverror.ErrNotFound) {
+			return err
+		}
+		if err := s.addRevision(ctx, key, nil, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package gokv
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// _setImpl sets keep a meta with the cardinality at key and one internal key per member
+type _setImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewSetImpl(kv kvstore.Kvstore) *_setImpl {
+	return &_setImpl{
+		kv: kv,
+	}
+}
+
+func (s *_setImpl) isMember(ctx context.Context, key, member []byte) (bool, error) {
+	_, err := s.kv.Get(ctx, subKey(setKeyTag, key, member))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *_setImpl) members(ctx context.Context, key []byte) [][]byte {
+	prefix := subKeyPrefix(setKeyTag, key)
+	var members = make([][]byte, 0, 8)
+	s.kv.Scan(ctx, func(k, _ []byte) {
+		members = append(members, k[len(prefix):])
+	}, 0, -1, prefix)
+	return members
+}
+
+// loadSet load all members of a set, missing key is an empty set
+func (s *_setImpl) loadSet(ctx context.Context, key []byte, now uint64) ([][]byte, error) {
+	_, ok, _, err := getMeta(ctx, s.kv, key, now, codec.SetType)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return s.members(ctx, key), nil
+}
+
+func (s *_setImpl) SAdd(ctx context.Context, cmd *protocol.SAddCmd) []*Submit {
+	_, ok, expired, err := getMeta(ctx, s.kv, cmd.Key, cmd.Now, codec.SetType)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.Members)+1)
+	if expired {
+		submits = append(submits, NewDelSubmit(cmd.Key))
+	}
+	for _, member := range cmd.Members {
+		if ok {
+			exist, err := s.isMember(ctx, cmd.Key, member)
+			if err != nil {
+				cmd.Err = err
+				return nil
+			}
+			if exist {
+				continue
+			}
+		}
+		submits = append(submits, NewSAddSubmit(cmd.Key, member))
+		cmd.Count++
+	}
+	return submits
+}
+
+func (s *_setImpl) SRem(ctx context.Context, cmd *protocol.SAddCmd) []*Submit {
+	_, ok, expired, err := getMeta(ctx, s.kv, cmd.Key, cmd.Now, codec.SetType)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		if expired {
+			return []*Submit{NewExDelSubmit(cmd.Key)}
+		}
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.Members))
+	for _, member := range cmd.Members {
+		exist, err := s.isMember(ctx, cmd.Key, member)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if exist {
+			submits = append(submits, NewSRemSubmit(cmd.Key, member))
+			cmd.Count++
+		}
+	}
+	return submits
+}
+
+func (s *_setImpl) SCard(ctx context.Context, cmd *protocol.SCardCmd) *Submit {
+	v, ok, expired, err := getMeta(ctx, s.kv, cmd.Key, cmd.Now, codec.SetType)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if ok {
+		cmd.Count = v.Len()
+	}
+	return nil
+}
+
+func (s *_setImpl) SIsMember(ctx context.Context, cmd *protocol.SIsMemberCmd) *Submit {
+	_, ok, expired, err := getMeta(ctx, s.kv, cmd.Key, cmd.Now, codec.SetType)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Exists = make([]bool, len(cmd.Members))
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if !ok {
+		return nil
+	}
+	for i, member := range cmd.Members {
+		cmd.Exists[i], err = s.isMember(ctx, cmd.Key, member)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *_setImpl) SMembers(ctx context.Context, cmd *protocol.SMembersCmd) *Submit {
+	_, ok, expired, err := getMeta(ctx, s.kv, cmd.Key, cmd.Now, codec.SetType)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if ok {
+		cmd.Members = s.members(ctx, cmd.Key)
+	}
+	return nil
+}
+
+// SOp sinter/sunion/sdiff and the store variants, which replace dest in one submit batch
+func (s *_setImpl) SOp(ctx context.Context, cmd *protocol.SOpCmd) []*Submit {
+	var sets = make([][][]byte, 0, len(cmd.Keys))
+	for _, key := range cmd.Keys {
+		members, err := s.loadSet(ctx, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		sets = append(sets, members)
+	}
+	cmd.Members = setOp(cmd.Op, sets)
+	if cmd.Dest == nil {
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.Members)+1)
+	submits = append(submits, NewDelSubmit(cmd.Dest))
+	for _, member := range cmd.Members {
+		submits = append(submits, NewSAddSubmit(cmd.Dest, member))
+	}
+	return submits
+}
+
+func setOp(op string, sets [][][]byte) [][]byte {
+	var res = make([][]byte, 0, len(sets[0]))
+	switch op {
+	case protocol.SetOpUnion:
+		var seen = make(map[string]struct{}, len(sets[0]))
+		for _, members := range sets {
+			for _, m := range members {
+				if _, ok := seen[codec.BytesToString(m)]; !ok {
+					seen[codec.BytesToString(m)] = struct{}{}
+					res = append(res, m)
+				}
+			}
+		}
+	case protocol.SetOpInter, protocol.SetOpDiff:
+		var others = make([]map[string]struct{}, 0, len(sets)-1)
+		for _, members := range sets[1:] {
+			m := make(map[string]struct{}, len(members))
+			for _, member := range members {
+				m[codec.BytesToString(member)] = struct{}{}
+			}
+			others = append(others, m)
+		}
+		for _, m := range sets[0] {
+			var keep = true
+			for _, other := range others {
+				_, in := other[codec.BytesToString(m)]
+				if in != (op == protocol.SetOpInter) {
+					keep = false
+					break
+				}
+			}
+			if keep {
+				res = append(res, m)
+			}
+		}
+	}
+	return res
+}
+
+func (s *_setImpl) SPop(ctx context.Context, cmd *protocol.SRandCmd) []*Submit {
+	members, err := s.loadSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if int64(len(members)) > cmd.Count {
+		members = members[:cmd.Count]
+	}
+	cmd.Members = members
+	var submits = make([]*Submit, 0, len(members))
+	for _, member := range members {
+		submits = append(submits, NewSRemSubmit(cmd.Key, member))
+	}
+	return submits
+}
+
+func (s *_setImpl) SRandMember(ctx context.Context, cmd *protocol.SRandCmd) *Submit {
+	members, err := s.loadSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	// negative count may return the same member multiple times
+	if cmd.Count < 0 {
+		cmd.Members = make([][]byte, 0, -cmd.Count)
+		for i := int64(0); i < -cmd.Count; i++ {
+			cmd.Members = append(cmd.Members, members[rand.Intn(len(members))])
+		}
+		return nil
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if int64(len(members)) > cmd.Count {
+		members = members[:cmd.Count]
+	}
+	cmd.Members = members
+	return nil
+}
+
+// SScan scan set members with the same cursor as scan
+func (s *_setImpl) SScan(ctx context.Context, cmd *protocol.ScanCmd) *Submit {
+	_, ok, expired, err := getMeta(ctx, s.kv, cmd.BaseCmd.Key, cmd.Now, codec.SetType)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.BaseCmd.Key)
+	}
+	if !ok {
+		return nil
+	}
+	if len(cmd.Key) > 0 {
+		exist, err := s.isMember(ctx, cmd.BaseCmd.Key, cmd.Key)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if exist {
+			cmd.Keys = append(cmd.Keys, cmd.Key)
+		}
+		return nil
+	}
+	var limit = -1
+	if cmd.Limit > 0 {
+		limit = int(cmd.Limit)
+	}
+	prefix := subKeyPrefix(setKeyTag, cmd.BaseCmd.Key)
+	cmd.Cursor = s.kv.Scan(ctx, func(k, _ []byte) {
+		cmd.Keys = append(cmd.Keys, k[len(prefix):])
+	}, int(cmd.Cursor), limit, append(prefix, cmd.Prefix...))
+	return nil
+}
+
+// applySAdd add the member key and increase the cardinality
+func (s *RaftKv) applySAdd(ctx context.Context, cmd *Submit) error {
+	mk := subKey(setKeyTag, cmd.Key, cmd.Value)
+	switch _, err := s.db.Get(ctx, mk); err {
+	case nil:
+		return nil
+	case kverror.ErrNotFound:
+	default:
+		return err
+	}
+	var size int64
+	var ex uint64
+	switch data, err := s.db.Get(ctx, cmd.Key); err {
+	case nil:
+		v := codec.Decode(data)
+		if v.Type() != codec.SetType {
+			return kverror.ErrKeyOPType
+		}
+		size, ex = v.Len(), v.ExpireAt()
+	case kverror.ErrNotFound:
+	default:
+		return err
+	}
+	if err := s.db.Set(ctx, mk, nil); err != nil {
+		return err
+	}
+	return s.db.Set(ctx, cmd.Key, codec.EncodeMeta(codec.SetType, size+1, ex).Raw())
+}
+
+// applySRem delete the member key and decrease the cardinality, empty set is deleted
+func (s *RaftKv) applySRem(ctx context.Context, cmd *Submit) error {
+	mk := subKey(setKeyTag, cmd.Key, cmd.Value)
+	switch _, err := s.db.Get(ctx, mk); err {
+	case nil:
+	case kverror.ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+	data, err := s.db.Get(ctx, cmd.Key)
+	if err != nil {
+		return err
+	}
+	v := codec.Decode(data)
+	if v.Type() != codec.SetType {
+		return kverror.ErrKeyOPType
+	}
+	if err := s.db.Delete(ctx, mk); err != nil {
+		return err
+	}
+	if v.Len() <= 1 {
+		return s.db.Delete(ctx, cmd.Key)
+	}
+	return s.db.Set(ctx, cmd.Key, codec.EncodeMeta(codec.SetType, v.Len()-1, v.ExpireAt()).Raw())
+}
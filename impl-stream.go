@@ -0,0 +1,747 @@
+package gokv
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// stream element keys, under the internal prefix of the stream key:
+//
+//	'e' | id               the entry fields
+//	'g' | group            the consumer group
+//	'p' | len(group) | group | id   the pending entry of a group
+//
+// the meta at key holds the length and the last id, so ids keep growing after entries are deleted.
+const (
+	streamEntryTag   byte = 'e'
+	streamGroupTag   byte = 'g'
+	streamPendingTag byte = 'p'
+)
+
+type _streamImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewStreamImpl(kv kvstore.Kvstore) *_streamImpl {
+	return &_streamImpl{
+		kv: kv,
+	}
+}
+
+type streamMeta struct {
+	Len    int64
+	LastID protocol.StreamID
+	ex     uint64
+}
+
+func (m *streamMeta) submit(key []byte) *Submit {
+	return NewSetRawSubmit(key, codec.EncodeMetaExt(codec.StreamType, m.Len, m.LastID.Bytes(), m.ex).Raw())
+}
+
+// streamGroup a consumer group, replicated as a stream element key
+type streamGroup struct {
+	LastID protocol.StreamID `json:"l"`
+	// Consumers the last seen unix milliseconds of consumers
+	Consumers map[string]int64 `json:"c"`
+}
+
+// streamPending an entry delivered to a consumer but not acknowledged
+type streamPending struct {
+	Consumer string `json:"c"`
+	// Time the last delivery unix milliseconds
+	Time  int64 `json:"t"`
+	Count int64 `json:"n"`
+}
+
+func streamEntryKey(key []byte, id protocol.StreamID) []byte {
+	return subKey(streamKeyTag, key, append([]byte{streamEntryTag}, id.Bytes()...))
+}
+
+func streamGroupKey(key, group []byte) []byte {
+	return subKey(streamKeyTag, key, append([]byte{streamGroupTag}, group...))
+}
+
+func streamPendingPrefix(key, group []byte) []byte {
+	p := make([]byte, 5, 5+len(group))
+	p[0] = streamPendingTag
+	binary.BigEndian.PutUint32(p[1:], uint32(len(group)))
+	return subKey(streamKeyTag, key, append(p, group...))
+}
+
+func streamPendingKey(key, group []byte, id protocol.StreamID) []byte {
+	return append(streamPendingPrefix(key, group), id.Bytes()...)
+}
+
+// rangeEnd the exclusive limit key of a range which ends at the inclusive key
+func rangeEnd(key []byte) []byte {
+	return append(key, 0)
+}
+
+func encodeStreamFields(fields [][]byte) []byte {
+	var size int
+	for _, f := range fields {
+		size += 4 + len(f)
+	}
+	buf := make([]byte, 0, size)
+	for _, f := range fields {
+		buf = append(buf, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(buf[len(buf)-4:], uint32(len(f)))
+		buf = append(buf, f...)
+	}
+	return buf
+}
+
+func decodeStreamFields(buf []byte) [][]byte {
+	var fields = make([][]byte, 0, 4)
+	for len(buf) >= 4 {
+		size := binary.BigEndian.Uint32(buf)
+		fields = append(fields, buf[4:4+size])
+		buf = buf[4+size:]
+	}
+	return fields
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// getStream get the live stream meta, nil if key does not exist
+func (s *_streamImpl) getStream(ctx context.Context, key []byte, now uint64) (m *streamMeta, expired bool, err error) {
+	v, ok, expired, err := getMeta(ctx, s.kv, key, now, codec.StreamType)
+	if err != nil || !ok {
+		return nil, expired, err
+	}
+	return &streamMeta{
+		Len:    v.Len(),
+		LastID: protocol.StreamIDFromBytes(v.Ext()),
+		ex:     v.ExpireAt(),
+	}, false, nil
+}
+
+// getGroup get the consumer group of stream key, nil if the stream or group does not exist
+func (s *_streamImpl) getGroup(ctx context.Context, key, group []byte, now uint64) (*streamMeta, *streamGroup, error) {
+	m, _, err := s.getStream(ctx, key, now)
+	if err != nil || m == nil {
+		return nil, nil, err
+	}
+	data, err := s.kv.Get(ctx, streamGroupKey(key, group))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return m, nil, nil
+		}
+		return nil, nil, err
+	}
+	var g streamGroup
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, nil, err
+	}
+	if g.Consumers == nil {
+		g.Consumers = make(map[string]int64)
+	}
+	return m, &g, nil
+}
+
+func groupSubmit(key, group []byte, g *streamGroup) *Submit {
+	data, _ := json.Marshal(g)
+	return NewSubSetSubmit(streamGroupKey(key, group), data)
+}
+
+func pendingSubmit(key, group []byte, id protocol.StreamID, p *streamPending) *Submit {
+	data, _ := json.Marshal(p)
+	return NewSubSetSubmit(streamPendingKey(key, group, id), data)
+}
+
+// entries get entries of [start, end], count < 0 for all
+func (s *_streamImpl) entries(ctx context.Context, key []byte, start, end protocol.StreamID, rev bool, count int64) ([]protocol.StreamEntry, error) {
+	var entries = make([]protocol.StreamEntry, 0, 8)
+	prefix := len(streamEntryKey(key, start)) - 16
+	err := s.kv.Range(ctx, streamEntryKey(key, start), rangeEnd(streamEntryKey(key, end)), rev, func(k, data []byte) bool {
+		entries = append(entries, protocol.StreamEntry{
+			ID:     protocol.StreamIDFromBytes(k[prefix:]),
+			Fields: decodeStreamFields(data),
+		})
+		return count < 0 || int64(len(entries)) < count
+	})
+	return entries, err
+}
+
+// entry get the fields of an entry, nil if it is deleted
+func (s *_streamImpl) entry(ctx context.Context, key []byte, id protocol.StreamID) ([][]byte, error) {
+	data, err := s.kv.Get(ctx, streamEntryKey(key, id))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeStreamFields(data), nil
+}
+
+// pendings iterate the pending entries of [start, end] in a group until f returns false
+func (s *_streamImpl) pendings(ctx context.Context, key, group []byte, start, end protocol.StreamID, f func(id protocol.StreamID, p *streamPending) bool) error {
+	var err error
+	prefix := len(streamPendingPrefix(key, group))
+	rerr := s.kv.Range(ctx, streamPendingKey(key, group, start), rangeEnd(streamPendingKey(key, group, end)), false, func(k, data []byte) bool {
+		var p streamPending
+		if err = json.Unmarshal(data, &p); err != nil {
+			return false
+		}
+		return f(protocol.StreamIDFromBytes(k[prefix:]), &p)
+	})
+	if err != nil {
+		return err
+	}
+	return rerr
+}
+
+// nextID the id of a new entry, which must be greater than the last id
+func nextID(cmd *protocol.XAddCmd, last protocol.StreamID) (protocol.StreamID, error) {
+	switch {
+	case cmd.AutoID:
+		ms := uint64(nowMs())
+		if ms > last.Ms {
+			return protocol.StreamID{Ms: ms}, nil
+		}
+		id, ok := last.Incr()
+		if !ok {
+			return id, kverror.ErrStreamExhausted
+		}
+		return id, nil
+	case cmd.AutoSeq:
+		id := protocol.StreamID{Ms: cmd.ID.Ms}
+		if id.Ms < last.Ms {
+			return id, kverror.ErrStreamIDSmall
+		}
+		if id.Ms == last.Ms {
+			var ok bool
+			if id, ok = last.Incr(); !ok || id.Ms != last.Ms {
+				return id, kverror.ErrStreamIDSmall
+			}
+		}
+		return id, nil
+	}
+	if !last.Less(cmd.ID) {
+		return cmd.ID, kverror.ErrStreamIDSmall
+	}
+	return cmd.ID, nil
+}
+
+// trim delete entries from the head of stream, added is the entry added in the same submit batch
+func (s *_streamImpl) trim(ctx context.Context, key []byte, m *streamMeta, t *protocol.StreamTrim, added *protocol.StreamID) ([]*Submit, int64, error) {
+	var submits = make([]*Submit, 0, 8)
+	var n int64
+	var should = func(id protocol.StreamID) bool {
+		if t.Limit > 0 && n >= t.Limit {
+			return false
+		}
+		if t.Strategy == protocol.StreamTrimMaxLen {
+			return m.Len > t.MaxLen
+		}
+		return id.Less(t.MinID)
+	}
+	prefix := len(streamEntryKey(key, protocol.StreamID{})) - 16
+	err := s.kv.Range(ctx, streamEntryKey(key, protocol.StreamID{}), rangeEnd(streamEntryKey(key, protocol.MaxStreamID)), false, func(k, _ []byte) bool {
+		if !should(protocol.StreamIDFromBytes(k[prefix:])) {
+			return false
+		}
+		submits = append(submits, NewSubDelSubmit(k))
+		m.Len--
+		n++
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if added != nil && should(*added) {
+		submits = append(submits, NewSubDelSubmit(streamEntryKey(key, *added)))
+		m.Len--
+		n++
+	}
+	return submits, n, nil
+}
+
+func (s *_streamImpl) XAdd(ctx context.Context, cmd *protocol.XAddCmd) []*Submit {
+	m, expired, err := s.getStream(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, 4)
+	if m == nil {
+		if cmd.NoMkStream {
+			return nil
+		}
+		if expired {
+			submits = append(submits, NewDelSubmit(cmd.Key))
+		}
+		m = &streamMeta{}
+	}
+	id, err := nextID(cmd, m.LastID)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	submits = append(submits, NewSubSetSubmit(streamEntryKey(cmd.Key, id), encodeStreamFields(cmd.Fields)))
+	m.Len++
+	m.LastID = id
+	if cmd.Trim != nil {
+		trims, _, err := s.trim(ctx, cmd.Key, m, cmd.Trim, &id)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		submits = append(submits, trims...)
+	}
+	cmd.Added = &id
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_streamImpl) XRange(ctx context.Context, cmd *protocol.XRangeCmd) *Submit {
+	m, expired, err := s.getStream(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil || cmd.Empty {
+		return nil
+	}
+	cmd.Entries, cmd.Err = s.entries(ctx, cmd.Key, cmd.Start, cmd.End, cmd.Rev, cmd.Count)
+	return nil
+}
+
+func (s *_streamImpl) XLen(ctx context.Context, cmd *protocol.XLenCmd) *Submit {
+	m, expired, err := s.getStream(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m != nil {
+		cmd.Len = m.Len
+	}
+	return nil
+}
+
+func (s *_streamImpl) XDel(ctx context.Context, cmd *protocol.XDelCmd) []*Submit {
+	m, _, err := s.getStream(ctx, cmd.Key, cmd.Now)
+	if err != nil || m == nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.IDs)+1)
+	var seen = make(map[protocol.StreamID]struct{}, len(cmd.IDs))
+	for _, id := range cmd.IDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ek := streamEntryKey(cmd.Key, id)
+		if _, err := s.kv.Get(ctx, ek); err != nil {
+			if errors.Is(err, kverror.ErrNotFound) {
+				continue
+			}
+			cmd.Err = err
+			return nil
+		}
+		submits = append(submits, NewSubDelSubmit(ek))
+		m.Len--
+		cmd.Count++
+	}
+	if cmd.Count == 0 {
+		return nil
+	}
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_streamImpl) XTrim(ctx context.Context, cmd *protocol.XDelCmd) []*Submit {
+	m, _, err := s.getStream(ctx, cmd.Key, cmd.Now)
+	if err != nil || m == nil {
+		cmd.Err = err
+		return nil
+	}
+	submits, n, err := s.trim(ctx, cmd.Key, m, cmd.Trim, nil)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Count = n
+	if n == 0 {
+		return nil
+	}
+	return append(submits, m.submit(cmd.Key))
+}
+
+// XRead read entries after the ids, returns whether any stream has entries
+func (s *_streamImpl) XRead(ctx context.Context, cmd *protocol.XReadCmd) bool {
+	cmd.Results = cmd.Results[:0]
+	for i, key := range cmd.Keys {
+		m, _, err := s.getStream(ctx, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return false
+		}
+		if cmd.Last[i] {
+			// $ is resolved once, later reads of a blocked client wait for entries after it
+			if m != nil {
+				cmd.IDs[i] = m.LastID
+			}
+			cmd.Last[i] = false
+		}
+		if m == nil {
+			continue
+		}
+		start, ok := cmd.IDs[i].Incr()
+		if !ok || !cmd.IDs[i].Less(m.LastID) {
+			continue
+		}
+		entries, err := s.entries(ctx, key, start, protocol.MaxStreamID, false, cmd.Count)
+		if err != nil {
+			cmd.Err = err
+			return false
+		}
+		if len(entries) > 0 {
+			cmd.Results = append(cmd.Results, protocol.StreamResult{Key: key, Entries: entries})
+		}
+	}
+	return len(cmd.Results) > 0
+}
+
+// XReadGroup deliver new entries to the consumer or read its pending history,
+// the pending entries and the group offset are submitted in one batch
+func (s *_streamImpl) XReadGroup(ctx context.Context, cmd *protocol.XReadCmd) []*Submit {
+	cmd.Results = cmd.Results[:0]
+	var submits = make([]*Submit, 0, 8)
+	var now = nowMs()
+	for i, key := range cmd.Keys {
+		m, g, err := s.getGroup(ctx, key, cmd.Group, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if g == nil {
+			cmd.Err = kverror.ErrNoGroup
+			return nil
+		}
+		g.Consumers[string(cmd.Consumer)] = now
+		if !cmd.New[i] {
+			// history of the consumer's pending entries
+			start, ok := cmd.IDs[i].Incr()
+			var entries = make([]protocol.StreamEntry, 0, 8)
+			if ok {
+				err = s.pendings(ctx, key, cmd.Group, start, protocol.MaxStreamID, func(id protocol.StreamID, p *streamPending) bool {
+					if p.Consumer != string(cmd.Consumer) {
+						return true
+					}
+					var fields [][]byte
+					if fields, err = s.entry(ctx, key, id); err != nil {
+						return false
+					}
+					p.Time = now
+					p.Count++
+					submits = append(submits, pendingSubmit(key, cmd.Group, id, p))
+					entries = append(entries, protocol.StreamEntry{ID: id, Fields: fields})
+					return cmd.Count < 0 || int64(len(entries)) < cmd.Count
+				})
+				if err != nil {
+					cmd.Err = err
+					return nil
+				}
+			}
+			cmd.Results = append(cmd.Results, protocol.StreamResult{Key: key, Entries: entries})
+			submits = append(submits, groupSubmit(key, cmd.Group, g))
+			continue
+		}
+		var entries []protocol.StreamEntry
+		if start, ok := g.LastID.Incr(); ok && g.LastID.Less(m.LastID) {
+			if entries, err = s.entries(ctx, key, start, protocol.MaxStreamID, false, cmd.Count); err != nil {
+				cmd.Err = err
+				return nil
+			}
+		}
+		for _, e := range entries {
+			if !cmd.NoAck {
+				submits = append(submits, pendingSubmit(key, cmd.Group, e.ID, &streamPending{
+					Consumer: string(cmd.Consumer),
+					Time:     now,
+					Count:    1,
+				}))
+			}
+			g.LastID = e.ID
+		}
+		if len(entries) > 0 {
+			cmd.Results = append(cmd.Results, protocol.StreamResult{Key: key, Entries: entries})
+		}
+		submits = append(submits, groupSubmit(key, cmd.Group, g))
+	}
+	return submits
+}
+
+func (s *_streamImpl) XGroup(ctx context.Context, cmd *protocol.XGroupCmd) []*Submit {
+	m, g, err := s.getGroup(ctx, cmd.Key, cmd.Group, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, 2)
+	if m == nil {
+		if cmd.Sub != protocol.XGroupCreate || !cmd.MkStream {
+			cmd.Err = kverror.ErrXGroupKey
+			return nil
+		}
+		m = &streamMeta{}
+		_, expired, _ := s.getStream(ctx, cmd.Key, cmd.Now)
+		if expired {
+			submits = append(submits, NewDelSubmit(cmd.Key))
+		}
+		submits = append(submits, m.submit(cmd.Key))
+	}
+	if cmd.Last {
+		cmd.ID = m.LastID
+	}
+	switch cmd.Sub {
+	case protocol.XGroupCreate:
+		if g != nil {
+			cmd.Err = kverror.ErrBusyGroup
+			return nil
+		}
+		return append(submits, groupSubmit(cmd.Key, cmd.Group, &streamGroup{
+			LastID:    cmd.ID,
+			Consumers: map[string]int64{},
+		}))
+	}
+	if g == nil {
+		if cmd.Sub == protocol.XGroupDestroy {
+			return nil
+		}
+		cmd.Err = kverror.ErrNoGroup
+		return nil
+	}
+	switch cmd.Sub {
+	case protocol.XGroupSetID:
+		g.LastID = cmd.ID
+		return append(submits, groupSubmit(cmd.Key, cmd.Group, g))
+	case protocol.XGroupDestroy:
+		err = s.pendings(ctx, cmd.Key, cmd.Group, protocol.StreamID{}, protocol.MaxStreamID, func(id protocol.StreamID, _ *streamPending) bool {
+			submits = append(submits, NewSubDelSubmit(streamPendingKey(cmd.Key, cmd.Group, id)))
+			return true
+		})
+		cmd.Count = 1
+		submits = append(submits, NewSubDelSubmit(streamGroupKey(cmd.Key, cmd.Group)))
+	case protocol.XGroupCreateConsumer:
+		if _, ok := g.Consumers[string(cmd.Consumer)]; ok {
+			return nil
+		}
+		cmd.Count = 1
+		g.Consumers[string(cmd.Consumer)] = nowMs()
+		submits = append(submits, groupSubmit(cmd.Key, cmd.Group, g))
+	case protocol.XGroupDelConsumer:
+		if _, ok := g.Consumers[string(cmd.Consumer)]; !ok {
+			return nil
+		}
+		// the pending entries of the consumer are deleted too, replies the count of them
+		err = s.pendings(ctx, cmd.Key, cmd.Group, protocol.StreamID{}, protocol.MaxStreamID, func(id protocol.StreamID, p *streamPending) bool {
+			if p.Consumer == string(cmd.Consumer) {
+				submits = append(submits, NewSubDelSubmit(streamPendingKey(cmd.Key, cmd.Group, id)))
+				cmd.Count++
+			}
+			return true
+		})
+		delete(g.Consumers, string(cmd.Consumer))
+		submits = append(submits, groupSubmit(cmd.Key, cmd.Group, g))
+	}
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	return submits
+}
+
+func (s *_streamImpl) XAck(ctx context.Context, cmd *protocol.XAckCmd) []*Submit {
+	_, g, err := s.getGroup(ctx, cmd.Key, cmd.Group, cmd.Now)
+	if err != nil || g == nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, len(cmd.IDs))
+	var seen = make(map[protocol.StreamID]struct{}, len(cmd.IDs))
+	for _, id := range cmd.IDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		pk := streamPendingKey(cmd.Key, cmd.Group, id)
+		if _, err := s.kv.Get(ctx, pk); err != nil {
+			if errors.Is(err, kverror.ErrNotFound) {
+				continue
+			}
+			cmd.Err = err
+			return nil
+		}
+		submits = append(submits, NewSubDelSubmit(pk))
+		cmd.Count++
+	}
+	return submits
+}
+
+func (s *_streamImpl) XPending(ctx context.Context, cmd *protocol.XPendingCmd) *Submit {
+	_, g, err := s.getGroup(ctx, cmd.Key, cmd.Group, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if g == nil {
+		cmd.Err = kverror.ErrNoGroup
+		return nil
+	}
+	var now = nowMs()
+	if cmd.Extended {
+		if cmd.Count == 0 {
+			return nil
+		}
+		cmd.Err = s.pendings(ctx, cmd.Key, cmd.Group, cmd.Start, cmd.End, func(id protocol.StreamID, p *streamPending) bool {
+			if cmd.Consumer != nil && p.Consumer != string(cmd.Consumer) {
+				return true
+			}
+			if idle := now - p.Time; idle >= cmd.MinIdle {
+				cmd.Entries = append(cmd.Entries, protocol.PendingEntry{
+					ID:        id,
+					Consumer:  []byte(p.Consumer),
+					Idle:      idle,
+					Delivered: p.Count,
+				})
+			}
+			return int64(len(cmd.Entries)) < cmd.Count
+		})
+		return nil
+	}
+	var consumers = make(map[string]int64)
+	cmd.Err = s.pendings(ctx, cmd.Key, cmd.Group, protocol.StreamID{}, protocol.MaxStreamID, func(id protocol.StreamID, p *streamPending) bool {
+		if cmd.Total == 0 {
+			cmd.Min = id
+		}
+		cmd.Max = id
+		cmd.Total++
+		consumers[p.Consumer]++
+		return true
+	})
+	for name, count := range consumers {
+		cmd.Consumers = append(cmd.Consumers, protocol.PendingConsumer{Name: []byte(name), Count: count})
+	}
+	sort.Slice(cmd.Consumers, func(i, j int) bool {
+		return string(cmd.Consumers[i].Name) < string(cmd.Consumers[j].Name)
+	})
+	return nil
+}
+
+// XClaim change the owner of pending entries which are idle for at least min-idle-time,
+// xautoclaim scans the pending list from start and deletes the entries which no longer exist
+func (s *_streamImpl) XClaim(ctx context.Context, cmd *protocol.XClaimCmd) []*Submit {
+	_, g, err := s.getGroup(ctx, cmd.Key, cmd.Group, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if g == nil {
+		cmd.Err = kverror.ErrNoGroup
+		return nil
+	}
+	var now = nowMs()
+	var submits = make([]*Submit, 0, 8)
+	var claim = func(id protocol.StreamID, p *streamPending) error {
+		if p == nil || now-p.Time < cmd.MinIdle {
+			return nil
+		}
+		fields, err := s.entry(ctx, cmd.Key, id)
+		if err != nil {
+			return err
+		}
+		if fields == nil {
+			submits = append(submits, NewSubDelSubmit(streamPendingKey(cmd.Key, cmd.Group, id)))
+			cmd.Deleted = append(cmd.Deleted, id)
+			return nil
+		}
+		p.Consumer = string(cmd.Consumer)
+		switch {
+		case cmd.Idle >= 0:
+			p.Time = now - cmd.Idle
+		case cmd.Time >= 0:
+			p.Time = cmd.Time
+		default:
+			p.Time = now
+		}
+		if cmd.RetryCount >= 0 {
+			p.Count = cmd.RetryCount
+		} else if !cmd.JustID {
+			p.Count++
+		}
+		submits = append(submits, pendingSubmit(cmd.Key, cmd.Group, id, p))
+		cmd.Entries = append(cmd.Entries, protocol.StreamEntry{ID: id, Fields: fields})
+		return nil
+	}
+
+	if cmd.Auto {
+		var scanned int64
+		err = s.pendings(ctx, cmd.Key, cmd.Group, cmd.Start, protocol.MaxStreamID, func(id protocol.StreamID, p *streamPending) bool {
+			if scanned >= cmd.Count {
+				cmd.Next = id
+				return false
+			}
+			scanned++
+			if err := claim(id, p); err != nil {
+				cmd.Err = err
+				return false
+			}
+			return true
+		})
+	} else {
+		for _, id := range cmd.IDs {
+			var p *streamPending
+			data, err := s.kv.Get(ctx, streamPendingKey(cmd.Key, cmd.Group, id))
+			switch {
+			case err == nil:
+				p = new(streamPending)
+				err = json.Unmarshal(data, p)
+			case errors.Is(err, kverror.ErrNotFound) && cmd.Force:
+				// FORCE creates the pending entry if the entry exists
+				if fields, ferr := s.entry(ctx, cmd.Key, id); ferr == nil && fields != nil {
+					p = &streamPending{}
+				}
+				err = nil
+			case errors.Is(err, kverror.ErrNotFound):
+				err = nil
+			}
+			if err == nil {
+				err = claim(id, p)
+			}
+			if err != nil {
+				cmd.Err = err
+				return nil
+			}
+		}
+		if cmd.LastID != nil && g.LastID.Less(*cmd.LastID) {
+			g.LastID = *cmd.LastID
+		}
+	}
+	if err != nil || cmd.Err != nil {
+		if cmd.Err == nil {
+			cmd.Err = err
+		}
+		return nil
+	}
+	g.Consumers[string(cmd.Consumer)] = now
+	return append(submits, groupSubmit(cmd.Key, cmd.Group, g))
+}
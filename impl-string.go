@@ -0,0 +1,178 @@
+package gokv
+
+import (
+	"context"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// MaxStringSize the max size of a string value, same as redis proto-max-bulk-len
+const MaxStringSize = 512 * 1024 * 1024
+
+func (s *_baseImpl) Append(ctx context.Context, cmd *protocol.AppendCmd) *Submit {
+	v, ok, err := getString(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		cmd.Len = int64(len(cmd.Val))
+		return NewSetSubmit(cmd.Key, cmd.Val)
+	}
+	old := v.StringVal()
+	if len(old)+len(cmd.Val) > MaxStringSize {
+		cmd.Err = kverror.ErrStringSize
+		return nil
+	}
+	val := make([]byte, 0, len(old)+len(cmd.Val))
+	val = append(append(val, old...), cmd.Val...)
+	cmd.Len = int64(len(val))
+	return NewSetSubmit(cmd.Key, val, v.ExpireAt())
+}
+
+func (s *_baseImpl) StrLen(ctx context.Context, cmd *protocol.StrLenCmd) *Submit {
+	v, ok, err := getString(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	cmd.Len = int64(len(v.StringVal()))
+	return nil
+}
+
+func (s *_baseImpl) GetRange(ctx context.Context, cmd *protocol.GetRangeCmd) *Submit {
+	v, ok, err := getString(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	val := v.StringVal()
+	start, end, ok := strRange(int64(len(val)), cmd.Start, cmd.End)
+	if ok {
+		cmd.Val = append([]byte{}, val[start:end+1]...)
+	}
+	return nil
+}
+
+// strRange convert redis start/end index (may be negative) to [start, end] of a string
+func strRange(size, start, end int64) (int64, int64, bool) {
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if size == 0 || start > end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func (s *_baseImpl) SetRange(ctx context.Context, cmd *protocol.SetRangeCmd) *Submit {
+	v, ok, err := getString(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var old []byte
+	if ok {
+		old = v.StringVal()
+	}
+	if len(cmd.Val) == 0 {
+		cmd.Len = int64(len(old))
+		return nil
+	}
+	if cmd.Offset+int64(len(cmd.Val)) > MaxStringSize {
+		cmd.Err = kverror.ErrStringSize
+		return nil
+	}
+	size := int(cmd.Offset) + len(cmd.Val)
+	if size < len(old) {
+		size = len(old)
+	}
+	val := make([]byte, size)
+	copy(val, old)
+	copy(val[cmd.Offset:], cmd.Val)
+	cmd.Len = int64(size)
+	if !ok {
+		return NewSetSubmit(cmd.Key, val)
+	}
+	return NewSetSubmit(cmd.Key, val, v.ExpireAt())
+}
+
+// GetSet reply the old value and set the new value without ttl
+func (s *_baseImpl) GetSet(ctx context.Context, cmd *protocol.GetSetCmd) *Submit {
+	v, ok, err := getString(ctx, s.kv, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if ok {
+		cmd.Val = append([]byte{}, v.StringVal()...)
+	} else {
+		cmd.Err = kverror.ErrNIL
+	}
+	return NewSetSubmit(cmd.Key, cmd.NewVal)
+}
+
+func (s *_baseImpl) GetDel(ctx context.Context, cmd *protocol.GetCmd) *Submit {
+	data, err := s.kv.Get(ctx, cmd.Key)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	v := codec.Decode(data)
+	if v.Expired(cmd.Now) {
+		cmd.Err = kverror.ErrNIL
+		return NewExDelSubmit(cmd.Key)
+	}
+	if !v.IsString() {
+		cmd.Err = kverror.ErrKeyOPType
+		return nil
+	}
+	cmd.Val = append([]byte{}, v.StringVal()...)
+	return NewDelSubmit(cmd.Key)
+}
+
+func (s *_baseImpl) GetEx(ctx context.Context, cmd *protocol.GetExCmd) *Submit {
+	data, err := s.kv.Get(ctx, cmd.Key)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	v := codec.Decode(data)
+	if v.Expired(cmd.Now) {
+		cmd.Err = kverror.ErrNIL
+		return NewExDelSubmit(cmd.Key)
+	}
+	if !v.IsString() {
+		cmd.Err = kverror.ErrKeyOPType
+		return nil
+	}
+	cmd.Val = append([]byte{}, v.StringVal()...)
+	if !cmd.Update || (cmd.Persist && v.ExpireAt() == 0) {
+		return nil
+	}
+	if cmd.EX > 0 && cmd.Now >= cmd.EX {
+		return NewDelSubmit(cmd.Key)
+	}
+	v.SetExpireAt(cmd.EX)
+	return NewSetRawSubmit(cmd.Key, v.Raw())
+}
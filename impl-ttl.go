@@ -70,6 +70,7 @@ func (t *_ttlImpl) TTL(ctx context.Context, ttl *protocol.TTLCmd) *Submit {
 }
 
 const (
+	// GC_EPOCH the default gc-batch-size
 	GC_EPOCH = 100
 )
 
@@ -79,7 +80,8 @@ func (t *RaftKv) GC(ctx context.Context) {
 			logger.Errorf(ctx, "ttl gc recovered %v, stacks:%s", r, debug.Stack())
 		}
 	}()
-	var Next uint64
+	// next the scan cursor of each database
+	var next []uint64
 	var ticker = time.NewTicker(time.Second)
 	defer ticker.Stop()
 loop:
@@ -93,32 +95,73 @@ loop:
 				ticker.Reset(time.Second)
 				continue loop
 			}
-			func() {
-				defer recover()
-				var nowUnix = uint64(time.Now().Unix())
-
-				var submits = make([]*Submit, 0, GC_EPOCH)
-				var f = func(key, data []byte) {
-					if v := codec.Decode(data); v.Expired(nowUnix) {
-						st := NewExDelSubmit(key)
-						if logger.EnableDebug() {
-							logger.Debugf(ctx, "gc del %s ex:%s, val:%s", key, time.Unix(int64(v.ExpireAt()), 0), v.String())
-						}
-						submits = append(submits, st)
-					}
-				}
-				Next = t.db.Scan(ctx, f, int(Next), GC_EPOCH, nil)
-				if len(submits) > 0 {
-					if logger.EnableDebug() {
-						for _, v := range submits {
-							logger.Debugf(ctx, "push submit: %s", v.Key)
-						}
-					}
-					submit, _ := t.StartSubmit(ctx)
-					submit(submits...)
-				}
-			}()
+			if next == nil {
+				next = make([]uint64, t.dbs.Databases())
+			}
+			var now = uint64(time.Now().Unix())
+			for db := range next {
+				t.gcDB(kvstore.WithDB(ctx, db), &next[db])
+				t.expireLeases(kvstore.WithDB(ctx, db), now)
+				t.compactDB(kvstore.WithDB(ctx, db))
+			}
 			ticker.Reset(time.Second)
 		}
 	}
 }
+
+// gcDB delete the expired keys of the next gc-batch-size keys of a database
+func (t *RaftKv) gcDB(ctx context.Context, next *uint64) {
+	defer recover()
+	var nowUnix = uint64(time.Now().Unix())
+
+	var batch = t.settings.GCBatch()
+	var submits = make([]*Submit, 0, batch)
+	var f = func(key, data []byte) {
+		if isInternalKey(key) {
+			return
+		}
+		if v := codec.Decode(data); v.Expired(nowUnix) {
+			st := NewExDelSubmit(key)
+			if logger.EnableDebug() {
+				logger.Debugf(ctx, "gc del %s ex:%s, val:%s", key, time.Unix(int64(v.ExpireAt()), 0), v.String())
+			}
+			submits = append(submits, st)
+		}
+	}
+	*next = t.db.Scan(ctx, f, int(*next), batch, nil)
+	if len(submits) > 0 {
+		if logger.EnableDebug() {
+			for _, v := range submits {
+				logger.Debugf(ctx, "push submit: %s", v.Key)
+			}
+		}
+		submit, _ := t.StartSubmit(ctx)
+		if _, err := submit(submits...); err == nil {
+			t.metrics.gcDeletes.Add(uint64(len(submits)))
+		}
+	}
+}
+
+// compactDB remove gc-batch-size revisions of a database older than the retention
+func (t *RaftKv) compactDB(ctx context.Context) {
+	retention := t.cfg.ServerCfg.RevisionRetention
+	applied := t.appliedIndex()
+	if retention == 0 || applied <= retention {
+		return
+	}
+	rev := applied - retention
+	// a compaction scans all revisions of the database, it is done in steps of a tenth of the retention
+	compacted, err := t.compactedRevision(ctx)
+	if err != nil || rev < compacted+retention/10 {
+		return
+	}
+	submits, _, err := t.compactSubmits(ctx, rev, t.settings.GCBatch())
+	if err != nil {
+		logger.Errorf(ctx, "compact revisions error:%v", err)
+		return
+	}
+	if len(submits) > 0 {
+		submit, _ := t.StartSubmit(ctx)
+		submit(submits...)
+	}
+}
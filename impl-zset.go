@@ -1 +1,390 @@
 package gokv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// sorted set element keys, under the internal prefix of the zset key:
+//
+//	'm' | member                 the score of member
+//	's' | sortable score | member  empty, members ordered by score then member
+//
+// the meta at key holds the cardinality.
+const (
+	zsetMemberTag byte = 'm'
+	zsetScoreTag  byte = 's'
+)
+
+type _zsetImpl struct {
+	kv kvstore.Kvstore
+}
+
+func NewZSetImpl(kv kvstore.Kvstore) *_zsetImpl {
+	return &_zsetImpl{
+		kv: kv,
+	}
+}
+
+type zsetMeta struct {
+	Len int64
+	ex  uint64
+}
+
+func (m *zsetMeta) submit(key []byte) *Submit {
+	if m.Len == 0 {
+		return NewDelSubmit(key)
+	}
+	return NewSetRawSubmit(key, codec.EncodeMeta(codec.ZSetType, m.Len, m.ex).Raw())
+}
+
+// sortableScore encode a score to bytes ordered as the float values
+func sortableScore(score float64) []byte {
+	if score == 0 {
+		// -0 and 0 are the same score
+		score = 0
+	}
+	bits := math.Float64bits(score)
+	if bits>>63 == 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return codec.Uint642Bytes(bits)
+}
+
+func scoreFromSortable(b []byte) float64 {
+	bits := binary.BigEndian.Uint64(b)
+	if bits>>63 == 1 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+func zsetMemberKey(key, member []byte) []byte {
+	return subKey(zsetKeyTag, key, append([]byte{zsetMemberTag}, member...))
+}
+
+func zsetScorePrefix(key []byte) []byte {
+	return subKey(zsetKeyTag, key, []byte{zsetScoreTag})
+}
+
+func zsetScoreKey(key []byte, score float64, member []byte) []byte {
+	return append(append(zsetScorePrefix(key), sortableScore(score)...), member...)
+}
+
+// getZSet get the live zset meta, nil if key does not exist
+func (s *_zsetImpl) getZSet(ctx context.Context, key []byte, now uint64) (m *zsetMeta, expired bool, err error) {
+	v, ok, expired, err := getMeta(ctx, s.kv, key, now, codec.ZSetType)
+	if err != nil || !ok {
+		return nil, expired, err
+	}
+	return &zsetMeta{
+		Len: v.Len(),
+		ex:  v.ExpireAt(),
+	}, false, nil
+}
+
+// score get the score of member, ok is false if it is not a member
+func (s *_zsetImpl) score(ctx context.Context, key, member []byte) (score float64, ok bool, err error) {
+	data, err := s.kv.Get(ctx, zsetMemberKey(key, member))
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return codec.Bytes2Float(data), true, nil
+}
+
+// rank iterate members ordered by score from rank start until f returns false
+func (s *_zsetImpl) rank(ctx context.Context, key []byte, start int64, rev bool, f func(m protocol.ZMember) bool) error {
+	prefix := zsetScorePrefix(key)
+	var i int64
+	return s.kv.Range(ctx, prefix, prefixEnd(prefix), rev, func(k, _ []byte) bool {
+		if i < start {
+			i++
+			return true
+		}
+		elem := k[len(prefix):]
+		return f(protocol.ZMember{
+			Member: elem[8:],
+			Score:  scoreFromSortable(elem[:8]),
+		})
+	})
+}
+
+// scoreRange iterate members with min <= score < max ordered by score until f returns false
+func (s *_zsetImpl) scoreRange(ctx context.Context, key []byte, min, max float64, f func(m protocol.ZMember) bool) error {
+	prefix := zsetScorePrefix(key)
+	start := append(zsetScorePrefix(key), sortableScore(min)...)
+	limit := append(zsetScorePrefix(key), sortableScore(max)...)
+	return s.kv.Range(ctx, start, limit, false, func(k, _ []byte) bool {
+		elem := k[len(prefix):]
+		return f(protocol.ZMember{
+			Member: elem[8:],
+			Score:  scoreFromSortable(elem[:8]),
+		})
+	})
+}
+
+func zsetSetSubmits(key, member []byte, score float64) []*Submit {
+	return []*Submit{
+		NewSubSetSubmit(zsetMemberKey(key, member), codec.Float2Bytes(score)),
+		NewSubSetSubmit(zsetScoreKey(key, score, member), []byte{}),
+	}
+}
+
+func zsetDelSubmits(key, member []byte, score float64) []*Submit {
+	return []*Submit{
+		NewSubDelSubmit(zsetMemberKey(key, member)),
+		NewSubDelSubmit(zsetScoreKey(key, score, member)),
+	}
+}
+
+func (s *_zsetImpl) ZAdd(ctx context.Context, cmd *protocol.ZAddCmd) []*Submit {
+	m, expired, err := s.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	var submits = make([]*Submit, 0, 2*len(cmd.Members)+2)
+	if m == nil {
+		if expired {
+			submits = append(submits, NewDelSubmit(cmd.Key))
+		}
+		m = &zsetMeta{}
+	}
+	// scores updated by former pairs of the same command
+	var updated = make(map[string]float64, len(cmd.Members))
+	var added, changed int64
+	for _, zm := range cmd.Members {
+		old, exist := updated[string(zm.Member)]
+		if !exist && m.Len > 0 {
+			old, exist, err = s.score(ctx, cmd.Key, zm.Member)
+			if err != nil {
+				cmd.Err = err
+				return nil
+			}
+		}
+		if (cmd.NX && exist) || (cmd.XX && !exist) {
+			continue
+		}
+		var score = zm.Score
+		if cmd.Incr && exist {
+			score += old
+			if math.IsNaN(score) {
+				cmd.Err = kverror.ErrScoreNaN
+				return nil
+			}
+		}
+		if exist && ((cmd.GT && score <= old) || (cmd.LT && score >= old)) {
+			continue
+		}
+		if cmd.Incr {
+			cmd.Score = &score
+		}
+		updated[string(zm.Member)] = score
+		if !exist {
+			submits = append(submits, zsetSetSubmits(cmd.Key, zm.Member, score)...)
+			m.Len++
+			added++
+			continue
+		}
+		if score == old {
+			continue
+		}
+		submits = append(submits, NewSubDelSubmit(zsetScoreKey(cmd.Key, old, zm.Member)))
+		submits = append(submits, zsetSetSubmits(cmd.Key, zm.Member, score)...)
+		changed++
+	}
+	cmd.Count = added
+	if cmd.CH {
+		cmd.Count += changed
+	}
+	if added+changed == 0 {
+		return submits
+	}
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_zsetImpl) ZRem(ctx context.Context, cmd *protocol.SAddCmd) []*Submit {
+	m, expired, err := s.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if m == nil {
+		if expired {
+			return []*Submit{NewExDelSubmit(cmd.Key)}
+		}
+		return nil
+	}
+	var removed = make(map[string]bool, len(cmd.Members))
+	var submits = make([]*Submit, 0, 2*len(cmd.Members)+1)
+	for _, member := range cmd.Members {
+		if removed[string(member)] {
+			continue
+		}
+		score, ok, err := s.score(ctx, cmd.Key, member)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if !ok {
+			continue
+		}
+		removed[string(member)] = true
+		submits = append(submits, zsetDelSubmits(cmd.Key, member, score)...)
+		m.Len--
+		cmd.Count++
+	}
+	if cmd.Count == 0 {
+		return nil
+	}
+	return append(submits, m.submit(cmd.Key))
+}
+
+func (s *_zsetImpl) ZCard(ctx context.Context, cmd *protocol.SCardCmd) *Submit {
+	m, expired, err := s.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m != nil {
+		cmd.Count = m.Len
+	}
+	return nil
+}
+
+func (s *_zsetImpl) ZScore(ctx context.Context, cmd *protocol.ZScoreCmd) *Submit {
+	m, expired, err := s.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	score, ok, err := s.score(ctx, cmd.Key, cmd.Member)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if ok {
+		cmd.Score = &score
+	}
+	return nil
+}
+
+func (s *_zsetImpl) ZRange(ctx context.Context, cmd *protocol.ZRangeCmd) *Submit {
+	m, expired, err := s.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if expired {
+		return NewExDelSubmit(cmd.Key)
+	}
+	if m == nil {
+		return nil
+	}
+	start, stop, ok := strRange(m.Len, cmd.Start, cmd.Stop)
+	if !ok {
+		return nil
+	}
+	cmd.Members = make([]protocol.ZMember, 0, stop-start+1)
+	cmd.Err = s.rank(ctx, cmd.Key, start, cmd.Rev, func(zm protocol.ZMember) bool {
+		cmd.Members = append(cmd.Members, zm)
+		return int64(len(cmd.Members)) < stop-start+1
+	})
+	return nil
+}
+
+// pop remove at most count members with the lowest or highest scores, the meta is not submitted
+func (s *_zsetImpl) pop(ctx context.Context, key []byte, m *zsetMeta, max bool, count int64) ([]protocol.ZMember, []*Submit, error) {
+	if count > m.Len {
+		count = m.Len
+	}
+	var members = make([]protocol.ZMember, 0, count)
+	var submits = make([]*Submit, 0, 2*count)
+	if count == 0 {
+		return members, submits, nil
+	}
+	err := s.rank(ctx, key, 0, max, func(zm protocol.ZMember) bool {
+		members = append(members, zm)
+		submits = append(submits, zsetDelSubmits(key, zm.Member, zm.Score)...)
+		m.Len--
+		return int64(len(members)) < count
+	})
+	return members, submits, err
+}
+
+func (s *_zsetImpl) ZPop(ctx context.Context, cmd *protocol.ZPopCmd) []*Submit {
+	m, expired, err := s.getZSet(ctx, cmd.Key, cmd.Now)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	if m == nil {
+		if expired {
+			return []*Submit{NewExDelSubmit(cmd.Key)}
+		}
+		return nil
+	}
+	members, submits, err := s.pop(ctx, cmd.Key, m, cmd.Max, cmd.Count)
+	if err != nil {
+		cmd.Err = err
+		return nil
+	}
+	cmd.Members = members
+	if len(members) == 0 {
+		return nil
+	}
+	return append(submits, m.submit(cmd.Key))
+}
+
+// BZPop pop a member from the first non-empty zset, cmd.Key is nil if all zsets are empty
+func (s *_zsetImpl) BZPop(ctx context.Context, cmd *protocol.BZPopCmd) []*Submit {
+	var submits = make([]*Submit, 0, 4)
+	for _, key := range cmd.Keys {
+		m, expired, err := s.getZSet(ctx, key, cmd.Now)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if m == nil {
+			if expired {
+				submits = append(submits, NewExDelSubmit(key))
+			}
+			continue
+		}
+		members, sts, err := s.pop(ctx, key, m, cmd.Max, 1)
+		if err != nil {
+			cmd.Err = err
+			return nil
+		}
+		if len(members) == 0 {
+			continue
+		}
+		cmd.Key, cmd.Member = key, members[0]
+		submits = append(submits, sts...)
+		return append(submits, m.submit(key))
+	}
+	return submits
+}
@@ -0,0 +1,194 @@
+package gokv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yixinin/gokv/redis/protocol"
+	"github.com/yixinin/raft"
+)
+
+// redisVersion the redis version INFO reports, tools check it for the commands they use
+const redisVersion = "7.0.0"
+
+// infoWriter write the fields of INFO sections
+type infoWriter struct {
+	strings.Builder
+}
+
+func (w *infoWriter) field(key string, v interface{}) {
+	w.WriteString(key)
+	w.WriteByte(':')
+	fmt.Fprint(w, v)
+	w.WriteString("\r\n")
+}
+
+// infoSections the sections of INFO in order
+var infoSections = []struct {
+	name, title string
+	write       func(n *Server, ctx context.Context, w *infoWriter)
+}{
+	{"server", "Server", (*Server).infoServer},
+	{"clients", "Clients", (*Server).infoClients},
+	{"replication", "Replication", (*Server).infoReplication},
+	{"stats", "Stats", (*Server).infoStats},
+	{"keyspace", "Keyspace", (*Server).infoKeyspace},
+	{"raft", "Raft", (*Server).infoRaft},
+}
+
+// info write the requested sections, it runs on the receive loop
+func (n *Server) info(ctx context.Context, cmd *protocol.InfoCmd) {
+	var w infoWriter
+	for _, section := range infoSections {
+		if !cmd.Wants(section.name) {
+			continue
+		}
+		if w.Len() > 0 {
+			w.WriteString("\r\n")
+		}
+		w.WriteString("# " + section.title + "\r\n")
+		section.write(n, ctx, &w)
+	}
+	cmd.Info = w.String()
+}
+
+func (n *Server) infoServer(ctx context.Context, w *infoWriter) {
+	uptime := time.Since(n.started)
+	w.field("redis_version", redisVersion)
+	w.field("redis_mode", "standalone")
+	w.field("os", runtime.GOOS+" "+runtime.GOARCH)
+	w.field("arch_bits", strconv.IntSize)
+	w.field("go_version", runtime.Version())
+	w.field("process_id", os.Getpid())
+	w.field("run_id", fmt.Sprintf("%040x", n.started.UnixNano()))
+	if node := n.kv.node; node != nil {
+		w.field("tcp_port", node.HTTPPort)
+	}
+	w.field("uptime_in_seconds", int64(uptime.Seconds()))
+	w.field("uptime_in_days", int64(uptime.Hours()/24))
+}
+
+func (n *Server) infoClients(ctx context.Context, w *infoWriter) {
+	var blocked, watching int
+	n.RLock()
+	connected := len(n.clients)
+	for _, c := range n.clients {
+		if c.blocked != nil {
+			blocked++
+		}
+		if c.watch != nil {
+			watching++
+		}
+	}
+	n.RUnlock()
+	w.field("connected_clients", connected)
+	w.field("blocked_clients", blocked)
+	w.field("watching_clients", watching)
+}
+
+// infoReplication the raft followers are the replicas of the leader
+func (n *Server) infoReplication(ctx context.Context, w *infoWriter) {
+	applied := n.kv.appliedIndex()
+	if n.kv.leader != n.kv.nodeID {
+		w.field("role", "slave")
+		if leader := n.kv.getLeader(); leader != nil {
+			w.field("master_host", leader.Host)
+			w.field("master_port", leader.HTTPPort)
+			w.field("master_link_status", "up")
+		} else {
+			w.field("master_link_status", "down")
+		}
+		w.field("slave_repl_offset", applied)
+		w.field("slave_read_only", 1)
+		w.field("connected_slaves", 0)
+		w.field("master_repl_offset", applied)
+		return
+	}
+	w.field("role", "master")
+	var replicas []string
+	if n.kv.rs != nil {
+		status := n.kv.rs.Status(DefaultClusterID)
+		for _, id := range replicaIDs(status.Replicas) {
+			r := status.Replicas[id]
+			node := n.kv.cfg.FindClusterNode(id)
+			if id == n.kv.nodeID || node == nil || !r.Active {
+				continue
+			}
+			state := "online"
+			if r.Snapshoting {
+				state = "wait_bgsave"
+			}
+			replicas = append(replicas, fmt.Sprintf("ip=%s,port=%d,state=%s,offset=%d,lag=%d",
+				node.Host, node.HTTPPort, state, r.Match, int64(time.Since(r.LastActive).Seconds())))
+		}
+	}
+	w.field("connected_slaves", len(replicas))
+	for i, r := range replicas {
+		w.field("slave"+strconv.Itoa(i), r)
+	}
+	w.field("master_repl_offset", applied)
+}
+
+func (n *Server) infoStats(ctx context.Context, w *infoWriter) {
+	m := n.kv.metrics
+	w.field("total_connections_received", m.connections.Value())
+	w.field("total_commands_processed", m.commands.Total())
+	w.field("expired_keys", m.gcDeletes.Value())
+	w.field("expired_leases", m.expiredLeases.Value())
+	w.field("total_raft_proposals", m.proposals.Value())
+	w.field("total_raft_proposal_failures", m.proposalFailures.Value())
+}
+
+// infoKeyspace the key counts of the databases with keys, keys with ttl are not counted
+func (n *Server) infoKeyspace(ctx context.Context, w *infoWriter) {
+	for db := range n.kv.keyCounts {
+		if keys := atomic.LoadInt64(&n.kv.keyCounts[db]); keys > 0 {
+			w.field("db"+strconv.Itoa(db), fmt.Sprintf("keys=%d,expires=0,avg_ttl=0", keys))
+		}
+	}
+}
+
+func (n *Server) infoRaft(ctx context.Context, w *infoWriter) {
+	w.field("raft_node_id", n.kv.nodeID)
+	if n.kv.rs == nil {
+		w.field("raft_state", "stopped")
+		return
+	}
+	status := n.kv.rs.Status(DefaultClusterID)
+	w.field("raft_state", status.State)
+	w.field("raft_term", status.Term)
+	w.field("raft_leader", status.Leader)
+	w.field("raft_applied_index", n.kv.appliedIndex())
+	w.field("raft_commit_index", status.Commit)
+	w.field("raft_last_index", status.Index)
+	w.field("raft_replicas", len(status.Replicas))
+	for i, id := range replicaIDs(status.Replicas) {
+		r := status.Replicas[id]
+		w.field("raft_replica"+strconv.Itoa(i), fmt.Sprintf("id=%d,match=%d,commit=%d,next=%d,state=%s,active=%d,paused=%d,snapshotting=%d,inflight=%d",
+			id, r.Match, r.Commit, r.Next, r.State, boolInt(r.Active), boolInt(r.Paused), boolInt(r.Snapshoting), r.Inflight))
+	}
+}
+
+// replicaIDs the ids of the replicas in order
+func replicaIDs(replicas map[uint64]*raft.ReplicaStatus) []uint64 {
+	ids := make([]uint64, 0, len(replicas))
+	for id := range replicas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
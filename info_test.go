@@ -0,0 +1,27 @@
+package gokv_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17701)
+	cli.Set(ctx, "k", "v", 0)
+
+	info, err := cli.Info(ctx).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{"# Server\r\n", "redis_version:", "role:master", "connected_clients:1", "db0:keys=", "# Raft\r\n", "raft_term:"} {
+		if !strings.Contains(info, expect) {
+			t.Errorf("info missing %q", expect)
+		}
+	}
+	info, _ = cli.Info(ctx, "replication").Result()
+	if !strings.HasPrefix(info, "# Replication\r\n") || strings.Contains(info, "# Server") {
+		t.Errorf("replication section %q", info)
+	}
+}
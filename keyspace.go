@@ -0,0 +1,239 @@
+package gokv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// elements of composite types are stored in internal keys:
+//
+//	0xff | type tag | len(key) uint32 | key | element
+//
+// internal keys sort after normal keys and are hidden from keys/scan.
+const internalKeyPrefix byte = 0xff
+
+const (
+	setKeyTag    byte = 's'
+	streamKeyTag byte = 'x'
+	listKeyTag   byte = 'l'
+	zsetKeyTag   byte = 'z'
+	hashKeyTag   byte = 'h'
+	// revisionKeyTag the revisions of a string key
+	revisionKeyTag byte = 'r'
+	// leaseKeyTag the ttl and expire time of a lease at 0xff | tag | id
+	leaseKeyTag byte = 'e'
+	// leaseAttachTag the keys attached to a lease, they are the elements of the lease id
+	leaseAttachTag byte = 'a'
+	// keyLeaseTag the lease id a key is attached to
+	keyLeaseTag byte = 'k'
+)
+
+// keyCountKey the internal key of the replicated key counter
+var keyCountKey = []byte{internalKeyPrefix, '#'}
+
+// revisionCompactKey the revision the revisions of a database are compacted at
+var revisionCompactKey = []byte{internalKeyPrefix, 'R'}
+
+func isInternalKey(key []byte) bool {
+	return len(key) > 0 && key[0] == internalKeyPrefix
+}
+
+// subKeyTag the internal key tag of a composite type
+func subKeyTag(t uint8) byte {
+	switch t {
+	case codec.SetType:
+		return setKeyTag
+	case codec.StreamType:
+		return streamKeyTag
+	case codec.ListType:
+		return listKeyTag
+	case codec.ZSetType:
+		return zsetKeyTag
+	case codec.HashType:
+		return hashKeyTag
+	}
+	return 0
+}
+
+// typeName the redis type name of a value type
+func typeName(t uint8) string {
+	switch t {
+	case codec.SetType:
+		return "set"
+	case codec.StreamType:
+		return "stream"
+	case codec.ListType:
+		return "list"
+	case codec.ZSetType:
+		return "zset"
+	case codec.HashType:
+		return "hash"
+	}
+	return "string"
+}
+
+// subKeyPrefix the prefix of all element keys of key
+func subKeyPrefix(tag byte, key []byte) []byte {
+	p := make([]byte, 6, 6+len(key))
+	p[0] = internalKeyPrefix
+	p[1] = tag
+	binary.BigEndian.PutUint32(p[2:], uint32(len(key)))
+	return append(p, key...)
+}
+
+func subKey(tag byte, key, elem []byte) []byte {
+	return append(subKeyPrefix(tag, key), elem...)
+}
+
+// prefixEnd the exclusive limit key of all keys with prefix, nil if there is no limit
+func prefixEnd(prefix []byte) []byte {
+	limit := append([]byte{}, prefix...)
+	for i := len(limit) - 1; i >= 0; i-- {
+		if limit[i] < 0xff {
+			limit[i]++
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// getMeta get the live meta of a composite key and check its type,
+// expired reports whether an expired value should be deleted before reusing the key
+func getMeta(ctx context.Context, kv kvstore.Kvstore, key []byte, now uint64, t uint8) (v codec.Value, ok, expired bool, err error) {
+	data, err := kv.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return v, false, false, nil
+		}
+		return v, false, false, err
+	}
+	v = codec.Decode(data)
+	if v.Expired(now) {
+		return v, false, true, nil
+	}
+	if v.Type() != t {
+		return v, false, false, kverror.ErrKeyOPType
+	}
+	return v, true, false, nil
+}
+
+// clearSubKeys delete the element keys if key holds a composite value of another type than t
+func (s *RaftKv) clearSubKeys(ctx context.Context, key []byte, t uint8) error {
+	data, err := s.db.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, kverror.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	old := codec.Decode(data).Type()
+	if !codec.IsComposite(old) || old == t {
+		return nil
+	}
+	return s.db.DeletePrefix(ctx, subKeyPrefix(subKeyTag(old), key))
+}
+
+// keyExists whether key is stored, expired keys are counted until they are deleted
+func (s *RaftKv) keyExists(ctx context.Context, key []byte) bool {
+	_, err := s.db.Get(ctx, key)
+	return err == nil
+}
+
+// countKey update the key counter after applying a write to key
+func (s *RaftKv) countKey(ctx context.Context, key []byte, existed bool) {
+	switch exists := s.keyExists(ctx, key); {
+	case exists && !existed:
+		s.setKeyCount(ctx, atomic.AddInt64(s.keyCount(ctx), 1))
+	case !exists && existed:
+		s.setKeyCount(ctx, atomic.AddInt64(s.keyCount(ctx), -1))
+	}
+}
+
+// keyCount the key counter of the database of ctx
+func (s *RaftKv) keyCount(ctx context.Context) *int64 {
+	return &s.keyCounts[kvstore.DBFromContext(ctx)]
+}
+
+func (s *RaftKv) setKeyCount(ctx context.Context, n int64) {
+	atomic.StoreInt64(s.keyCount(ctx), n)
+	if err := s.db.Set(ctx, keyCountKey, codec.Int642Bytes(n)); err != nil {
+		logger.Errorf(ctx, "save key count %d error:%v", n, err)
+	}
+}
+
+// loadKeyCounts load the key counters, data written before the counters existed is counted once
+func (s *RaftKv) loadKeyCounts(ctx context.Context) {
+	s.keyCounts = make([]int64, s.dbs.Databases())
+	for db := range s.keyCounts {
+		ctx := kvstore.WithDB(ctx, db)
+		data, err := s.db.Get(ctx, keyCountKey)
+		if err == nil {
+			atomic.StoreInt64(s.keyCount(ctx), codec.Bytes2Int64(data))
+			continue
+		}
+		var n int64
+		err = s.db.Range(ctx, nil, []byte{internalKeyPrefix}, false, func(key, data []byte) bool {
+			n++
+			return true
+		})
+		if err != nil {
+			logger.Errorf(ctx, "count keys of db %d error:%v", db, err)
+			continue
+		}
+		s.setKeyCount(ctx, n)
+	}
+}
+
+// DBSize the number of keys in O(1)
+func (s *RaftKv) DBSize(ctx context.Context, cmd *protocol.DBSizeCmd) {
+	cmd.Size = atomic.LoadInt64(s.keyCount(ctx))
+}
+
+// applySwapDB swap the data of two databases, the revisions stay with their databases. the clients blocked on them retry
+func (s *RaftKv) applySwapDB(ctx context.Context, db1, db2 int, index uint64) error {
+	if err := s.dbs.Swap(ctx, db1, db2); err != nil {
+		return err
+	}
+	if err := s.swapRevisions(ctx, db1, db2, index); err != nil {
+		return err
+	}
+	c1, c2 := atomic.LoadInt64(&s.keyCounts[db1]), atomic.LoadInt64(&s.keyCounts[db2])
+	atomic.StoreInt64(&s.keyCounts[db1], c2)
+	atomic.StoreInt64(&s.keyCounts[db2], c1)
+	s.waits.TouchDB(db1)
+	s.waits.TouchDB(db2)
+	return nil
+}
+
+// applyCopy replace the destination key of another database with the source key of ctx database
+func (s *RaftKv) applyCopy(ctx context.Context, cmd *Submit, index uint64) error {
+	if len(cmd.Value) < codec.NumberSize {
+		return kverror.ErrCommandArgs
+	}
+	db, dst := int(codec.Bytes2Int64(cmd.Value[:codec.NumberSize])), cmd.Value[codec.NumberSize:]
+	v, ok, err := getLive(ctx, s.db, cmd.Key, uint64(time.Now().Unix()))
+	if err != nil || !ok {
+		return err
+	}
+	submits, err := s.copySubmits(ctx, cmd.Key, dst, v)
+	if err != nil {
+		return err
+	}
+	dctx := kvstore.WithDB(ctx, db)
+	for _, st := range submits {
+		if err := s.apply(dctx, st, index); err != nil {
+			return err
+		}
+	}
+	s.waits.Touch(db, dst)
+	return nil
+}
@@ -0,0 +1,196 @@
+package gokv_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDatabases(t *testing.T) {
+	ctx := context.Background()
+	cfg := nodeConfig(t, 17781)
+	_, cli, stop := startNode(t, cfg, 17781)
+	db1 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17781", DB: 1})
+	defer db1.Close()
+
+	// SELECT
+	cli.Set(ctx, "k", "0", 0)
+	db1.Set(ctx, "k", "1", 0)
+	db1.RPush(ctx, "list", "a", "b")
+	if v := cli.Get(ctx, "k").Val(); v != "0" {
+		t.Errorf("db 0 k %q", v)
+	}
+	if v := db1.Get(ctx, "k").Val(); v != "1" {
+		t.Errorf("db 1 k %q", v)
+	}
+	if n := cli.Exists(ctx, "list").Val(); n != 0 {
+		t.Error("db 1 list in db 0")
+	}
+	if err := cli.Do(ctx, "SELECT", 16).Err(); err == nil {
+		t.Error("select out of the databases should fail")
+	}
+
+	// MOVE
+	cli.Set(ctx, "m", "moved", 0)
+	if ok := cli.Move(ctx, "m", 1).Val(); !ok {
+		t.Error("move m failed")
+	}
+	if v := db1.Get(ctx, "m").Val(); v != "moved" || cli.Exists(ctx, "m").Val() != 0 {
+		t.Errorf("moved m %q", v)
+	}
+	if ok := cli.Move(ctx, "k", 1).Val(); ok {
+		t.Error("move to an existing key should fail")
+	}
+	if v := cli.Get(ctx, "k").Val(); v != "0" {
+		t.Errorf("k %q after the failed move", v)
+	}
+	if ok := cli.Move(ctx, "nokey", 1).Val(); ok {
+		t.Error("move a missing key should fail")
+	}
+
+	// SWAPDB
+	if err := cli.Do(ctx, "SWAPDB", 0, 1).Err(); err != nil {
+		t.Fatal(err)
+	}
+	var check = func(cli, db1 *redis.Client) {
+		if v := cli.Get(ctx, "k").Val(); v != "1" {
+			t.Errorf("db 0 k %q after swapdb", v)
+		}
+		if v := cli.LRange(ctx, "list", 0, -1).Val(); len(v) != 2 {
+			t.Errorf("db 0 list %v after swapdb", v)
+		}
+		if v := db1.Get(ctx, "k").Val(); v != "0" {
+			t.Errorf("db 1 k %q after swapdb", v)
+		}
+		if n := cli.DBSize(ctx).Val(); n != 3 {
+			t.Errorf("db 0 dbsize %d after swapdb", n)
+		}
+		if n := db1.DBSize(ctx).Val(); n != 1 {
+			t.Errorf("db 1 dbsize %d after swapdb", n)
+		}
+	}
+	check(cli, db1)
+
+	// the swapped databases survive a restart
+	stop()
+	_, cli, stop = startNode(t, cfg, 17782)
+	defer stop()
+	db1 = redis.NewClient(&redis.Options{Addr: "127.0.0.1:17782", DB: 1})
+	defer db1.Close()
+	check(cli, db1)
+}
+
+func TestDBSize(t *testing.T) {
+	ctx := context.Background()
+	cfg := nodeConfig(t, 17791)
+	_, cli, stop := startNode(t, cfg, 17791)
+	var expect = func(step string, want int64) {
+		t.Helper()
+		if n := cli.DBSize(ctx).Val(); n != want {
+			t.Errorf("dbsize %d after %s, want %d", n, step, want)
+		}
+	}
+	expect("start", 0)
+	cli.Set(ctx, "a", "1", 0)
+	cli.Set(ctx, "b", "2", 0)
+	cli.Set(ctx, "a", "3", 0)
+	expect("set", 2)
+	cli.RPush(ctx, "list", "x")
+	cli.SAdd(ctx, "set", "x")
+	expect("rpush and sadd", 4)
+
+	cli.Rename(ctx, "a", "c")
+	expect("rename", 4)
+	cli.Rename(ctx, "c", "b")
+	expect("rename over a key", 3)
+	cli.RenameNX(ctx, "b", "list")
+	expect("renamenx to an existing key", 3)
+	cli.RenameNX(ctx, "b", "a")
+	expect("renamenx", 3)
+
+	cli.Copy(ctx, "a", "c", 0, false)
+	expect("copy", 4)
+	cli.Copy(ctx, "a", "c", 0, true)
+	expect("copy replace", 4)
+	cli.Copy(ctx, "nokey", "d", 0, false)
+	expect("copy of a missing key", 4)
+
+	cli.Del(ctx, "c", "nokey")
+	expect("del", 3)
+	cli.LPop(ctx, "list")
+	expect("pop of the last element", 2)
+
+	// reading an expired key deletes it, the expire times are in seconds
+	cli.Set(ctx, "e", "1", time.Second)
+	expect("set px", 3)
+	time.Sleep(2 * time.Second)
+	if err := cli.Get(ctx, "e").Err(); err != redis.Nil {
+		t.Errorf("get of the expired key %v", err)
+	}
+	expect("expired", 2)
+
+	// the counters are internal keys the clients can not write
+	for _, key := range []string{"\xff#", "\xffR"} {
+		if err := cli.Set(ctx, key, "x", 0).Err(); err == nil || err.Error() != "ERR keys starting with 0xff are reserved" {
+			t.Errorf("set %q %v", key, err)
+		}
+	}
+	expect("set of the counter", 2)
+
+	// the counters are loaded on restart
+	stop()
+	_, cli, stop = startNode(t, cfg, 17792)
+	defer stop()
+	expect("restart", 2)
+	cli.FlushDB(ctx)
+	expect("flushdb", 0)
+	cli.Set(ctx, "a", "1", 0)
+	expect("set after flushdb", 1)
+}
+
+func TestMSetNX(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18171)
+	if n, err := cli.MSetNX(ctx, "a", "1", "b", "2").Result(); err != nil || !n {
+		t.Fatalf("msetnx %v %v", n, err)
+	}
+	if n, _ := cli.MSetNX(ctx, "b", "3", "c", "3").Result(); n || cli.Exists(ctx, "c").Val() != 0 {
+		t.Errorf("msetnx with an existing key %v", n)
+	}
+	cli.Set(ctx, "old", "v", time.Second)
+	time.Sleep(2100 * time.Millisecond)
+	if n, _ := cli.MSetNX(ctx, "old", "new", "d", "4").Result(); !n || cli.Get(ctx, "old").Val() != "new" {
+		t.Errorf("msetnx of an expired key %v", n)
+	}
+
+	// the keys are checked when applied, so only one of the concurrent calls sets its keys
+	var wg sync.WaitGroup
+	var set = make([]bool, 8)
+	for i := range set {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			set[i], _ = cli.MSetNX(ctx, "shared", i, "own:"+strconv.Itoa(i), i).Result()
+		}(i)
+	}
+	wg.Wait()
+	var winners int
+	for i, ok := range set {
+		if ok {
+			winners++
+			if v := cli.Get(ctx, "shared").Val(); v != strconv.Itoa(i) {
+				t.Errorf("shared %q set by %d", v, i)
+			}
+		}
+		if n := cli.Exists(ctx, "own:"+strconv.Itoa(i)).Val(); (n == 1) != ok {
+			t.Errorf("own key of %d exists %d, set %v", i, n, ok)
+		}
+	}
+	if winners != 1 {
+		t.Errorf("%d concurrent msetnx succeeded", winners)
+	}
+}
@@ -16,6 +16,61 @@ var ErrCommandArgs = errors.New("command args error")
 var ErrCommandNotSupport = errors.New("command not support")
 var ErrNotImpl = errors.New("not impl")
 
+var ErrSyntax = errors.New("ERR syntax error")
+var ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+var ErrNotFloat = errors.New("ERR value is not a valid float")
+var ErrIncrOverflow = errors.New("ERR increment or decrement would overflow")
+var ErrIncrNaN = errors.New("ERR increment would produce NaN or Infinity")
+var ErrBitOffset = errors.New("ERR bit offset is not an integer or out of range")
+var ErrBitValue = errors.New("ERR bit is not an integer or out of range")
+var ErrBitOpNot = errors.New("ERR BITOP NOT must be called with a single source key.")
+var ErrBitFieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+var ErrBitFieldOverflow = errors.New("ERR Invalid OVERFLOW type specified")
+var ErrBitFieldRO = errors.New("ERR BITFIELD_RO only supports the GET subcommand")
+var ErrInvalidExpire = errors.New("ERR invalid expire time")
+var ErrOffsetRange = errors.New("ERR offset is out of range")
+var ErrStringSize = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+var ErrPositive = errors.New("ERR value is out of range, must be positive")
+var ErrStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+var ErrStreamIDZero = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+var ErrStreamIDSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+var ErrStreamExhausted = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+var ErrStreamTrimLimit = errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+var ErrUnbalancedStreams = errors.New("ERR Unbalanced list of streams: for each stream key an ID must be specified")
+var ErrTimeoutNegative = errors.New("ERR timeout is negative")
+var ErrTimeoutFloat = errors.New("ERR timeout is not a float or out of range")
+var ErrXAutoClaimCount = errors.New("ERR COUNT must be > 0")
+var ErrXGroupKey = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+var ErrNoGroup = errors.New("NOGROUP No such key or consumer group")
+var ErrBusyGroup = errors.New("BUSYGROUP Consumer Group name already exists")
+var ErrZAddXXNX = errors.New("ERR XX and NX options at the same time are not compatible")
+var ErrZAddGTLTNX = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+var ErrZAddIncr = errors.New("ERR INCR option supports a single increment-element pair")
+var ErrScoreNaN = errors.New("ERR resulting score is not a number (NaN)")
+var ErrHashNotInteger = errors.New("ERR hash value is not an integer")
+var ErrHashNotFloat = errors.New("ERR hash value is not a float")
+var ErrGeoUnit = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+var ErrGeoMember = errors.New("ERR could not decode requested zset member")
+var ErrGeoFrom = errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+var ErrGeoBy = errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+var ErrGeoAny = errors.New("ERR the ANY argument requires COUNT argument")
+var ErrGeoCount = errors.New("ERR COUNT must be > 0")
+var ErrGeoRadius = errors.New("ERR radius cannot be negative")
+var ErrGeoBox = errors.New("ERR height or width cannot be negative")
+var ErrGeoStore = errors.New("ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORDS options")
+var ErrNoSuchKey = errors.New("ERR no such key")
+var ErrSameObject = errors.New("ERR source and destination objects are the same")
+var ErrReservedKey = errors.New("ERR keys starting with 0xff are reserved")
+var ErrDBIndex = errors.New("ERR DB index is out of range")
+var ErrDBIndexFirst = errors.New("ERR invalid first DB index")
+var ErrDBIndexSecond = errors.New("ERR invalid second DB index")
+var ErrBusyKey = errors.New("BUSYKEY Target key name already exists.")
+var ErrDumpPayload = errors.New("ERR DUMP payload version or checksum are wrong")
+var ErrInvalidTTL = errors.New("ERR Invalid TTL value, must be >= 0")
+var ErrMigrateKeys = errors.New("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+var ErrMigrateConnect = errors.New("IOERR error or timeout connecting to the client")
+var ErrMigrateIO = errors.New("IOERR error or timeout reading to target instance")
+
 type KvError struct {
 	Code     int      `json:"-"`
 	Messages []string `json:"-"`
@@ -84,3 +139,19 @@ func NewError(code int, msg string) error {
 	e.Stack = getStacks()
 	return e
 }
+
+var ErrWatchCompacted = errors.New("ERR required index has been compacted")
+var ErrWatchLagged = errors.New("ERR watch lagged behind the changes, watch again")
+var ErrWatching = errors.New("ERR the connection is watching, KVUNWATCH first")
+var ErrWatchContext = errors.New("ERR only KVUNWATCH / PING are allowed in this context")
+var ErrRevisionDisabled = errors.New("ERR revisions are not recorded, set revision-retention")
+var ErrRevisionCompacted = errors.New("ERR required revision has been compacted")
+var ErrFutureRevision = errors.New("ERR required revision is a future revision")
+var ErrLeaseNotFound = errors.New("ERR requested lease not found")
+var ErrInvalidLeaseTTL = errors.New("ERR invalid lease TTL, must be > 0")
+var ErrNoConfigFile = errors.New("ERR The server is running without a config file")
+var ErrMaxClients = errors.New("ERR max number of clients reached")
+var ErrMonitorContext = errors.New("ERR only PING is allowed in the MONITOR context")
+var ErrNoSuchClient = errors.New("ERR No such client")
+var ErrInvalidClientID = errors.New("ERR client-id should be greater than 0")
+var ErrClientName = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
@@ -0,0 +1,274 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore/leveldb"
+)
+
+// logical databases are key ranges prefixed by a 2 bytes slot number.
+// a database maps to a slot, so swapping databases only swaps the mapping.
+const (
+	slotSize = 2
+	// metaSlot the slot of the store meta keys, it is never mapped
+	metaSlot = 0xffff
+	// MaxDatabases the max number of databases
+	MaxDatabases = metaSlot
+)
+
+var slotsKey = append(slotPrefix(metaSlot), "slots"...)
+
+type dbKey struct{}
+
+type txnKey struct{}
+
+// WithDB set the database of the store operations with ctx
+func WithDB(ctx context.Context, db int) context.Context {
+	return context.WithValue(ctx, dbKey{}, db)
+}
+
+// DBFromContext the database of ctx, 0 by default
+func DBFromContext(ctx context.Context) int {
+	db, _ := ctx.Value(dbKey{}).(int)
+	return db
+}
+
+func slotPrefix(slot uint16) []byte {
+	var p = make([]byte, slotSize)
+	binary.BigEndian.PutUint16(p, slot)
+	return p
+}
+
+// DBStore a Kvstore of multiple databases, keys are prefixed by the slot of the database of ctx
+type DBStore struct {
+	kv Kvstore
+
+	sync.RWMutex
+	slots []uint16
+}
+
+// NewDBStore open the databases of kv, the mapping of swapped databases is loaded from kv
+func NewDBStore(ctx context.Context, kv Kvstore, databases int) (*DBStore, error) {
+	if databases <= 0 || databases > MaxDatabases {
+		return nil, kverror.ErrDBIndex
+	}
+	s := &DBStore{
+		kv:    kv,
+		slots: make([]uint16, databases),
+	}
+	if err := s.loadSlots(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadSlots load the mapping of databases to slots, a store without the mapping is upgraded
+func (s *DBStore) loadSlots(ctx context.Context) error {
+	var databases = len(s.slots)
+	var used = make(map[uint16]bool, databases)
+	data, err := s.kv.Get(ctx, slotsKey)
+	var saved = err == nil
+	if err != nil && !errors.Is(err, kverror.ErrNotFound) {
+		return err
+	}
+	for i := 0; i+slotSize <= len(data) && i/slotSize < databases; i += slotSize {
+		slot := binary.BigEndian.Uint16(data[i:])
+		s.slots[i/slotSize] = slot
+		used[slot] = true
+	}
+	// databases added since the mapping was saved use the free slots in order
+	var next uint16
+	for db := len(data) / slotSize; db < databases; db++ {
+		for used[next] {
+			next++
+		}
+		s.slots[db] = next
+		used[next] = true
+	}
+	if !saved {
+		return s.upgrade(ctx)
+	}
+	return nil
+}
+
+// upgrade move the keys of a store of the versions before the databases into database 0, and save
+// the mapping in the same batch. the mapping is saved on the first open, so the keys are moved once
+func (s *DBStore) upgrade(ctx context.Context) error {
+	if p, ok := s.kv.(interface {
+		PrefixAll(ctx context.Context, prefix, key, val []byte) error
+	}); ok {
+		return p.PrefixAll(ctx, slotPrefix(s.slots[0]), slotsKey, s.slotsData())
+	}
+	// the stores in memory are always empty when opened
+	return s.kv.Set(ctx, slotsKey, s.slotsData())
+}
+
+func (s *DBStore) slotsData() []byte {
+	var data = make([]byte, 0, len(s.slots)*slotSize)
+	for _, slot := range s.slots {
+		data = append(data, slotPrefix(slot)...)
+	}
+	return data
+}
+
+// Databases the number of databases
+func (s *DBStore) Databases() int {
+	return len(s.slots)
+}
+
+func (s *DBStore) prefix(ctx context.Context) []byte {
+	db := DBFromContext(ctx)
+	s.RLock()
+	defer s.RUnlock()
+	return slotPrefix(s.slots[db])
+}
+
+func (s *DBStore) key(ctx context.Context, key []byte) []byte {
+	p := s.prefix(ctx)
+	return append(p, key...)
+}
+
+// store the store of the operations with ctx, the transaction of ctx if it is one of s
+func (s *DBStore) store(ctx context.Context) Kvstore {
+	if t, ok := ctx.Value(txnKey{}).(*txn); ok && t.kv == s.kv {
+		return t
+	}
+	return s.kv
+}
+
+// Begin start a transaction, the operations with the returned ctx are in it. its writes are seen
+// by its reads and written at once by Commit, the other operations see them after the commit
+func (s *DBStore) Begin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txnKey{}, newTxn(s.kv))
+}
+
+// Commit write the writes of the transaction of ctx at once
+func (s *DBStore) Commit(ctx context.Context) error {
+	t, ok := ctx.Value(txnKey{}).(*txn)
+	if !ok || t.kv != s.kv {
+		return errors.New("no transaction of the store")
+	}
+	return t.commit(ctx)
+}
+
+// Discard drop the writes of the transaction of ctx, the mapping of the databases swapped in it is reloaded
+func (s *DBStore) Discard(ctx context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.loadSlots(ctx)
+}
+
+// Swap swap the data of two databases
+func (s *DBStore) Swap(ctx context.Context, db1, db2 int) error {
+	s.Lock()
+	defer s.Unlock()
+	s.slots[db1], s.slots[db2] = s.slots[db2], s.slots[db1]
+	return s.store(ctx).Set(ctx, slotsKey, s.slotsData())
+}
+
+// Snapshot iterate a point in time view of all databases and their mapping
+func (s *DBStore) Snapshot() (Iterator, error) {
+	ss, ok := s.kv.(interface{ Snapshot() (Iterator, error) })
+	if !ok {
+		return nil, errors.New("snapshot is not supported by the store")
+	}
+	return ss.Snapshot()
+}
+
+// Stats the stats of the leveldb store
+func (s *DBStore) Stats() (*leveldb.Stats, error) {
+	st, ok := s.kv.(interface {
+		Stats() (*leveldb.Stats, error)
+	})
+	if !ok {
+		return nil, errors.New("stats are not supported by the store")
+	}
+	return st.Stats()
+}
+
+// ReadSnapshot open a read only point in time view of all databases, it must be closed when done
+func (s *DBStore) ReadSnapshot(ctx context.Context) (*DBStore, error) {
+	ss, ok := s.kv.(interface {
+		ReadSnapshot() (*leveldb.SnapshotStore, error)
+	})
+	if !ok {
+		return nil, errors.New("snapshot is not supported by the store")
+	}
+	snap, err := ss.ReadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	// the mapping of databases is read from the snapshot too
+	dbs, err := NewDBStore(ctx, snap, len(s.slots))
+	if err != nil {
+		snap.Close(ctx)
+		return nil, err
+	}
+	return dbs, nil
+}
+
+// Restore replace all databases with the keys of a snapshot, next returns io.EOF after the last key
+func (s *DBStore) Restore(ctx context.Context, next func() (key, val []byte, err error)) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.kv.DeletePrefix(ctx, nil); err != nil {
+		return err
+	}
+	for {
+		key, val, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.kv.Set(ctx, key, val); err != nil {
+			return err
+		}
+	}
+	return s.loadSlots(ctx)
+}
+
+func (s *DBStore) Set(ctx context.Context, key, val []byte) error {
+	return s.store(ctx).Set(ctx, s.key(ctx, key), val)
+}
+
+func (s *DBStore) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return s.store(ctx).Get(ctx, s.key(ctx, key))
+}
+
+func (s *DBStore) Delete(ctx context.Context, key []byte) error {
+	return s.store(ctx).Delete(ctx, s.key(ctx, key))
+}
+
+func (s *DBStore) DeletePrefix(ctx context.Context, prefix []byte) error {
+	return s.store(ctx).DeletePrefix(ctx, s.key(ctx, prefix))
+}
+
+func (s *DBStore) Scan(ctx context.Context, f func(key, data []byte), skip, limit int, prefix []byte) uint64 {
+	return s.store(ctx).Scan(ctx, func(key, data []byte) {
+		f(key[slotSize:], data)
+	}, skip, limit, s.key(ctx, prefix))
+}
+
+func (s *DBStore) Range(ctx context.Context, start, limit []byte, reverse bool, f func(key, data []byte) bool) error {
+	p := s.prefix(ctx)
+	var end []byte
+	if limit != nil {
+		end = append(p, limit...)
+	} else {
+		end = slotPrefix(binary.BigEndian.Uint16(p) + 1)
+	}
+	return s.store(ctx).Range(ctx, append(p, start...), end, reverse, func(key, data []byte) bool {
+		return f(key[slotSize:], data)
+	})
+}
+
+func (s *DBStore) Close(ctx context.Context) error {
+	return s.kv.Close(ctx)
+}
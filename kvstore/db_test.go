@@ -0,0 +1,150 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore/leveldb"
+)
+
+func TestUpgrade(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "gokv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the keys of an older version have no slot prefix, one of them looks like a prefixed key
+	kv, err := leveldb.NewStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"a", "\x00\x00a", "\xffsinternal"} {
+		if err := kv.Set(ctx, []byte(k), []byte("v"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kv.Close(ctx)
+
+	var open = func() *DBStore {
+		kv, err := leveldb.NewStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewDBStore(ctx, kv, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	var check = func(s *DBStore) {
+		for _, k := range []string{"a", "\x00\x00a", "\xffsinternal"} {
+			if v, err := s.Get(ctx, []byte(k)); err != nil || string(v) != "v"+k {
+				t.Errorf("db 0 %q: %q %v", k, v, err)
+			}
+			if _, err := s.Get(WithDB(ctx, 1), []byte(k)); !errors.Is(err, kverror.ErrNotFound) {
+				t.Errorf("db 1 %q: %v", k, err)
+			}
+		}
+	}
+	s := open()
+	check(s)
+	s.Close(ctx)
+
+	// the keys are moved once
+	s = open()
+	defer s.Close(ctx)
+	check(s)
+	var n int
+	s.kv.Range(ctx, nil, nil, false, func(key, _ []byte) bool {
+		n++
+		return true
+	})
+	if n != 4 {
+		t.Errorf("%d keys in the store, expect 3 keys and the mapping", n)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "gokv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kv, err := leveldb.NewStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewDBStore(ctx, kv, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	for _, k := range []string{"a", "c", "e", "p1", "p2"} {
+		s.Set(ctx, []byte(k), []byte(k))
+	}
+
+	var keys = func(ctx context.Context, reverse bool) string {
+		var keys string
+		s.Range(ctx, nil, nil, reverse, func(key, data []byte) bool {
+			keys += string(key) + "=" + string(data) + " "
+			return true
+		})
+		return keys
+	}
+	txn := s.Begin(ctx)
+	s.Set(txn, []byte("b"), []byte("B"))
+	s.Set(txn, []byte("c"), []byte("C"))
+	s.Delete(txn, []byte("e"))
+	s.Set(txn, []byte("f"), []byte("F"))
+	s.DeletePrefix(txn, []byte("p"))
+	s.Set(txn, []byte("p3"), []byte("P"))
+	s.Set(WithDB(txn, 1), []byte("x"), []byte("X"))
+
+	// the transaction reads its writes, the others read the store
+	if got := keys(txn, false); got != "a=a b=B c=C f=F p3=P " {
+		t.Errorf("range in the transaction %s", got)
+	}
+	if got := keys(txn, true); got != "p3=P f=F c=C b=B a=a " {
+		t.Errorf("reverse range in the transaction %s", got)
+	}
+	if v, err := s.Get(txn, []byte("e")); !errors.Is(err, kverror.ErrNotFound) {
+		t.Errorf("get of a deleted key %q %v", v, err)
+	}
+	var scanned string
+	cursor := s.Scan(txn, func(key, data []byte) { scanned += string(key) }, 1, 2, nil)
+	if scanned != "bc" || cursor != 3 {
+		t.Errorf("scan in the transaction %s %d", scanned, cursor)
+	}
+	if got := keys(ctx, false); got != "a=a c=c e=e p1=p1 p2=p2 " {
+		t.Errorf("range out of the transaction %s", got)
+	}
+
+	// a discarded transaction writes nothing
+	s.Swap(txn, 0, 1)
+	if err := s.Discard(txn); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(ctx, false); got != "a=a c=c e=e p1=p1 p2=p2 " {
+		t.Errorf("range after discard %s", got)
+	}
+
+	txn = s.Begin(ctx)
+	s.Set(txn, []byte("b"), []byte("B"))
+	s.Delete(txn, []byte("a"))
+	s.Swap(txn, 0, 1)
+	if err := s.Commit(txn); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(WithDB(ctx, 1), false); got != "b=B c=c e=e p1=p1 p2=p2 " {
+		t.Errorf("range after commit %s", got)
+	}
+	if err := s.loadSlots(ctx); err != nil || keys(WithDB(ctx, 1), false) != "b=B c=c e=e p1=p1 p2=p2 " {
+		t.Errorf("the swap is not committed %v", err)
+	}
+}
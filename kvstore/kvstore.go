@@ -11,9 +11,16 @@ type Kvstore interface {
 	Set(ctx context.Context, key, val []byte) error
 	Get(ctx context.Context, key []byte) ([]byte, error)
 	Delete(ctx context.Context, key []byte) error
+	// DeletePrefix delete all keys with the prefix
+	DeletePrefix(ctx context.Context, prefix []byte) error
 	Scan(ctx context.Context, f func(key, data []byte), skip, limit int, prefix []byte) uint64
+	// Range iterate keys in [start, limit) in order or reversed, stops when f returns false
+	Range(ctx context.Context, start, limit []byte, reverse bool, f func(key, data []byte) bool) error
 	Close(ctx context.Context) error
 }
 
+// Iterator iterates the keys of a store in order, it must be released when done
+type Iterator = leveldb.Iterator
+
 var NewMemDB = memdb.NewStorage
 var NewLevelDB = leveldb.NewStorage
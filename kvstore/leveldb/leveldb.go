@@ -2,14 +2,19 @@ package leveldb
 
 import (
 	"context"
+	"errors"
 	"math"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/yixinin/gokv/codec"
 	"github.com/yixinin/gokv/kverror"
 )
 
+var errReadOnly = errors.New("the snapshot is read only")
+
 type ldb struct {
 	db  *leveldb.DB
 	dir string
@@ -29,12 +34,85 @@ func (l *ldb) Get(ctx context.Context, key []byte) ([]byte, error) {
 func (l *ldb) Delete(ctx context.Context, key []byte) error {
 	return l.db.Delete(key, nil)
 }
+func (l *ldb) DeletePrefix(ctx context.Context, prefix []byte) error {
+	iter := l.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	var batch = new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return l.db.Write(batch, nil)
+}
+func (l *ldb) Range(ctx context.Context, start, limit []byte, reverse bool, f func(key, data []byte) bool) error {
+	return rangeKeys(l.db, start, limit, reverse, f)
+}
+
+// Write write a batch of puts and deletes atomically
+func (l *ldb) Write(ctx context.Context, batch *leveldb.Batch) error {
+	return l.db.Write(batch, nil)
+}
+
+// PrefixAll prefix every key with prefix and set key to val in one batch, it upgrades the stores
+// of older versions whose keys have no prefix. the keys are deleted before the prefixed ones are
+// put, so a prefixed key equal to an old key is kept
+func (l *ldb) PrefixAll(ctx context.Context, prefix, key, val []byte) error {
+	var batch = new(leveldb.Batch)
+	for _, put := range []bool{false, true} {
+		iter := l.db.NewIterator(nil, nil)
+		for iter.Next() {
+			if put {
+				batch.Put(append(append([]byte{}, prefix...), iter.Key()...), iter.Value())
+			} else {
+				batch.Delete(iter.Key())
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	batch.Put(key, val)
+	return l.db.Write(batch, nil)
+}
 func (l *ldb) Scan(ctx context.Context, f func(key, data []byte), skip, limit int, prefix []byte) uint64 {
+	return scanKeys(l.db, f, skip, limit, prefix)
+}
+
+// reader the read methods shared by the db and its snapshots
+type reader interface {
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+func rangeKeys(r reader, start, limit []byte, reverse bool, f func(key, data []byte) bool) error {
+	iter := r.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+	defer iter.Release()
+	var next = iter.Next
+	if reverse {
+		next = iter.Prev
+		if !iter.Last() {
+			return iter.Error()
+		}
+		if !f(append([]byte{}, iter.Key()...), append([]byte{}, iter.Value()...)) {
+			return nil
+		}
+	}
+	for next() {
+		if !f(append([]byte{}, iter.Key()...), append([]byte{}, iter.Value()...)) {
+			return nil
+		}
+	}
+	return iter.Error()
+}
+
+func scanKeys(r reader, f func(key, data []byte), skip, limit int, prefix []byte) uint64 {
 	var slice *util.Range
 	if prefix != nil {
 		slice = util.BytesPrefix(prefix)
 	}
-	iter := l.db.NewIterator(slice, nil)
+	iter := r.NewIterator(slice, nil)
 	defer iter.Release()
 	if limit <= 0 {
 		limit = math.MaxInt
@@ -71,6 +149,92 @@ func (l *ldb) Scan(ctx context.Context, f func(key, data []byte), skip, limit in
 	return uint64(skip + i)
 }
 
+// Iterator iterates the keys in order, it must be released when done
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Release()
+}
+
+type snapshotIterator struct {
+	iterator.Iterator
+	snap *leveldb.Snapshot
+}
+
+func (it *snapshotIterator) Release() {
+	it.Iterator.Release()
+	it.snap.Release()
+}
+
+// Snapshot iterate all keys of a point in time view of the store
+func (l *ldb) Snapshot() (Iterator, error) {
+	snap, err := l.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotIterator{Iterator: snap.NewIterator(nil, nil), snap: snap}, nil
+}
+
+// Stats the io, compaction and level stats of leveldb
+type Stats = leveldb.DBStats
+
+func (l *ldb) Stats() (*Stats, error) {
+	var st Stats
+	if err := l.db.Stats(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// SnapshotStore a read only point in time view of the store, it must be closed when done
+type SnapshotStore struct {
+	snap *leveldb.Snapshot
+}
+
+// ReadSnapshot open a read only point in time view of the store
+func (l *ldb) ReadSnapshot() (*SnapshotStore, error) {
+	snap, err := l.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotStore{snap: snap}, nil
+}
+
+func (s *SnapshotStore) Set(ctx context.Context, key, val []byte) error {
+	return errReadOnly
+}
+
+func (s *SnapshotStore) Get(ctx context.Context, key []byte) ([]byte, error) {
+	data, err := s.snap.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, kverror.ErrNotFound
+	}
+	return data, err
+}
+
+func (s *SnapshotStore) Delete(ctx context.Context, key []byte) error {
+	return errReadOnly
+}
+
+func (s *SnapshotStore) DeletePrefix(ctx context.Context, prefix []byte) error {
+	return errReadOnly
+}
+
+func (s *SnapshotStore) Range(ctx context.Context, start, limit []byte, reverse bool, f func(key, data []byte) bool) error {
+	return rangeKeys(s.snap, start, limit, reverse, f)
+}
+
+func (s *SnapshotStore) Scan(ctx context.Context, f func(key, data []byte), skip, limit int, prefix []byte) uint64 {
+	return scanKeys(s.snap, f, skip, limit, prefix)
+}
+
+func (s *SnapshotStore) Close(ctx context.Context) error {
+	s.snap.Release()
+	return nil
+}
+
 func (m *ldb) Close(ctx context.Context) error {
 	if m != nil && m.db != nil {
 		return m.db.Close()
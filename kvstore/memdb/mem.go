@@ -30,6 +30,40 @@ func (m *mdb) Get(ctx context.Context, key []byte) ([]byte, error) {
 func (m *mdb) Delete(ctx context.Context, key []byte) error {
 	return m.db.Delete(key)
 }
+func (m *mdb) DeletePrefix(ctx context.Context, prefix []byte) error {
+	iter := m.db.NewIterator(util.BytesPrefix(prefix))
+	var keys = make([][]byte, 0, 8)
+	for iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	for _, key := range keys {
+		if err := m.db.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (m *mdb) Range(ctx context.Context, start, limit []byte, reverse bool, f func(key, data []byte) bool) error {
+	iter := m.db.NewIterator(&util.Range{Start: start, Limit: limit})
+	defer iter.Release()
+	var next = iter.Next
+	if reverse {
+		next = iter.Prev
+		if !iter.Last() {
+			return iter.Error()
+		}
+		if !f(append([]byte{}, iter.Key()...), append([]byte{}, iter.Value()...)) {
+			return nil
+		}
+	}
+	for next() {
+		if !f(append([]byte{}, iter.Key()...), append([]byte{}, iter.Value()...)) {
+			return nil
+		}
+	}
+	return iter.Error()
+}
 func (m *mdb) Scan(ctx context.Context, f func(key, data []byte), skip, limit int, prefix []byte) uint64 {
 	var slice *util.Range
 	if prefix != nil {
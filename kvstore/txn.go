@@ -0,0 +1,175 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// the writes of a transaction are kept in memory as a flag byte and the value
+const (
+	txnDelete byte = iota
+	txnPut
+)
+
+// txn buffer the writes to a store, its reads see them and commit writes them at once
+type txn struct {
+	kv  Kvstore
+	mem *memdb.DB
+}
+
+func newTxn(kv Kvstore) *txn {
+	return &txn{kv: kv, mem: memdb.New(comparer.DefaultComparer, 0)}
+}
+
+func (t *txn) Set(ctx context.Context, key, val []byte) error {
+	return t.mem.Put(key, append([]byte{txnPut}, val...))
+}
+
+func (t *txn) Get(ctx context.Context, key []byte) ([]byte, error) {
+	data, err := t.mem.Get(key)
+	if err != nil {
+		return t.kv.Get(ctx, key)
+	}
+	if data[0] == txnDelete {
+		return nil, kverror.ErrNotFound
+	}
+	return append([]byte{}, data[1:]...), nil
+}
+
+func (t *txn) Delete(ctx context.Context, key []byte) error {
+	return t.mem.Put(key, []byte{txnDelete})
+}
+
+func (t *txn) DeletePrefix(ctx context.Context, prefix []byte) error {
+	var keys [][]byte
+	r := util.BytesPrefix(prefix)
+	err := t.Range(ctx, r.Start, r.Limit, false, func(key, data []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := t.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Range merge the writes of the transaction in [start, limit) with the keys of the store
+func (t *txn) Range(ctx context.Context, start, limit []byte, reverse bool, f func(key, data []byte) bool) error {
+	var keys, vals [][]byte
+	iter := t.mem.NewIterator(&util.Range{Start: start, Limit: limit})
+	for iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		vals = append(vals, append([]byte{}, iter.Value()...))
+	}
+	iter.Release()
+	if reverse {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+			vals[i], vals[j] = vals[j], vals[i]
+		}
+	}
+
+	var i int
+	var stopped bool
+	var emit = func(key, data []byte) bool {
+		stopped = !f(key, data)
+		return !stopped
+	}
+	// before emit the writes ordered before key, or all of them at the end
+	var before = func(key []byte, end bool) bool {
+		for ; i < len(keys); i++ {
+			if c := bytes.Compare(keys[i], key); !end && (c == 0 || (c > 0) != reverse) {
+				return true
+			}
+			if vals[i][0] == txnPut && !emit(keys[i], vals[i][1:]) {
+				i++
+				return false
+			}
+		}
+		return true
+	}
+	err := t.kv.Range(ctx, start, limit, reverse, func(key, data []byte) bool {
+		if !before(key, false) {
+			return false
+		}
+		if i < len(keys) && bytes.Equal(keys[i], key) {
+			i++
+			if vals[i-1][0] == txnDelete {
+				return true
+			}
+			return emit(key, vals[i-1][1:])
+		}
+		return emit(key, data)
+	})
+	if err != nil || stopped {
+		return err
+	}
+	before(nil, true)
+	return nil
+}
+
+// Scan skip the first skip keys with prefix and iterate limit keys, the cursor is 0 if no keys are left
+func (t *txn) Scan(ctx context.Context, f func(key, data []byte), skip, limit int, prefix []byte) uint64 {
+	var n int
+	var cursor uint64
+	r := util.BytesPrefix(prefix)
+	t.Range(ctx, r.Start, r.Limit, false, func(key, data []byte) bool {
+		switch {
+		case n < skip:
+		case limit > 0 && n == skip+limit:
+			cursor = uint64(n)
+			return false
+		default:
+			f(key, data)
+		}
+		n++
+		return true
+	})
+	return cursor
+}
+
+func (t *txn) Close(ctx context.Context) error {
+	return nil
+}
+
+// commit write the writes to the store, in one batch if the store supports it
+func (t *txn) commit(ctx context.Context) error {
+	iter := t.mem.NewIterator(nil)
+	defer iter.Release()
+	if w, ok := t.kv.(interface {
+		Write(ctx context.Context, batch *leveldb.Batch) error
+	}); ok {
+		var batch = new(leveldb.Batch)
+		for iter.Next() {
+			if data := iter.Value(); data[0] == txnPut {
+				batch.Put(iter.Key(), data[1:])
+			} else {
+				batch.Delete(iter.Key())
+			}
+		}
+		return w.Write(ctx, batch)
+	}
+	for iter.Next() {
+		var err error
+		if data := iter.Value(); data[0] == txnPut {
+			err = t.kv.Set(ctx, iter.Key(), data[1:])
+		} else {
+			err = t.kv.Delete(ctx, iter.Key())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package gokv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17381)
+	id, err := cli.Do(ctx, "LEASE", "GRANT", 60).Int64()
+	if err != nil || id <= 0 {
+		t.Fatalf("grant %d %v", id, err)
+	}
+	for _, key := range []string{"svc/a", "svc/b", "svc/c"} {
+		if err := cli.Do(ctx, "SET", key, "up", "LEASE", id).Err(); err != nil {
+			t.Fatalf("set with lease %v", err)
+		}
+	}
+	if err := cli.Do(ctx, "SET", "svc/d", "up", "LEASE", id+1000).Err(); err == nil || err.Error() != "ERR requested lease not found" {
+		t.Errorf("set with a missing lease %v", err)
+	}
+	// a key written without the lease is detached from it
+	cli.Set(ctx, "svc/c", "static", 0)
+	if keys, _ := cli.Do(ctx, "LEASE", "KEYS", id).StringSlice(); fmt.Sprint(keys) != "[svc/a svc/b]" {
+		t.Errorf("lease keys %v", keys)
+	}
+	if ttl, err := cli.Do(ctx, "LEASE", "KEEPALIVE", id).Int(); err != nil || ttl != 60 {
+		t.Errorf("keepalive %d %v", ttl, err)
+	}
+	if ttl, _ := cli.Do(ctx, "LEASE", "TTL", id).Int(); ttl <= 0 || ttl > 60 {
+		t.Errorf("lease ttl %d", ttl)
+	}
+	if err := cli.Do(ctx, "LEASE", "REVOKE", id).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := cli.Exists(ctx, "svc/a", "svc/b", "svc/c").Val(); n != 1 {
+		t.Errorf("keys after revoke %d", n)
+	}
+	if ttl, _ := cli.Do(ctx, "LEASE", "TTL", id).Int(); ttl != -2 {
+		t.Errorf("ttl of a revoked lease %d", ttl)
+	}
+	if err := cli.Do(ctx, "LEASE", "KEEPALIVE", id).Err(); err == nil {
+		t.Errorf("keepalive of a revoked lease")
+	}
+
+	// the keys are deleted by gc when the lease expires
+	id, _ = cli.Do(ctx, "LEASE", "GRANT", 1).Int64()
+	cli.Do(ctx, "SET", "svc/e", "up", "LEASE", id)
+	time.Sleep(3 * time.Second)
+	if n := cli.Exists(ctx, "svc/e").Val(); n != 0 {
+		t.Errorf("key of an expired lease %d", n)
+	}
+	if err := cli.Do(ctx, "LEASE", "GRANT", 0).Err(); err == nil {
+		t.Errorf("grant with an invalid ttl")
+	}
+}
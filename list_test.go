@@ -0,0 +1,173 @@
+package gokv_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18121)
+	cli.RPush(ctx, "l", "b", "c")
+	cli.LPush(ctx, "l", "a")
+	if v := cli.LRange(ctx, "l", 0, -1).Val(); fmt.Sprint(v) != "[a b c]" {
+		t.Errorf("lrange %v", v)
+	}
+	if v := cli.LIndex(ctx, "l", -1).Val(); v != "c" {
+		t.Errorf("lindex %q", v)
+	}
+	if n := cli.LPushX(ctx, "nol", "a").Val(); n != 0 || cli.Exists(ctx, "nol").Val() != 0 {
+		t.Errorf("lpushx of a missing key %d", n)
+	}
+	if v := cli.LMove(ctx, "l", "l2", "RIGHT", "LEFT").Val(); v != "c" {
+		t.Errorf("lmove %q", v)
+	}
+	if v := cli.LPopCount(ctx, "l", 5).Val(); fmt.Sprint(v) != "[a b]" {
+		t.Errorf("lpop count %v", v)
+	}
+	if n := cli.Exists(ctx, "l").Val(); n != 0 {
+		t.Error("the empty list is not deleted")
+	}
+	if err := cli.RPop(ctx, "l").Err(); err != redis.Nil {
+		t.Errorf("rpop of a missing key %v", err)
+	}
+	cli.Set(ctx, "str", "v", 0)
+	if err := cli.LPush(ctx, "str", "a").Err(); err == nil {
+		t.Error("lpush to a string should fail")
+	}
+}
+
+func TestZSet(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18131)
+	cli.ZAdd(ctx, "z", &redis.Z{Score: 2, Member: "b"}, &redis.Z{Score: 1, Member: "a"}, &redis.Z{Score: 3, Member: "c"})
+	if v := cli.ZRange(ctx, "z", 0, -1).Val(); fmt.Sprint(v) != "[a b c]" {
+		t.Errorf("zrange %v", v)
+	}
+	if v := cli.ZRevRange(ctx, "z", 0, 0).Val(); fmt.Sprint(v) != "[c]" {
+		t.Errorf("zrevrange %v", v)
+	}
+	if v := cli.ZIncrBy(ctx, "z", 5, "a").Val(); v != 6 {
+		t.Errorf("zincrby %v", v)
+	}
+	if n := cli.ZAdd(ctx, "z", &redis.Z{Score: 0, Member: "b"}).Val(); n != 0 {
+		t.Errorf("zadd of an existing member %d", n)
+	}
+	if v := cli.ZRangeWithScores(ctx, "z", 0, -1).Val(); fmt.Sprint(v) != "[{0 b} {3 c} {6 a}]" {
+		t.Errorf("zrange withscores %v", v)
+	}
+	if v := cli.ZPopMin(ctx, "z").Val(); len(v) != 1 || v[0].Member != "b" {
+		t.Errorf("zpopmin %v", v)
+	}
+	if v := cli.ZPopMax(ctx, "z").Val(); len(v) != 1 || v[0].Member != "a" {
+		t.Errorf("zpopmax %v", v)
+	}
+	if n := cli.ZRem(ctx, "z", "c", "x").Val(); n != 1 {
+		t.Errorf("zrem %d", n)
+	}
+	if n := cli.Exists(ctx, "z").Val(); n != 0 {
+		t.Error("the empty zset is not deleted")
+	}
+	if err := cli.ZScore(ctx, "z", "a").Err(); err != redis.Nil {
+		t.Errorf("zscore of a missing key %v", err)
+	}
+}
+
+// waitBlocked wait until n clients are blocked
+func waitBlocked(t *testing.T, cli *redis.Client, n int) {
+	t.Helper()
+	var want = fmt.Sprintf("blocked_clients:%d\r\n", n)
+	for i := 0; i < 100; i++ {
+		if strings.Contains(cli.Info(context.Background(), "clients").Val(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%d clients are not blocked", n)
+}
+
+func TestBlocking(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18141)
+
+	// a push wakes up the blocked client
+	var result = make(chan []string, 2)
+	go func() {
+		result <- cli.BLPop(ctx, 5*time.Second, "q").Val()
+	}()
+	waitBlocked(t, cli, 1)
+	cli.LPush(ctx, "q", "v")
+	select {
+	case v := <-result:
+		if fmt.Sprint(v) != "[q v]" {
+			t.Errorf("blpop %v", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("blpop is not woken up")
+	}
+	if n := cli.Exists(ctx, "q").Val(); n != 0 {
+		t.Error("the popped list is not deleted")
+	}
+
+	// the timeout replies nil
+	start := time.Now()
+	if err := cli.BRPop(ctx, time.Second, "q").Err(); err != redis.Nil {
+		t.Errorf("brpop timeout %v", err)
+	}
+	if d := time.Since(start); d < 900*time.Millisecond || d > 3*time.Second {
+		t.Errorf("brpop timeout after %v", d)
+	}
+	if err := cli.BZPopMin(ctx, time.Second, "z").Err(); err != redis.Nil {
+		t.Errorf("bzpopmin timeout %v", err)
+	}
+
+	// the clients blocked first are served first
+	for i, name := range []string{"w1", "w2"} {
+		name := name
+		go func() {
+			v := cli.BLPop(ctx, 5*time.Second, "f").Val()
+			result <- append([]string{name}, v...)
+		}()
+		waitBlocked(t, cli, i+1)
+	}
+	cli.RPush(ctx, "f", "a")
+	cli.RPush(ctx, "f", "b")
+	first, second := <-result, <-result
+	if fmt.Sprint(first) != "[w1 f a]" || fmt.Sprint(second) != "[w2 f b]" {
+		t.Errorf("blpop order %v %v", first, second)
+	}
+
+	// BLMOVE pops and pushes in one write
+	var moved = make(chan string, 1)
+	go func() {
+		moved <- cli.BLMove(ctx, "src", "dst", "LEFT", "RIGHT", 5*time.Second).Val()
+	}()
+	waitBlocked(t, cli, 1)
+	cli.RPush(ctx, "src", "x", "y")
+	if v := <-moved; v != "x" {
+		t.Errorf("blmove %q", v)
+	}
+	if v := cli.LRange(ctx, "src", 0, -1).Val(); fmt.Sprint(v) != "[y]" {
+		t.Errorf("blmove source %v", v)
+	}
+	if v := cli.LRange(ctx, "dst", 0, -1).Val(); fmt.Sprint(v) != "[x]" {
+		t.Errorf("blmove destination %v", v)
+	}
+
+	// XREAD BLOCK $ reads only the entries added after it blocked
+	cli.XAdd(ctx, &redis.XAddArgs{Stream: "s", ID: "1-1", Values: []string{"f", "old"}})
+	var read = make(chan []redis.XStream, 1)
+	go func() {
+		read <- cli.XRead(ctx, &redis.XReadArgs{Streams: []string{"s", "$"}, Block: 5 * time.Second}).Val()
+	}()
+	waitBlocked(t, cli, 1)
+	cli.XAdd(ctx, &redis.XAddArgs{Stream: "s", ID: "2-1", Values: []string{"f", "new"}})
+	if v := <-read; len(v) != 1 || fmt.Sprint(ids(v[0].Messages)) != "[2-1]" {
+		t.Errorf("xread block $ %v", v)
+	}
+}
@@ -3,25 +3,27 @@ package logger
 import (
 	"context"
 	"io"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
 
 var (
-	err   = logrus.New()
-	level logrus.Level
+	err = logrus.New()
+	// level the logrus.Level, it is changed by CONFIG SET at runtime
+	level uint32
 )
 
 func init() {
 	err.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetFormatter(&logrus.JSONFormatter{})
-	level = logrus.InfoLevel
+	level = uint32(logrus.InfoLevel)
 }
 
 var EnbaleErrorLogger bool
 
 func EnableDebug() bool {
-	return level >= logrus.DebugLevel
+	return GetLevel() >= logrus.DebugLevel
 }
 
 func SetOutput(stdW, errW io.Writer) {
@@ -32,11 +34,15 @@ func SetOutput(stdW, errW io.Writer) {
 }
 
 func SetLevel(lvl logrus.Level) {
-	level = lvl
+	atomic.StoreUint32(&level, uint32(lvl))
 	logrus.SetLevel(lvl)
 	err.SetLevel(logrus.ErrorLevel)
 }
 
+func GetLevel() logrus.Level {
+	return logrus.Level(atomic.LoadUint32(&level))
+}
+
 func AddHook(hook logrus.Hook) {
 	logrus.AddHook(hook)
 	err.AddHook(hook)
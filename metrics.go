@@ -0,0 +1,168 @@
+package gokv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yixinin/gokv/kvstore/leveldb"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/metrics"
+)
+
+// kvMetrics the metrics of a node served at /metrics of the admin port
+type kvMetrics struct {
+	registry *metrics.Registry
+
+	commands        *metrics.CounterVec
+	commandDuration *metrics.HistogramVec
+
+	proposals        *metrics.Counter
+	proposalFailures *metrics.Counter
+	proposalDuration *metrics.Histogram
+
+	gcDeletes     *metrics.Counter
+	expiredLeases *metrics.Counter
+	connections   *metrics.Counter
+}
+
+// single the value of a metric without labels
+func single(v float64) map[string]float64 {
+	return map[string]float64{"": v}
+}
+
+func newKvMetrics(s *RaftKv) *kvMetrics {
+	r := metrics.NewRegistry()
+	m := &kvMetrics{
+		registry:         r,
+		commands:         r.NewCounterVec("gokv_commands_total", "The number of commands handled.", "command"),
+		commandDuration:  r.NewHistogramVec("gokv_command_duration_seconds", "The latency of commands.", "command", metrics.DefaultBuckets),
+		proposals:        r.NewCounter("gokv_raft_proposals_total", "The number of raft proposals."),
+		proposalFailures: r.NewCounter("gokv_raft_proposal_failures_total", "The number of failed or timed out raft proposals."),
+		proposalDuration: r.NewHistogram("gokv_raft_proposal_duration_seconds", "The latency of raft proposals until they are applied.", metrics.DefaultBuckets),
+		gcDeletes:        r.NewCounter("gokv_gc_deleted_keys_total", "The number of expired keys deleted by gc."),
+		expiredLeases:    r.NewCounter("gokv_gc_expired_leases_total", "The number of expired leases revoked by gc."),
+		connections:      r.NewCounter("gokv_connections_total", "The number of accepted client connections."),
+	}
+	r.NewGaugeFunc("gokv_raft_applied_index", "The raft index applied to the store.", "", func() map[string]float64 {
+		return single(float64(s.appliedIndex()))
+	})
+	r.NewGaugeFunc("gokv_raft_commit_index", "The committed raft index.", "", func() map[string]float64 {
+		if s.rs == nil {
+			return nil
+		}
+		return single(float64(s.rs.CommittedIndex(DefaultClusterID)))
+	})
+	r.NewGaugeFunc("gokv_raft_apply_lag", "The committed entries not applied yet.", "", func() map[string]float64 {
+		if s.rs == nil {
+			return nil
+		}
+		commit, applied := s.rs.CommittedIndex(DefaultClusterID), s.appliedIndex()
+		if commit < applied {
+			return single(0)
+		}
+		return single(float64(commit - applied))
+	})
+	r.NewGaugeFunc("gokv_raft_is_leader", "Whether the node is the raft leader.", "", func() map[string]float64 {
+		if s.leader == s.nodeID {
+			return single(1)
+		}
+		return single(0)
+	})
+	m.leveldbStats(s)
+	return m
+}
+
+// leveldbStats the stats of the leveldb store, nothing is written if the store is not leveldb
+func (m *kvMetrics) leveldbStats(s *RaftKv) {
+	var stat = func(f func(st *leveldb.Stats) map[string]float64) func() map[string]float64 {
+		return func() map[string]float64 {
+			if s.dbs == nil {
+				return nil
+			}
+			st, err := s.dbs.Stats()
+			if err != nil {
+				return nil
+			}
+			return f(st)
+		}
+	}
+	r := m.registry
+	r.NewCounterFunc("gokv_leveldb_read_bytes_total", "The bytes read by leveldb.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(float64(st.IORead))
+	}))
+	r.NewCounterFunc("gokv_leveldb_write_bytes_total", "The bytes written by leveldb.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(float64(st.IOWrite))
+	}))
+	r.NewCounterFunc("gokv_leveldb_write_delays_total", "The number of writes delayed by compactions.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(float64(st.WriteDelayCount))
+	}))
+	r.NewCounterFunc("gokv_leveldb_write_delay_seconds_total", "The time writes are delayed by compactions.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(st.WriteDelayDuration.Seconds())
+	}))
+	r.NewGaugeFunc("gokv_leveldb_alive_snapshots", "The number of open leveldb snapshots.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(float64(st.AliveSnapshots))
+	}))
+	r.NewGaugeFunc("gokv_leveldb_alive_iterators", "The number of open leveldb iterators.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(float64(st.AliveIterators))
+	}))
+	r.NewGaugeFunc("gokv_leveldb_opened_tables", "The number of opened leveldb tables.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(float64(st.OpenedTablesCount))
+	}))
+	r.NewGaugeFunc("gokv_leveldb_block_cache_bytes", "The size of the leveldb block cache.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		return single(float64(st.BlockCacheSize))
+	}))
+	// the level stats skip the empty levels, so they are summed up
+	r.NewGaugeFunc("gokv_leveldb_table_bytes", "The size of the leveldb tables.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		var size int64
+		for _, n := range st.LevelSizes {
+			size += n
+		}
+		return single(float64(size))
+	}))
+	r.NewGaugeFunc("gokv_leveldb_tables", "The number of leveldb tables.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		var tables int
+		for _, n := range st.LevelTablesCounts {
+			tables += n
+		}
+		return single(float64(tables))
+	}))
+	r.NewCounterFunc("gokv_leveldb_compaction_seconds_total", "The time spent compacting leveldb tables.", "", stat(func(st *leveldb.Stats) map[string]float64 {
+		var d time.Duration
+		for _, n := range st.LevelDurations {
+			d += n
+		}
+		return single(d.Seconds())
+	}))
+}
+
+// command count a command handled since start
+func (m *kvMetrics) command(name string, start time.Time) {
+	m.commands.With(name).Inc()
+	m.commandDuration.With(name).Observe(time.Since(start).Seconds())
+}
+
+// proposal count a raft proposal submitted since start
+func (m *kvMetrics) proposal(start time.Time, err error) {
+	m.proposals.Inc()
+	if err != nil {
+		m.proposalFailures.Inc()
+	}
+	m.proposalDuration.Observe(time.Since(start).Seconds())
+}
+
+// serveAdmin serve /metrics on the admin port until ctx is done
+func (n *Server) serveAdmin(ctx context.Context, port uint32) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", n.kv.metrics.registry)
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	logger.Info(ctx, "admin listen on ", port)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Errorf(ctx, "serve admin port %d error:%v", port, err)
+	}
+}
@@ -0,0 +1,341 @@
+// Package metrics a minimal set of counters, gauges and histograms exposed in the
+// prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets the upper bounds in seconds of latency histograms
+var DefaultBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry the metrics written by WriteTo in the order they are created
+type Registry struct {
+	mu      sync.Mutex
+	metrics []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, c)
+	r.mu.Unlock()
+}
+
+// WriteTo write all metrics in the prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]collector{}, r.metrics...)
+	r.mu.Unlock()
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serve the metrics to a prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	w.WriteString("# HELP ")
+	w.WriteString(name)
+	w.WriteByte(' ')
+	w.WriteString(strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	w.WriteString("\n# TYPE ")
+	w.WriteString(name)
+	w.WriteByte(' ')
+	w.WriteString(typ)
+	w.WriteByte('\n')
+}
+
+// writeSample write name{labels} value, labels are name and value pairs
+func writeSample(w *bufio.Writer, name string, v float64, labels ...string) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(labels[i])
+			w.WriteString(`="`)
+			w.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1]))
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter a monotonically increasing count
+type Counter struct {
+	v uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+type counter struct {
+	Counter
+	name, help string
+}
+
+func (c *counter) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	writeSample(w, c.name, float64(c.Value()))
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &counter{name: name, help: help}
+	r.register(c)
+	return &c.Counter
+}
+
+// CounterVec the counters of the values of a label
+type CounterVec struct {
+	name, help, label string
+	mu                sync.RWMutex
+	children          map[string]*Counter
+}
+
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, children: make(map[string]*Counter)}
+	r.register(c)
+	return c
+}
+
+// With the counter of the label value
+func (c *CounterVec) With(value string) *Counter {
+	c.mu.RLock()
+	child, ok := c.children[value]
+	c.mu.RUnlock()
+	if ok {
+		return child
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if child, ok = c.children[value]; !ok {
+		child = &Counter{}
+		c.children[value] = child
+	}
+	return child
+}
+
+// Total the sum of the counters of all label values
+func (c *CounterVec) Total() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var total uint64
+	for _, child := range c.children {
+		total += child.Value()
+	}
+	return total
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var values = make([]string, 0, len(c.children))
+	for value := range c.children {
+		values = append(values, value)
+	}
+	for _, value := range sorted(values) {
+		writeSample(w, c.name, float64(c.children[value].Value()), c.label, value)
+	}
+}
+
+// Histogram count the observed values in buckets
+type Histogram struct {
+	buckets []float64
+	// counts the observations of each bucket, the last one is +Inf
+	counts  []uint64
+	count   uint64
+	sumBits uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, sum) {
+			return
+		}
+	}
+}
+
+func (h *Histogram) writeSamples(w *bufio.Writer, name string, labels ...string) {
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		le := math.Inf(1)
+		if i < len(h.buckets) {
+			le = h.buckets[i]
+		}
+		writeSample(w, name+"_bucket", float64(cumulative), append(labels, "le", formatFloat(le))...)
+	}
+	writeSample(w, name+"_sum", math.Float64frombits(atomic.LoadUint64(&h.sumBits)), labels...)
+	writeSample(w, name+"_count", float64(atomic.LoadUint64(&h.count)), labels...)
+}
+
+type histogram struct {
+	*Histogram
+	name, help string
+}
+
+func (h *histogram) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.writeSamples(w, h.name)
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &histogram{Histogram: newHistogram(buckets), name: name, help: help}
+	r.register(h)
+	return h.Histogram
+}
+
+// HistogramVec the histograms of the values of a label
+type HistogramVec struct {
+	name, help, label string
+	buckets           []float64
+	mu                sync.RWMutex
+	children          map[string]*Histogram
+}
+
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, label: label, buckets: buckets, children: make(map[string]*Histogram)}
+	r.register(h)
+	return h
+}
+
+// With the histogram of the label value
+func (h *HistogramVec) With(value string) *Histogram {
+	h.mu.RLock()
+	child, ok := h.children[value]
+	h.mu.RUnlock()
+	if ok {
+		return child
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if child, ok = h.children[value]; !ok {
+		child = newHistogram(h.buckets)
+		h.children[value] = child
+	}
+	return child
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var values = make([]string, 0, len(h.children))
+	for value := range h.children {
+		values = append(values, value)
+	}
+	for _, value := range sorted(values) {
+		h.children[value].writeSamples(w, h.name, h.label, value)
+	}
+}
+
+// funcMetric a gauge or counter read when the metrics are written
+type funcMetric struct {
+	name, help, typ, label string
+	f                      func() map[string]float64
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	values := m.f()
+	if len(values) == 0 {
+		return
+	}
+	writeHeader(w, m.name, m.help, m.typ)
+	var labels = make([]string, 0, len(values))
+	for value := range values {
+		labels = append(labels, value)
+	}
+	for _, value := range sorted(labels) {
+		if m.label == "" {
+			writeSample(w, m.name, values[value])
+		} else {
+			writeSample(w, m.name, values[value], m.label, value)
+		}
+	}
+}
+
+// NewGaugeFunc the gauges of the label values returned by f when the metrics are written,
+// an empty label writes the value of "" without labels, nothing is written if f returns none
+func (r *Registry) NewGaugeFunc(name, help, label string, f func() map[string]float64) {
+	r.register(&funcMetric{name: name, help: help, typ: "gauge", label: label, f: f})
+}
+
+// NewCounterFunc the counters of the label values returned by f, like NewGaugeFunc
+func (r *Registry) NewCounterFunc(name, help, label string, f func() map[string]float64) {
+	r.register(&funcMetric{name: name, help: help, typ: "counter", label: label, f: f})
+}
+
+// sorted the label values in order
+func sorted(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("cmds_total", "Commands.", "command")
+	c.With("set").Add(2)
+	c.With("get").Inc()
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(3)
+	r.NewGaugeFunc("clients", "Clients.", "", func() map[string]float64 {
+		return map[string]float64{"": 4}
+	})
+	r.NewGaugeFunc("missing", "Not written.", "level", func() map[string]float64 {
+		return nil
+	})
+	r.NewGaugeFunc("level_tables", "Tables.", "level", func() map[string]float64 {
+		return map[string]float64{"1": 3, "0": 1}
+	})
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expect := `# HELP cmds_total Commands.
+# TYPE cmds_total counter
+cmds_total{command="get"} 1
+cmds_total{command="set"} 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.15
+latency_seconds_count 3
+# HELP clients Clients.
+# TYPE clients gauge
+clients 4
+# HELP level_tables Tables.
+# TYPE level_tables gauge
+level_tables{level="0"} 1
+level_tables{level="1"} 3
+`
+	if buf.String() != expect {
+		t.Errorf("metrics:\n%s\nexpect:\n%s", buf.String(), expect)
+	}
+
+	// label values are escaped
+	buf.Reset()
+	r = NewRegistry()
+	r.NewCounterVec("c", "C.", "k").With("a\"b\\").Inc()
+	r.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `c{k="a\"b\\"} 1`) {
+		t.Errorf("escaped label %s", buf.String())
+	}
+}
@@ -0,0 +1,42 @@
+package gokv_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yixinin/gokv"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17391, func(cfg *gokv.Config) {
+		cfg.ClusterCfg.Nodes[0].AdminPort = 17691
+	})
+	cli.Set(ctx, "k", "v", 0)
+	cli.Get(ctx, "k")
+	cli.Do(ctx, "NOSUCHCOMMAND")
+
+	resp, err := http.Get("http://127.0.0.1:17691/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, expect := range []string{
+		`gokv_commands_total{command="set"} `,
+		`gokv_commands_total{command="get"} 1`,
+		`gokv_commands_total{command="unknown"} 1`,
+		`gokv_command_duration_seconds_count{command="get"} 1`,
+		"gokv_raft_proposal_failures_total 0",
+		"gokv_connected_clients 1",
+		"gokv_raft_apply_lag ",
+		"gokv_leveldb_tables ",
+	} {
+		if !strings.Contains(string(body), expect) {
+			t.Errorf("metrics missing %q", expect)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package gokv_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yixinin/gokv"
+	"github.com/yixinin/gokv/rdb"
+)
+
+// startServer start a single node cluster on port and its raft ports
+func startServer(t *testing.T, port uint32, opts ...func(cfg *gokv.Config)) *redis.Client {
+	_, cli, _ := startNode(t, nodeConfig(t, port, opts...), port)
+	return cli
+}
+
+// nodeConfig the config of a single node cluster on port and its raft ports, with a temporary data path
+func nodeConfig(t *testing.T, port uint32, opts ...func(cfg *gokv.Config)) *gokv.Config {
+	dir, err := os.MkdirTemp("", "gokv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cfg := &gokv.Config{}
+	cfg.ServerCfg.DataPath = dir
+	cfg.ServerCfg.LogPath = dir
+	cfg.ServerCfg.Databases = 16
+	cfg.ClusterCfg.Nodes = []*gokv.ClusterNode{{NodeID: 1, Host: "127.0.0.1", HTTPPort: port, HeartbeatPort: port + 100, ReplicatePort: port + 200}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.Validate(1)
+	return cfg
+}
+
+// startNode start the node of cfg serving on port, stop stops the node and closes its store.
+// the server keeps listening, start the node again on another port
+func startNode(t *testing.T, cfg *gokv.Config, port uint32) (kv *gokv.RaftKv, cli *redis.Client, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	kv = gokv.NewRaftKv(1, cfg)
+	kv.Run(ctx)
+	go kv.GC(ctx)
+	go gokv.NewServer(kv).Run(ctx, port)
+	stop = func() {
+		cancel()
+		kv.Stop(context.Background())
+	}
+
+	cli = redis.NewClient(&redis.Options{Addr: "127.0.0.1:" + strconv.Itoa(int(port))})
+	t.Cleanup(func() { cli.Close() })
+	for i := 0; i < 100; i++ {
+		if cli.Set(ctx, "ready", 1, 0).Err() == nil {
+			cli.Del(ctx, "ready")
+			return kv, cli, stop
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("server %d is not ready", port)
+	return kv, nil, stop
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	src, dst := startServer(t, 17301), startServer(t, 17311)
+	dst1 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17311", DB: 1})
+	defer dst1.Close()
+
+	src.Set(ctx, "str", "v", time.Hour)
+	src.SAdd(ctx, "set", "a", "b", "c")
+	src.RPush(ctx, "list", "1", "2", "3")
+	src.ZAdd(ctx, "zset", &redis.Z{Score: 1, Member: "m1"}, &redis.Z{Score: 2, Member: "m2"})
+	src.XAdd(ctx, &redis.XAddArgs{Stream: "stream", ID: "1-1", Values: []string{"f", "v"}})
+
+	// dump and restore round trip
+	payload, err := src.Dump(ctx, "set").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Restore(ctx, "set2", 0, payload).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := src.SCard(ctx, "set2").Val(); n != 3 {
+		t.Errorf("restored set card %d", n)
+	}
+	if err := src.Restore(ctx, "set2", 0, payload).Err(); err == nil || err.Error() != "BUSYKEY Target key name already exists." {
+		t.Errorf("restore busy key: %v", err)
+	}
+	if err := src.Restore(ctx, "bad", 0, payload[1:]).Err(); err == nil {
+		t.Error("restore corrupted payload should fail")
+	}
+	if err := src.Dump(ctx, "nokey").Err(); err != redis.Nil {
+		t.Errorf("dump missing key: %v", err)
+	}
+
+	// the payloads are in the DUMP format of redis, the one of a stream is in the format of gokv.
+	// the expire time is in a trailer redis ignores, it is kept by RESTORE with ttl 0
+	if payload := src.Dump(ctx, "set").Val(); !strings.HasPrefix(payload, "\x02\x03") || len(payload) != 18 {
+		t.Errorf("dump set %q", payload)
+	}
+	payload = src.Dump(ctx, "str").Val()
+	if !strings.HasPrefix(payload, "\x00\x01v\xfc") {
+		t.Errorf("dump string %q", payload)
+	}
+	src.Restore(ctx, "str2", 0, payload)
+	if ttl := src.TTL(ctx, "str2").Val(); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("restored string ttl %v", ttl)
+	}
+	src.RestoreReplace(ctx, "str2", time.Minute, payload)
+	if ttl := src.TTL(ctx, "str2").Val(); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("restored string ttl %v with a ttl", ttl)
+	}
+	src.Del(ctx, "str2")
+	if payload := src.Dump(ctx, "stream").Val(); !strings.HasPrefix(payload, "GOKV") {
+		t.Errorf("dump stream %q", payload)
+	}
+	// the payload of DUMP of a key set to 10 by redis 7
+	if err := src.Restore(ctx, "redis", time.Hour, "\x00\xc0\n\n\x00n\x9fWE\x0e\xaec\xbb").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v := src.Get(ctx, "redis").Val(); v != "10" {
+		t.Errorf("restored redis string %q", v)
+	}
+	if ttl := src.TTL(ctx, "redis").Val(); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("restored redis string ttl %v", ttl)
+	}
+	hash := rdb.EncodeDump(&rdb.Entry{Type: rdb.Hash, Elems: [][]byte{[]byte("f"), []byte("v")}})
+	if err := src.Restore(ctx, "hash", 0, string(hash)).Err(); err != nil {
+		t.Errorf("restore hash: %v", err)
+	}
+	if payload := src.Dump(ctx, "hash").Val(); payload != string(hash) {
+		t.Errorf("dump hash %q", payload)
+	}
+	src.Del(ctx, "hash")
+	src.Del(ctx, "redis")
+
+	// single key with ttl
+	if err := src.Migrate(ctx, "127.0.0.1", "17311", "str", 0, time.Second).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if src.Exists(ctx, "str").Val() != 0 {
+		t.Error("migrated key still exists")
+	}
+	if v := dst.Get(ctx, "str").Val(); v != "v" {
+		t.Errorf("migrated string %q", v)
+	}
+	if ttl := dst.TTL(ctx, "str").Val(); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("migrated ttl %v", ttl)
+	}
+
+	// KEYS to another database with COPY
+	res, err := src.Do(ctx, "migrate", "127.0.0.1", "17311", "", 1, 1000, "copy", "keys", "set", "list", "zset", "stream", "nokey").Result()
+	if err != nil || res != "OK" {
+		t.Fatal(res, err)
+	}
+	if src.Exists(ctx, "set", "list", "zset", "stream").Val() != 4 {
+		t.Error("copied keys are deleted")
+	}
+	if v := dst1.SMembers(ctx, "set").Val(); len(v) != 3 {
+		t.Errorf("migrated set %v", v)
+	}
+	if v := dst1.LRange(ctx, "list", 0, -1).Val(); len(v) != 3 || v[0] != "1" || v[2] != "3" {
+		t.Errorf("migrated list %v", v)
+	}
+	if v := dst1.ZRangeWithScores(ctx, "zset", 0, -1).Val(); len(v) != 2 || v[1].Score != 2 {
+		t.Errorf("migrated zset %v", v)
+	}
+	if v := dst1.XRange(ctx, "stream", "-", "+").Val(); len(v) != 1 || v[0].ID != "1-1" {
+		t.Errorf("migrated stream %v", v)
+	}
+	if dst.Exists(ctx, "set").Val() != 0 {
+		t.Error("migrated to the wrong database")
+	}
+
+	// existing target keys need REPLACE
+	src.SAdd(ctx, "set", "d")
+	err = src.Do(ctx, "migrate", "127.0.0.1", "17311", "set", 1, 1000).Err()
+	if err == nil || err.Error() != "ERR Target instance replied with error: BUSYKEY Target key name already exists." {
+		t.Errorf("migrate busy key: %v", err)
+	}
+	if src.Exists(ctx, "set").Val() != 1 {
+		t.Error("failed key is deleted")
+	}
+	if err := src.Do(ctx, "migrate", "127.0.0.1", "17311", "set", 1, 1000, "replace").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := dst1.SCard(ctx, "set").Val(); n != 4 {
+		t.Errorf("replaced set card %d", n)
+	}
+
+	if v := src.Do(ctx, "migrate", "127.0.0.1", "17311", "nokey", 0, 1000).Val(); v != "NOKEY" {
+		t.Errorf("migrate missing key %v", v)
+	}
+	if err := src.Do(ctx, "migrate", "127.0.0.1", "1", "list", 0, 100).Err(); err == nil {
+		t.Error("migrate to closed port should fail")
+	}
+}
@@ -0,0 +1,104 @@
+package gokv
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// monitorWriteTimeout a monitor that can not take a command in the time is disconnected
+const monitorWriteTimeout = time.Second
+
+// monitor put the client in the MONITOR context, the commands of all clients are streamed to it
+// until it disconnects
+func (n *Server) monitor(client *Client, cmd *protocol.MonitorCmd) error {
+	if client.watch != nil {
+		cmd.Err = kverror.ErrWatching
+		return cmd.Write(client.wr)
+	}
+	// the pseudo client of the upstream has no connection to stream to
+	if !client.monitor && client.conn != nil {
+		client.monitor = true
+		n.monitors = append(n.monitors, client)
+	}
+	return cmd.Write(client.wr)
+}
+
+// feedMonitors write a command of client to the monitors, it runs on the receive loop
+func (n *Server) feedMonitors(ctx context.Context, client *Client, args []interface{}) {
+	line := monitorLine(time.Now(), client.db, client.addr.String(), args)
+	var alive = n.monitors[:0]
+	for _, m := range n.monitors {
+		select {
+		case <-m.closed:
+			continue
+		default:
+		}
+		m.conn.SetWriteDeadline(time.Now().Add(monitorWriteTimeout))
+		m.wr.WriteStatus(line)
+		if err := m.bw.Flush(); err != nil {
+			logger.Errorf(ctx, "feed monitor %s error:%v, it is disconnected", m.addr, err)
+			m.conn.Close()
+			continue
+		}
+		m.conn.SetWriteDeadline(time.Time{})
+		alive = append(alive, m)
+	}
+	for i := len(alive); i < len(n.monitors); i++ {
+		n.monitors[i] = nil
+	}
+	n.monitors = alive
+}
+
+// monitorLine format a command like redis, 1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+func monitorLine(now time.Time, db int, addr string, args []interface{}) []byte {
+	var line = make([]byte, 0, 64)
+	line = strconv.AppendInt(line, now.Unix(), 10)
+	line = append(line, fmt.Sprintf(".%06d [%d %s]", now.Nanosecond()/1000, db, addr)...)
+	for _, arg := range args {
+		line = append(line, ' ')
+		switch arg := arg.(type) {
+		case []byte:
+			line = appendRepr(line, arg)
+		case string:
+			line = appendRepr(line, []byte(arg))
+		default:
+			line = appendRepr(line, []byte(fmt.Sprint(arg)))
+		}
+	}
+	return line
+}
+
+// appendRepr append the quoted arg, the bytes not printable are escaped as \xhh like redis
+func appendRepr(line, arg []byte) []byte {
+	const hex = "0123456789abcdef"
+	line = append(line, '"')
+	for _, c := range arg {
+		switch c {
+		case '\\', '"':
+			line = append(line, '\\', c)
+		case '\n':
+			line = append(line, '\\', 'n')
+		case '\r':
+			line = append(line, '\\', 'r')
+		case '\t':
+			line = append(line, '\\', 't')
+		case '\a':
+			line = append(line, '\\', 'a')
+		case '\b':
+			line = append(line, '\\', 'b')
+		default:
+			if c < 0x20 || c > 0x7e {
+				line = append(line, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				line = append(line, c)
+			}
+		}
+	}
+	return append(line, '"')
+}
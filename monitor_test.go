@@ -0,0 +1,52 @@
+package gokv_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMonitor(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17741)
+	conn, err := net.Dial("tcp", "127.0.0.1:17741")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	rd := bufio.NewReader(conn)
+	conn.Write([]byte("*1\r\n$7\r\nMONITOR\r\n"))
+	if line, _ := rd.ReadString('\n'); line != "+OK\r\n" {
+		t.Fatalf("monitor reply %q", line)
+	}
+
+	db1 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17741", DB: 1})
+	defer db1.Close()
+	cli.Set(ctx, "k", "a\"b\n\x00", 0)
+	db1.Get(ctx, "k")
+	for _, expect := range []string{
+		`^\+\d+\.\d{6} \[0 127\.0\.0\.1:\d+\] "set" "k" "a\\"b\\n\\x00"\r\n$`,
+		`^\+\d+\.\d{6} \[0 127\.0\.0\.1:\d+\] "select" "1"\r\n$`,
+		`^\+\d+\.\d{6} \[1 127\.0\.0\.1:\d+\] "get" "k"\r\n$`,
+	} {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(expect).MatchString(line) {
+			t.Errorf("monitor line %q, expect %s", line, expect)
+		}
+	}
+
+	// only ping is allowed in the monitor context
+	conn.Write([]byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"))
+	if line, _ := rd.ReadString('\n'); line != "-ERR only PING is allowed in the MONITOR context\r\n" {
+		t.Errorf("command in monitor context %q", line)
+	}
+}
@@ -0,0 +1,96 @@
+package gokv_test
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIncrByFloat(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18161)
+	if v := cli.IncrByFloat(ctx, "f", 10.5).Val(); v != 10.5 {
+		t.Errorf("incrbyfloat of a missing key %v", v)
+	}
+	if v, err := cli.Do(ctx, "INCRBYFLOAT", "f", "0.1").Text(); v != "10.6" {
+		t.Errorf("incrbyfloat %q %v", v, err)
+	}
+
+	// NaN and infinite increments and results are not stored
+	for _, incr := range []string{"inf", "-inf", "+Inf", "nan"} {
+		err := cli.Do(ctx, "INCRBYFLOAT", "f", incr).Err()
+		if err == nil || err.Error() != "ERR increment would produce NaN or Infinity" {
+			t.Errorf("incrbyfloat %s %v", incr, err)
+		}
+	}
+	if err := cli.Do(ctx, "INCRBYFLOAT", "nof", "inf").Err(); err == nil || cli.Exists(ctx, "nof").Val() != 0 {
+		t.Errorf("incrbyfloat inf of a missing key %v", err)
+	}
+	cli.Set(ctx, "max", "1.1e4932", 0)
+	err := cli.Do(ctx, "INCRBYFLOAT", "max", "1.1e4932").Err()
+	if err == nil || err.Error() != "ERR increment would produce NaN or Infinity" {
+		t.Errorf("incrbyfloat overflow %v", err)
+	}
+	if v := cli.Get(ctx, "max").Val(); v != "1.1e4932" {
+		t.Errorf("the overflowed value %q is stored", v)
+	}
+	if v := cli.Get(ctx, "f").Val(); v != "10.6" {
+		t.Errorf("f %q after the failed increments", v)
+	}
+	if err := cli.Do(ctx, "INCRBYFLOAT", "f", "abc").Err(); err == nil || err.Error() != "ERR value is not a valid float" {
+		t.Errorf("incrbyfloat abc %v", err)
+	}
+}
+
+func TestHIncrByFloat(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18191)
+	if v, err := cli.Do(ctx, "HINCRBYFLOAT", "h", "f", "10.5").Text(); v != "10.5" {
+		t.Errorf("hincrbyfloat of a missing key %q %v", v, err)
+	}
+	if v, err := cli.Do(ctx, "HINCRBYFLOAT", "h", "f", "0.1").Text(); v != "10.6" {
+		t.Errorf("hincrbyfloat %q %v", v, err)
+	}
+	if v, err := cli.Do(ctx, "HINCRBYFLOAT", "h", "e", "5.0e3").Text(); v != "5000" {
+		t.Errorf("hincrbyfloat of a missing field %q %v", v, err)
+	}
+	for _, incr := range []string{"inf", "nan"} {
+		err := cli.Do(ctx, "HINCRBYFLOAT", "h", "f", incr).Err()
+		if err == nil || err.Error() != "ERR increment would produce NaN or Infinity" {
+			t.Errorf("hincrbyfloat %s %v", incr, err)
+		}
+	}
+	cli.HSet(ctx, "h", "max", "1.1e4932", "s", "abc", "empty", "")
+	err := cli.Do(ctx, "HINCRBYFLOAT", "h", "max", "1.1e4932").Err()
+	if err == nil || err.Error() != "ERR increment would produce NaN or Infinity" || cli.HGet(ctx, "h", "max").Val() != "1.1e4932" {
+		t.Errorf("hincrbyfloat overflow %v", err)
+	}
+	for _, field := range []string{"s", "empty"} {
+		if err := cli.Do(ctx, "HINCRBYFLOAT", "h", field, "1").Err(); err == nil || err.Error() != "ERR hash value is not a float" {
+			t.Errorf("hincrbyfloat of %s %v", field, err)
+		}
+	}
+	if v := cli.HGet(ctx, "h", "f").Val(); v != "10.6" || cli.HLen(ctx, "h").Val() != 5 {
+		t.Errorf("f %q after the failed increments", v)
+	}
+
+	// hincrby
+	if v, err := cli.HIncrBy(ctx, "h", "i", 5).Result(); v != 5 || err != nil {
+		t.Errorf("hincrby of a missing field %d %v", v, err)
+	}
+	if v := cli.HIncrBy(ctx, "h", "i", -7).Val(); v != -2 {
+		t.Errorf("hincrby %d", v)
+	}
+	cli.HSet(ctx, "h", "big", "9223372036854775807")
+	if err := cli.HIncrBy(ctx, "h", "big", 1).Err(); err == nil || err.Error() != "ERR increment or decrement would overflow" {
+		t.Errorf("hincrby overflow %v", err)
+	}
+	for _, field := range []string{"f", "s"} {
+		if err := cli.HIncrBy(ctx, "h", field, 1).Err(); err == nil || err.Error() != "ERR hash value is not an integer" {
+			t.Errorf("hincrby of %s %v", field, err)
+		}
+	}
+	cli.Set(ctx, "str", "1", 0)
+	if err := cli.HIncrBy(ctx, "str", "f", 1).Err(); err == nil || err.Error() != "WRONGTYPE Operation against a key holding the wrong kind of value" {
+		t.Errorf("hincrby of a string %v", err)
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"path"
 	"runtime/debug"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yixinin/gokv/codec"
@@ -59,23 +61,62 @@ type RaftKv struct {
 
 	fs *os.File
 
+	// applyMu guards the store from being applied while a snapshot is taken,
+	// applied is written under applyMu and read by appliedIndex
+	applyMu sync.Mutex
+	applied uint64
+
+	// watches the history of the applied changes for KVWATCH
+	watches *watchHub
+
+	// waits the clients blocked on keys
+	waits *waitRegistry
+
+	// feed the change feed of the applied submits, nil if disabled
+	feed *changeFeed
+
+	// keyCounts the number of keys of each database, maintained by apply
+	keyCounts []int64
+
+	metrics *kvMetrics
+
+	// settings the settings changed by CONFIG SET
+	settings *settings
+
 	*_baseImpl
 	*_numImpl
 	*_ttlImpl
-	db kvstore.Kvstore // we use leveldb to store key-value data
+	*_bitmapImpl
+	*_setImpl
+	*_streamImpl
+	*_listImpl
+	*_zsetImpl
+	*_hashImpl
+	*_hllImpl
+	*_geoImpl
+	*_keyspaceImpl
+	*_dumpImpl
+	*_revisionImpl
+	*_casImpl
+	*_leaseImpl
+	db  kvstore.Kvstore // we use leveldb to store key-value data
+	dbs *kvstore.DBStore
 }
 
 // NewRaftKv create kvs
 func NewRaftKv(nodeID uint64, cfg *Config) *RaftKv {
 	s := &RaftKv{
-		nodeID: nodeID,
-		cfg:    cfg,
+		nodeID:   nodeID,
+		cfg:      cfg,
+		waits:    newWaitRegistry(),
+		settings: newSettings(cfg.ServerCfg),
 	}
 	node := cfg.FindClusterNode(nodeID)
 	if node == nil {
 		logger.Errorf(context.TODO(), "could not find self node(%v) in cluster config: \n(%v)", nodeID, cfg.String())
 	}
 	s.node = node
+	s.metrics = newKvMetrics(s)
 	return s
 }
 
@@ -83,6 +124,15 @@ func NewRaftKv(nodeID uint64, cfg *Config) *RaftKv {
 func (s *RaftKv) Run(ctx context.Context) {
 	// init store
 	s.initLeveldb(ctx)
+	if s.cfg.FeedCfg.Path != "" {
+		feed, err := newChangeFeed(s.cfg.FeedCfg)
+		if err != nil {
+			logger.Errorf(ctx, "open change feed failed: %v, path: %v", err, s.cfg.FeedCfg.Path)
+			panic(err)
+		}
+		s.feed = feed
+	}
+	s.watches = newWatchHub(s.cfg.ServerCfg.WatchHistory, s.applied)
 	// start raft
 	s.startRaft(ctx)
 }
@@ -95,6 +145,10 @@ func (s *RaftKv) Stop(ctx context.Context) {
 		s.rs.Stop()
 	}
 
+	if err := s.feed.Close(); err != nil {
+		logger.Errorf(ctx, "close change feed failed: %v", err)
+	}
+
 	// close leveldb
 	if s.db != nil {
 		if err := s.db.Close(ctx); err != nil {
@@ -114,10 +168,30 @@ func (s *RaftKv) initLeveldb(ctx context.Context) {
 		logger.Errorf(ctx, "init leveldb failed: %v, path: %v", err, dbPath)
 		panic(err)
 	}
-	s.db = db
+	dbs, err := kvstore.NewDBStore(ctx, db, s.cfg.ServerCfg.Databases)
+	if err != nil {
+		logger.Errorf(ctx, "init databases failed: %v, databases: %v", err, s.cfg.ServerCfg.Databases)
+		panic(err)
+	}
+	s.db = dbs
+	s.dbs = dbs
 	s._baseImpl = NewBaseImpl(s.db)
 	s._numImpl = NewNumImpl(s.db)
 	s._ttlImpl = NewTTLImpl(s.db)
+	s._bitmapImpl = NewBitmapImpl(s.db)
+	s._setImpl = NewSetImpl(s.db)
+	s._streamImpl = NewStreamImpl(s.db)
+	s._listImpl = NewListImpl(s.db)
+	s._zsetImpl = NewZSetImpl(s.db)
+	s._hashImpl = NewHashImpl(s.db)
+	s._hllImpl = NewHLLImpl(s.db)
+	s._geoImpl = NewGeoImpl(s.db, s._zsetImpl)
+	s._keyspaceImpl = NewKeyspaceImpl(s.db, s.dbs)
+	s._dumpImpl = NewDumpImpl(s.db)
+	s._revisionImpl = NewRevisionImpl(s.db, s.cfg.ServerCfg.RevisionRetention > 0)
+	s._casImpl = NewCASImpl(s.db)
+	s._leaseImpl = NewLeaseImpl(s.db)
+	s.loadKeyCounts(ctx)
 	logger.Infof(ctx, "init leveldb sucessfully. path: %v", dbPath)
 
 	idxPath := path.Join(s.cfg.ServerCfg.DataPath, "applied.index")
@@ -126,6 +200,7 @@ func (s *RaftKv) initLeveldb(ctx context.Context) {
 		panic(err)
 	}
 	s.fs = fs
+	s.applied = s.getAppliedIndex()
 }
 
 func (s *RaftKv) startRaft(ctx context.Context) {
@@ -146,8 +221,7 @@ func (s *RaftKv) startRaft(ctx context.Context) {
 	logger.Info(ctx, "raft server started.")
 
 	// create raft
-	walPath := path.Join(s.cfg.ServerCfg.DataPath, "wal")
-	raftStore, err := wal.NewStorage(walPath, &wal.Config{})
+	raftStore, err := wal.NewStorage(s.walPath(), &wal.Config{})
 	if err != nil {
 		logger.Errorf(ctx, "init raft log storage failed: %v", err)
 		panic(err)
@@ -156,7 +230,7 @@ func (s *RaftKv) startRaft(ctx context.Context) {
 		ID:           DefaultClusterID,
 		Storage:      raftStore,
 		StateMachine: s,
-		Applied:      s.getAppliedIndex(),
+		Applied:      s.applied,
 	}
 	for _, n := range s.cfg.ClusterCfg.Nodes {
 		rc.Peers = append(rc.Peers, proto.Peer{
@@ -173,6 +247,10 @@ func (s *RaftKv) startRaft(ctx context.Context) {
 	logger.Info(ctx, "raft created.")
 }
 
+func (s *RaftKv) walPath() string {
+	return path.Join(s.cfg.ServerCfg.DataPath, "wal")
+}
+
 // Apply implement raft StateMachine Apply method
 func (s *RaftKv) Apply(command []byte, index uint64) (interface{}, error) {
 	var submits []*Submit
@@ -181,14 +259,83 @@ func (s *RaftKv) Apply(command []byte, index uint64) (interface{}, error) {
 		return false, fmt.Errorf("unmarshal command failed: %v", command)
 	}
 
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	// the submits of the entry are written in one transaction, nothing is written if one fails
+	txn := s.dbs.Begin(context.Background())
+	s.waits.Hold()
+	defer s.waits.Release()
+	var events []watchEvent
+	var result = applyResult{index: index, ok: true}
+	var applied = make([]*Submit, 0, len(submits))
 	for _, submit := range submits {
-		err := s.apply(context.Background(), submit, index)
+		ctx := kvstore.WithDB(txn, submit.DB)
+		resolved, ok, err := s.resolve(ctx, submit, index)
 		if err != nil {
-			return false, err
+			return false, s.discard(txn, index, err)
+		}
+		if !ok {
+			result.ok = false
+			continue
+		}
+		for _, submit := range resolved {
+			var existed bool
+			if submit.OP == CommitOPDel || submit.OP == CommitOPExDel {
+				existed = s.keyExists(ctx, submit.Key)
+			}
+			err := s.apply(ctx, submit, index)
+			if err != nil {
+				return false, s.discard(txn, index, err)
+			}
+			if !isInternalKey(submit.Key) {
+				s.waits.Touch(submit.DB, submit.Key)
+				events = append(events, s.changes(ctx, submit, index, existed)...)
+			}
+			applied = append(applied, submit)
 		}
-		go s.updateAppliedIndex(index)
 	}
-	return true, nil
+	if err := s.dbs.Commit(txn); err != nil {
+		return false, s.discard(txn, index, err)
+	}
+	go s.updateAppliedIndex(index)
+	s.feed.write(context.Background(), index, applied)
+	s.watches.publish(events)
+	atomic.StoreUint64(&s.applied, index)
+	return result, nil
+}
+
+// discard drop the writes of a raft entry which failed to apply, the key counters and the
+// mapping of the databases kept in memory are loaded again
+func (s *RaftKv) discard(ctx context.Context, index uint64, err error) error {
+	logger.Errorf(ctx, "apply entry at index %d error:%v, the entry is discarded", index, err)
+	if err := s.dbs.Discard(ctx); err != nil {
+		logger.Errorf(ctx, "reload the databases error:%v", err)
+	}
+	s.loadKeyCounts(context.Background())
+	return err
+}
+
+// resolve the submits a conditional submit makes when it is applied at index,
+// ok is false if its condition does not hold
+func (s *RaftKv) resolve(ctx context.Context, st *Submit, index uint64) (submits []*Submit, ok bool, err error) {
+	switch st.OP {
+	case CommitOPCAS, CommitOPCAD:
+		resolved, ok, err := s.compare(ctx, st)
+		if !ok {
+			return nil, false, err
+		}
+		return []*Submit{resolved}, true, nil
+	case CommitOPMSetNX:
+		return s.msetNX(ctx, st)
+	case CommitOPLease:
+		return s.resolveLease(ctx, st, index)
+	}
+	return []*Submit{st}, true, nil
+}
+
+func (s *RaftKv) appliedIndex() uint64 {
+	return atomic.LoadUint64(&s.applied)
 }
 
 func (s *RaftKv) updateAppliedIndex(index uint64) {
@@ -198,20 +345,25 @@ func (s *RaftKv) updateAppliedIndex(index uint64) {
 
 func (s *RaftKv) getAppliedIndex() uint64 {
 	var b = make([]byte, 8)
-	n, _ := s.fs.Read(b)
+	n, _ := s.fs.ReadAt(b, 0)
 	if n != 8 {
 		return 0
 	}
 	return binary.BigEndian.Uint64(b)
 }
 
-func (s *RaftKv) apply(ctx context.Context, cmd *Submit, index uint64) error {
+func (s *RaftKv) apply(ctx context.Context, cmd *Submit, index uint64) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Errorf(ctx, "apply set [%s %v] error:%v, stacks:%s", cmd.Key, cmd.Value, r, debug.Stack())
+			err = fmt.Errorf("apply panic: %v", r)
 		}
 	}()
 	switch cmd.OP {
+	case CommitOPSet, CommitOPDel, CommitOPExDel, CommitOPSAdd, CommitOPSRem:
+		defer s.countKey(ctx, cmd.Key, s.keyExists(ctx, cmd.Key))
+	}
+	switch cmd.OP {
 	case CommitOPSet:
 		if logger.EnableDebug() && s.leader != s.nodeID {
 			v := codec.Decode(cmd.Value)
@@ -223,7 +375,16 @@ func (s *RaftKv) apply(ctx context.Context, cmd *Submit, index uint64) error {
 				logger.Debugf(ctx, "apply set command at index(%v) key:%s : %v, long live", index, cmd.Key, val)
 			}
 		}
-		err := s.db.Set(ctx, cmd.Key, cmd.Value)
+		err := s.clearSubKeys(ctx, cmd.Key, codec.Decode(cmd.Value).Type())
+		if err == nil {
+			err = s.detachLease(ctx, cmd.Key)
+		}
+		if err == nil {
+			err = s.db.Set(ctx, cmd.Key, cmd.Value)
+		}
+		if err == nil {
+			err = s.addRevision(ctx, cmd.Key, cmd.Value, index)
+		}
 		if err != nil {
 			logger.Errorf(ctx, "apply set [%s %v] error:%v", cmd.Key, cmd.Value, err)
 		}
@@ -232,7 +393,16 @@ func (s *RaftKv) apply(ctx context.Context, cmd *Submit, index uint64) error {
 		if logger.EnableDebug() && s.leader != s.nodeID {
 			logger.Debugf(ctx, "apply del command at index(%v) key:%s", index, cmd.Key)
 		}
-		err := s.db.Delete(ctx, cmd.Key)
+		err := s.clearSubKeys(ctx, cmd.Key, codec.NIL)
+		if err == nil {
+			err = s.detachLease(ctx, cmd.Key)
+		}
+		if err == nil {
+			err = s.db.Delete(ctx, cmd.Key)
+		}
+		if err == nil {
+			err = s.addRevision(ctx, cmd.Key, nil, index)
+		}
 		if err != nil {
 			logger.Errorf(ctx, "apply del [%s] error:%v", cmd.Key, err)
 		}
@@ -249,33 +419,96 @@ func (s *RaftKv) apply(ctx context.Context, cmd *Submit, index uint64) error {
 			return err
 		}
 		if codec.Decode(data).Expired(uint64(time.Now().Unix())) {
-			err := s.db.Delete(ctx, cmd.Key)
+			err := s.clearSubKeys(ctx, cmd.Key, codec.NIL)
+			if err == nil {
+				err = s.detachLease(ctx, cmd.Key)
+			}
+			if err == nil {
+				err = s.db.Delete(ctx, cmd.Key)
+			}
+			if err == nil {
+				err = s.addRevision(ctx, cmd.Key, nil, index)
+			}
 			if err != nil {
 				logger.Errorf(ctx, "apply exdel [%s] error:%v", cmd.Key, err)
 			}
 			return err
 		}
+	case CommitOPSAdd:
+		err := s.applySAdd(ctx, cmd)
+		if err != nil {
+			logger.Errorf(ctx, "apply sadd [%s %s] error:%v", cmd.Key, cmd.Value, err)
+		}
+		return err
+	case CommitOPSRem:
+		err := s.applySRem(ctx, cmd)
+		if err != nil {
+			logger.Errorf(ctx, "apply srem [%s %s] error:%v", cmd.Key, cmd.Value, err)
+		}
+		return err
+	case CommitOPSubSet:
+		err := s.db.Set(ctx, cmd.Key, cmd.Value)
+		if err != nil {
+			logger.Errorf(ctx, "apply subset [%q] error:%v", cmd.Key, err)
+		}
+		return err
+	case CommitOPSubDel:
+		err := s.db.Delete(ctx, cmd.Key)
+		if err != nil {
+			logger.Errorf(ctx, "apply subdel [%q] error:%v", cmd.Key, err)
+		}
+		return err
+	case CommitOPFlush:
+		if logger.EnableDebug() && s.leader != s.nodeID {
+			logger.Debugf(ctx, "apply flush command at index(%v) prefix:%q", index, cmd.Key)
+		}
+		err := s.flush(ctx, cmd.Key, index)
+		if err != nil {
+			logger.Errorf(ctx, "apply flush [%q] error:%v", cmd.Key, err)
+			return err
+		}
+		s.setKeyCount(ctx, 0)
+		return nil
+	case CommitOPFlushAll:
+		if logger.EnableDebug() && s.leader != s.nodeID {
+			logger.Debugf(ctx, "apply flushall command at index(%v)", index)
+		}
+		for db := 0; db < s.dbs.Databases(); db++ {
+			ctx := kvstore.WithDB(ctx, db)
+			if err := s.flush(ctx, nil, index); err != nil {
+				logger.Errorf(ctx, "apply flushall db %d error:%v", db, err)
+				return err
+			}
+			s.setKeyCount(ctx, 0)
+		}
+		return nil
+	case CommitOPSwapDB:
+		err := s.applySwapDB(ctx, int(codec.Bytes2Int64(cmd.Key)), int(codec.Bytes2Int64(cmd.Value)), index)
+		if err != nil {
+			logger.Errorf(ctx, "apply swapdb [%v] error:%v", cmd, err)
+		}
+		return err
+	case CommitOPCopy:
+		err := s.applyCopy(ctx, cmd, index)
+		if err != nil {
+			logger.Errorf(ctx, "apply copy [%q %q] error:%v", cmd.Key, cmd.Value, err)
+		}
+		return err
 	}
 	return nil
 }
 
+// applyResult the result of a raft entry applied, ok is false if a compare of the entry does not match
+type applyResult struct {
+	index uint64
+	ok    bool
+}
+
 // ApplyMemberChange implement raft.StateMachine
 func (s *RaftKv) ApplyMemberChange(confChange *proto.ConfChange, index uint64) (interface{}, error) {
 	return nil, nil
 }
 
-// Snapshot implement raft.StateMachine
-func (s *RaftKv) Snapshot() (proto.Snapshot, error) {
-	// return s.db.GetSnapshot(context.Background())
-	return nil, errors.New("not supported")
-}
-
-// ApplySnapshot implement raft.StateMachine
-func (s *RaftKv) ApplySnapshot(peers []proto.Peer, iter proto.SnapIterator) error {
-	// s.db.RecoverFromSnapshot(context)
-	return errors.New("not supported")
-}
-
 // HandleFatalEvent implement raft.StateMachine
 func (s *RaftKv) HandleFatalEvent(err *raft.FatalError) {
 	logger.Errorf(context.TODO(), "raft fatal error: %v", err)
@@ -307,8 +540,9 @@ func (s *RaftKv) StartSubmit(ctx context.Context) (func(submits ...*Submit) (boo
 	return submit, true
 }
 
-func (s *RaftKv) SubmitAsync(submits ...*Submit) {
-	go s.process(context.Background(), submits...)
+func (s *RaftKv) SubmitAsync(ctx context.Context, submits ...*Submit) {
+	// the command does not wait for the proposal, it is not timed
+	go s.process(withTiming(ctx, nil), submits...)
 }
 
 func (s *RaftKv) getLeader() *ClusterNode {
@@ -316,24 +550,39 @@ func (s *RaftKv) getLeader() *ClusterNode {
 }
 
 func (s *RaftKv) process(ctx context.Context, submits ...*Submit) (ok bool, err error) {
+	r, err := s.propose(ctx, submits...)
+	return r.ok, err
+}
+
+// propose submit to raft and wait for the result of the entry applied on the leader
+func (s *RaftKv) propose(ctx context.Context, submits ...*Submit) (r applyResult, err error) {
 	if len(submits) == 0 || submits[0] == nil {
 		return
 	}
+	db := kvstore.DBFromContext(ctx)
+	for _, st := range submits {
+		st.DB = db
+	}
 	data, err := json.Marshal(submits)
 	if err != nil {
 		logger.Errorf(ctx, "marshal raft command failed: %v", err)
 		return
 	}
 
+	start := time.Now()
+	defer func() {
+		s.metrics.proposal(start, err)
+		addProposeTime(ctx, time.Since(start))
+	}()
 	f := s.rs.Submit(DefaultClusterID, data)
 	respCh, errCh := f.AsyncResponse()
 	select {
 	case resp := <-respCh:
-		ok, _ = resp.(bool)
+		r, _ = resp.(applyResult)
 		return
 	case err = <-errCh:
 		return
-	case <-time.After(DefaultRequestTimeout):
+	case <-time.After(s.settings.RequestTimeout()):
 		err = os.ErrDeadlineExceeded
 		return
 	}
@@ -352,7 +601,7 @@ func (s *RaftKv) getByReadIndex(ctx context.Context, key string) ([]byte, error)
 
 	case err := <-errCh:
 		return nil, err
-	case <-time.After(DefaultRequestTimeout):
+	case <-time.After(s.settings.RequestTimeout()):
 		return nil, os.ErrDeadlineExceeded
 	}
 }
@@ -0,0 +1,176 @@
+package gokv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/rdb"
+	"github.com/yixinin/raft/proto"
+	"github.com/yixinin/raft/storage/wal"
+)
+
+// rdbSnapshotIndex the raft index of the data imported from a rdb file
+const rdbSnapshotIndex = 1
+
+// ImportRDB load a redis rdb file into the store of a fresh node before it is started.
+// the loaded data becomes the raft snapshot at index 1, so the node is started with the
+// data applied and the other nodes of the cluster bootstrap from it once it is the leader.
+// start the imported node first, a fresh node can not win the election against it.
+func (s *RaftKv) ImportRDB(ctx context.Context, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s.initLeveldb(ctx)
+	defer s.fs.Close()
+	defer s.Stop(ctx)
+	raftStore, err := wal.NewStorage(s.walPath(), &wal.Config{})
+	if err != nil {
+		return err
+	}
+	defer raftStore.Close()
+	if err := s.checkFresh(ctx, raftStore); err != nil {
+		return err
+	}
+
+	// a key of an unsupported type or a reserved key fails the import before any key is loaded
+	err = rdb.Parse(f, rdbCheck)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var now = uint64(time.Now().Unix())
+	var loaded = make(map[rdb.Type]int)
+	var expired int
+	err = rdb.Parse(f, func(e *rdb.Entry) error {
+		if e.DB >= s.dbs.Databases() {
+			return fmt.Errorf("db %d of key %q is out of %d databases", e.DB, e.Key, s.dbs.Databases())
+		}
+		var ex uint64
+		if e.ExpireAt > 0 {
+			ex = (uint64(e.ExpireAt) + 999) / 1000
+			if ex <= now {
+				expired++
+				return nil
+			}
+		}
+		submits, err := rdbSubmits(e, ex)
+		if err != nil {
+			return err
+		}
+		ctx := kvstore.WithDB(ctx, e.DB)
+		for _, st := range submits {
+			if err := s.apply(ctx, st, rdbSnapshotIndex); err != nil {
+				return err
+			}
+		}
+		loaded[e.Type]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the log before the snapshot is truncated, followers receive the snapshot instead
+	if err := raftStore.ApplySnapshot(proto.SnapshotMeta{Index: rdbSnapshotIndex, Term: 1}); err != nil {
+		return err
+	}
+	if err := raftStore.StoreHardState(proto.HardState{Term: 1, Commit: rdbSnapshotIndex}); err != nil {
+		return err
+	}
+	s.applied = rdbSnapshotIndex
+	s.updateAppliedIndex(rdbSnapshotIndex)
+
+	logger.Infof(ctx, "imported rdb %s, loaded: %v, expired: %d", file, loaded, expired)
+	return nil
+}
+
+// checkFresh the node to import into must have no raft log and no keys
+func (s *RaftKv) checkFresh(ctx context.Context, raftStore *wal.Storage) error {
+	last, err := raftStore.LastIndex()
+	if err != nil {
+		return err
+	}
+	if last != 0 || s.applied != 0 {
+		return errors.New("the node has raft logs, import into a fresh node")
+	}
+	for db := 0; db < s.dbs.Databases(); db++ {
+		if atomic.LoadInt64(s.keyCount(kvstore.WithDB(ctx, db))) != 0 {
+			return fmt.Errorf("db %d has keys, import into a fresh node", db)
+		}
+	}
+	return nil
+}
+
+// rdbSupported whether the keys of the rdb type can be loaded
+func rdbSupported(t rdb.Type) bool {
+	switch t {
+	case rdb.String, rdb.List, rdb.Set, rdb.ZSet, rdb.Hash:
+		return true
+	}
+	return false
+}
+
+// rdbTypeError the error of a rdb key of an unsupported type, the key is never dropped silently
+func rdbTypeError(e *rdb.Entry) error {
+	return fmt.Errorf("key %q of db %d is a %s, the type is not supported", e.Key, e.DB, e.Type)
+}
+
+// rdbCheck fail on a key of a rdb file which can not be loaded
+func rdbCheck(e *rdb.Entry) error {
+	if isInternalKey(e.Key) {
+		return fmt.Errorf("key %q of db %d starts with 0xff, the keys are reserved", e.Key, e.DB)
+	}
+	if !rdbSupported(e.Type) {
+		return rdbTypeError(e)
+	}
+	return nil
+}
+
+// rdbSubmits the submits to store a key of a rdb file, it fails if the key can not be loaded
+func rdbSubmits(e *rdb.Entry, ex uint64) ([]*Submit, error) {
+	if err := rdbCheck(e); err != nil {
+		return nil, err
+	}
+	switch e.Type {
+	case rdb.String:
+		return []*Submit{NewSetSubmit(e.Key, e.Value, ex)}, nil
+	case rdb.List:
+		m := &listMeta{Head: listInitHead, ex: ex}
+		submits := push(e.Key, m, false, e.Elems)
+		return append(submits, m.submit(e.Key)), nil
+	case rdb.Set:
+		var submits = make([]*Submit, 0, len(e.Elems)+1)
+		for _, member := range e.Elems {
+			submits = append(submits, NewSubSetSubmit(subKey(setKeyTag, e.Key, member), nil))
+		}
+		return append(submits, NewSetRawSubmit(e.Key, codec.EncodeMeta(codec.SetType, int64(len(e.Elems)), ex).Raw())), nil
+	case rdb.ZSet:
+		var submits = make([]*Submit, 0, 2*len(e.Members)+1)
+		for _, m := range e.Members {
+			submits = append(submits, zsetSetSubmits(e.Key, m.Member, m.Score)...)
+		}
+		m := &zsetMeta{Len: int64(len(e.Members)), ex: ex}
+		return append(submits, m.submit(e.Key)), nil
+	case rdb.Hash:
+		var fields, vals = make([][]byte, 0, len(e.Elems)/2), make([][]byte, 0, len(e.Elems)/2)
+		for i := 0; i+1 < len(e.Elems); i += 2 {
+			fields, vals = append(fields, e.Elems[i]), append(vals, e.Elems[i+1])
+		}
+		return hashSetSubmits(e.Key, fields, vals, ex), nil
+	}
+	return nil, rdbTypeError(e)
+}
@@ -0,0 +1,134 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// the serialized value of the DUMP command of redis:
+//
+//	value type | value | [expire trailer] | rdb version | crc64
+//
+// the value is encoded like in a rdb file, the version is 2 bytes and the crc64 8 bytes, both
+// little endian. the crc64 covers all bytes before it. redis does not write the expire trailer,
+// gokv writes the expire time of the key there as the opcode of a rdb file and 8 bytes of unix
+// milliseconds. RESTORE of redis stops reading after the value, so it ignores the trailer.
+
+// DumpVersion the rdb version of the values serialized by EncodeDump, redis 5 and later restore them
+const DumpVersion = 9
+
+const dumpFooterSize = 10
+
+// EncodeDump serialize the value of e in the DUMP format of redis, the expire time is in the trailer
+// and the key is not serialized
+func EncodeDump(e *Entry) []byte {
+	var b []byte
+	switch e.Type {
+	case String:
+		b = append(b, typeString)
+		b = appendString(b, e.Value)
+	case List, Set, Hash:
+		switch e.Type {
+		case List:
+			b = append(b, typeList)
+			b = appendLength(b, uint64(len(e.Elems)))
+		case Set:
+			b = append(b, typeSet)
+			b = appendLength(b, uint64(len(e.Elems)))
+		case Hash:
+			b = append(b, typeHash)
+			b = appendLength(b, uint64(len(e.Elems)/2))
+		}
+		for _, elem := range e.Elems {
+			b = appendString(b, elem)
+		}
+	case ZSet:
+		b = append(b, typeZSet2)
+		b = appendLength(b, uint64(len(e.Members)))
+		var score = make([]byte, 8)
+		for _, m := range e.Members {
+			b = appendString(b, m.Member)
+			binary.LittleEndian.PutUint64(score, math.Float64bits(m.Score))
+			b = append(b, score...)
+		}
+	}
+	if e.ExpireAt > 0 {
+		var ex = make([]byte, 8)
+		binary.LittleEndian.PutUint64(ex, uint64(e.ExpireAt))
+		b = append(append(b, opExpireTimeMs), ex...)
+	}
+	b = append(b, DumpVersion&0xff, DumpVersion>>8)
+	var sum = make([]byte, 8)
+	binary.LittleEndian.PutUint64(sum, crc(0, b))
+	return append(b, sum...)
+}
+
+// DecodeDump parse a value serialized by the DUMP command of redis, the key of the entry is empty
+// and the expire time is 0 unless the payload has the expire trailer
+func DecodeDump(b []byte) (*Entry, error) {
+	if len(b) < dumpFooterSize+1 {
+		return nil, ErrFormat
+	}
+	body, footer := b[:len(b)-dumpFooterSize], b[len(b)-dumpFooterSize:]
+	version := int(binary.LittleEndian.Uint16(footer))
+	if version > MaxVersion {
+		return nil, fmt.Errorf("rdb: unsupported version %d", version)
+	}
+	if binary.LittleEndian.Uint64(footer[2:]) != crc(0, b[:len(b)-8]) {
+		return nil, ErrChecksum
+	}
+	p := &parser{rd: bufio.NewReader(bytes.NewReader(body)), version: version}
+	t, err := p.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var e = &Entry{}
+	if err := p.readValue(t, e); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrFormat
+		}
+		return nil, err
+	}
+	op, err := p.rd.ReadByte()
+	if err == io.EOF {
+		return e, nil
+	}
+	if err != nil || op != opExpireTimeMs {
+		return nil, ErrFormat
+	}
+	ex, err := p.read(8)
+	if err != nil {
+		return nil, ErrFormat
+	}
+	e.ExpireAt = int64(binary.LittleEndian.Uint64(ex))
+	if _, err := p.rd.ReadByte(); err != io.EOF {
+		return nil, ErrFormat
+	}
+	return e, nil
+}
+
+// appendLength append a length in the shortest of the 6, 14, 32 and 64 bits encodings
+func appendLength(b []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(b, byte(n))
+	case n < 1<<14:
+		return append(b, 0x40|byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		var data = make([]byte, 4)
+		binary.BigEndian.PutUint32(data, uint32(n))
+		return append(append(b, 0x80), data...)
+	}
+	var data = make([]byte, 8)
+	binary.BigEndian.PutUint64(data, n)
+	return append(append(b, 0x81), data...)
+}
+
+// appendString append a string as its length and bytes, without the int and lzf encodings
+func appendString(b, s []byte) []byte {
+	return append(appendLength(b, uint64(len(s))), s...)
+}
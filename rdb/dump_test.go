@@ -0,0 +1,48 @@
+package rdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	// the payload of DUMP of a key set to 10 by redis 7
+	e, err := DecodeDump([]byte("\x00\xc0\n\n\x00n\x9fWE\x0e\xaec\xbb"))
+	if err != nil || e.Type != String || string(e.Value) != "10" {
+		t.Fatalf("decode redis dump %+v %v", e, err)
+	}
+
+	long := []byte(strings.Repeat("x", 20000))
+	entries := []*Entry{
+		{Type: String, Value: []byte("v")},
+		{Type: String, Value: long},
+		{Type: List, Elems: [][]byte{[]byte("a"), long, []byte("c")}},
+		{Type: Set, Elems: [][]byte{[]byte("x"), []byte("y")}},
+		{Type: ZSet, Members: []Member{{[]byte("m1"), 1.5}, {[]byte("m2"), -2}}},
+		{Type: Hash, Elems: [][]byte{[]byte("f"), []byte("v")}},
+		{Type: String, Value: []byte("ex"), ExpireAt: 1700000000123},
+	}
+	for _, e := range entries {
+		b := EncodeDump(e)
+		got, err := DecodeDump(b)
+		if err != nil || !reflect.DeepEqual(got, e) {
+			t.Errorf("dump %s round trip: %v", e.Type, err)
+		}
+		bad := append([]byte{}, b...)
+		bad[0] ^= 1
+		if _, err := DecodeDump(bad); err != ErrChecksum {
+			t.Errorf("dump %s with a wrong checksum: %v", e.Type, err)
+		}
+		if _, err := DecodeDump(b[1:]); err == nil {
+			t.Errorf("dump %s truncated should fail", e.Type)
+		}
+	}
+	// the expire trailer is between the value and the footer
+	if b := EncodeDump(&Entry{Type: String, Value: []byte("v"), ExpireAt: 1}); string(b[:12]) != "\x00\x01v\xfc\x01\x00\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("dump with the expire trailer %q", b)
+	}
+	if _, err := DecodeDump([]byte("GOKV")); err != ErrFormat {
+		t.Errorf("short payload: %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// ziplist parse the entries of a ziplist:
+//
+//	zlbytes 4 | zltail 4 | zllen 2 | (prevlen 1|5 | encoding | data)* | 0xff
+func ziplist(b []byte) ([][]byte, error) {
+	if len(b) < 11 {
+		return nil, ErrFormat
+	}
+	var elems [][]byte
+	var pos = 10
+	for {
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+		if b[pos] == 0xff {
+			return elems, nil
+		}
+		if b[pos] < 254 {
+			pos++
+		} else {
+			pos += 5
+		}
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+		enc := b[pos]
+		var size, head int
+		switch enc >> 6 {
+		case 0:
+			head, size = 1, int(enc&0x3f)
+		case 1:
+			if pos+2 > len(b) {
+				return nil, ErrFormat
+			}
+			head, size = 2, int(enc&0x3f)<<8|int(b[pos+1])
+		case 2:
+			if pos+5 > len(b) {
+				return nil, ErrFormat
+			}
+			head, size = 5, int(binary.BigEndian.Uint32(b[pos+1:]))
+		default:
+			// integers
+			var v int64
+			switch {
+			case enc == 0xc0:
+				head = 3
+			case enc == 0xd0:
+				head = 5
+			case enc == 0xe0:
+				head = 9
+			case enc == 0xf0:
+				head = 4
+			case enc == 0xfe:
+				head = 2
+			case enc >= 0xf1 && enc <= 0xfd:
+				head = 1
+				v = int64(enc&0x0f) - 1
+			default:
+				return nil, ErrFormat
+			}
+			if pos+head > len(b) {
+				return nil, ErrFormat
+			}
+			if head > 1 {
+				v = leInt(b[pos+1 : pos+head])
+			}
+			elems = append(elems, strconv.AppendInt(nil, v, 10))
+			pos += head
+			continue
+		}
+		if size < 0 || pos+head+size > len(b) {
+			return nil, ErrFormat
+		}
+		elems = append(elems, b[pos+head:pos+head+size])
+		pos += head + size
+	}
+}
+
+// listpack parse the entries of a listpack:
+//
+//	total bytes 4 | num elements 2 | (encoding | data | backlen)* | 0xff
+func listpack(b []byte) ([][]byte, error) {
+	if len(b) < 7 {
+		return nil, ErrFormat
+	}
+	var elems [][]byte
+	var pos = 6
+	for {
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+		enc := b[pos]
+		if enc == 0xff {
+			return elems, nil
+		}
+		var head, size int
+		var v int64
+		var isInt = true
+		switch {
+		case enc&0x80 == 0:
+			// 7 bits unsigned int
+			head, v = 1, int64(enc&0x7f)
+		case enc&0xc0 == 0x80:
+			// 6 bits string length
+			head, size, isInt = 1, int(enc&0x3f), false
+		case enc&0xe0 == 0xc0:
+			// 13 bits signed int
+			if pos+2 > len(b) {
+				return nil, ErrFormat
+			}
+			head, v = 2, int64(enc&0x1f)<<8|int64(b[pos+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+		case enc&0xf0 == 0xe0:
+			// 12 bits string length
+			if pos+2 > len(b) {
+				return nil, ErrFormat
+			}
+			head, size, isInt = 2, int(enc&0x0f)<<8|int(b[pos+1]), false
+		case enc == 0xf0:
+			// 32 bits string length
+			if pos+5 > len(b) {
+				return nil, ErrFormat
+			}
+			head, size, isInt = 5, int(binary.LittleEndian.Uint32(b[pos+1:])), false
+		case enc >= 0xf1 && enc <= 0xf4:
+			// 16, 24, 32 and 64 bits signed int
+			head = 1 + []int{2, 3, 4, 8}[enc-0xf1]
+			if pos+head > len(b) {
+				return nil, ErrFormat
+			}
+			v = leInt(b[pos+1 : pos+head])
+		default:
+			return nil, ErrFormat
+		}
+		if size < 0 || pos+head+size > len(b) {
+			return nil, ErrFormat
+		}
+		if isInt {
+			elems = append(elems, strconv.AppendInt(nil, v, 10))
+		} else {
+			elems = append(elems, b[pos+head:pos+head+size])
+		}
+		pos += head + size
+		pos += backlenSize(head + size)
+	}
+}
+
+// backlenSize the size of the backward length of a listpack entry of size n
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// leInt a little endian signed int of 1 to 8 bytes
+func leInt(b []byte) int64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	shift := 64 - 8*uint(len(b))
+	return int64(u<<shift) >> shift
+}
+
+// intset parse the members of an intset:
+//
+//	encoding 4 | length 4 | ints of encoding bytes
+func intset(b []byte) ([][]byte, error) {
+	if len(b) < 8 {
+		return nil, ErrFormat
+	}
+	enc := int(binary.LittleEndian.Uint32(b))
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	if (enc != 2 && enc != 4 && enc != 8) || n < 0 || len(b) != 8+enc*n {
+		return nil, ErrFormat
+	}
+	var elems = make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		elems = append(elems, strconv.AppendInt(nil, leInt(b[8+i*enc:8+(i+1)*enc]), 10))
+	}
+	return elems, nil
+}
+
+// zipmap parse the fields and values of a zipmap:
+//
+//	zmlen 1 | (len | field | len | free 1 | value | free bytes)* | 0xff
+func zipmap(b []byte) ([][]byte, error) {
+	var elems [][]byte
+	var pos = 1
+	var next = func(free bool) ([]byte, error) {
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+		var size = int(b[pos])
+		pos++
+		if size == 254 {
+			if pos+4 > len(b) {
+				return nil, ErrFormat
+			}
+			size = int(binary.LittleEndian.Uint32(b[pos:]))
+			pos += 4
+		} else if size == 255 {
+			return nil, ErrFormat
+		}
+		var skip int
+		if free {
+			if pos >= len(b) {
+				return nil, ErrFormat
+			}
+			skip = int(b[pos])
+			pos++
+		}
+		if size < 0 || pos+size+skip > len(b) {
+			return nil, ErrFormat
+		}
+		data := b[pos : pos+size]
+		pos += size + skip
+		return data, nil
+	}
+	for {
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+		if b[pos] == 0xff {
+			return elems, nil
+		}
+		field, err := next(false)
+		if err != nil {
+			return nil, err
+		}
+		val, err := next(true)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, field, val)
+	}
+}
+
+// lzfDecompress decompress the lzf data of a string of size n
+func lzfDecompress(in []byte, n int) ([]byte, error) {
+	var out = make([]byte, 0, n)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// literal run of ctrl+1 bytes
+			size := ctrl + 1
+			if i+size > len(in) || len(out)+size > n {
+				return nil, ErrFormat
+			}
+			out = append(out, in[i:i+size]...)
+			i += size
+			continue
+		}
+		// back reference of length+2 bytes
+		size := ctrl >> 5
+		if size == 7 {
+			if i >= len(in) {
+				return nil, ErrFormat
+			}
+			size += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrFormat
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+size+2 > n {
+			return nil, ErrFormat
+		}
+		for j := 0; j < size+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != n {
+		return nil, ErrFormat
+	}
+	return out, nil
+}
@@ -0,0 +1,572 @@
+// Package rdb parses the RDB files of redis so existing datasets can be loaded into gokv,
+// and serializes the values of DUMP and RESTORE like redis.
+//
+// the file is the magic "REDIS" with a 4 digits version, followed by opcodes and keys:
+//
+//	[AUX | SELECTDB | RESIZEDB | EXPIRETIME | ...]* (value type | key | value)* EOF | crc64
+//
+// strings, lists, sets, sorted sets and hashes are supported in all their encodings,
+// including the ziplist, listpack, intset and zipmap ones. streams and module types are not.
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"strconv"
+)
+
+// MaxVersion the latest rdb version we can parse
+const MaxVersion = 12
+
+const (
+	opSlotInfo      = 244
+	opFunction2     = 245
+	opFunctionPreGA = 246
+	opModuleAux     = 247
+	opIdle          = 248
+	opFreq          = 249
+	opAux           = 250
+	opResizeDB      = 251
+	opExpireTimeMs  = 252
+	opExpireTime    = 253
+	opSelectDB      = 254
+	opEOF           = 255
+)
+
+const (
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeHashZipmap     = 9
+	typeListZiplist    = 10
+	typeSetIntset      = 11
+	typeZSetZiplist    = 12
+	typeHashZiplist    = 13
+	typeListQuicklist  = 14
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeSetListpack    = 20
+)
+
+// quicklist node containers
+const (
+	containerPlain  = 1
+	containerPacked = 2
+)
+
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// maxStringSize strings of redis are at most 512MB, larger ones are corrupted
+const maxStringSize = 512 << 20
+
+var (
+	// ErrFormat the file is not a valid rdb file
+	ErrFormat = errors.New("rdb: invalid format")
+	// ErrChecksum the checksum of the file is wrong
+	ErrChecksum = errors.New("rdb: wrong checksum")
+)
+
+// the crc64 of redis, the jones polynomial reflected with no initial and final xor
+var crcTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+func crc(sum uint64, b []byte) uint64 {
+	return ^crc64.Update(^sum, crcTable, b)
+}
+
+// Type the value type of a key
+type Type uint8
+
+const (
+	String Type = iota
+	List
+	Set
+	ZSet
+	Hash
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case List:
+		return "list"
+	case Set:
+		return "set"
+	case ZSet:
+		return "zset"
+	case Hash:
+		return "hash"
+	}
+	return "unknown"
+}
+
+// Member a member of a sorted set
+type Member struct {
+	Member []byte
+	Score  float64
+}
+
+// Entry a key of the rdb file
+type Entry struct {
+	DB   int
+	Key  []byte
+	Type Type
+	// ExpireAt the expire time in unix milliseconds, 0 if the key never expires
+	ExpireAt int64
+
+	// Value the value of a string
+	Value []byte
+	// Elems the elements of a list, the members of a set or the fields and values of a hash in pairs
+	Elems [][]byte
+	// Members the members of a sorted set
+	Members []Member
+}
+
+type parser struct {
+	rd      *bufio.Reader
+	sum     uint64
+	version int
+}
+
+// Parse read the rdb file of r and call f with each key in order, it stops at the first error of f
+func Parse(r io.Reader, f func(e *Entry) error) error {
+	p := &parser{rd: bufio.NewReader(r)}
+	head, err := p.read(9)
+	if err != nil {
+		return err
+	}
+	if string(head[:5]) != "REDIS" {
+		return ErrFormat
+	}
+	if p.version, err = strconv.Atoi(string(head[5:])); err != nil {
+		return ErrFormat
+	}
+	if p.version < 1 || p.version > MaxVersion {
+		return fmt.Errorf("rdb: unsupported version %d", p.version)
+	}
+
+	var db int
+	var expireAt int64
+	for {
+		op, err := p.readByte()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opAux:
+			if _, err := p.readString(); err != nil {
+				return err
+			}
+			if _, err := p.readString(); err != nil {
+				return err
+			}
+		case opResizeDB:
+			if err := p.skipLengths(2); err != nil {
+				return err
+			}
+		case opSlotInfo:
+			if err := p.skipLengths(3); err != nil {
+				return err
+			}
+		case opIdle:
+			if err := p.skipLengths(1); err != nil {
+				return err
+			}
+		case opFreq:
+			if _, err := p.readByte(); err != nil {
+				return err
+			}
+		case opFunction2:
+			if _, err := p.readString(); err != nil {
+				return err
+			}
+		case opFunctionPreGA, opModuleAux:
+			return fmt.Errorf("rdb: unsupported opcode %d", op)
+		case opExpireTimeMs:
+			b, err := p.read(8)
+			if err != nil {
+				return err
+			}
+			expireAt = int64(binary.LittleEndian.Uint64(b))
+		case opExpireTime:
+			b, err := p.read(4)
+			if err != nil {
+				return err
+			}
+			expireAt = int64(binary.LittleEndian.Uint32(b)) * 1000
+		case opSelectDB:
+			n, err := p.readLen()
+			if err != nil {
+				return err
+			}
+			if n > math.MaxInt32 {
+				return ErrFormat
+			}
+			db = int(n)
+		case opEOF:
+			return p.checksum()
+		default:
+			key, err := p.readString()
+			if err != nil {
+				return err
+			}
+			e := &Entry{DB: db, Key: key, ExpireAt: expireAt}
+			expireAt = 0
+			if err := p.readValue(op, e); err != nil {
+				return fmt.Errorf("%w, key: %q", err, key)
+			}
+			if err := f(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checksum verify the crc64 after EOF, a zero checksum means it is disabled
+func (p *parser) checksum() error {
+	if p.version < 5 {
+		return nil
+	}
+	sum := p.sum
+	b, err := p.read(8)
+	if err != nil {
+		return err
+	}
+	if expect := binary.LittleEndian.Uint64(b); expect != 0 && expect != sum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+func (p *parser) read(n uint64) ([]byte, error) {
+	if n > maxStringSize {
+		return nil, ErrFormat
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(p.rd, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	p.sum = crc(p.sum, b)
+	return b, nil
+}
+
+func (p *parser) readByte() (byte, error) {
+	b, err := p.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// readLength read a length, special is true if it is the encoding of a string
+func (p *parser) readLength() (n uint64, special bool, err error) {
+	b, err := p.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := p.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(next), false, nil
+	case 2:
+		switch b {
+		case 0x80:
+			data, err := p.read(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(data)), false, nil
+		case 0x81:
+			data, err := p.read(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(data), false, nil
+		}
+		return 0, false, ErrFormat
+	}
+	return uint64(b & 0x3f), true, nil
+}
+
+func (p *parser) readLen() (uint64, error) {
+	n, special, err := p.readLength()
+	if err == nil && special {
+		err = ErrFormat
+	}
+	return n, err
+}
+
+func (p *parser) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := p.readLen(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) readString() ([]byte, error) {
+	n, special, err := p.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !special {
+		return p.read(n)
+	}
+	switch n {
+	case encInt8:
+		b, err := p.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int8(b[0])), 10), nil
+	case encInt16:
+		b, err := p.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(b))), 10), nil
+	case encInt32:
+		b, err := p.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(b))), 10), nil
+	case encLZF:
+		clen, err := p.readLen()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := p.readLen()
+		if err != nil {
+			return nil, err
+		}
+		if ulen > maxStringSize {
+			return nil, ErrFormat
+		}
+		data, err := p.read(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(data, int(ulen))
+	}
+	return nil, ErrFormat
+}
+
+// readStrings read n strings
+func (p *parser) readStrings(n uint64) ([][]byte, error) {
+	var elems = make([][]byte, 0, capHint(n))
+	for i := uint64(0); i < n; i++ {
+		s, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, s)
+	}
+	return elems, nil
+}
+
+// readDouble read a score of the first sorted set encoding, a string of its length and digits
+func (p *parser) readDouble() (float64, error) {
+	n, err := p.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	b, err := p.read(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	return parseScore(b)
+}
+
+func parseScore(b []byte) (float64, error) {
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, ErrFormat
+	}
+	return f, nil
+}
+
+// capHint the capacity to allocate for n elements, lengths of corrupted files may be huge
+func capHint(n uint64) int {
+	if n > 1024 {
+		return 1024
+	}
+	return int(n)
+}
+
+func (p *parser) readValue(t byte, e *Entry) error {
+	var err error
+	switch t {
+	case typeString:
+		e.Type = String
+		e.Value, err = p.readString()
+		return err
+	case typeList, typeSet, typeHash:
+		n, err := p.readLen()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case typeList:
+			e.Type = List
+		case typeSet:
+			e.Type = Set
+		case typeHash:
+			e.Type = Hash
+			n *= 2
+		}
+		e.Elems, err = p.readStrings(n)
+		return err
+	case typeZSet, typeZSet2:
+		e.Type = ZSet
+		n, err := p.readLen()
+		if err != nil {
+			return err
+		}
+		e.Members = make([]Member, 0, capHint(n))
+		for i := uint64(0); i < n; i++ {
+			var m Member
+			if m.Member, err = p.readString(); err != nil {
+				return err
+			}
+			if t == typeZSet {
+				m.Score, err = p.readDouble()
+			} else {
+				var b []byte
+				b, err = p.read(8)
+				if err == nil {
+					m.Score = math.Float64frombits(binary.LittleEndian.Uint64(b))
+				}
+			}
+			if err != nil {
+				return err
+			}
+			e.Members = append(e.Members, m)
+		}
+		return nil
+	case typeListQuicklist, typeListQuicklist2:
+		e.Type = List
+		n, err := p.readLen()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			var container uint64 = containerPacked
+			if t == typeListQuicklist2 {
+				if container, err = p.readLen(); err != nil {
+					return err
+				}
+			}
+			node, err := p.readString()
+			if err != nil {
+				return err
+			}
+			switch {
+			case container == containerPlain:
+				e.Elems = append(e.Elems, node)
+				continue
+			case container != containerPacked:
+				return ErrFormat
+			}
+			var elems [][]byte
+			if t == typeListQuicklist {
+				elems, err = ziplist(node)
+			} else {
+				elems, err = listpack(node)
+			}
+			if err != nil {
+				return err
+			}
+			e.Elems = append(e.Elems, elems...)
+		}
+		return nil
+	case typeHashZipmap, typeListZiplist, typeSetIntset, typeSetListpack,
+		typeHashZiplist, typeHashListpack, typeZSetZiplist, typeZSetListpack:
+	default:
+		return fmt.Errorf("rdb: unsupported value type %d", t)
+	}
+
+	// values encoded in a single string
+	data, err := p.readString()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case typeHashZipmap:
+		e.Type = Hash
+		e.Elems, err = zipmap(data)
+	case typeListZiplist:
+		e.Type = List
+		e.Elems, err = ziplist(data)
+	case typeSetIntset:
+		e.Type = Set
+		e.Elems, err = intset(data)
+	case typeSetListpack:
+		e.Type = Set
+		e.Elems, err = listpack(data)
+	case typeHashZiplist, typeHashListpack:
+		e.Type = Hash
+		if t == typeHashZiplist {
+			e.Elems, err = ziplist(data)
+		} else {
+			e.Elems, err = listpack(data)
+		}
+		if err == nil && len(e.Elems)%2 != 0 {
+			err = ErrFormat
+		}
+	case typeZSetZiplist, typeZSetListpack:
+		e.Type = ZSet
+		var elems [][]byte
+		if t == typeZSetZiplist {
+			elems, err = ziplist(data)
+		} else {
+			elems, err = listpack(data)
+		}
+		if err == nil && len(elems)%2 != 0 {
+			err = ErrFormat
+		}
+		if err != nil {
+			return err
+		}
+		e.Members = make([]Member, 0, len(elems)/2)
+		for i := 0; i < len(elems); i += 2 {
+			score, err := parseScore(elems[i+1])
+			if err != nil {
+				return err
+			}
+			e.Members = append(e.Members, Member{Member: elems[i], Score: score})
+		}
+	}
+	return err
+}
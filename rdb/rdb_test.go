@@ -0,0 +1,149 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCRC(t *testing.T) {
+	// the check value of crc-64-jones used by redis
+	if sum := crc(0, []byte("123456789")); sum != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("crc %x", sum)
+	}
+	if sum := crc(crc(0, []byte("1234")), []byte("56789")); sum != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("incremental crc %x", sum)
+	}
+}
+
+func str(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// testFile a rdb file with the keys of each encoding
+func testFile() []byte {
+	ms := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ms, 1700000000000)
+	sec := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sec, 1700000000)
+	ziplist := []byte{27, 0, 0, 0, 19, 0, 0, 0, 4, 0,
+		0, 0x01, 'a',
+		3, 0xf6,
+		2, 0xc0, 0xfe, 0xff,
+		4, 0x05, 'h', 'e', 'l', 'l', 'o',
+		0xff}
+	intset := []byte{2, 0, 0, 0, 3, 0, 0, 0, 1, 0, 0xff, 0xff, 0x2c, 0x01}
+	zsetLp := []byte{22, 0, 0, 0, 4, 0,
+		0x82, 'm', '1', 3,
+		0x83, '1', '.', '5', 4,
+		0x82, 'm', '2', 3,
+		0x02, 1,
+		0xff}
+	hashLp := []byte{13, 0, 0, 0, 2, 0,
+		0x81, 'f', 2,
+		0xdf, 0x9c, 2,
+		0xff}
+	quickLp := []byte{10, 0, 0, 0, 1, 0, 0x81, 'x', 2, 0xff}
+	zipmap := []byte{1, 1, 'k', 1, 2, 'v', 0, 0, 0xff}
+
+	b := join(
+		[]byte("REDIS0011"),
+		[]byte{opAux}, str("redis-ver"), str("7.0.0"),
+		[]byte{opSelectDB, 0, opResizeDB, 9, 1},
+		[]byte{opExpireTimeMs}, ms, []byte{typeString}, str("str"), []byte{0xc0, 123},
+		[]byte{typeString}, str("lzf"), []byte{0xc3, 7, 20, 0x02, 'a', 'b', 'c', 0xe0, 8, 2},
+		[]byte{typeListZiplist}, str("zl"), str(string(ziplist)),
+		[]byte{typeSetIntset}, str("is"), str(string(intset)),
+		[]byte{opIdle, 5, typeZSetListpack}, str("zlp"), str(string(zsetLp)),
+		[]byte{opFreq, 1, typeHashListpack}, str("h"), str(string(hashLp)),
+		[]byte{typeListQuicklist2}, str("ql"), []byte{2, containerPacked}, str(string(quickLp)), []byte{containerPlain}, str("plain"),
+		[]byte{typeZSet2}, str("z2"), []byte{1}, str("m"), []byte{0, 0, 0, 0, 0, 0, 4, 0x40},
+		[]byte{typeZSet}, str("z1"), []byte{2}, str("a"), str("-3"), str("b"), []byte{254},
+		[]byte{opSelectDB, 1},
+		[]byte{opExpireTime}, sec, []byte{typeSet}, str("set"), []byte{2}, str("a"), str("b"),
+		[]byte{typeHashZipmap}, str("zm"), str(string(zipmap)),
+		[]byte{opEOF},
+	)
+	sum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sum, crc(0, b))
+	return append(b, sum...)
+}
+
+func TestParse(t *testing.T) {
+	var entries []*Entry
+	err := Parse(bytes.NewReader(testFile()), func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := func(ss ...string) [][]byte {
+		var b [][]byte
+		for _, s := range ss {
+			b = append(b, []byte(s))
+		}
+		return b
+	}
+	expect := []*Entry{
+		{Key: []byte("str"), Type: String, ExpireAt: 1700000000000, Value: []byte("123")},
+		{Key: []byte("lzf"), Type: String, Value: []byte("abcabcabcabcabcabcab")},
+		{Key: []byte("zl"), Type: List, Elems: bs("a", "5", "-2", "hello")},
+		{Key: []byte("is"), Type: Set, Elems: bs("1", "-1", "300")},
+		{Key: []byte("zlp"), Type: ZSet, Members: []Member{{[]byte("m1"), 1.5}, {[]byte("m2"), 2}}},
+		{Key: []byte("h"), Type: Hash, Elems: bs("f", "-100")},
+		{Key: []byte("ql"), Type: List, Elems: bs("x", "plain")},
+		{Key: []byte("z2"), Type: ZSet, Members: []Member{{[]byte("m"), 2.5}}},
+		{Key: []byte("z1"), Type: ZSet, Members: []Member{{[]byte("a"), -3}, {[]byte("b"), math.Inf(1)}}},
+		{DB: 1, Key: []byte("set"), Type: Set, ExpireAt: 1700000000000, Elems: bs("a", "b")},
+		{DB: 1, Key: []byte("zm"), Type: Hash, Elems: bs("k", "v")},
+	}
+	if len(entries) != len(expect) {
+		t.Fatalf("%d entries, expect %d", len(entries), len(expect))
+	}
+	for i, e := range entries {
+		if !reflect.DeepEqual(e, expect[i]) {
+			t.Errorf("entry %d: %+v, expect %+v", i, e, expect[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	b := testFile()
+	var nop = func(e *Entry) error { return nil }
+
+	bad := append([]byte{}, b...)
+	bad[len(bad)-1] ^= 1
+	if err := Parse(bytes.NewReader(bad), nop); err != ErrChecksum {
+		t.Errorf("wrong checksum: %v", err)
+	}
+	// a zero checksum is not verified
+	copy(bad[len(bad)-8:], make([]byte, 8))
+	if err := Parse(bytes.NewReader(bad), nop); err != nil {
+		t.Errorf("zero checksum: %v", err)
+	}
+	if err := Parse(bytes.NewReader(b[:len(b)-20]), nop); err == nil {
+		t.Error("truncated file should fail")
+	}
+	if err := Parse(bytes.NewReader([]byte("REDIS0099")), nop); err == nil {
+		t.Error("unsupported version should fail")
+	}
+	if err := Parse(bytes.NewReader([]byte("NOTRDB0009")), nop); err != ErrFormat {
+		t.Errorf("not a rdb file: %v", err)
+	}
+	stream := join([]byte("REDIS0011"), []byte{15}, str("s"), []byte{1})
+	if err := Parse(bytes.NewReader(stream), nop); err == nil {
+		t.Error("stream should be unsupported")
+	}
+	stop := errors.New("stop")
+	if err := Parse(bytes.NewReader(b), func(e *Entry) error { return stop }); err != stop {
+		t.Errorf("callback error: %v", err)
+	}
+}
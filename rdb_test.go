@@ -0,0 +1,144 @@
+package gokv_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yixinin/gokv"
+)
+
+// testRDB a rdb file without checksum, the string key expires in an hour
+func testRDB() []byte {
+	str := func(s string) []byte {
+		return append([]byte{byte(len(s))}, s...)
+	}
+	ms := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ms, uint64(time.Now().Add(time.Hour).UnixMilli()))
+	score := make([]byte, 8)
+	binary.LittleEndian.PutUint64(score, 0x4004000000000000) // 2.5
+	return bytes.Join([][]byte{
+		[]byte("REDIS0009"),
+		{0xfe, 0},
+		{0xfc}, ms, {0}, str("str"), str("v"),
+		{1}, str("list"), {3}, str("a"), str("b"), str("c"),
+		{2}, str("set"), {2}, str("x"), str("y"),
+		{5}, str("zset"), {1}, str("m"), score,
+		{4}, str("hash"), {2}, str("f1"), str("v1"), str("f2"), {0xc0, 7},
+		{0xfe, 1},
+		{0}, str("str1"), {0xc0, 42},
+		{0xff}, make([]byte, 8),
+	}, nil)
+}
+
+// reservedRDB a rdb file with a string and a key starting with 0xff, the keys are reserved by gokv
+func reservedRDB() []byte {
+	return bytes.Join([][]byte{
+		[]byte("REDIS0009"),
+		{0xfe, 0},
+		{0}, {3}, []byte("str"), {1}, []byte("v"),
+		{0}, {2}, []byte("\xff#"), {1}, []byte("v"),
+		{0xff}, make([]byte, 8),
+	}, nil)
+}
+
+func TestImportRDB(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "gokv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "dump.rdb")
+	if err := os.WriteFile(file, reservedRDB(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes []*gokv.ClusterNode
+	for id := uint32(1); id <= 3; id++ {
+		port := 17320 + id
+		nodes = append(nodes, &gokv.ClusterNode{NodeID: uint64(id), Host: "127.0.0.1", HTTPPort: port, HeartbeatPort: port + 100, ReplicatePort: port + 200})
+	}
+	var clients []*redis.Client
+	for _, node := range nodes {
+		cfg := &gokv.Config{}
+		cfg.ServerCfg.DataPath = path.Join(dir, strconv.Itoa(int(node.NodeID)))
+		cfg.ServerCfg.LogPath = cfg.ServerCfg.DataPath
+		cfg.ServerCfg.Databases = 16
+		cfg.ClusterCfg.Nodes = nodes
+		cfg.Validate(node.NodeID)
+		if err := os.MkdirAll(cfg.ServerCfg.DataPath, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if node.NodeID == 1 {
+			// the reserved key fails the import and nothing is loaded, so the node is still fresh
+			err := gokv.NewRaftKv(1, cfg).ImportRDB(ctx, file)
+			if err == nil || !strings.Contains(err.Error(), `key "\xff#" of db 0 starts with 0xff`) {
+				t.Fatalf("import a reserved key: %v", err)
+			}
+			if err := os.WriteFile(file, testRDB(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := gokv.NewRaftKv(1, cfg).ImportRDB(ctx, file); err != nil {
+				t.Fatal(err)
+			}
+			if err := gokv.NewRaftKv(1, cfg).ImportRDB(ctx, file); err == nil {
+				t.Fatal("import into a node with data should fail")
+			}
+		}
+		kv := gokv.NewRaftKv(node.NodeID, cfg)
+		kv.Run(ctx)
+		go gokv.NewServer(kv).Run(ctx, node.HTTPPort)
+		cli := redis.NewClient(&redis.Options{Addr: "127.0.0.1:" + strconv.Itoa(int(node.HTTPPort))})
+		defer cli.Close()
+		clients = append(clients, cli)
+	}
+
+	// the imported node is the leader, writes are replicated after the snapshot
+	var ok bool
+	for i := 0; i < 100 && !ok; i++ {
+		ok = clients[0].Set(ctx, "after", "1", 0).Err() == nil
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !ok {
+		t.Fatal("the imported node is not the leader")
+	}
+	for i, cli := range clients {
+		for j := 0; j < 100 && cli.Get(ctx, "after").Val() != "1"; j++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if v := cli.Get(ctx, "str").Val(); v != "v" {
+			t.Errorf("node %d str %q", i+1, v)
+		}
+		if ttl := cli.TTL(ctx, "str").Val(); ttl <= 0 || ttl > time.Hour {
+			t.Errorf("node %d ttl %v", i+1, ttl)
+		}
+		if v := cli.LRange(ctx, "list", 0, -1).Val(); len(v) != 3 || v[0] != "a" || v[2] != "c" {
+			t.Errorf("node %d list %v", i+1, v)
+		}
+		if n := cli.SCard(ctx, "set").Val(); n != 2 {
+			t.Errorf("node %d set card %d", i+1, n)
+		}
+		if v := cli.ZScore(ctx, "zset", "m").Val(); v != 2.5 {
+			t.Errorf("node %d zscore %v", i+1, v)
+		}
+		if v := cli.HGetAll(ctx, "hash").Val(); len(v) != 2 || v["f1"] != "v1" || v["f2"] != "7" {
+			t.Errorf("node %d hash %v", i+1, v)
+		}
+		if n := cli.DBSize(ctx).Val(); n != 6 {
+			t.Errorf("node %d dbsize %d", i+1, n)
+		}
+		db1 := redis.NewClient(&redis.Options{Addr: cli.Options().Addr, DB: 1})
+		if v := db1.Get(ctx, "str1").Val(); v != "42" {
+			t.Errorf("node %d db 1 str1 %q", i+1, v)
+		}
+		db1.Close()
+	}
+}
@@ -0,0 +1,360 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// MaxBitOffset bitmaps are limited to 512MB
+const MaxBitOffset = 1<<32 - 1
+
+const (
+	BitOpAnd = "and"
+	BitOpOr  = "or"
+	BitOpXor = "xor"
+	BitOpNot = "not"
+)
+
+const (
+	OverflowWrap = "wrap"
+	OverflowSat  = "sat"
+	OverflowFail = "fail"
+)
+
+func parseBitOffset(b []byte) (uint64, bool) {
+	off, ok := codec.StringBytes2Int64(b)
+	if !ok || off < 0 || off > MaxBitOffset {
+		return 0, false
+	}
+	return uint64(off), true
+}
+
+// SetBitCmd setbit key offset value / getbit key offset, replies the original bit
+type SetBitCmd struct {
+	*BaseCmd
+	Offset uint64
+	Val    byte
+	Bit    int64
+}
+
+func NewGetBitCmd(base *BaseCmd) *SetBitCmd {
+	cmd := &SetBitCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok bool
+	if cmd.Offset, ok = parseBitOffset(base.args[2]); !ok {
+		cmd.Err = kverror.ErrBitOffset
+	}
+	return cmd
+}
+
+func NewSetBitCmd(base *BaseCmd) *SetBitCmd {
+	cmd := NewGetBitCmd(base)
+	if cmd.Err != nil {
+		return cmd
+	}
+	if len(base.args) != 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	switch codec.BytesToString(base.args[3]) {
+	case "0":
+	case "1":
+		cmd.Val = 1
+	default:
+		cmd.Err = kverror.ErrBitValue
+	}
+	return cmd
+}
+
+func (c *SetBitCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Bit)
+}
+
+// BitCountCmd bitcount key [start end [byte|bit]] / bitpos key bit [start [end [byte|bit]]]
+type BitCountCmd struct {
+	*BaseCmd
+	Start    int64
+	End      int64
+	HasStart bool
+	HasEnd   bool
+	BitMode  bool
+
+	// Bit the bit bitpos looks for
+	Bit byte
+
+	Val int64
+}
+
+func NewBitCountCmd(base *BaseCmd) *BitCountCmd {
+	cmd := &BitCountCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	if size < 2 || size == 3 || size > 5 {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	cmd.parseRange(base.args[2:])
+	return cmd
+}
+
+func NewBitPosCmd(base *BaseCmd) *BitCountCmd {
+	cmd := &BitCountCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	if size < 3 || size > 6 {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	switch codec.BytesToString(base.args[2]) {
+	case "0":
+	case "1":
+		cmd.Bit = 1
+	default:
+		cmd.Err = kverror.ErrBitValue
+		return cmd
+	}
+	cmd.parseRange(base.args[3:])
+	return cmd
+}
+
+func (c *BitCountCmd) parseRange(args [][]byte) {
+	var ok bool
+	if len(args) > 0 {
+		if c.Start, ok = codec.StringBytes2Int64(args[0]); !ok {
+			c.Err = kverror.ErrNotInteger
+			return
+		}
+		c.HasStart = true
+	}
+	if len(args) > 1 {
+		if c.End, ok = codec.StringBytes2Int64(args[1]); !ok {
+			c.Err = kverror.ErrNotInteger
+			return
+		}
+		c.HasEnd = true
+	}
+	if len(args) > 2 {
+		switch strings.ToLower(codec.BytesToString(args[2])) {
+		case "byte":
+		case "bit":
+			c.BitMode = true
+		default:
+			c.Err = kverror.ErrSyntax
+		}
+	}
+}
+
+func (c *BitCountCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Val)
+}
+
+// BitOpCmd bitop operation destkey key [key ...], replies the size of destkey
+type BitOpCmd struct {
+	*BaseCmd
+	Op   string
+	Dest []byte
+	Keys [][]byte
+	Len  int64
+}
+
+func NewBitOpCmd(base *BaseCmd) *BitOpCmd {
+	cmd := &BitOpCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Op = strings.ToLower(codec.BytesToString(base.args[1]))
+	switch cmd.Op {
+	case BitOpAnd, BitOpOr, BitOpXor:
+	case BitOpNot:
+		if len(base.args) != 4 {
+			cmd.Err = kverror.ErrBitOpNot
+			return cmd
+		}
+	default:
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	cmd.Dest = base.args[2]
+	cmd.Keys = base.args[3:]
+	return cmd
+}
+
+func (c *BitOpCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Len)
+}
+
+// BitFieldOp one get/set/incrby sub command of bitfield
+type BitFieldOp struct {
+	Op       string
+	Signed   bool
+	Bits     uint64
+	Offset   uint64
+	Val      int64
+	Overflow string
+}
+
+// BitFieldCmd bitfield key [get type offset] [set type offset value] [incrby type offset increment] [overflow wrap|sat|fail]
+type BitFieldCmd struct {
+	*BaseCmd
+	Ops []BitFieldOp
+
+	// Vals the replies of each op, nil for a failed overflow
+	Vals []*int64
+}
+
+func NewBitFieldCmd(base *BaseCmd) *BitFieldCmd {
+	return newBitFieldCmd(base, false)
+}
+
+func NewBitFieldROCmd(base *BaseCmd) *BitFieldCmd {
+	return newBitFieldCmd(base, true)
+}
+
+func newBitFieldCmd(base *BaseCmd, readonly bool) *BitFieldCmd {
+	cmd := &BitFieldCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	if size < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var overflow = OverflowWrap
+	for i := 2; i < size; i++ {
+		op := strings.ToLower(codec.BytesToString(base.args[i]))
+		if op == "overflow" && !readonly {
+			if i+1 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			i++
+			overflow = strings.ToLower(codec.BytesToString(base.args[i]))
+			switch overflow {
+			case OverflowWrap, OverflowSat, OverflowFail:
+			default:
+				cmd.Err = kverror.ErrBitFieldOverflow
+				return cmd
+			}
+			continue
+		}
+		var argc = 2
+		switch op {
+		case "get":
+		case "set", "incrby":
+			if readonly {
+				cmd.Err = kverror.ErrBitFieldRO
+				return cmd
+			}
+			argc = 3
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		if i+argc >= size {
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		var bop = BitFieldOp{
+			Op:       op,
+			Overflow: overflow,
+		}
+		if !bop.parseType(base.args[i+1]) {
+			cmd.Err = kverror.ErrBitFieldType
+			return cmd
+		}
+		if !bop.parseOffset(base.args[i+2]) {
+			cmd.Err = kverror.ErrBitOffset
+			return cmd
+		}
+		if argc == 3 {
+			var ok bool
+			if bop.Val, ok = codec.StringBytes2Int64(base.args[i+3]); !ok {
+				cmd.Err = kverror.ErrNotInteger
+				return cmd
+			}
+		}
+		cmd.Ops = append(cmd.Ops, bop)
+		i += argc
+	}
+	return cmd
+}
+
+// parseType parse i1..i64 or u1..u63
+func (op *BitFieldOp) parseType(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	switch b[0] {
+	case 'i', 'I':
+		op.Signed = true
+	case 'u', 'U':
+	default:
+		return false
+	}
+	bits, ok := codec.StringBytes2Uint64(b[1:])
+	if !ok || bits < 1 || bits > 64 || (!op.Signed && bits == 64) {
+		return false
+	}
+	op.Bits = bits
+	return true
+}
+
+// parseOffset parse offset or #index which means index*bits
+func (op *BitFieldOp) parseOffset(b []byte) bool {
+	var mul uint64 = 1
+	if len(b) > 0 && b[0] == '#' {
+		mul = op.Bits
+		b = b[1:]
+	}
+	off, ok := parseBitOffset(b)
+	if !ok {
+		return false
+	}
+	op.Offset = off * mul
+	return op.Offset+op.Bits-1 <= MaxBitOffset
+}
+
+func (c *BitFieldCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(len(c.Vals)); err != nil {
+		return err
+	}
+	for _, v := range c.Vals {
+		if v == nil {
+			if err := w.writeNil(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.int(*v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
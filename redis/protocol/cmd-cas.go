@@ -0,0 +1,113 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// parseExpireOption parse an optional [ex|px|exat|pxat time] at args[i:]
+func parseExpireOption(args [][]byte, i int, now uint64) (uint64, error) {
+	switch len(args) - i {
+	case 0:
+		return 0, nil
+	case 2:
+		arg := strings.ToLower(codec.BytesToString(args[i]))
+		switch arg {
+		case EX, PX, EXAT, PXAT:
+			return parseExpireAt(arg, args[i+1], now)
+		}
+	}
+	return 0, kverror.ErrSyntax
+}
+
+// CASCmd cas key expected new [ex|px|exat|pxat time], set key to new if its value is expected,
+// replies 1 if key is swapped, 0 if not
+type CASCmd struct {
+	*BaseCmd
+	Expected []byte
+	Val      []byte
+	EX       uint64
+	Swapped  bool
+}
+
+func NewCASCmd(base *BaseCmd) *CASCmd {
+	cmd := &CASCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Expected, cmd.Val = base.args[2], base.args[3]
+	cmd.EX, cmd.Err = parseExpireOption(base.args, 4, base.Now)
+	return cmd
+}
+
+func (c *CASCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(boolInt(c.Swapped))
+}
+
+// CADCmd cad key expected, delete key if its value is expected, replies 1 if key is deleted, 0 if not
+type CADCmd struct {
+	*BaseCmd
+	Expected []byte
+	Deleted  bool
+}
+
+func NewCADCmd(base *BaseCmd) *CADCmd {
+	cmd := &CADCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Expected = base.args[2]
+	return cmd
+}
+
+func (c *CADCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(boolInt(c.Deleted))
+}
+
+// LockCmd lock key owner [ex|px|exat|pxat time], set key to owner if it is absent or held by owner,
+// replies the fencing token of the lock, or nil if it is held by another owner.
+// the lock is released by cad key owner
+type LockCmd struct {
+	*BaseCmd
+	Owner []byte
+	EX    uint64
+	// Token the raft index the lock is acquired at, it increases with every acquisition
+	Token uint64
+}
+
+func NewLockCmd(base *BaseCmd) *LockCmd {
+	cmd := &LockCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Owner = base.args[2]
+	cmd.EX, cmd.Err = parseExpireOption(base.args, 3, base.Now)
+	return cmd
+}
+
+func (c *LockCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Token == 0 {
+		return w.writeNil()
+	}
+	return w.uint(c.Token)
+}
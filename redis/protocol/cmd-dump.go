@@ -0,0 +1,199 @@
+package protocol
+
+import (
+	"strings"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+var NOKEY = []byte("NOKEY")
+
+// DumpCmd dump key, replies the serialized value or nil
+type DumpCmd struct {
+	*BaseCmd
+	Payload []byte
+}
+
+func NewDumpCmd(base *BaseCmd) *DumpCmd {
+	cmd := &DumpCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *DumpCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Payload == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, c.Payload)
+}
+
+// RestoreCmd restore key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency],
+// ttl is in milliseconds, 0 keeps the expire time of the dumped value. IDLETIME and FREQ are ignored
+type RestoreCmd struct {
+	*BaseCmd
+	TTL     int64
+	Payload []byte
+	Replace bool
+	AbsTTL  bool
+}
+
+func NewRestoreCmd(base *BaseCmd) *RestoreCmd {
+	cmd := &RestoreCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	ttl, ok := codec.StringBytes2Int64(base.args[2])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	if ttl < 0 {
+		cmd.Err = kverror.ErrInvalidTTL
+		return cmd
+	}
+	cmd.TTL = ttl
+	cmd.Payload = base.args[3]
+	for i := 4; i < len(base.args); i++ {
+		switch strings.ToLower(codec.BytesToString(base.args[i])) {
+		case "replace":
+			cmd.Replace = true
+		case "absttl":
+			cmd.AbsTTL = true
+		case "idletime", "freq":
+			if i+1 >= len(base.args) {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			i++
+			if n, ok := codec.StringBytes2Int64(base.args[i]); !ok || n < 0 {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+	}
+	return cmd
+}
+
+// ExpireAt the expire time of the restored key in unix seconds, ex is the dumped one
+func (c *RestoreCmd) ExpireAt(ex uint64) uint64 {
+	switch {
+	case c.TTL == 0:
+		return ex
+	case c.AbsTTL:
+		return (uint64(c.TTL) + 999) / 1000
+	}
+	return c.Now + (uint64(c.TTL)+999)/1000
+}
+
+func (c *RestoreCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.bytes(StatusReply, OK)
+}
+
+// MigrateCmd migrate host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password | AUTH2 username password] [KEYS key [key ...]]
+type MigrateCmd struct {
+	*BaseCmd
+	Host     string
+	Port     string
+	Keys     [][]byte
+	DB       int64
+	Timeout  time.Duration
+	Copy     bool
+	Replace  bool
+	Username []byte
+	Password []byte
+
+	// NoKey none of the keys exists
+	NoKey bool
+}
+
+func NewMigrateCmd(base *BaseCmd) *MigrateCmd {
+	cmd := &MigrateCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	if size < 6 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Host = string(base.args[1])
+	cmd.Port = string(base.args[2])
+	var ok bool
+	if cmd.DB, ok = codec.StringBytes2Int64(base.args[4]); !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	timeout, ok := codec.StringBytes2Int64(base.args[5])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	if timeout <= 0 {
+		timeout = 1000
+	}
+	cmd.Timeout = time.Duration(timeout) * time.Millisecond
+	for i := 6; i < size; i++ {
+		switch strings.ToLower(codec.BytesToString(base.args[i])) {
+		case "copy":
+			cmd.Copy = true
+		case "replace":
+			cmd.Replace = true
+		case "auth":
+			if i+1 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			cmd.Password = base.args[i+1]
+			i++
+		case "auth2":
+			if i+2 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			cmd.Username, cmd.Password = base.args[i+1], base.args[i+2]
+			i += 2
+		case "keys":
+			if len(base.args[3]) != 0 {
+				cmd.Err = kverror.ErrMigrateKeys
+				return cmd
+			}
+			cmd.Keys = uniqueKeys(base.args[i+1:])
+			i = size
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+	}
+	if cmd.Keys == nil {
+		cmd.Keys = [][]byte{base.args[3]}
+	}
+	return cmd
+}
+
+func (c *MigrateCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.NoKey {
+		return w.bytes(StatusReply, NOKEY)
+	}
+	return w.bytes(StatusReply, OK)
+}
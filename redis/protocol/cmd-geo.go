@@ -0,0 +1,500 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/geo"
+	"github.com/yixinin/gokv/kverror"
+)
+
+const (
+	GeoSortNone = 0
+	GeoSortAsc  = 1
+	GeoSortDesc = 2
+)
+
+// parseGeoUnit the meters of a distance unit
+func parseGeoUnit(b []byte) (float64, bool) {
+	switch strings.ToLower(codec.BytesToString(b)) {
+	case "m":
+		return 1, true
+	case "km":
+		return 1000, true
+	case "ft":
+		return 0.3048, true
+	case "mi":
+		return 1609.34, true
+	}
+	return 0, false
+}
+
+func parseLonLat(lonb, latb []byte) (lon, lat float64, err error) {
+	var err1, err2 error
+	lon, err1 = codec.ParseFloat(lonb, 64)
+	lat, err2 = codec.ParseFloat(latb, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, kverror.ErrNotFloat
+	}
+	if !geo.Valid(lon, lat) {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+func formatDist(d float64) []byte {
+	return strconv.AppendFloat(nil, d, 'f', 4, 64)
+}
+
+func formatCoord(f float64) []byte {
+	return strconv.AppendFloat(nil, f, 'f', -1, 64)
+}
+
+// NewGeoAddCmd geoadd key [NX|XX] [CH] longitude latitude member [longitude latitude member ...],
+// members are added to the sorted set with their geohash scores
+func NewGeoAddCmd(base *BaseCmd) *ZAddCmd {
+	cmd := &ZAddCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	var i = 2
+loop:
+	for ; i < size; i++ {
+		switch strings.ToLower(codec.BytesToString(base.args[i])) {
+		case "nx":
+			cmd.NX = true
+		case "xx":
+			cmd.XX = true
+		case "ch":
+			cmd.CH = true
+		default:
+			break loop
+		}
+	}
+	if i >= size || (size-i)%3 != 0 {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	if cmd.NX && cmd.XX {
+		cmd.Err = kverror.ErrZAddXXNX
+		return cmd
+	}
+	cmd.Members = make([]ZMember, 0, (size-i)/3)
+	for ; i < size; i += 3 {
+		lon, lat, err := parseLonLat(base.args[i], base.args[i+1])
+		if err != nil {
+			cmd.Err = err
+			return cmd
+		}
+		cmd.Members = append(cmd.Members, ZMember{Member: base.args[i+2], Score: float64(geo.Encode(lon, lat))})
+	}
+	return cmd
+}
+
+// GeoPosCmd geopos key [member ...]
+type GeoPosCmd struct {
+	*BaseCmd
+	Members [][]byte
+	// Pos the longitude and latitude of members, nil for missing members
+	Pos []*[2]float64
+}
+
+func NewGeoPosCmd(base *BaseCmd) *GeoPosCmd {
+	cmd := &GeoPosCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Members = base.args[2:]
+	cmd.Pos = make([]*[2]float64, len(cmd.Members))
+	return cmd
+}
+
+func (c *GeoPosCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	w.WriteByte(ArrayReply)
+	w.writeLen(len(c.Pos))
+	for _, pos := range c.Pos {
+		if pos == nil {
+			w.writeNilArray()
+			continue
+		}
+		w.writeBytesArray(StringReply, formatCoord(pos[0]), formatCoord(pos[1]))
+	}
+	return nil
+}
+
+// GeoHashCmd geohash key [member ...]
+type GeoHashCmd struct {
+	*BaseCmd
+	Members [][]byte
+	// Hashes the geohash strings of members, nil for missing members
+	Hashes [][]byte
+}
+
+func NewGeoHashCmd(base *BaseCmd) *GeoHashCmd {
+	cmd := &GeoHashCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Members = base.args[2:]
+	cmd.Hashes = make([][]byte, len(cmd.Members))
+	return cmd
+}
+
+func (c *GeoHashCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.writeBulkArray(c.Hashes...)
+}
+
+// GeoDistCmd geodist key member1 member2 [M|KM|FT|MI]
+type GeoDistCmd struct {
+	*BaseCmd
+	Member1 []byte
+	Member2 []byte
+	Unit    float64
+	// Dist nil if a member is missing
+	Dist *float64
+}
+
+func NewGeoDistCmd(base *BaseCmd) *GeoDistCmd {
+	cmd := &GeoDistCmd{
+		BaseCmd: base,
+		Unit:    1,
+	}
+	switch len(base.args) {
+	case 4:
+	case 5:
+		var ok bool
+		if cmd.Unit, ok = parseGeoUnit(base.args[4]); !ok {
+			cmd.Err = kverror.ErrGeoUnit
+			return cmd
+		}
+	default:
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Member1, cmd.Member2 = base.args[2], base.args[3]
+	return cmd
+}
+
+func (c *GeoDistCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Dist == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, formatDist(*c.Dist))
+}
+
+// GeoResult a member found by a geo search
+type GeoResult struct {
+	Member []byte
+	// Dist the distance in the unit of the search
+	Dist     float64
+	Score    uint64
+	Lon, Lat float64
+}
+
+// GeoSearchCmd geosearch, geosearchstore, georadius and georadiusbymember
+type GeoSearchCmd struct {
+	*BaseCmd
+	// FromMember the center member, Lon and Lat are resolved from it
+	FromMember []byte
+	Lon        float64
+	Lat        float64
+
+	ByBox bool
+	// Radius, Width and Height are in meters
+	Radius float64
+	Width  float64
+	Height float64
+	// Unit the meters of the unit of distances
+	Unit float64
+
+	Sort  int
+	Count int64
+	Any   bool
+
+	WithCoord bool
+	WithDist  bool
+	WithHash  bool
+
+	// Store the destination sorted set, scores are geohashes or distances with StoreDist
+	Store     []byte
+	StoreDist bool
+
+	Results []GeoResult
+	Stored  int64
+}
+
+// NewGeoSearchCmd geosearch key <FROMMEMBER member | FROMLONLAT longitude latitude>
+// <BYRADIUS radius unit | BYBOX width height unit> [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func NewGeoSearchCmd(base *BaseCmd) *GeoSearchCmd {
+	cmd := &GeoSearchCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.parseSearch(2, false)
+	return cmd
+}
+
+// NewGeoSearchStoreCmd geosearchstore destination source ... [STOREDIST]
+func NewGeoSearchStoreCmd(base *BaseCmd) *GeoSearchCmd {
+	cmd := &GeoSearchCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Store, cmd.Key = base.args[1], base.args[2]
+	cmd.parseSearch(3, true)
+	return cmd
+}
+
+// NewGeoRadiusCmd georadius key longitude latitude radius unit [WITHCOORD] [WITHDIST] [WITHHASH]
+// [COUNT count [ANY]] [ASC|DESC] [STORE key] [STOREDIST key]
+func NewGeoRadiusCmd(base *BaseCmd) *GeoSearchCmd {
+	cmd := &GeoSearchCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 6 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	if cmd.Lon, cmd.Lat, cmd.Err = parseLonLat(base.args[2], base.args[3]); cmd.Err != nil {
+		return cmd
+	}
+	cmd.parseRadius(4)
+	return cmd
+}
+
+// NewGeoRadiusByMemberCmd georadiusbymember key member radius unit ...
+func NewGeoRadiusByMemberCmd(base *BaseCmd) *GeoSearchCmd {
+	cmd := &GeoSearchCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 5 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.FromMember = base.args[2]
+	cmd.parseRadius(3)
+	return cmd
+}
+
+func (c *GeoSearchCmd) parseRadius(i int) {
+	var ok bool
+	if c.Radius, ok = ParseScore(c.args[i]); !ok {
+		c.Err = kverror.ErrNotFloat
+		return
+	}
+	if c.Radius < 0 {
+		c.Err = kverror.ErrGeoRadius
+		return
+	}
+	if c.Unit, ok = parseGeoUnit(c.args[i+1]); !ok {
+		c.Err = kverror.ErrGeoUnit
+		return
+	}
+	c.Radius *= c.Unit
+	for i += 2; i < len(c.args); i++ {
+		var arg = strings.ToLower(codec.BytesToString(c.args[i]))
+		switch {
+		case (arg == "store" || arg == "storedist") && i+1 < len(c.args):
+			c.Store = c.args[i+1]
+			c.StoreDist = arg == "storedist"
+			i++
+		default:
+			if i, ok = c.parseOption(i); !ok {
+				if c.Err == nil {
+					c.Err = kverror.ErrSyntax
+				}
+				return
+			}
+		}
+	}
+	if c.Store != nil && (c.WithCoord || c.WithDist || c.WithHash) {
+		c.Err = kverror.ErrGeoStore
+		return
+	}
+	c.check()
+}
+
+func (c *GeoSearchCmd) parseSearch(i int, store bool) {
+	var from, by int
+	var ok bool
+	for ; i < len(c.args); i++ {
+		var arg = strings.ToLower(codec.BytesToString(c.args[i]))
+		var left = len(c.args) - i - 1
+		switch {
+		case arg == "frommember" && left >= 1:
+			c.FromMember = c.args[i+1]
+			from++
+			i++
+		case arg == "fromlonlat" && left >= 2:
+			if c.Lon, c.Lat, c.Err = parseLonLat(c.args[i+1], c.args[i+2]); c.Err != nil {
+				return
+			}
+			from++
+			i += 2
+		case arg == "byradius" && left >= 2:
+			if c.Radius, ok = ParseScore(c.args[i+1]); !ok {
+				c.Err = kverror.ErrNotFloat
+				return
+			}
+			if c.Radius < 0 {
+				c.Err = kverror.ErrGeoRadius
+				return
+			}
+			if c.Unit, ok = parseGeoUnit(c.args[i+2]); !ok {
+				c.Err = kverror.ErrGeoUnit
+				return
+			}
+			c.Radius *= c.Unit
+			by++
+			i += 2
+		case arg == "bybox" && left >= 3:
+			var ok1, ok2 bool
+			c.Width, ok1 = ParseScore(c.args[i+1])
+			c.Height, ok2 = ParseScore(c.args[i+2])
+			if !ok1 || !ok2 {
+				c.Err = kverror.ErrNotFloat
+				return
+			}
+			if c.Width < 0 || c.Height < 0 {
+				c.Err = kverror.ErrGeoBox
+				return
+			}
+			if c.Unit, ok = parseGeoUnit(c.args[i+3]); !ok {
+				c.Err = kverror.ErrGeoUnit
+				return
+			}
+			c.Width *= c.Unit
+			c.Height *= c.Unit
+			c.ByBox = true
+			by++
+			i += 3
+		case arg == "storedist" && store:
+			c.StoreDist = true
+		default:
+			if i, ok = c.parseOption(i); !ok {
+				if c.Err == nil {
+					c.Err = kverror.ErrSyntax
+				}
+				return
+			}
+		}
+	}
+	if from != 1 {
+		c.Err = kverror.ErrGeoFrom
+		return
+	}
+	if by != 1 {
+		c.Err = kverror.ErrGeoBy
+		return
+	}
+	if store && (c.WithCoord || c.WithDist || c.WithHash) {
+		c.Err = kverror.ErrSyntax
+		return
+	}
+	c.check()
+}
+
+// parseOption parse the options shared by all searches, returns the index of the last parsed arg
+func (c *GeoSearchCmd) parseOption(i int) (int, bool) {
+	switch strings.ToLower(codec.BytesToString(c.args[i])) {
+	case "asc":
+		c.Sort = GeoSortAsc
+	case "desc":
+		c.Sort = GeoSortDesc
+	case "withcoord":
+		c.WithCoord = true
+	case "withdist":
+		c.WithDist = true
+	case "withhash":
+		c.WithHash = true
+	case "any":
+		c.Any = true
+	case "count":
+		if i+1 >= len(c.args) {
+			return i, false
+		}
+		var ok bool
+		if c.Count, ok = codec.StringBytes2Int64(c.args[i+1]); !ok {
+			c.Err = kverror.ErrNotInteger
+			return i, false
+		}
+		if c.Count <= 0 {
+			c.Err = kverror.ErrGeoCount
+			return i, false
+		}
+		return i + 1, true
+	default:
+		return i, false
+	}
+	return i, true
+}
+
+func (c *GeoSearchCmd) check() {
+	if c.Any && c.Count == 0 {
+		c.Err = kverror.ErrGeoAny
+		return
+	}
+	// the nearest ones are returned with a count
+	if c.Count > 0 && !c.Any && c.Sort == GeoSortNone {
+		c.Sort = GeoSortAsc
+	}
+}
+
+func (c *GeoSearchCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Store != nil {
+		return w.int(c.Stored)
+	}
+	w.WriteByte(ArrayReply)
+	w.writeLen(len(c.Results))
+	for _, r := range c.Results {
+		if !c.WithCoord && !c.WithDist && !c.WithHash {
+			w.bytes(StringReply, r.Member)
+			continue
+		}
+		var size = 1
+		for _, with := range []bool{c.WithCoord, c.WithDist, c.WithHash} {
+			if with {
+				size++
+			}
+		}
+		w.WriteByte(ArrayReply)
+		w.writeLen(size)
+		w.bytes(StringReply, r.Member)
+		if c.WithDist {
+			w.bytes(StringReply, formatDist(r.Dist))
+		}
+		if c.WithHash {
+			w.int(int64(r.Score))
+		}
+		if c.WithCoord {
+			w.writeBytesArray(StringReply, formatCoord(r.Lon), formatCoord(r.Lat))
+		}
+	}
+	return nil
+}
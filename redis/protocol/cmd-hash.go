@@ -0,0 +1,243 @@
+package protocol
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// HSetCmd hset key field value [field value ...] / hmset key field value [field value ...] / hsetnx key field value,
+// hset replies the count of added fields, hsetnx whether the field is set
+type HSetCmd struct {
+	*BaseCmd
+	Fields [][]byte
+	Vals   [][]byte
+	Count  int64
+
+	NX   bool
+	MSet bool
+}
+
+func NewHSetCmd(base *BaseCmd) *HSetCmd {
+	cmd := &HSetCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	if size < 4 || size%2 != 0 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Fields = make([][]byte, 0, size/2-1)
+	cmd.Vals = make([][]byte, 0, size/2-1)
+	for i := 2; i < size; i += 2 {
+		cmd.Fields = append(cmd.Fields, base.args[i])
+		cmd.Vals = append(cmd.Vals, base.args[i+1])
+	}
+	return cmd
+}
+
+func NewHMSetCmd(base *BaseCmd) *HSetCmd {
+	cmd := NewHSetCmd(base)
+	cmd.MSet = true
+	return cmd
+}
+
+func NewHSetNXCmd(base *BaseCmd) *HSetCmd {
+	cmd := NewHSetCmd(base)
+	if cmd.Err == nil && len(cmd.Fields) != 1 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	cmd.NX = true
+	return cmd
+}
+
+func (c *HSetCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.MSet {
+		return w.bytes(StatusReply, OK)
+	}
+	return w.int(c.Count)
+}
+
+// HGetCmd hget key field / hmget key field [field ...], the values of missing fields are nil
+type HGetCmd struct {
+	*BaseCmd
+	Fields [][]byte
+	Vals   [][]byte
+	Multi  bool
+}
+
+func NewHGetCmd(base *BaseCmd) *HGetCmd {
+	cmd := &HGetCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Fields = base.args[2:]
+	return cmd
+}
+
+func NewHMGetCmd(base *BaseCmd) *HGetCmd {
+	cmd := &HGetCmd{
+		BaseCmd: base,
+		Multi:   true,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Fields = base.args[2:]
+	return cmd
+}
+
+func (c *HGetCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	var vals = c.Vals
+	if vals == nil {
+		vals = make([][]byte, len(c.Fields))
+	}
+	if c.Multi {
+		return w.writeBulkArray(vals...)
+	}
+	if vals[0] == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, vals[0])
+}
+
+func NewHDelCmd(base *BaseCmd) *SAddCmd {
+	return NewSRemCmd(base)
+}
+
+func NewHLenCmd(base *BaseCmd) *SCardCmd {
+	return NewSCardCmd(base)
+}
+
+func NewHExistsCmd(base *BaseCmd) *SIsMemberCmd {
+	return NewSIsMemberCmd(base)
+}
+
+// HGetAllCmd hgetall key / hkeys key / hvals key, hgetall replies the fields and values in turn
+type HGetAllCmd struct {
+	*BaseCmd
+	Fields [][]byte
+	Vals   [][]byte
+
+	WithFields bool
+	WithVals   bool
+}
+
+func newHGetAllCmd(base *BaseCmd, fields, vals bool) *HGetAllCmd {
+	cmd := &HGetAllCmd{
+		BaseCmd:    base,
+		WithFields: fields,
+		WithVals:   vals,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func NewHGetAllCmd(base *BaseCmd) *HGetAllCmd {
+	return newHGetAllCmd(base, true, true)
+}
+
+func NewHKeysCmd(base *BaseCmd) *HGetAllCmd {
+	return newHGetAllCmd(base, true, false)
+}
+
+func NewHValsCmd(base *BaseCmd) *HGetAllCmd {
+	return newHGetAllCmd(base, false, true)
+}
+
+func (c *HGetAllCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	var elems = make([][]byte, 0, len(c.Fields)*2)
+	for i := range c.Fields {
+		if c.WithFields {
+			elems = append(elems, c.Fields[i])
+		}
+		if c.WithVals {
+			elems = append(elems, c.Vals[i])
+		}
+	}
+	return w.writeBytesArray(StringReply, elems...)
+}
+
+// HIncrByCmd hincrby key field increment, replies the new value
+type HIncrByCmd struct {
+	*BaseCmd
+	Field []byte
+	Val   int64
+}
+
+func NewHIncrByCmd(base *BaseCmd) *HIncrByCmd {
+	cmd := &HIncrByCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Field = base.args[2]
+	val, ok := codec.StringBytes2Int64(base.args[3])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	cmd.Val = val
+	return cmd
+}
+
+func (c *HIncrByCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Val)
+}
+
+// HIncrByFloatCmd hincrbyfloat key field increment, replies the new value as bulk string
+type HIncrByFloatCmd struct {
+	*BaseCmd
+	Field []byte
+	Incr  *big.Float
+	Val   []byte
+}
+
+func NewHIncrByFloatCmd(base *BaseCmd) *HIncrByFloatCmd {
+	cmd := &HIncrByFloatCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Field = base.args[2]
+	var ok bool
+	cmd.Incr, ok = codec.ParseLongDouble(base.args[3])
+	if !ok {
+		cmd.Err = kverror.ErrNotFloat
+		if f, err := codec.ParseFloat(base.args[3], 64); err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			cmd.Err = kverror.ErrIncrNaN
+		}
+	}
+	return cmd
+}
+
+func (c *HIncrByFloatCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.bytes(StringReply, c.Val)
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"github.com/yixinin/gokv/kverror"
+)
+
+// PFAddCmd pfadd key [element ...], replies 1 if the HyperLogLog is created or changed
+type PFAddCmd struct {
+	*BaseCmd
+	Elems   [][]byte
+	Updated bool
+}
+
+func NewPFAddCmd(base *BaseCmd) *PFAddCmd {
+	cmd := &PFAddCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Elems = base.args[2:]
+	return cmd
+}
+
+func (c *PFAddCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(boolInt(c.Updated))
+}
+
+// PFCountCmd pfcount key [key ...], the cardinality of the union of multiple keys
+type PFCountCmd struct {
+	*BaseCmd
+	Keys  [][]byte
+	Count uint64
+}
+
+func NewPFCountCmd(base *BaseCmd) *PFCountCmd {
+	cmd := &PFCountCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Keys = base.args[1:]
+	return cmd
+}
+
+func (c *PFCountCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.uint(c.Count)
+}
+
+// PFMergeCmd pfmerge destkey [sourcekey ...]
+type PFMergeCmd struct {
+	*BaseCmd
+	*OkResp
+	Srcs [][]byte
+}
+
+func NewPFMergeCmd(base *BaseCmd) *PFMergeCmd {
+	cmd := &PFMergeCmd{
+		BaseCmd: base,
+		OkResp:  &OkResp{},
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Srcs = base.args[2:]
+	return cmd
+}
+
+func (c *PFMergeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return c.OkResp.Write(w)
+}
@@ -0,0 +1,307 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// TypeCmd type key, replies the type name or none
+type TypeCmd struct {
+	*BaseCmd
+	Type string
+}
+
+func NewTypeCmd(base *BaseCmd) *TypeCmd {
+	cmd := &TypeCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *TypeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.bytes(StatusReply, codec.StringToBytes(c.Type))
+}
+
+// RenameCmd rename/renamenx key newkey, renamenx replies 1 if key is renamed
+type RenameCmd struct {
+	*BaseCmd
+	Dst     []byte
+	NX      bool
+	Renamed bool
+}
+
+func NewRenameCmd(base *BaseCmd) *RenameCmd {
+	cmd := &RenameCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Dst = base.args[2]
+	return cmd
+}
+
+func NewRenameNXCmd(base *BaseCmd) *RenameCmd {
+	cmd := NewRenameCmd(base)
+	cmd.NX = true
+	return cmd
+}
+
+func (c *RenameCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.NX {
+		return w.int(boolInt(c.Renamed))
+	}
+	return w.bytes(StatusReply, OK)
+}
+
+// CopyCmd copy source destination [DB destination-db] [REPLACE], replies 1 if source is copied.
+// DB is -1 for the selected database
+type CopyCmd struct {
+	*BaseCmd
+	Dst     []byte
+	DB      int64
+	Replace bool
+	Copied  bool
+}
+
+func NewCopyCmd(base *BaseCmd) *CopyCmd {
+	cmd := &CopyCmd{
+		BaseCmd: base,
+		DB:      -1,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Dst = base.args[2]
+	for i := 3; i < len(base.args); i++ {
+		switch strings.ToLower(codec.BytesToString(base.args[i])) {
+		case "replace":
+			cmd.Replace = true
+		case "db":
+			if i+1 >= len(base.args) {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			i++
+			db, ok := codec.StringBytes2Int64(base.args[i])
+			if !ok {
+				cmd.Err = kverror.ErrNotInteger
+				return cmd
+			}
+			if db < 0 {
+				cmd.Err = kverror.ErrDBIndex
+				return cmd
+			}
+			cmd.DB = db
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+	}
+	return cmd
+}
+
+func (c *CopyCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(boolInt(c.Copied))
+}
+
+// RandomKeyCmd randomkey, replies nil if the database is empty
+type RandomKeyCmd struct {
+	*BaseCmd
+	Found []byte
+}
+
+func NewRandomKeyCmd(base *BaseCmd) *RandomKeyCmd {
+	cmd := &RandomKeyCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 1 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *RandomKeyCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Found == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, c.Found)
+}
+
+// DBSizeCmd dbsize, expired keys are counted until they are deleted
+type DBSizeCmd struct {
+	*BaseCmd
+	Size int64
+}
+
+func NewDBSizeCmd(base *BaseCmd) *DBSizeCmd {
+	cmd := &DBSizeCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 1 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *DBSizeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Size)
+}
+
+// FlushCmd flushdb/flushall [ASYNC|SYNC], both modes delete synchronously
+type FlushCmd struct {
+	*BaseCmd
+	*OkResp
+	All bool
+}
+
+func NewFlushCmd(base *BaseCmd) *FlushCmd {
+	cmd := &FlushCmd{
+		BaseCmd: base,
+		OkResp:  &OkResp{},
+	}
+	if len(base.args) > 2 {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	if len(base.args) == 2 {
+		switch strings.ToLower(codec.BytesToString(base.args[1])) {
+		case "async", "sync":
+		default:
+			cmd.Err = kverror.ErrSyntax
+		}
+	}
+	return cmd
+}
+
+func NewFlushAllCmd(base *BaseCmd) *FlushCmd {
+	cmd := NewFlushCmd(base)
+	cmd.All = true
+	return cmd
+}
+
+func (c *FlushCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return c.OkResp.Write(w)
+}
+
+// SelectCmd select index
+type SelectCmd struct {
+	*BaseCmd
+	*OkResp
+	DB int64
+}
+
+func NewSelectCmd(base *BaseCmd) *SelectCmd {
+	cmd := &SelectCmd{
+		BaseCmd: base,
+		OkResp:  &OkResp{},
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	db, ok := codec.StringBytes2Int64(base.args[1])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	cmd.DB = db
+	return cmd
+}
+
+func (c *SelectCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return c.OkResp.Write(w)
+}
+
+// SwapDBCmd swapdb index1 index2
+type SwapDBCmd struct {
+	*BaseCmd
+	*OkResp
+	DB1, DB2 int64
+}
+
+func NewSwapDBCmd(base *BaseCmd) *SwapDBCmd {
+	cmd := &SwapDBCmd{
+		BaseCmd: base,
+		OkResp:  &OkResp{},
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok bool
+	if cmd.DB1, ok = codec.StringBytes2Int64(base.args[1]); !ok {
+		cmd.Err = kverror.ErrDBIndexFirst
+		return cmd
+	}
+	if cmd.DB2, ok = codec.StringBytes2Int64(base.args[2]); !ok {
+		cmd.Err = kverror.ErrDBIndexSecond
+	}
+	return cmd
+}
+
+func (c *SwapDBCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return c.OkResp.Write(w)
+}
+
+// MoveCmd move key db, replies 1 if key is moved
+type MoveCmd struct {
+	*BaseCmd
+	DB    int64
+	Moved bool
+}
+
+func NewMoveCmd(base *BaseCmd) *MoveCmd {
+	cmd := &MoveCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	db, ok := codec.StringBytes2Int64(base.args[2])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	cmd.DB = db
+	return cmd
+}
+
+func (c *MoveCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(boolInt(c.Moved))
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+const (
+	LeaseGrant     = "grant"
+	LeaseKeepAlive = "keepalive"
+	LeaseRevoke    = "revoke"
+	LeaseTTL       = "ttl"
+	LeaseKeys      = "keys"
+)
+
+// LeaseCmd lease grant ttl, lease keepalive|revoke|ttl|keys id.
+// grant replies the lease id, keepalive the granted ttl, ttl the remaining seconds or -2,
+// keys the keys attached to the lease
+type LeaseCmd struct {
+	*BaseCmd
+	Sub  string
+	ID   uint64
+	TTL  int64
+	Keys [][]byte
+}
+
+func NewLeaseCmd(base *BaseCmd) *LeaseCmd {
+	cmd := &LeaseCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Sub = strings.ToLower(codec.BytesToString(base.args[1]))
+	n, ok := codec.StringBytes2Int64(base.args[2])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	switch cmd.Sub {
+	case LeaseGrant:
+		if n <= 0 {
+			cmd.Err = kverror.ErrInvalidLeaseTTL
+		}
+		cmd.TTL = n
+	case LeaseKeepAlive, LeaseRevoke, LeaseTTL, LeaseKeys:
+		if n <= 0 {
+			cmd.Err = kverror.ErrLeaseNotFound
+		}
+		cmd.ID = uint64(n)
+	default:
+		cmd.Err = kverror.ErrSyntax
+	}
+	return cmd
+}
+
+func (c *LeaseCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	switch c.Sub {
+	case LeaseGrant:
+		return w.uint(c.ID)
+	case LeaseRevoke:
+		return w.bytes(StatusReply, OK)
+	case LeaseKeys:
+		return w.writeBulkArray(c.Keys...)
+	}
+	return w.int(c.TTL)
+}
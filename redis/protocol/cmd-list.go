@@ -0,0 +1,332 @@
+package protocol
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// parseTimeout parse the timeout seconds of blocking commands, 0 blocks forever
+func parseTimeout(b []byte) (time.Duration, error) {
+	f, err := strconv.ParseFloat(codec.BytesToString(b), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, kverror.ErrTimeoutFloat
+	}
+	if f < 0 {
+		return 0, kverror.ErrTimeoutNegative
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+func parseLeftRight(b []byte) (left bool, ok bool) {
+	switch strings.ToLower(codec.BytesToString(b)) {
+	case "left":
+		return true, true
+	case "right":
+		return false, true
+	}
+	return false, false
+}
+
+// PushCmd lpush/rpush/lpushx/rpushx key element [element ...], replies the length after push
+type PushCmd struct {
+	*BaseCmd
+	Left bool
+	// X only push if the list exists
+	X    bool
+	Vals [][]byte
+	Len  int64
+}
+
+func NewLPushCmd(base *BaseCmd) *PushCmd {
+	return newPushCmd(base, true, false)
+}
+
+func NewRPushCmd(base *BaseCmd) *PushCmd {
+	return newPushCmd(base, false, false)
+}
+
+func NewLPushXCmd(base *BaseCmd) *PushCmd {
+	return newPushCmd(base, true, true)
+}
+
+func NewRPushXCmd(base *BaseCmd) *PushCmd {
+	return newPushCmd(base, false, true)
+}
+
+func newPushCmd(base *BaseCmd, left, x bool) *PushCmd {
+	cmd := &PushCmd{
+		BaseCmd: base,
+		Left:    left,
+		X:       x,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Vals = base.args[2:]
+	return cmd
+}
+
+func (c *PushCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Len)
+}
+
+// PopCmd lpop/rpop key [count], replies a single element without count
+type PopCmd struct {
+	*BaseCmd
+	Left     bool
+	Count    int64
+	HasCount bool
+	// Vals nil if the list does not exist
+	Vals [][]byte
+}
+
+func NewLPopCmd(base *BaseCmd) *PopCmd {
+	return newPopCmd(base, true)
+}
+
+func NewRPopCmd(base *BaseCmd) *PopCmd {
+	return newPopCmd(base, false)
+}
+
+func newPopCmd(base *BaseCmd, left bool) *PopCmd {
+	cmd := &PopCmd{
+		BaseCmd: base,
+		Left:    left,
+		Count:   1,
+	}
+	switch len(base.args) {
+	case 2:
+	case 3:
+		var ok bool
+		if cmd.Count, ok = codec.StringBytes2Int64(base.args[2]); !ok || cmd.Count < 0 {
+			cmd.Err = kverror.ErrPositive
+			return cmd
+		}
+		cmd.HasCount = true
+	default:
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *PopCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Vals == nil {
+		if c.HasCount {
+			return w.writeNilArray()
+		}
+		return w.writeNil()
+	}
+	if c.HasCount {
+		return w.writeBytesArray(StringReply, c.Vals...)
+	}
+	return w.bytes(StringReply, c.Vals[0])
+}
+
+func NewLLenCmd(base *BaseCmd) *SCardCmd {
+	return NewSCardCmd(base)
+}
+
+// LRangeCmd lrange key start stop
+type LRangeCmd struct {
+	*BaseCmd
+	Start int64
+	Stop  int64
+	Vals  [][]byte
+}
+
+func NewLRangeCmd(base *BaseCmd) *LRangeCmd {
+	cmd := &LRangeCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok1, ok2 bool
+	cmd.Start, ok1 = codec.StringBytes2Int64(base.args[2])
+	cmd.Stop, ok2 = codec.StringBytes2Int64(base.args[3])
+	if !ok1 || !ok2 {
+		cmd.Err = kverror.ErrNotInteger
+	}
+	return cmd
+}
+
+func (c *LRangeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.writeBytesArray(StringReply, c.Vals...)
+}
+
+// LIndexCmd lindex key index
+type LIndexCmd struct {
+	*BaseCmd
+	Index int64
+	Val   []byte
+}
+
+func NewLIndexCmd(base *BaseCmd) *LIndexCmd {
+	cmd := &LIndexCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok bool
+	if cmd.Index, ok = codec.StringBytes2Int64(base.args[2]); !ok {
+		cmd.Err = kverror.ErrNotInteger
+	}
+	return cmd
+}
+
+func (c *LIndexCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Val == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, c.Val)
+}
+
+// LMoveCmd lmove source destination LEFT|RIGHT LEFT|RIGHT, rpoplpush source destination
+// and the blocking blmove/brpoplpush with a timeout
+type LMoveCmd struct {
+	*BaseCmd
+	Src      []byte
+	Dst      []byte
+	FromLeft bool
+	ToLeft   bool
+	Timeout  time.Duration
+
+	Val []byte
+}
+
+func NewLMoveCmd(base *BaseCmd) *LMoveCmd {
+	return newLMoveCmd(base, false)
+}
+
+func NewBLMoveCmd(base *BaseCmd) *LMoveCmd {
+	return newLMoveCmd(base, true)
+}
+
+func newLMoveCmd(base *BaseCmd, block bool) *LMoveCmd {
+	cmd := &LMoveCmd{
+		BaseCmd: base,
+	}
+	var size = 5
+	if block {
+		size = 6
+	}
+	if len(base.args) != size {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Src, cmd.Dst = base.args[1], base.args[2]
+	var ok1, ok2 bool
+	cmd.FromLeft, ok1 = parseLeftRight(base.args[3])
+	cmd.ToLeft, ok2 = parseLeftRight(base.args[4])
+	if !ok1 || !ok2 {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	if block {
+		cmd.Timeout, cmd.Err = parseTimeout(base.args[5])
+	}
+	return cmd
+}
+
+func NewRPopLPushCmd(base *BaseCmd) *LMoveCmd {
+	return newRPopLPushCmd(base, false)
+}
+
+func NewBRPopLPushCmd(base *BaseCmd) *LMoveCmd {
+	return newRPopLPushCmd(base, true)
+}
+
+func newRPopLPushCmd(base *BaseCmd, block bool) *LMoveCmd {
+	cmd := &LMoveCmd{
+		BaseCmd: base,
+		ToLeft:  true,
+	}
+	var size = 3
+	if block {
+		size = 4
+	}
+	if len(base.args) != size {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Src, cmd.Dst = base.args[1], base.args[2]
+	if block {
+		cmd.Timeout, cmd.Err = parseTimeout(base.args[3])
+	}
+	return cmd
+}
+
+func (c *LMoveCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Val == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, c.Val)
+}
+
+// BPopCmd blpop/brpop key [key ...] timeout, replies the key and the popped element
+type BPopCmd struct {
+	*BaseCmd
+	Keys    [][]byte
+	Left    bool
+	Timeout time.Duration
+
+	Key []byte
+	Val []byte
+}
+
+func NewBLPopCmd(base *BaseCmd) *BPopCmd {
+	return newBPopCmd(base, true)
+}
+
+func NewBRPopCmd(base *BaseCmd) *BPopCmd {
+	return newBPopCmd(base, false)
+}
+
+func newBPopCmd(base *BaseCmd, left bool) *BPopCmd {
+	cmd := &BPopCmd{
+		BaseCmd: base,
+		Left:    left,
+	}
+	var size = len(base.args)
+	if size < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Keys = base.args[1 : size-1]
+	cmd.Timeout, cmd.Err = parseTimeout(base.args[size-1])
+	return cmd
+}
+
+func (c *BPopCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Key == nil {
+		return w.writeNilArray()
+	}
+	return w.writeBytesArray(StringReply, c.Key, c.Val)
+}
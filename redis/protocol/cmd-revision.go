@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// Revision the value of a key written at a revision, nil if the key is deleted or is not a string
+type Revision struct {
+	Rev uint64
+	Val []byte
+}
+
+func parseRevision(arg []byte) (uint64, error) {
+	rev, ok := codec.StringBytes2Int64(arg)
+	if !ok || rev < 0 {
+		return 0, kverror.ErrNotInteger
+	}
+	return uint64(rev), nil
+}
+
+// GetRevCmd getrev key rev, replies the string value of key at the revision or nil
+type GetRevCmd struct {
+	*BaseCmd
+	Rev uint64
+	Val []byte
+}
+
+func NewGetRevCmd(base *BaseCmd) *GetRevCmd {
+	cmd := &GetRevCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Rev, cmd.Err = parseRevision(base.args[2])
+	return cmd
+}
+
+func (c *GetRevCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Val == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, c.Val)
+}
+
+// HistoryCmd history key, replies the kept revisions of key as [rev, value] pairs from the oldest one
+type HistoryCmd struct {
+	*BaseCmd
+	Revs []Revision
+}
+
+func NewHistoryCmd(base *BaseCmd) *HistoryCmd {
+	cmd := &HistoryCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *HistoryCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	w.WriteByte(ArrayReply)
+	w.writeLen(len(c.Revs))
+	for _, r := range c.Revs {
+		w.WriteByte(ArrayReply)
+		w.writeLen(2)
+		w.uint(r.Rev)
+		if r.Val == nil {
+			w.writeNil()
+		} else {
+			w.bytes(StringReply, r.Val)
+		}
+	}
+	return nil
+}
+
+// CompactCmd compact rev, removes the revisions older than rev of the selected database,
+// replies the number of removed revisions
+type CompactCmd struct {
+	*BaseCmd
+	Rev     uint64
+	Removed int64
+}
+
+func NewCompactCmd(base *BaseCmd) *CompactCmd {
+	cmd := &CompactCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Rev, cmd.Err = parseRevision(base.args[1])
+	return cmd
+}
+
+func (c *CompactCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Removed)
+}
@@ -0,0 +1,511 @@
+package protocol
+
+import (
+	"strings"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// InfoCmd info [section ...], replies the sections as a bulk string formatted like redis
+type InfoCmd struct {
+	*BaseCmd
+	Sections []string
+	Info     string
+}
+
+func NewInfoCmd(base *BaseCmd) *InfoCmd {
+	cmd := &InfoCmd{
+		BaseCmd: base,
+	}
+	for _, arg := range base.args[1:] {
+		cmd.Sections = append(cmd.Sections, strings.ToLower(codec.BytesToString(arg)))
+	}
+	return cmd
+}
+
+// Wants whether the section is requested, all sections are written by default
+func (c *InfoCmd) Wants(section string) bool {
+	if len(c.Sections) == 0 {
+		return true
+	}
+	for _, s := range c.Sections {
+		switch s {
+		case section, "all", "everything", "default":
+			return true
+		}
+	}
+	return false
+}
+
+func (c *InfoCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.bytes(StringReply, codec.StringToBytes(c.Info))
+}
+
+const (
+	ConfigGet     = "get"
+	ConfigSet     = "set"
+	ConfigRewrite = "rewrite"
+)
+
+// ConfigCmd config get pattern [pattern ...], config set name value [name value ...], config rewrite.
+// get replies the names and values of the matched settings
+type ConfigCmd struct {
+	*BaseCmd
+	Sub string
+	// Args the lower case patterns of get, the names and values of set
+	Args   []string
+	Values []string
+}
+
+func NewConfigCmd(base *BaseCmd) *ConfigCmd {
+	cmd := &ConfigCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Sub = strings.ToLower(codec.BytesToString(base.args[1]))
+	for i, arg := range base.args[2:] {
+		// the names are case insensitive, the values are kept
+		if cmd.Sub == ConfigGet || i%2 == 0 {
+			cmd.Args = append(cmd.Args, strings.ToLower(string(arg)))
+		} else {
+			cmd.Args = append(cmd.Args, string(arg))
+		}
+	}
+	switch cmd.Sub {
+	case ConfigGet:
+		if len(cmd.Args) == 0 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	case ConfigSet:
+		if len(cmd.Args) == 0 || len(cmd.Args)%2 != 0 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	case ConfigRewrite:
+		if len(cmd.Args) != 0 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	default:
+		cmd.Err = kverror.ErrSyntax
+	}
+	return cmd
+}
+
+func (c *ConfigCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Sub == ConfigGet {
+		return w.writeArray(StringReply, c.Values...)
+	}
+	return w.bytes(StatusReply, OK)
+}
+
+const (
+	SlowlogGet   = "get"
+	SlowlogLen   = "len"
+	SlowlogReset = "reset"
+)
+
+// SlowlogEntry a command slower than the threshold, durations are in microseconds
+type SlowlogEntry struct {
+	ID       uint64
+	Time     int64
+	Duration int64
+	Args     [][]byte
+	Addr     string
+	Name     string
+	// Phases the durations of the phases, parse=1 read=2 propose=3 reply=4
+	Phases string
+}
+
+// SlowlogCmd slowlog get [count], slowlog len, slowlog reset.
+// get replies the entries like redis with the phases as the seventh field
+type SlowlogCmd struct {
+	*BaseCmd
+	Sub string
+	// Count the number of entries to get, all if negative
+	Count   int64
+	Entries []SlowlogEntry
+	Len     int64
+}
+
+func NewSlowlogCmd(base *BaseCmd) *SlowlogCmd {
+	cmd := &SlowlogCmd{
+		BaseCmd: base,
+		Count:   10,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Sub = strings.ToLower(codec.BytesToString(base.args[1]))
+	switch cmd.Sub {
+	case SlowlogGet:
+		if len(base.args) > 3 {
+			cmd.Err = kverror.ErrCommandArgs
+			return cmd
+		}
+		if len(base.args) == 3 {
+			n, ok := codec.StringBytes2Int64(base.args[2])
+			if !ok || n < -1 {
+				cmd.Err = kverror.ErrNotInteger
+				return cmd
+			}
+			cmd.Count = n
+		}
+	case SlowlogLen, SlowlogReset:
+		if len(base.args) != 2 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	default:
+		cmd.Err = kverror.ErrSyntax
+	}
+	return cmd
+}
+
+func (c *SlowlogCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	switch c.Sub {
+	case SlowlogLen:
+		return w.int(c.Len)
+	case SlowlogReset:
+		return w.bytes(StatusReply, OK)
+	}
+	w.WriteByte(ArrayReply)
+	w.writeLen(len(c.Entries))
+	for _, e := range c.Entries {
+		w.WriteByte(ArrayReply)
+		w.writeLen(7)
+		w.uint(e.ID)
+		w.int(e.Time)
+		w.int(e.Duration)
+		w.writeBulkArray(e.Args...)
+		w.bytes(StringReply, codec.StringToBytes(e.Addr))
+		w.bytes(StringReply, codec.StringToBytes(e.Name))
+		if err := w.bytes(StringReply, codec.StringToBytes(e.Phases)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	LatencyLatest  = "latest"
+	LatencyHistory = "history"
+	LatencyReset   = "reset"
+)
+
+// LatencySample the latency in milliseconds of an event at the unix time
+type LatencySample struct {
+	Time    int64
+	Latency int64
+}
+
+// LatencyEvent the latest and max latency of an event
+type LatencyEvent struct {
+	Name   string
+	Latest LatencySample
+	Max    int64
+}
+
+// LatencyCmd latency latest, latency history event, latency reset [event ...]
+type LatencyCmd struct {
+	*BaseCmd
+	Sub     string
+	Events  []string
+	Latest  []LatencyEvent
+	History []LatencySample
+	Reset   int64
+}
+
+func NewLatencyCmd(base *BaseCmd) *LatencyCmd {
+	cmd := &LatencyCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Sub = strings.ToLower(codec.BytesToString(base.args[1]))
+	for _, arg := range base.args[2:] {
+		cmd.Events = append(cmd.Events, strings.ToLower(string(arg)))
+	}
+	switch cmd.Sub {
+	case LatencyLatest:
+		if len(cmd.Events) != 0 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	case LatencyHistory:
+		if len(cmd.Events) != 1 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	case LatencyReset:
+	default:
+		cmd.Err = kverror.ErrSyntax
+	}
+	return cmd
+}
+
+func (c *LatencyCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	switch c.Sub {
+	case LatencyReset:
+		return w.int(c.Reset)
+	case LatencyHistory:
+		w.WriteByte(ArrayReply)
+		w.writeLen(len(c.History))
+		for _, s := range c.History {
+			w.WriteByte(ArrayReply)
+			w.writeLen(2)
+			w.int(s.Time)
+			if err := w.int(s.Latency); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w.WriteByte(ArrayReply)
+	w.writeLen(len(c.Latest))
+	for _, e := range c.Latest {
+		w.WriteByte(ArrayReply)
+		w.writeLen(4)
+		w.bytes(StringReply, codec.StringToBytes(e.Name))
+		w.int(e.Latest.Time)
+		w.int(e.Latest.Latency)
+		if err := w.int(e.Max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MonitorCmd monitor, the commands are streamed to the client after OK
+type MonitorCmd struct {
+	*BaseCmd
+}
+
+func NewMonitorCmd(base *BaseCmd) *MonitorCmd {
+	cmd := &MonitorCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 1 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *MonitorCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.bytes(StatusReply, OK)
+}
+
+const (
+	ClientList    = "list"
+	ClientInfo    = "info"
+	ClientKill    = "kill"
+	ClientID      = "id"
+	ClientSetName = "setname"
+	ClientGetName = "getname"
+	ClientPause   = "pause"
+	ClientUnpause = "unpause"
+	ClientNoEvict = "no-evict"
+)
+
+// ClientKillFilter the clients to kill, the zero fields match all clients
+type ClientKillFilter struct {
+	ID    uint64
+	Addr  string
+	LAddr string
+	User  string
+	// SkipMe keep the client calling kill, it is the default of the filter form
+	SkipMe bool
+}
+
+// ClientCmd client list [id id ...], client info, client kill addr, client kill filter value [filter value ...],
+// client id, client setname name, client getname, client pause timeout [write|all], client unpause,
+// client no-evict on|off
+type ClientCmd struct {
+	*BaseCmd
+	Sub string
+	// IDs the clients to list, all if empty
+	IDs  []uint64
+	Kill ClientKillFilter
+	// KillAddr the old form of kill, it replies OK or an error if no client is killed
+	KillAddr   bool
+	Name       []byte
+	Timeout    time.Duration
+	PauseWrite bool
+	NoEvict    bool
+
+	// Info the lines of list and info, N the id or the number of killed clients
+	Info string
+	N    int64
+}
+
+func NewClientCmd(base *BaseCmd) *ClientCmd {
+	cmd := &ClientCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Sub = strings.ToLower(codec.BytesToString(base.args[1]))
+	args := base.args[2:]
+	switch cmd.Sub {
+	case ClientList:
+		if len(args) == 0 {
+			return cmd
+		}
+		if len(args) < 2 || strings.ToLower(codec.BytesToString(args[0])) != "id" {
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		for _, arg := range args[1:] {
+			id, ok := codec.StringBytes2Uint64(arg)
+			if !ok {
+				cmd.Err = kverror.ErrInvalidClientID
+				return cmd
+			}
+			cmd.IDs = append(cmd.IDs, id)
+		}
+	case ClientKill:
+		cmd.parseKill(args)
+	case ClientSetName:
+		if len(args) != 1 {
+			cmd.Err = kverror.ErrCommandArgs
+			return cmd
+		}
+		for _, c := range args[0] {
+			if c <= ' ' || c > '~' {
+				cmd.Err = kverror.ErrClientName
+				return cmd
+			}
+		}
+		cmd.Name = args[0]
+	case ClientPause:
+		if len(args) != 1 && len(args) != 2 {
+			cmd.Err = kverror.ErrCommandArgs
+			return cmd
+		}
+		ms, ok := codec.StringBytes2Int64(args[0])
+		if !ok {
+			cmd.Err = kverror.ErrTimeoutFloat
+			return cmd
+		}
+		if ms < 0 {
+			cmd.Err = kverror.ErrTimeoutNegative
+			return cmd
+		}
+		cmd.Timeout = time.Duration(ms) * time.Millisecond
+		if len(args) == 2 {
+			switch strings.ToLower(codec.BytesToString(args[1])) {
+			case "write":
+				cmd.PauseWrite = true
+			case "all":
+			default:
+				cmd.Err = kverror.ErrSyntax
+			}
+		}
+	case ClientNoEvict:
+		if len(args) != 1 {
+			cmd.Err = kverror.ErrCommandArgs
+			return cmd
+		}
+		switch strings.ToLower(codec.BytesToString(args[0])) {
+		case "on":
+			cmd.NoEvict = true
+		case "off":
+		default:
+			cmd.Err = kverror.ErrSyntax
+		}
+	case ClientInfo, ClientID, ClientGetName, ClientUnpause:
+		if len(args) != 0 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	default:
+		cmd.Err = kverror.ErrSyntax
+	}
+	return cmd
+}
+
+// parseKill parse kill addr or the filters of kill
+func (c *ClientCmd) parseKill(args [][]byte) {
+	if len(args) == 1 {
+		c.KillAddr = true
+		c.Kill.Addr = string(args[0])
+		return
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		c.Err = kverror.ErrSyntax
+		return
+	}
+	c.Kill.SkipMe = true
+	for i := 0; i < len(args); i += 2 {
+		v := args[i+1]
+		switch strings.ToLower(codec.BytesToString(args[i])) {
+		case "id":
+			id, ok := codec.StringBytes2Uint64(v)
+			if !ok || id == 0 {
+				c.Err = kverror.ErrInvalidClientID
+				return
+			}
+			c.Kill.ID = id
+		case "addr":
+			c.Kill.Addr = string(v)
+		case "laddr":
+			c.Kill.LAddr = string(v)
+		case "user":
+			c.Kill.User = string(v)
+		case "skipme":
+			switch strings.ToLower(codec.BytesToString(v)) {
+			case "yes":
+				c.Kill.SkipMe = true
+			case "no":
+				c.Kill.SkipMe = false
+			default:
+				c.Err = kverror.ErrSyntax
+				return
+			}
+		default:
+			c.Err = kverror.ErrSyntax
+			return
+		}
+	}
+}
+
+func (c *ClientCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	switch c.Sub {
+	case ClientList, ClientInfo:
+		return w.bytes(StringReply, codec.StringToBytes(c.Info))
+	case ClientID:
+		return w.int(c.N)
+	case ClientGetName:
+		if len(c.Name) == 0 {
+			return w.writeNil()
+		}
+		return w.bytes(StringReply, c.Name)
+	case ClientKill:
+		if !c.KillAddr {
+			return w.int(c.N)
+		}
+	}
+	return w.bytes(StatusReply, OK)
+}
@@ -0,0 +1,270 @@
+package protocol
+
+import (
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+const (
+	SetOpInter = "inter"
+	SetOpUnion = "union"
+	SetOpDiff  = "diff"
+)
+
+// SAddCmd sadd/srem key member [member ...], replies the count of added/removed members
+type SAddCmd struct {
+	*BaseCmd
+	Members [][]byte
+	Count   int64
+}
+
+func NewSAddCmd(base *BaseCmd) *SAddCmd {
+	cmd := &SAddCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Members = uniqueKeys(base.args[2:])
+	return cmd
+}
+
+func NewSRemCmd(base *BaseCmd) *SAddCmd {
+	return NewSAddCmd(base)
+}
+
+func (c *SAddCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Count)
+}
+
+// SCardCmd scard key
+type SCardCmd struct {
+	*BaseCmd
+	Count int64
+}
+
+func NewSCardCmd(base *BaseCmd) *SCardCmd {
+	cmd := &SCardCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *SCardCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Count)
+}
+
+// SIsMemberCmd sismember key member / smismember key member [member ...]
+type SIsMemberCmd struct {
+	*BaseCmd
+	Members [][]byte
+	Exists  []bool
+	Multi   bool
+}
+
+func NewSIsMemberCmd(base *BaseCmd) *SIsMemberCmd {
+	cmd := &SIsMemberCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Members = base.args[2:]
+	return cmd
+}
+
+func NewSMIsMemberCmd(base *BaseCmd) *SIsMemberCmd {
+	cmd := &SIsMemberCmd{
+		BaseCmd: base,
+		Multi:   true,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Members = base.args[2:]
+	return cmd
+}
+
+func (c *SIsMemberCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if !c.Multi {
+		return w.int(boolInt(c.Exists[0]))
+	}
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(len(c.Exists)); err != nil {
+		return err
+	}
+	for _, ok := range c.Exists {
+		if err := w.int(boolInt(ok)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// SMembersCmd smembers key
+type SMembersCmd struct {
+	*BaseCmd
+	Members [][]byte
+}
+
+func NewSMembersCmd(base *BaseCmd) *SMembersCmd {
+	cmd := &SMembersCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *SMembersCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.writeBytesArray(StringReply, c.Members...)
+}
+
+// SOpCmd sinter/sunion/sdiff key [key ...] and sinterstore/sunionstore/sdiffstore destination key [key ...]
+type SOpCmd struct {
+	*BaseCmd
+	Op      string
+	Dest    []byte
+	Keys    [][]byte
+	Members [][]byte
+}
+
+func NewSInterCmd(base *BaseCmd) *SOpCmd {
+	return newSOpCmd(base, SetOpInter, false)
+}
+
+func NewSUnionCmd(base *BaseCmd) *SOpCmd {
+	return newSOpCmd(base, SetOpUnion, false)
+}
+
+func NewSDiffCmd(base *BaseCmd) *SOpCmd {
+	return newSOpCmd(base, SetOpDiff, false)
+}
+
+func NewSInterStoreCmd(base *BaseCmd) *SOpCmd {
+	return newSOpCmd(base, SetOpInter, true)
+}
+
+func NewSUnionStoreCmd(base *BaseCmd) *SOpCmd {
+	return newSOpCmd(base, SetOpUnion, true)
+}
+
+func NewSDiffStoreCmd(base *BaseCmd) *SOpCmd {
+	return newSOpCmd(base, SetOpDiff, true)
+}
+
+func newSOpCmd(base *BaseCmd, op string, store bool) *SOpCmd {
+	cmd := &SOpCmd{
+		BaseCmd: base,
+		Op:      op,
+	}
+	var min = 2
+	if store {
+		min = 3
+	}
+	if len(base.args) < min {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	if store {
+		cmd.Dest = base.args[1]
+	}
+	cmd.Keys = base.args[min-1:]
+	return cmd
+}
+
+func (c *SOpCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Dest != nil {
+		return w.int(int64(len(c.Members)))
+	}
+	return w.writeBytesArray(StringReply, c.Members...)
+}
+
+// SRandCmd spop/srandmember key [count], replies a single member without count
+type SRandCmd struct {
+	*BaseCmd
+	Count    int64
+	HasCount bool
+	Members  [][]byte
+}
+
+func NewSPopCmd(base *BaseCmd) *SRandCmd {
+	cmd := newSRandCmd(base)
+	if cmd.Err == nil && cmd.Count < 0 {
+		cmd.Err = kverror.ErrPositive
+	}
+	return cmd
+}
+
+func NewSRandMemberCmd(base *BaseCmd) *SRandCmd {
+	return newSRandCmd(base)
+}
+
+func newSRandCmd(base *BaseCmd) *SRandCmd {
+	cmd := &SRandCmd{
+		BaseCmd: base,
+		Count:   1,
+	}
+	switch len(base.args) {
+	case 2:
+	case 3:
+		var ok bool
+		if cmd.Count, ok = codec.StringBytes2Int64(base.args[2]); !ok {
+			cmd.Err = kverror.ErrNotInteger
+			return cmd
+		}
+		cmd.HasCount = true
+	default:
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *SRandCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.HasCount {
+		return w.writeBytesArray(StringReply, c.Members...)
+	}
+	if len(c.Members) == 0 {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, c.Members[0])
+}
+
+// NewSScanCmd sscan key cursor [match pattern] [count count]
+func NewSScanCmd(base *BaseCmd) *ScanCmd {
+	return newScanCmd(base, 2)
+}
@@ -0,0 +1,1086 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// StreamID ms-seq id of stream entries
+type StreamID struct {
+	Ms  uint64 `json:"ms"`
+	Seq uint64 `json:"seq"`
+}
+
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Less(o StreamID) bool {
+	return id.Ms < o.Ms || (id.Ms == o.Ms && id.Seq < o.Seq)
+}
+
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Incr the next id, false if id is the max id
+func (id StreamID) Incr() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		id.Seq++
+	case id.Ms < math.MaxUint64:
+		id.Ms++
+		id.Seq = 0
+	default:
+		return id, false
+	}
+	return id, true
+}
+
+// Decr the previous id, false if id is 0-0
+func (id StreamID) Decr() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		id.Seq--
+	case id.Ms > 0:
+		id.Ms--
+		id.Seq = math.MaxUint64
+	default:
+		return id, false
+	}
+	return id, true
+}
+
+// Bytes big endian ms and seq, which keeps the order of ids
+func (id StreamID) Bytes() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, id.Ms)
+	binary.BigEndian.PutUint64(b[8:], id.Seq)
+	return b
+}
+
+func StreamIDFromBytes(b []byte) StreamID {
+	if len(b) < 16 {
+		return StreamID{}
+	}
+	return StreamID{
+		Ms:  binary.BigEndian.Uint64(b),
+		Seq: binary.BigEndian.Uint64(b[8:]),
+	}
+}
+
+// ParseStreamID parse ms-seq or ms, seq is used when it is missing
+func ParseStreamID(b []byte, seq uint64) (StreamID, bool) {
+	var id StreamID
+	var ok bool
+	i := bytes.IndexByte(b, '-')
+	if i < 0 {
+		id.Ms, ok = codec.StringBytes2Uint64(b)
+		id.Seq = seq
+		return id, ok
+	}
+	if id.Ms, ok = codec.StringBytes2Uint64(b[:i]); !ok {
+		return id, false
+	}
+	id.Seq, ok = codec.StringBytes2Uint64(b[i+1:])
+	return id, ok
+}
+
+// parseRangeID parse the start/end of a range, - + and exclusive (id
+func parseRangeID(b []byte, start bool) (id StreamID, empty bool, ok bool) {
+	switch string(b) {
+	case "-":
+		return StreamID{}, false, true
+	case "+":
+		return MaxStreamID, false, true
+	}
+	var exclusive = len(b) > 0 && b[0] == '('
+	if exclusive {
+		b = b[1:]
+	}
+	var seq uint64
+	if !start {
+		seq = math.MaxUint64
+	}
+	if id, ok = ParseStreamID(b, seq); !ok {
+		return id, false, false
+	}
+	if exclusive {
+		if start {
+			id, ok = id.Incr()
+		} else {
+			id, ok = id.Decr()
+		}
+		return id, !ok, true
+	}
+	return id, false, true
+}
+
+// StreamEntry an entry of stream, nil fields for a deleted entry in the pending list
+type StreamEntry struct {
+	ID     StreamID
+	Fields [][]byte
+}
+
+type StreamResult struct {
+	Key     []byte
+	Entries []StreamEntry
+}
+
+func (w *Writer) writeNilArray() error {
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if _, err := w.Write(NIL); err != nil {
+		return err
+	}
+	return w.crlf()
+}
+
+func (w *Writer) writeStreamEntries(entries []StreamEntry) error {
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(len(entries)); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := w.WriteByte(ArrayReply); err != nil {
+			return err
+		}
+		if err := w.writeLen(2); err != nil {
+			return err
+		}
+		if err := w.bytes(StringReply, codec.StringToBytes(e.ID.String())); err != nil {
+			return err
+		}
+		if e.Fields == nil {
+			if err := w.writeNilArray(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.writeBytesArray(StringReply, e.Fields...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) writeStreamIDs(ids []StreamID) error {
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(len(ids)); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := w.bytes(StringReply, codec.StringToBytes(id.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	StreamTrimMaxLen = "maxlen"
+	StreamTrimMinID  = "minid"
+)
+
+// StreamTrim MAXLEN|MINID [=|~] threshold [LIMIT count]
+type StreamTrim struct {
+	Strategy string
+	Approx   bool
+	MaxLen   int64
+	MinID    StreamID
+	Limit    int64
+}
+
+// parseStreamTrim parse the trim options start from args[i], returns the index of the last parsed arg
+func parseStreamTrim(args [][]byte, i int) (*StreamTrim, int, error) {
+	var t = &StreamTrim{
+		Strategy: strings.ToLower(codec.BytesToString(args[i])),
+	}
+	i++
+	if i < len(args) {
+		switch codec.BytesToString(args[i]) {
+		case "~":
+			t.Approx = true
+			i++
+		case "=":
+			i++
+		}
+	}
+	if i >= len(args) {
+		return nil, i, kverror.ErrSyntax
+	}
+	var ok bool
+	switch t.Strategy {
+	case StreamTrimMaxLen:
+		if t.MaxLen, ok = codec.StringBytes2Int64(args[i]); !ok {
+			return nil, i, kverror.ErrNotInteger
+		}
+		if t.MaxLen < 0 {
+			return nil, i, kverror.ErrPositive
+		}
+	case StreamTrimMinID:
+		if t.MinID, ok = ParseStreamID(args[i], 0); !ok {
+			return nil, i, kverror.ErrStreamID
+		}
+	}
+	if i+1 < len(args) && strings.ToLower(codec.BytesToString(args[i+1])) == "limit" {
+		if i+2 >= len(args) {
+			return nil, i, kverror.ErrSyntax
+		}
+		if t.Limit, ok = codec.StringBytes2Int64(args[i+2]); !ok || t.Limit < 0 {
+			return nil, i, kverror.ErrNotInteger
+		}
+		if !t.Approx {
+			return nil, i, kverror.ErrStreamTrimLimit
+		}
+		i += 2
+	}
+	return t, i, nil
+}
+
+// XAddCmd xadd key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+type XAddCmd struct {
+	*BaseCmd
+	NoMkStream bool
+	Trim       *StreamTrim
+
+	ID StreamID
+	// AutoID * and AutoSeq ms-*
+	AutoID  bool
+	AutoSeq bool
+	Fields  [][]byte
+
+	// Added the id of the added entry, nil if the stream does not exist with NOMKSTREAM
+	Added *StreamID
+}
+
+func NewXAddCmd(base *BaseCmd) *XAddCmd {
+	cmd := &XAddCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	var i = 2
+loop:
+	for ; i < size; i++ {
+		switch strings.ToLower(codec.BytesToString(base.args[i])) {
+		case "nomkstream":
+			cmd.NoMkStream = true
+		case StreamTrimMaxLen, StreamTrimMinID:
+			cmd.Trim, i, cmd.Err = parseStreamTrim(base.args, i)
+			if cmd.Err != nil {
+				return cmd
+			}
+		default:
+			break loop
+		}
+	}
+	if i >= size || (size-i-1) == 0 || (size-i-1)%2 != 0 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Fields = base.args[i+1:]
+	id := base.args[i]
+	switch {
+	case string(id) == "*":
+		cmd.AutoID = true
+	case bytes.HasSuffix(id, []byte("-*")):
+		var ok bool
+		if cmd.ID.Ms, ok = codec.StringBytes2Uint64(id[:len(id)-2]); !ok {
+			cmd.Err = kverror.ErrStreamID
+			return cmd
+		}
+		cmd.AutoSeq = true
+	default:
+		var ok bool
+		if cmd.ID, ok = ParseStreamID(id, 0); !ok {
+			cmd.Err = kverror.ErrStreamID
+			return cmd
+		}
+		if cmd.ID.IsZero() {
+			cmd.Err = kverror.ErrStreamIDZero
+		}
+	}
+	return cmd
+}
+
+func (c *XAddCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Added == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, codec.StringToBytes(c.Added.String()))
+}
+
+// XRangeCmd xrange key start end [COUNT count] / xrevrange key end start [COUNT count]
+type XRangeCmd struct {
+	*BaseCmd
+	Start StreamID
+	End   StreamID
+	Rev   bool
+	// Count -1 for all entries
+	Count int64
+	// Empty the range is empty, like an exclusive start at the max id
+	Empty bool
+
+	Entries []StreamEntry
+}
+
+func NewXRangeCmd(base *BaseCmd) *XRangeCmd {
+	return newXRangeCmd(base, false)
+}
+
+func NewXRevRangeCmd(base *BaseCmd) *XRangeCmd {
+	return newXRangeCmd(base, true)
+}
+
+func newXRangeCmd(base *BaseCmd, rev bool) *XRangeCmd {
+	cmd := &XRangeCmd{
+		BaseCmd: base,
+		Rev:     rev,
+		Count:   -1,
+	}
+	var size = len(base.args)
+	if size != 4 && size != 6 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var start, end = base.args[2], base.args[3]
+	if rev {
+		start, end = end, start
+	}
+	var emptyStart, emptyEnd, ok bool
+	if cmd.Start, emptyStart, ok = parseRangeID(start, true); !ok {
+		cmd.Err = kverror.ErrStreamID
+		return cmd
+	}
+	if cmd.End, emptyEnd, ok = parseRangeID(end, false); !ok {
+		cmd.Err = kverror.ErrStreamID
+		return cmd
+	}
+	cmd.Empty = emptyStart || emptyEnd || cmd.End.Less(cmd.Start)
+	if size == 6 {
+		if strings.ToLower(codec.BytesToString(base.args[4])) != "count" {
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		if cmd.Count, ok = codec.StringBytes2Int64(base.args[5]); !ok {
+			cmd.Err = kverror.ErrNotInteger
+			return cmd
+		}
+		if cmd.Count <= 0 {
+			cmd.Empty = true
+		}
+	}
+	return cmd
+}
+
+func (c *XRangeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.writeStreamEntries(c.Entries)
+}
+
+// XLenCmd xlen key
+type XLenCmd struct {
+	*BaseCmd
+	Len int64
+}
+
+func NewXLenCmd(base *BaseCmd) *XLenCmd {
+	cmd := &XLenCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *XLenCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Len)
+}
+
+// XDelCmd xdel key id [id ...] / xtrim key MAXLEN|MINID [=|~] threshold [LIMIT count], replies the count of deleted entries
+type XDelCmd struct {
+	*BaseCmd
+	IDs   []StreamID
+	Trim  *StreamTrim
+	Count int64
+}
+
+func NewXDelCmd(base *BaseCmd) *XDelCmd {
+	cmd := &XDelCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.IDs = make([]StreamID, 0, len(base.args)-2)
+	for _, arg := range base.args[2:] {
+		id, ok := ParseStreamID(arg, 0)
+		if !ok {
+			cmd.Err = kverror.ErrStreamID
+			return cmd
+		}
+		cmd.IDs = append(cmd.IDs, id)
+	}
+	return cmd
+}
+
+func NewXTrimCmd(base *BaseCmd) *XDelCmd {
+	cmd := &XDelCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	switch strings.ToLower(codec.BytesToString(base.args[2])) {
+	case StreamTrimMaxLen, StreamTrimMinID:
+	default:
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	var i int
+	cmd.Trim, i, cmd.Err = parseStreamTrim(base.args, 2)
+	if cmd.Err == nil && i != len(base.args)-1 {
+		cmd.Err = kverror.ErrSyntax
+	}
+	return cmd
+}
+
+func (c *XDelCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Count)
+}
+
+// XReadCmd xread [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// and xreadgroup GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+type XReadCmd struct {
+	*BaseCmd
+	// Count -1 for all entries
+	Count int64
+	// Block -1 for not blocking
+	Block int64
+
+	Group    []byte
+	Consumer []byte
+	NoAck    bool
+
+	Keys [][]byte
+	IDs  []StreamID
+	// Last $, the last id of the stream
+	Last []bool
+	// New >, entries never delivered to the group
+	New []bool
+
+	Results []StreamResult
+}
+
+func NewXReadCmd(base *BaseCmd) *XReadCmd {
+	return newXReadCmd(base, false)
+}
+
+func NewXReadGroupCmd(base *BaseCmd) *XReadCmd {
+	return newXReadCmd(base, true)
+}
+
+func newXReadCmd(base *BaseCmd, group bool) *XReadCmd {
+	cmd := &XReadCmd{
+		BaseCmd: base,
+		Count:   -1,
+		Block:   -1,
+	}
+	var size = len(base.args)
+	var streams = -1
+	var ok bool
+loop:
+	for i := 1; i < size; i++ {
+		opt := strings.ToLower(codec.BytesToString(base.args[i]))
+		switch {
+		case opt == "streams":
+			streams = i + 1
+			break loop
+		case opt == "count" && i+1 < size:
+			i++
+			if cmd.Count, ok = codec.StringBytes2Int64(base.args[i]); !ok {
+				cmd.Err = kverror.ErrNotInteger
+				return cmd
+			}
+			if cmd.Count <= 0 {
+				cmd.Count = -1
+			}
+		case opt == "block" && i+1 < size:
+			i++
+			if cmd.Block, ok = codec.StringBytes2Int64(base.args[i]); !ok {
+				cmd.Err = kverror.ErrNotInteger
+				return cmd
+			}
+			if cmd.Block < 0 {
+				cmd.Err = kverror.ErrTimeoutNegative
+				return cmd
+			}
+		case opt == "group" && group && i+2 < size:
+			cmd.Group = base.args[i+1]
+			cmd.Consumer = base.args[i+2]
+			i += 2
+		case opt == "noack" && group:
+			cmd.NoAck = true
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+	}
+	if streams < 0 || (group && cmd.Group == nil) {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	var rest = base.args[streams:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		cmd.Err = kverror.ErrUnbalancedStreams
+		return cmd
+	}
+	var n = len(rest) / 2
+	cmd.Keys = rest[:n]
+	cmd.IDs = make([]StreamID, n)
+	cmd.Last = make([]bool, n)
+	cmd.New = make([]bool, n)
+	for i, arg := range rest[n:] {
+		switch {
+		case string(arg) == "$" && !group:
+			cmd.Last[i] = true
+		case string(arg) == ">" && group:
+			cmd.New[i] = true
+		default:
+			if cmd.IDs[i], ok = ParseStreamID(arg, 0); !ok {
+				cmd.Err = kverror.ErrStreamID
+				return cmd
+			}
+		}
+	}
+	return cmd
+}
+
+func (c *XReadCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if len(c.Results) == 0 {
+		return w.writeNilArray()
+	}
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(len(c.Results)); err != nil {
+		return err
+	}
+	for _, r := range c.Results {
+		if err := w.WriteByte(ArrayReply); err != nil {
+			return err
+		}
+		if err := w.writeLen(2); err != nil {
+			return err
+		}
+		if err := w.bytes(StringReply, r.Key); err != nil {
+			return err
+		}
+		if err := w.writeStreamEntries(r.Entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	XGroupCreate         = "create"
+	XGroupSetID          = "setid"
+	XGroupDestroy        = "destroy"
+	XGroupCreateConsumer = "createconsumer"
+	XGroupDelConsumer    = "delconsumer"
+)
+
+// XGroupCmd xgroup create key group id|$ [MKSTREAM], xgroup setid key group id|$,
+// xgroup destroy key group, xgroup createconsumer|delconsumer key group consumer
+type XGroupCmd struct {
+	*BaseCmd
+	Sub      string
+	Group    []byte
+	Consumer []byte
+	ID       StreamID
+	Last     bool
+	MkStream bool
+
+	// Count the reply of destroy/createconsumer/delconsumer
+	Count int64
+}
+
+func NewXGroupCmd(base *BaseCmd) *XGroupCmd {
+	cmd := &XGroupCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	if size < 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Sub = strings.ToLower(codec.BytesToString(base.args[1]))
+	cmd.Key = base.args[2]
+	cmd.Group = base.args[3]
+	switch cmd.Sub {
+	case XGroupCreate, XGroupSetID:
+		if size < 5 {
+			cmd.Err = kverror.ErrCommandArgs
+			return cmd
+		}
+		if string(base.args[4]) == "$" {
+			cmd.Last = true
+		} else {
+			var ok bool
+			if cmd.ID, ok = ParseStreamID(base.args[4], 0); !ok {
+				cmd.Err = kverror.ErrStreamID
+				return cmd
+			}
+		}
+		for i := 5; i < size; i++ {
+			switch strings.ToLower(codec.BytesToString(base.args[i])) {
+			case "mkstream":
+				if cmd.Sub != XGroupCreate {
+					cmd.Err = kverror.ErrSyntax
+					return cmd
+				}
+				cmd.MkStream = true
+			case "entriesread":
+				// entries-read is only used for the lag of xinfo, which is not supported
+				if i+1 >= size {
+					cmd.Err = kverror.ErrSyntax
+					return cmd
+				}
+				i++
+				if _, ok := codec.StringBytes2Int64(base.args[i]); !ok {
+					cmd.Err = kverror.ErrNotInteger
+					return cmd
+				}
+			default:
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+		}
+	case XGroupDestroy:
+		if size != 4 {
+			cmd.Err = kverror.ErrCommandArgs
+		}
+	case XGroupCreateConsumer, XGroupDelConsumer:
+		if size != 5 {
+			cmd.Err = kverror.ErrCommandArgs
+			return cmd
+		}
+		cmd.Consumer = base.args[4]
+	default:
+		cmd.Err = kverror.ErrSyntax
+	}
+	return cmd
+}
+
+func (c *XGroupCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	switch c.Sub {
+	case XGroupCreate, XGroupSetID:
+		return w.bytes(StatusReply, OK)
+	}
+	return w.int(c.Count)
+}
+
+// XAckCmd xack key group id [id ...]
+type XAckCmd struct {
+	*BaseCmd
+	Group []byte
+	IDs   []StreamID
+	Count int64
+}
+
+func NewXAckCmd(base *BaseCmd) *XAckCmd {
+	cmd := &XAckCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Group = base.args[2]
+	cmd.IDs = make([]StreamID, 0, len(base.args)-3)
+	for _, arg := range base.args[3:] {
+		id, ok := ParseStreamID(arg, 0)
+		if !ok {
+			cmd.Err = kverror.ErrStreamID
+			return cmd
+		}
+		cmd.IDs = append(cmd.IDs, id)
+	}
+	return cmd
+}
+
+func (c *XAckCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Count)
+}
+
+// PendingEntry an entry of the pending entries list of a consumer group
+type PendingEntry struct {
+	ID       StreamID
+	Consumer []byte
+	// Idle milliseconds since the last delivery
+	Idle      int64
+	Delivered int64
+}
+
+type PendingConsumer struct {
+	Name  []byte
+	Count int64
+}
+
+// XPendingCmd xpending key group [[IDLE min-idle-time] start end count [consumer]]
+type XPendingCmd struct {
+	*BaseCmd
+	Group    []byte
+	Extended bool
+	MinIdle  int64
+	Start    StreamID
+	End      StreamID
+	Count    int64
+	Consumer []byte
+
+	// the summary form
+	Total     int64
+	Min       StreamID
+	Max       StreamID
+	Consumers []PendingConsumer
+
+	// the extended form
+	Entries []PendingEntry
+}
+
+func NewXPendingCmd(base *BaseCmd) *XPendingCmd {
+	cmd := &XPendingCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	if size < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Group = base.args[2]
+	if size == 3 {
+		return cmd
+	}
+	cmd.Extended = true
+	var i = 3
+	var ok bool
+	if strings.ToLower(codec.BytesToString(base.args[i])) == "idle" {
+		if i+1 >= size {
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		if cmd.MinIdle, ok = codec.StringBytes2Int64(base.args[i+1]); !ok {
+			cmd.Err = kverror.ErrNotInteger
+			return cmd
+		}
+		i += 2
+	}
+	if size-i != 3 && size-i != 4 {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	var empty bool
+	if cmd.Start, empty, ok = parseRangeID(base.args[i], true); !ok {
+		cmd.Err = kverror.ErrStreamID
+		return cmd
+	}
+	var emptyEnd bool
+	if cmd.End, emptyEnd, ok = parseRangeID(base.args[i+1], false); !ok {
+		cmd.Err = kverror.ErrStreamID
+		return cmd
+	}
+	if cmd.Count, ok = codec.StringBytes2Int64(base.args[i+2]); !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	if empty || emptyEnd || cmd.Count < 0 {
+		cmd.Count = 0
+	}
+	if size-i == 4 {
+		cmd.Consumer = base.args[i+3]
+	}
+	return cmd
+}
+
+func (c *XPendingCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Extended {
+		if err := w.WriteByte(ArrayReply); err != nil {
+			return err
+		}
+		if err := w.writeLen(len(c.Entries)); err != nil {
+			return err
+		}
+		for _, e := range c.Entries {
+			if err := w.WriteByte(ArrayReply); err != nil {
+				return err
+			}
+			if err := w.writeLen(4); err != nil {
+				return err
+			}
+			if err := w.bytes(StringReply, codec.StringToBytes(e.ID.String())); err != nil {
+				return err
+			}
+			if err := w.bytes(StringReply, e.Consumer); err != nil {
+				return err
+			}
+			if err := w.int(e.Idle); err != nil {
+				return err
+			}
+			if err := w.int(e.Delivered); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(4); err != nil {
+		return err
+	}
+	if err := w.int(c.Total); err != nil {
+		return err
+	}
+	if c.Total == 0 {
+		w.writeNil()
+		w.writeNil()
+		return w.writeNilArray()
+	}
+	w.bytes(StringReply, codec.StringToBytes(c.Min.String()))
+	w.bytes(StringReply, codec.StringToBytes(c.Max.String()))
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(len(c.Consumers)); err != nil {
+		return err
+	}
+	for _, consumer := range c.Consumers {
+		if err := w.writeBytesArray(StringReply, consumer.Name, codec.StringToBytes(strconv.FormatInt(consumer.Count, 10))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// XClaimCmd xclaim key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+// and xautoclaim key group consumer min-idle-time start [COUNT count] [JUSTID]
+type XClaimCmd struct {
+	*BaseCmd
+	Group    []byte
+	Consumer []byte
+	MinIdle  int64
+	IDs      []StreamID
+
+	// Idle/Time/RetryCount -1 if not set
+	Idle       int64
+	Time       int64
+	RetryCount int64
+	Force      bool
+	JustID     bool
+	LastID     *StreamID
+
+	// Auto xautoclaim scans the pending list from Start
+	Auto  bool
+	Start StreamID
+	Count int64
+
+	Entries []StreamEntry
+	// Next/Deleted the cursor and the deleted ids of xautoclaim
+	Next    StreamID
+	Deleted []StreamID
+}
+
+func NewXClaimCmd(base *BaseCmd) *XClaimCmd {
+	cmd := newXClaimCmd(base)
+	if cmd.Err != nil {
+		return cmd
+	}
+	var size = len(base.args)
+	var i = 5
+	for ; i < size; i++ {
+		id, ok := ParseStreamID(base.args[i], 0)
+		if !ok {
+			break
+		}
+		cmd.IDs = append(cmd.IDs, id)
+	}
+	if len(cmd.IDs) == 0 {
+		cmd.Err = kverror.ErrStreamID
+		return cmd
+	}
+	for ; i < size; i++ {
+		opt := strings.ToLower(codec.BytesToString(base.args[i]))
+		switch opt {
+		case "force":
+			cmd.Force = true
+		case "justid":
+			cmd.JustID = true
+		case "idle", "time", "retrycount", "lastid":
+			if i+1 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			i++
+			if opt == "lastid" {
+				id, ok := ParseStreamID(base.args[i], 0)
+				if !ok {
+					cmd.Err = kverror.ErrStreamID
+					return cmd
+				}
+				cmd.LastID = &id
+				continue
+			}
+			n, ok := codec.StringBytes2Int64(base.args[i])
+			if !ok {
+				cmd.Err = kverror.ErrNotInteger
+				return cmd
+			}
+			if n < 0 {
+				n = 0
+			}
+			switch opt {
+			case "idle":
+				cmd.Idle = n
+			case "time":
+				cmd.Time = n
+			case "retrycount":
+				cmd.RetryCount = n
+			}
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+	}
+	return cmd
+}
+
+func NewXAutoClaimCmd(base *BaseCmd) *XClaimCmd {
+	cmd := newXClaimCmd(base)
+	if cmd.Err != nil {
+		return cmd
+	}
+	cmd.Auto = true
+	cmd.Count = 100
+	var ok bool
+	var empty bool
+	if cmd.Start, empty, ok = parseRangeID(base.args[5], true); !ok || empty {
+		cmd.Err = kverror.ErrStreamID
+		return cmd
+	}
+	var size = len(base.args)
+	for i := 6; i < size; i++ {
+		switch strings.ToLower(codec.BytesToString(base.args[i])) {
+		case "justid":
+			cmd.JustID = true
+		case "count":
+			if i+1 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			i++
+			if cmd.Count, ok = codec.StringBytes2Int64(base.args[i]); !ok || cmd.Count < 1 {
+				cmd.Err = kverror.ErrXAutoClaimCount
+				return cmd
+			}
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+	}
+	return cmd
+}
+
+func newXClaimCmd(base *BaseCmd) *XClaimCmd {
+	cmd := &XClaimCmd{
+		BaseCmd:    base,
+		Idle:       -1,
+		Time:       -1,
+		RetryCount: -1,
+	}
+	if len(base.args) < 6 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Group = base.args[2]
+	cmd.Consumer = base.args[3]
+	var ok bool
+	if cmd.MinIdle, ok = codec.StringBytes2Int64(base.args[4]); !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	if cmd.MinIdle < 0 {
+		cmd.MinIdle = 0
+	}
+	return cmd
+}
+
+func (c *XClaimCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Auto {
+		if err := w.WriteByte(ArrayReply); err != nil {
+			return err
+		}
+		if err := w.writeLen(3); err != nil {
+			return err
+		}
+		if err := w.bytes(StringReply, codec.StringToBytes(c.Next.String())); err != nil {
+			return err
+		}
+	}
+	var err error
+	if c.JustID {
+		var ids = make([]StreamID, 0, len(c.Entries))
+		for _, e := range c.Entries {
+			ids = append(ids, e.ID)
+		}
+		err = w.writeStreamIDs(ids)
+	} else {
+		err = w.writeStreamEntries(c.Entries)
+	}
+	if err != nil || !c.Auto {
+		return err
+	}
+	return w.writeStreamIDs(c.Deleted)
+}
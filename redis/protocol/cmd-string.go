@@ -0,0 +1,300 @@
+package protocol
+
+import (
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// MGetCmd mget key [key ...]
+type MGetCmd struct {
+	*BaseCmd
+	Keys [][]byte
+	Vals [][]byte
+}
+
+func NewMGetCmd(base *BaseCmd) *MGetCmd {
+	cmd := &MGetCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Keys = base.args[1:]
+	cmd.Vals = make([][]byte, len(cmd.Keys))
+	return cmd
+}
+
+func (c *MGetCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.writeBulkArray(c.Vals...)
+}
+
+// MSetCmd mset/msetnx key value [key value ...]
+type MSetCmd struct {
+	*BaseCmd
+	*OkResp
+	Keys [][]byte
+	Vals [][]byte
+
+	NX bool
+}
+
+func NewMSetCmd(base *BaseCmd) *MSetCmd {
+	cmd := &MSetCmd{
+		BaseCmd: base,
+		OkResp:  &OkResp{},
+	}
+	var size = len(base.args)
+	if size < 3 || size%2 != 1 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Keys = make([][]byte, 0, size/2)
+	cmd.Vals = make([][]byte, 0, size/2)
+	for i := 1; i < size; i += 2 {
+		cmd.Keys = append(cmd.Keys, base.args[i])
+		cmd.Vals = append(cmd.Vals, base.args[i+1])
+	}
+	return cmd
+}
+
+func NewMSetNXCmd(base *BaseCmd) *MSetCmd {
+	cmd := NewMSetCmd(base)
+	cmd.NX = true
+	return cmd
+}
+
+func (c *MSetCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.NX {
+		if c.OK {
+			return w.int(1)
+		}
+		return w.int(0)
+	}
+	return c.OkResp.Write(w)
+}
+
+// AppendCmd append key value, replies the length after append
+type AppendCmd struct {
+	*BaseCmd
+	Val []byte
+	Len int64
+}
+
+func NewAppendCmd(base *BaseCmd) *AppendCmd {
+	cmd := &AppendCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Val = base.args[2]
+	return cmd
+}
+
+func (c *AppendCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Len)
+}
+
+// StrLenCmd strlen key
+type StrLenCmd struct {
+	*BaseCmd
+	Len int64
+}
+
+func NewStrLenCmd(base *BaseCmd) *StrLenCmd {
+	cmd := &StrLenCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 2 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *StrLenCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Len)
+}
+
+// GetRangeCmd getrange key start end
+type GetRangeCmd struct {
+	*BaseCmd
+	Start int64
+	End   int64
+	Val   []byte
+}
+
+func NewGetRangeCmd(base *BaseCmd) *GetRangeCmd {
+	cmd := &GetRangeCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok1, ok2 bool
+	cmd.Start, ok1 = codec.StringBytes2Int64(base.args[2])
+	cmd.End, ok2 = codec.StringBytes2Int64(base.args[3])
+	if !ok1 || !ok2 {
+		cmd.Err = kverror.ErrNotInteger
+	}
+	return cmd
+}
+
+func (c *GetRangeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.bytes(StringReply, c.Val)
+}
+
+// SetRangeCmd setrange key offset value, replies the length after modify
+type SetRangeCmd struct {
+	*BaseCmd
+	Offset int64
+	Val    []byte
+	Len    int64
+}
+
+func NewSetRangeCmd(base *BaseCmd) *SetRangeCmd {
+	cmd := &SetRangeCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok bool
+	cmd.Offset, ok = codec.StringBytes2Int64(base.args[2])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	if cmd.Offset < 0 {
+		cmd.Err = kverror.ErrOffsetRange
+		return cmd
+	}
+	cmd.Val = base.args[3]
+	return cmd
+}
+
+func (c *SetRangeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Len)
+}
+
+// GetSetCmd getset key value
+type GetSetCmd struct {
+	*GetCmd
+	NewVal []byte
+}
+
+func NewGetSetCmd(base *BaseCmd) *GetSetCmd {
+	cmd := &GetSetCmd{
+		GetCmd: NewGetCmd(base),
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.NewVal = base.args[2]
+	return cmd
+}
+
+// GetExCmd getex key [ex|px|exat|pxat time|persist]
+type GetExCmd struct {
+	*GetCmd
+	EX      uint64
+	Persist bool
+	// Update whether the expire time should be modified
+	Update bool
+}
+
+func NewGetExCmd(base *BaseCmd) *GetExCmd {
+	cmd := &GetExCmd{
+		GetCmd: NewGetCmd(base),
+	}
+	var size = len(base.args)
+	if size < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	for i := 2; i < size; i++ {
+		if cmd.Update {
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		arg := strings.ToLower(codec.BytesToString(base.args[i]))
+		switch arg {
+		case EX, PX, EXAT, PXAT:
+			if i+1 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			i++
+			cmd.EX, cmd.Err = parseExpireAt(arg, base.args[i], base.Now)
+			if cmd.Err != nil {
+				return cmd
+			}
+		case PERSIST:
+			cmd.Persist = true
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		cmd.Update = true
+	}
+	return cmd
+}
+
+// IncrByFloatCmd incrbyfloat key increment, replies the new value as bulk string
+type IncrByFloatCmd struct {
+	*BaseCmd
+	Incr *big.Float
+	Val  []byte
+}
+
+func NewIncrByFloatCmd(base *BaseCmd) *IncrByFloatCmd {
+	cmd := &IncrByFloatCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok bool
+	cmd.Incr, ok = codec.ParseLongDouble(base.args[2])
+	if !ok {
+		cmd.Err = kverror.ErrNotFloat
+		if f, err := codec.ParseFloat(base.args[2], 64); err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			cmd.Err = kverror.ErrIncrNaN
+		}
+	}
+	return cmd
+}
+
+func (c *IncrByFloatCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.bytes(StringReply, c.Val)
+}
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+var (
+	KVWATCH   = []byte("kvwatch")
+	KVUNWATCH = []byte("kvunwatch")
+	CHANGE    = []byte("change")
+)
+
+// KVWatchCmd kvwatch prefix [FROM index], replies ["kvwatch", prefix, index] with the applied index,
+// then the changes of keys with prefix applied after FROM are pushed as ChangeEvent
+type KVWatchCmd struct {
+	*BaseCmd
+	Prefix []byte
+	From   uint64
+	Index  uint64
+}
+
+func NewKVWatchCmd(base *BaseCmd) *KVWatchCmd {
+	cmd := &KVWatchCmd{
+		BaseCmd: base,
+	}
+	switch len(base.args) {
+	case 2:
+	case 4:
+		if strings.ToLower(codec.BytesToString(base.args[2])) != "from" {
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+		from, ok := codec.StringBytes2Int64(base.args[3])
+		if !ok || from < 0 {
+			cmd.Err = kverror.ErrNotInteger
+			return cmd
+		}
+		cmd.From = uint64(from)
+	default:
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Prefix = base.args[1]
+	return cmd
+}
+
+func (c *KVWatchCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	w.WriteByte(ArrayReply)
+	w.writeLen(3)
+	w.bytes(StringReply, KVWATCH)
+	w.bytes(StringReply, c.Prefix)
+	return w.uint(c.Index)
+}
+
+// KVUnwatchCmd kvunwatch, replies ["kvunwatch", prefix, index] with the index of the last pushed change
+type KVUnwatchCmd struct {
+	*BaseCmd
+	Prefix []byte
+	Index  uint64
+}
+
+func NewKVUnwatchCmd(base *BaseCmd) *KVUnwatchCmd {
+	cmd := &KVUnwatchCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 1 {
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *KVUnwatchCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	w.WriteByte(ArrayReply)
+	w.writeLen(3)
+	w.bytes(StringReply, KVUNWATCH)
+	if c.Prefix == nil {
+		w.writeNil()
+	} else {
+		w.bytes(StringReply, c.Prefix)
+	}
+	return w.uint(c.Index)
+}
+
+// ChangeEvent a change pushed to a watching client as ["change", index, op, key, value],
+// value is the string value of a put, nil for the other ops and for the puts of other types
+type ChangeEvent struct {
+	Index uint64
+	OP    string
+	Key   []byte
+	Value []byte
+}
+
+func (e *ChangeEvent) Write(w *Writer) error {
+	w.WriteByte(ArrayReply)
+	w.writeLen(5)
+	w.bytes(StringReply, CHANGE)
+	w.uint(e.Index)
+	w.bytes(StringReply, codec.StringToBytes(e.OP))
+	if e.Key == nil {
+		w.writeNil()
+	} else {
+		w.bytes(StringReply, e.Key)
+	}
+	if e.Value == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, e.Value)
+}
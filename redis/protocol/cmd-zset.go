@@ -0,0 +1,339 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+)
+
+// ZMember a sorted set member with its score
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ParseScore parse a sorted set score, inf and -inf are allowed but NaN is not
+func ParseScore(b []byte) (float64, bool) {
+	f, err := codec.ParseFloat(b, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// FormatScore format a score like redis, infinities are inf and -inf
+func FormatScore(f float64) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return []byte("inf")
+	case math.IsInf(f, -1):
+		return []byte("-inf")
+	}
+	return strconv.AppendFloat(nil, f, 'g', -1, 64)
+}
+
+func (w *Writer) writeZMembers(members []ZMember, withScores bool) error {
+	var size = len(members)
+	if withScores {
+		size *= 2
+	}
+	var vals = make([][]byte, 0, size)
+	for _, m := range members {
+		vals = append(vals, m.Member)
+		if withScores {
+			vals = append(vals, FormatScore(m.Score))
+		}
+	}
+	return w.writeBytesArray(StringReply, vals...)
+}
+
+// ZAddCmd zadd key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...], and zincrby key increment member
+type ZAddCmd struct {
+	*BaseCmd
+	NX   bool
+	XX   bool
+	GT   bool
+	LT   bool
+	CH   bool
+	Incr bool
+
+	Members []ZMember
+
+	// Count the added members, or the changed ones with CH
+	Count int64
+	// Score the new score with INCR, nil if the operation is aborted
+	Score *float64
+}
+
+func NewZAddCmd(base *BaseCmd) *ZAddCmd {
+	cmd := &ZAddCmd{
+		BaseCmd: base,
+	}
+	var size = len(base.args)
+	var i = 2
+loop:
+	for ; i < size; i++ {
+		switch strings.ToLower(codec.BytesToString(base.args[i])) {
+		case "nx":
+			cmd.NX = true
+		case "xx":
+			cmd.XX = true
+		case "gt":
+			cmd.GT = true
+		case "lt":
+			cmd.LT = true
+		case "ch":
+			cmd.CH = true
+		case "incr":
+			cmd.Incr = true
+		default:
+			break loop
+		}
+	}
+	if i >= size || (size-i)%2 != 0 {
+		cmd.Err = kverror.ErrSyntax
+		return cmd
+	}
+	if cmd.NX && cmd.XX {
+		cmd.Err = kverror.ErrZAddXXNX
+		return cmd
+	}
+	if (cmd.GT && cmd.LT) || (cmd.NX && (cmd.GT || cmd.LT)) {
+		cmd.Err = kverror.ErrZAddGTLTNX
+		return cmd
+	}
+	if cmd.Incr && size-i != 2 {
+		cmd.Err = kverror.ErrZAddIncr
+		return cmd
+	}
+	cmd.Members = make([]ZMember, 0, (size-i)/2)
+	for ; i < size; i += 2 {
+		score, ok := ParseScore(base.args[i])
+		if !ok {
+			cmd.Err = kverror.ErrNotFloat
+			return cmd
+		}
+		cmd.Members = append(cmd.Members, ZMember{Member: base.args[i+1], Score: score})
+	}
+	return cmd
+}
+
+func NewZIncrByCmd(base *BaseCmd) *ZAddCmd {
+	cmd := &ZAddCmd{
+		BaseCmd: base,
+		Incr:    true,
+	}
+	if len(base.args) != 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	score, ok := ParseScore(base.args[2])
+	if !ok {
+		cmd.Err = kverror.ErrNotFloat
+		return cmd
+	}
+	cmd.Members = []ZMember{{Member: base.args[3], Score: score}}
+	return cmd
+}
+
+func (c *ZAddCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if !c.Incr {
+		return w.int(c.Count)
+	}
+	if c.Score == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, FormatScore(*c.Score))
+}
+
+func NewZRemCmd(base *BaseCmd) *SAddCmd {
+	return NewSRemCmd(base)
+}
+
+func NewZCardCmd(base *BaseCmd) *SCardCmd {
+	return NewSCardCmd(base)
+}
+
+// ZScoreCmd zscore key member
+type ZScoreCmd struct {
+	*BaseCmd
+	Member []byte
+	Score  *float64
+}
+
+func NewZScoreCmd(base *BaseCmd) *ZScoreCmd {
+	cmd := &ZScoreCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) != 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Member = base.args[2]
+	return cmd
+}
+
+func (c *ZScoreCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Score == nil {
+		return w.writeNil()
+	}
+	return w.bytes(StringReply, FormatScore(*c.Score))
+}
+
+// ZRangeCmd zrange key start stop [REV] [WITHSCORES], zrevrange key start stop [WITHSCORES] by rank
+type ZRangeCmd struct {
+	*BaseCmd
+	Start      int64
+	Stop       int64
+	Rev        bool
+	WithScores bool
+
+	Members []ZMember
+}
+
+func NewZRangeCmd(base *BaseCmd) *ZRangeCmd {
+	return newZRangeCmd(base, false)
+}
+
+func NewZRevRangeCmd(base *BaseCmd) *ZRangeCmd {
+	return newZRangeCmd(base, true)
+}
+
+func newZRangeCmd(base *BaseCmd, rev bool) *ZRangeCmd {
+	cmd := &ZRangeCmd{
+		BaseCmd: base,
+		Rev:     rev,
+	}
+	if len(base.args) < 4 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	var ok1, ok2 bool
+	cmd.Start, ok1 = codec.StringBytes2Int64(base.args[2])
+	cmd.Stop, ok2 = codec.StringBytes2Int64(base.args[3])
+	if !ok1 || !ok2 {
+		cmd.Err = kverror.ErrNotInteger
+		return cmd
+	}
+	for _, arg := range base.args[4:] {
+		switch strings.ToLower(codec.BytesToString(arg)) {
+		case "withscores":
+			cmd.WithScores = true
+		case "rev":
+			if rev {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			cmd.Rev = true
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
+		}
+	}
+	return cmd
+}
+
+func (c *ZRangeCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.writeZMembers(c.Members, c.WithScores)
+}
+
+// ZPopCmd zpopmin/zpopmax key [count]
+type ZPopCmd struct {
+	*BaseCmd
+	Max   bool
+	Count int64
+
+	Members []ZMember
+}
+
+func NewZPopMinCmd(base *BaseCmd) *ZPopCmd {
+	return newZPopCmd(base, false)
+}
+
+func NewZPopMaxCmd(base *BaseCmd) *ZPopCmd {
+	return newZPopCmd(base, true)
+}
+
+func newZPopCmd(base *BaseCmd, max bool) *ZPopCmd {
+	cmd := &ZPopCmd{
+		BaseCmd: base,
+		Max:     max,
+		Count:   1,
+	}
+	switch len(base.args) {
+	case 2:
+	case 3:
+		var ok bool
+		if cmd.Count, ok = codec.StringBytes2Int64(base.args[2]); !ok || cmd.Count < 0 {
+			cmd.Err = kverror.ErrPositive
+		}
+	default:
+		cmd.Err = kverror.ErrCommandArgs
+	}
+	return cmd
+}
+
+func (c *ZPopCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.writeZMembers(c.Members, true)
+}
+
+// BZPopCmd bzpopmin/bzpopmax key [key ...] timeout, replies the key, member and score
+type BZPopCmd struct {
+	*BaseCmd
+	Keys    [][]byte
+	Max     bool
+	Timeout time.Duration
+
+	Key    []byte
+	Member ZMember
+}
+
+func NewBZPopMinCmd(base *BaseCmd) *BZPopCmd {
+	return newBZPopCmd(base, false)
+}
+
+func NewBZPopMaxCmd(base *BaseCmd) *BZPopCmd {
+	return newBZPopCmd(base, true)
+}
+
+func newBZPopCmd(base *BaseCmd, max bool) *BZPopCmd {
+	cmd := &BZPopCmd{
+		BaseCmd: base,
+		Max:     max,
+	}
+	var size = len(base.args)
+	if size < 3 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Keys = base.args[1 : size-1]
+	cmd.Timeout, cmd.Err = parseTimeout(base.args[size-1])
+	return cmd
+}
+
+func (c *BZPopCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	if c.Key == nil {
+		return w.writeNilArray()
+	}
+	return w.writeBytesArray(StringReply, c.Key, c.Member.Member, FormatScore(c.Member.Score))
+}
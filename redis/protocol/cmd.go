@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"context"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -12,9 +13,16 @@ import (
 )
 
 var (
-	EX = "ex"
-	PX = "px"
-	NX = "nx"
+	EX      = "ex"
+	PX      = "px"
+	EXAT    = "exat"
+	PXAT    = "pxat"
+	NX      = "nx"
+	XX      = "xx"
+	GET     = "get"
+	KEEPTTL = "keepttl"
+	PERSIST = "persist"
+	LEASE   = "lease"
 )
 
 var OK = []byte("OK")
@@ -106,9 +114,16 @@ type SetCmd struct {
 
 	EX     uint64
 	KEEPEX bool
-	DEL    bool
 
-	NX bool
+	NX  bool
+	XX  bool
+	GET bool
+
+	// Old the previous value replied by set ... get
+	Old []byte
+
+	// Lease the lease the key is attached to, 0 if none
+	Lease uint64
 }
 
 func NewSetCmd(base *BaseCmd) *SetCmd {
@@ -123,31 +138,91 @@ func NewSetCmd(base *BaseCmd) *SetCmd {
 	}
 
 	cmd.Val = base.args[2]
-	cmd.KEEPEX = true
+	var hasEX bool
 	for i := 3; i < size; i++ {
-		arg := base.args[i]
-		switch codec.BytesToString(arg) {
-		case EX:
-			if size >= i+2 {
-				ex, _ := codec.StringBytes2Int64(base.args[i+1])
-				if ex > 0 {
-					cmd.EX = uint64(ex) + base.Now
-				}
-				cmd.DEL = ex < 0
-				cmd.KEEPEX = ex == 0
-				i++
+		arg := strings.ToLower(codec.BytesToString(base.args[i]))
+		switch arg {
+		case EX, PX, EXAT, PXAT:
+			if hasEX || cmd.KEEPEX || i+1 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
 			}
+			i++
+			cmd.EX, cmd.Err = parseExpireAt(arg, base.args[i], base.Now)
+			if cmd.Err != nil {
+				return cmd
+			}
+			hasEX = true
+		case KEEPTTL:
+			if hasEX {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			cmd.KEEPEX = true
 		case NX:
 			cmd.NX = true
+		case XX:
+			cmd.XX = true
+		case GET:
+			cmd.GET = true
+		case LEASE:
+			if cmd.Lease > 0 || i+1 >= size {
+				cmd.Err = kverror.ErrSyntax
+				return cmd
+			}
+			i++
+			id, ok := codec.StringBytes2Int64(base.args[i])
+			if !ok || id <= 0 {
+				cmd.Err = kverror.ErrLeaseNotFound
+				return cmd
+			}
+			cmd.Lease = uint64(id)
+		default:
+			cmd.Err = kverror.ErrSyntax
+			return cmd
 		}
 	}
+	if cmd.NX && cmd.XX {
+		cmd.Err = kverror.ErrSyntax
+	}
 	return cmd
 }
 
+// parseExpireAt convert ex/px/exat/pxat option to unix seconds
+func parseExpireAt(opt string, arg []byte, now uint64) (uint64, error) {
+	n, ok := codec.StringBytes2Int64(arg)
+	if !ok {
+		return 0, kverror.ErrNotInteger
+	}
+	if n <= 0 {
+		return 0, kverror.ErrInvalidExpire
+	}
+	switch opt {
+	case EX:
+		return now + uint64(n), nil
+	case PX:
+		return now + (uint64(n)+999)/1000, nil
+	case EXAT:
+		return uint64(n), nil
+	case PXAT:
+		return (uint64(n) + 999) / 1000, nil
+	}
+	return 0, kverror.ErrSyntax
+}
+
 func (c *SetCmd) Write(w *Writer) error {
 	if c.Err != nil {
 		return c.ErrResp.Write(w)
 	}
+	if c.GET {
+		if c.Old == nil {
+			return w.writeNil()
+		}
+		return w.bytes(StringReply, c.Old)
+	}
+	if !c.OK {
+		return w.writeNil()
+	}
 	return c.OkResp.Write(w)
 }
 
@@ -171,19 +246,79 @@ func (c *GetCmd) Write(w *Writer) error {
 	return w.bytes(StringReply, c.Val)
 }
 
+// DelCmd del/unlink key [key ...], replies the number of removed keys
 type DelCmd struct {
 	*BaseCmd
-	*OkResp
+	Keys  [][]byte
+	Count int64
 }
 
 func NewDelCmd(base *BaseCmd) *DelCmd {
 	cmd := &DelCmd{
 		BaseCmd: base,
-		OkResp:  &OkResp{},
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Keys = uniqueKeys(base.args[1:])
+	return cmd
+}
+
+func (c *DelCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Count)
+}
+
+// ExistsCmd exists/touch key [key ...], replies the number of existing keys
+type ExistsCmd struct {
+	*BaseCmd
+	Keys  [][]byte
+	Count int64
+}
+
+func NewExistsCmd(base *BaseCmd) *ExistsCmd {
+	cmd := &ExistsCmd{
+		BaseCmd: base,
+	}
+	if len(base.args) < 2 {
+		cmd.Err = kverror.ErrCommandArgs
+		return cmd
+	}
+	cmd.Keys = base.args[1:]
+	return cmd
+}
+
+func NewTouchCmd(base *BaseCmd) *ExistsCmd {
+	cmd := NewExistsCmd(base)
+	if cmd.Err == nil {
+		cmd.Keys = uniqueKeys(cmd.Keys)
 	}
 	return cmd
 }
 
+func (c *ExistsCmd) Write(w *Writer) error {
+	if c.Err != nil {
+		return c.ErrResp.Write(w)
+	}
+	return w.int(c.Count)
+}
+
+func uniqueKeys(keys [][]byte) [][]byte {
+	var m = make(map[string]struct{}, len(keys))
+	var uniq = make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := m[codec.BytesToString(key)]; ok {
+			continue
+		}
+		m[codec.BytesToString(key)] = struct{}{}
+		uniq = append(uniq, key)
+	}
+	return uniq
+}
+
 type ExpireCmd struct {
 	*BaseCmd
 	*OkResp
@@ -264,33 +399,30 @@ func NewIncrByCmd(base *BaseCmd) *IncrByCmd {
 	var cmd = &IncrByCmd{
 		BaseCmd: base,
 	}
-	if len(base.args) < 3 {
+	if len(base.args) != 3 {
 		cmd.Err = kverror.ErrCommandArgs
 		return cmd
 	}
 
-	val, _ := codec.StringBytes2Int64(base.args[2])
-	if val != 0 {
-		cmd.Val = val
+	val, ok := codec.StringBytes2Int64(base.args[2])
+	if !ok {
+		cmd.Err = kverror.ErrNotInteger
 		return cmd
 	}
+	cmd.Val = val
 	return cmd
 }
 
 func NewDecrByCmd(base *BaseCmd) *IncrByCmd {
-	var cmd = &IncrByCmd{
-		BaseCmd: base,
-	}
-	if len(base.args) < 3 {
-		cmd.Err = kverror.ErrCommandArgs
+	var cmd = NewIncrByCmd(base)
+	if cmd.Err != nil {
 		return cmd
 	}
-
-	val, _ := codec.StringBytes2Int64(base.args[2])
-	if val != 0 {
-		cmd.Val = -val
+	if cmd.Val == math.MinInt64 {
+		cmd.Err = kverror.ErrIncrOverflow
 		return cmd
 	}
+	cmd.Val = -cmd.Val
 	return cmd
 }
 
@@ -334,6 +466,38 @@ func NewCommandsInfoCmd(isLeader bool) *CommandsInfoCmd {
 				"@fast",
 			},
 		},
+		{
+			ReadOnly: true,
+			Name:     "mget",
+			Arity:    -2,
+			Flags: []string{
+				"fast",
+			},
+			FirstKeyPos: 1,
+			LastKeyPos:  -1,
+			StepCount:   1,
+			ACLFlags: []string{
+				"@read",
+				"@string",
+				"@fast",
+			},
+		},
+		{
+			ReadOnly: true,
+			Name:     "exists",
+			Arity:    -2,
+			Flags: []string{
+				"fast",
+			},
+			FirstKeyPos: 1,
+			LastKeyPos:  -1,
+			StepCount:   1,
+			ACLFlags: []string{
+				"@keyspace",
+				"@read",
+				"@fast",
+			},
+		},
 		{
 			ReadOnly: true,
 			Name:     "ttl",
@@ -422,6 +586,57 @@ func NewCommandsInfoCmd(isLeader bool) *CommandsInfoCmd {
 				"@slow",
 			},
 		},
+		{
+			ReadOnly: false,
+			Name:     "unlink",
+			Arity:    -2,
+			Flags: []string{
+				"write",
+				"fast",
+			},
+			FirstKeyPos: 1,
+			LastKeyPos:  -1,
+			StepCount:   1,
+			ACLFlags: []string{
+				"@keyspace",
+				"@write",
+				"@fast",
+			},
+		},
+		{
+			ReadOnly: false,
+			Name:     "mset",
+			Arity:    -3,
+			Flags: []string{
+				"write",
+				"denyoom",
+			},
+			FirstKeyPos: 1,
+			LastKeyPos:  -1,
+			StepCount:   2,
+			ACLFlags: []string{
+				"@write",
+				"@string",
+				"@slow",
+			},
+		},
+		{
+			ReadOnly: false,
+			Name:     "msetnx",
+			Arity:    -3,
+			Flags: []string{
+				"write",
+				"denyoom",
+			},
+			FirstKeyPos: 1,
+			LastKeyPos:  -1,
+			StepCount:   2,
+			ACLFlags: []string{
+				"@write",
+				"@string",
+				"@slow",
+			},
+		},
 		{
 			ReadOnly: false,
 			Name:     "expire",
@@ -675,17 +890,22 @@ type ScanCmd struct {
 }
 
 func NewScanCmd(base *BaseCmd) *ScanCmd {
+	return newScanCmd(base, 1)
+}
+
+// newScanCmd parse cursor [match pattern] [count count], the cursor is at args[at]
+func newScanCmd(base *BaseCmd, at int) *ScanCmd {
 	argsSize := len(base.args)
 	cmd := &ScanCmd{
 		BaseCmd: base,
 		Limit:   10,
 	}
-	if len(base.args) < 2 {
+	if len(base.args) < at+1 {
 		cmd.Err = kverror.ErrCommandArgs
 		return cmd
 	}
-	cmd.Cursor, _ = codec.StringBytes2Uint64(base.args[1])
-	for i := 2; i < len(base.args); i++ {
+	cmd.Cursor, _ = codec.StringBytes2Uint64(base.args[at])
+	for i := at + 1; i < len(base.args); i++ {
 		if i != argsSize-1 {
 			switch strings.ToLower(codec.BytesToString(base.args[i])) {
 			case "match":
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/yixinin/gokv/codec"
+)
+
+// keySpec the keys of a command are the arguments from first to last by step, a negative last
+// counts from the end, like the key specs of COMMAND INFO. the commands without keys have first 0
+type keySpec struct {
+	first, last, step int
+}
+
+// keySpecs the commands whose keys are not only the first argument
+var keySpecs = map[string]keySpec{
+	"del": {1, -1, 1}, "unlink": {1, -1, 1}, "exists": {1, -1, 1}, "touch": {1, -1, 1},
+	"mget": {1, -1, 1}, "mset": {1, -1, 2}, "msetnx": {1, -1, 2}, "bitop": {2, -1, 1},
+	"sinter": {1, -1, 1}, "sunion": {1, -1, 1}, "sdiff": {1, -1, 1},
+	"sinterstore": {1, -1, 1}, "sunionstore": {1, -1, 1}, "sdiffstore": {1, -1, 1},
+	"lmove": {1, 2, 1}, "rpoplpush": {1, 2, 1}, "blmove": {1, 2, 1}, "brpoplpush": {1, 2, 1},
+	"blpop": {1, -2, 1}, "brpop": {1, -2, 1}, "bzpopmin": {1, -2, 1}, "bzpopmax": {1, -2, 1},
+	"pfcount": {1, -1, 1}, "pfmerge": {1, -1, 1},
+	"geosearchstore": {1, 2, 1}, "rename": {1, 2, 1}, "renamenx": {1, 2, 1}, "copy": {1, 2, 1},
+
+	"ping": {}, "select": {}, "swapdb": {}, "dbsize": {}, "flushdb": {}, "flushall": {},
+	"randomkey": {}, "keys": {}, "scan": {}, "compact": {}, "lease": {}, "kvwatch": {}, "kvunwatch": {},
+	"command": {}, "monitor": {}, "client": {}, "config": {}, "slowlog": {}, "latency": {},
+	"info": {}, "sentinel": {},
+}
+
+// Keys the key arguments of the command
+func (c *BaseCmd) Keys() [][]byte {
+	var name = strings.ToLower(c.Command)
+	switch name {
+	case "xread", "xreadgroup":
+		return streamKeys(c.args)
+	case "migrate":
+		return migrateKeys(c.args)
+	case "georadius", "georadiusbymember":
+		if len(c.args) < 2 {
+			return nil
+		}
+		var keys = c.args[1:2]
+		for i := 5; i+1 < len(c.args); i++ {
+			if arg := strings.ToLower(codec.BytesToString(c.args[i])); arg == "store" || arg == "storedist" {
+				keys = append(keys[:len(keys):len(keys)], c.args[i+1])
+			}
+		}
+		return keys
+	}
+	spec, ok := keySpecs[name]
+	if !ok {
+		spec = keySpec{1, 1, 1}
+	}
+	if spec.first == 0 || spec.first >= len(c.args) {
+		return nil
+	}
+	var last = spec.last
+	if last < 0 {
+		last += len(c.args)
+	}
+	if last >= len(c.args) {
+		last = len(c.args) - 1
+	}
+	var keys = make([][]byte, 0, (last-spec.first)/spec.step+1)
+	for i := spec.first; i <= last; i += spec.step {
+		keys = append(keys, c.args[i])
+	}
+	return keys
+}
+
+// streamKeys the keys of xread and xreadgroup, the first half of the arguments after STREAMS
+func streamKeys(args [][]byte) [][]byte {
+	for i := 1; i < len(args); i++ {
+		if strings.EqualFold(codec.BytesToString(args[i]), "streams") {
+			rest := args[i+1:]
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
+
+// migrateKeys the key of migrate, or the keys after KEYS
+func migrateKeys(args [][]byte) [][]byte {
+	if len(args) < 6 {
+		return nil
+	}
+	var keys [][]byte
+	if len(args[3]) != 0 {
+		keys = append(keys, args[3])
+	}
+	for i := 6; i < len(args); i++ {
+		switch strings.ToLower(codec.BytesToString(args[i])) {
+		case "auth":
+			i++
+		case "auth2":
+			i += 2
+		case "keys":
+			return append(keys, args[i+1:]...)
+		}
+	}
+	return keys
+}
@@ -143,6 +143,9 @@ func (r *Reader) readStringReply(line []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if replyLen < 0 {
+		return nil, Nil
+	}
 
 	b := make([]byte, replyLen+2)
 
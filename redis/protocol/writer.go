@@ -45,13 +45,7 @@ func (w *Writer) writeLen(n int) error {
 func (w *Writer) writeError(err error) error {
 	switch err {
 	case kverror.ErrNotFound, kverror.ErrNIL, nil:
-		if err := w.WriteByte(StringReply); err != nil {
-			return err
-		}
-		if _, err := w.Write(NIL); err != nil {
-			return err
-		}
-		return w.crlf()
+		return w.writeNil()
 	}
 	return w.bytes(ErrorReply, codec.StringToBytes(err.Error()))
 }
@@ -74,6 +68,30 @@ func (w *Writer) writeBytesArray(t byte, msg ...[]byte) error {
 	return nil
 }
 
+// writeBulkArray write bulk strings array, nil item as nil bulk
+func (w *Writer) writeBulkArray(msg ...[]byte) error {
+	w.WriteByte(ArrayReply)
+	w.writeLen(len(msg))
+	for i := range msg {
+		if msg[i] == nil {
+			w.writeNil()
+			continue
+		}
+		w.bytes(StringReply, msg[i])
+	}
+	return nil
+}
+
+func (w *Writer) writeNil() error {
+	if err := w.WriteByte(StringReply); err != nil {
+		return err
+	}
+	if _, err := w.Write(NIL); err != nil {
+		return err
+	}
+	return w.crlf()
+}
+
 func (w *Writer) WriteWrongArgs(args []interface{}) error {
 	msg := fmt.Sprintf("args[%v] error", args)
 	return w.bytes(ErrorReply, codec.StringToBytes(msg))
@@ -82,6 +100,12 @@ func (w *Writer) WriteNotLeader(host string, port uint32) error {
 	msg := fmt.Sprintf("MOVED %s:%d", host, port)
 	return w.bytes(ErrorReply, codec.StringToBytes(msg))
 }
+func (w *Writer) WriteError(err error) error {
+	return w.bytes(ErrorReply, codec.StringToBytes(err.Error()))
+}
+func (w *Writer) WriteStatus(msg []byte) error {
+	return w.bytes(StatusReply, msg)
+}
 func (w *Writer) WriteClose() error {
 	_, err := w.Write([]byte("EOF"))
 	return err
@@ -124,3 +148,19 @@ func (w *Writer) crlf() error {
 	}
 	return w.WriteByte('\n')
 }
+
+// WriteArgs write a request of bulk strings, it is what clients send
+func (w *Writer) WriteArgs(args ...[]byte) error {
+	if err := w.WriteByte(ArrayReply); err != nil {
+		return err
+	}
+	if err := w.writeLen(len(args)); err != nil {
+		return err
+	}
+	for i := range args {
+		if err := w.bytes(StringReply, args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
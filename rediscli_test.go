@@ -3,12 +3,10 @@ package gokv
 import (
 	"context"
 	"fmt"
-	"math"
 	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/yixinin/gokv/codec"
 )
 
 func TestRedisCli(t *testing.T) {
@@ -43,21 +41,6 @@ func TestRedisCli(t *testing.T) {
 
 }
 
-func TestBytesAdd(t *testing.T) {
-	var x1 int64 = math.MaxInt - 255
-	var x2 int64 = 254
-
-	b1 := codec.Int642Bytes(x1)
-	b2 := codec.Int642Bytes(x2)
-	fmt.Println(b1)
-	fmt.Println(b2)
-	sum := bytesAdd(b1, b2)
-	fmt.Println(codec.Bytes2Int64(sum))
-	fmt.Println("except", codec.Int642Bytes(x1+x2))
-	fmt.Println("result", sum)
-
-}
-
 func TestNx(t *testing.T) {
 	c := redis.NewFailoverClusterClient(&redis.FailoverOptions{
 		MasterName: "xx",
@@ -0,0 +1,408 @@
+package gokv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/rdb"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+const (
+	upstreamTimeout = 5 * time.Second
+	// upstreamAckInterval the interval to ack the replication offset to the master
+	upstreamAckInterval = time.Second
+	// upstreamBatchSize the max number of submits of the rdb keys in a raft command
+	upstreamBatchSize = 256
+	// eofMarkSize the size of the mark ending a rdb sent without length
+	eofMarkSize = 40
+)
+
+var errUpstreamLeader = errors.New("not the leader")
+
+// upstreamAddr the address of the pseudo client applying the replication stream
+type upstreamAddr string
+
+func (a upstreamAddr) Network() string {
+	return "upstream"
+}
+
+func (a upstreamAddr) String() string {
+	return "upstream:" + string(a)
+}
+
+// replyLogger drops the replies to the upstream commands, errors are logged
+type replyLogger struct {
+	ctx context.Context
+}
+
+func (w replyLogger) Write(p []byte) (int, error) {
+	if len(p) > 0 && p[0] == protocol.ErrorReply {
+		logger.Warningf(w.ctx, "upstream command error: %s", bytes.TrimSpace(p[1:]))
+	}
+	return len(p), nil
+}
+
+// countReader counts the bytes read from the connection
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// upstream the leader replicates from a redis master as a replica. the rdb of a full resync
+// is loaded through raft, and the commands of the replication stream are handled like the
+// commands of a client, so followers replicate them as usual.
+type upstream struct {
+	srv    *Server
+	cfg    UpstreamConfig
+	port   uint32
+	client *Client
+
+	replID string
+	// offset the replication offset of the applied stream
+	offset int64
+}
+
+// replicate keep replicating from the upstream master while the node is the leader
+func (n *Server) replicate(ctx context.Context, port uint32) {
+	u := &upstream{
+		srv:  n,
+		cfg:  n.kv.cfg.UpstreamCfg,
+		port: port,
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if n.kv.leader != n.kv.nodeID {
+			continue
+		}
+		if err := u.sync(ctx); err != nil {
+			logger.Errorf(ctx, "replicate from upstream %s error:%v", u.cfg.Addr, err)
+		}
+	}
+}
+
+// sync connect to the master, resync and apply the replication stream until the connection breaks
+func (u *upstream) sync(ctx context.Context) error {
+	conn, err := net.DialTimeout("tcp", u.cfg.Addr, upstreamTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	cr := &countReader{r: conn}
+	// the rdb parser shares the buffer of the reader, so it never reads beyond the rdb
+	br := bufio.NewReader(cr)
+	rd := protocol.NewReader(br)
+	bw := bufio.NewWriter(conn)
+	wr := protocol.NewWriter(bw)
+	var call = func(args ...string) (interface{}, error) {
+		var bs = make([][]byte, 0, len(args))
+		for _, arg := range args {
+			bs = append(bs, []byte(arg))
+		}
+		if err := wr.WriteArgs(bs...); err != nil {
+			return nil, err
+		}
+		if err := bw.Flush(); err != nil {
+			return nil, err
+		}
+		return rd.ReadRequest(protocol.SliceParser)
+	}
+
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+	if u.cfg.Password != "" {
+		var err error
+		if u.cfg.Username != "" {
+			_, err = call("AUTH", u.cfg.Username, u.cfg.Password)
+		} else {
+			_, err = call("AUTH", u.cfg.Password)
+		}
+		if err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if _, err := call("PING"); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	// older masters may not know the capabilities, it is not an error
+	if _, err := call("REPLCONF", "listening-port", strconv.Itoa(int(u.port))); err != nil {
+		logger.Warningf(ctx, "upstream replconf listening-port: %v", err)
+	}
+	if _, err := call("REPLCONF", "capa", "eof", "capa", "psync2"); err != nil {
+		logger.Warningf(ctx, "upstream replconf capa: %v", err)
+	}
+	var reply interface{}
+	if u.replID == "" {
+		reply, err = call("PSYNC", "?", "-1")
+	} else {
+		reply, err = call("PSYNC", u.replID, strconv.FormatInt(u.offset+1, 10))
+	}
+	if err != nil {
+		return fmt.Errorf("psync: %w", err)
+	}
+	// the reply shares the buffer of the reader, it is copied to keep the replid
+	status, _ := reply.(string)
+	status = string([]byte(status))
+	fields := strings.Fields(status)
+	switch {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("psync: invalid reply %q", status)
+		}
+		logger.Infof(ctx, "full resync from upstream %s, replid:%s offset:%d", u.cfg.Addr, fields[1], offset)
+		conn.SetDeadline(time.Time{})
+		if err := u.load(ctx, br, rd); err != nil {
+			// the data is flushed, only a full resync loads it again
+			u.replID = ""
+			return fmt.Errorf("load rdb: %w", err)
+		}
+		u.replID, u.offset = fields[1], offset
+		if u.client != nil {
+			u.client.db = 0
+		}
+	case len(fields) >= 1 && fields[0] == "CONTINUE":
+		if len(fields) == 2 {
+			u.replID = fields[1]
+		}
+		logger.Infof(ctx, "partial resync from upstream %s, replid:%s offset:%d", u.cfg.Addr, u.replID, u.offset)
+	default:
+		return fmt.Errorf("psync: unexpected reply %v", reply)
+	}
+	conn.SetDeadline(time.Time{})
+	return u.stream(ctx, conn, cr, br, rd, wr, bw)
+}
+
+// load flush all databases and load the rdb sent by the master through raft
+func (u *upstream) load(ctx context.Context, br *bufio.Reader, rd *protocol.Reader) error {
+	// the master sends newlines to keep the connection alive while the rdb is being saved
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] != '\n' {
+			break
+		}
+		br.ReadByte()
+	}
+	line, err := rd.ReadLine()
+	if err != nil {
+		return err
+	}
+	if len(line) == 0 || line[0] != protocol.StringReply {
+		return fmt.Errorf("invalid rdb payload %q", line)
+	}
+	var src io.Reader = br
+	var mark []byte
+	var limit *io.LimitedReader
+	if bytes.HasPrefix(line, []byte("$EOF:")) {
+		// the rdb is streamed without length, it ends with the mark
+		mark = append([]byte{}, line[5:]...)
+		if len(mark) != eofMarkSize {
+			return fmt.Errorf("invalid rdb eof mark %q", mark)
+		}
+	} else {
+		size, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid rdb size %q", line)
+		}
+		limit = &io.LimitedReader{R: br, N: size}
+		src = limit
+	}
+
+	kv := u.srv.kv
+	if _, err := kv.process(ctx, NewFlushAllSubmit()); err != nil {
+		return err
+	}
+	var now = uint64(time.Now().Unix())
+	var db int
+	var batch []*Submit
+	var flush = func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if kv.leader != kv.nodeID {
+			return errUpstreamLeader
+		}
+		_, err := kv.process(kvstore.WithDB(ctx, db), batch...)
+		batch = batch[:0]
+		return err
+	}
+	var loaded, skipped int
+	err = rdb.Parse(src, func(e *rdb.Entry) error {
+		if e.DB >= kv.dbs.Databases() {
+			return fmt.Errorf("db %d of key %q is out of %d databases", e.DB, e.Key, kv.dbs.Databases())
+		}
+		var ex uint64
+		if e.ExpireAt > 0 {
+			ex = (uint64(e.ExpireAt) + 999) / 1000
+			if ex <= now {
+				return nil
+			}
+		}
+		// the data is flushed already, a key which can not be loaded is skipped rather than failing the sync
+		if err := rdbCheck(e); err != nil {
+			logger.Warningf(ctx, "skip rdb key from upstream %s: %v", u.cfg.Addr, err)
+			skipped++
+			return nil
+		}
+		submits, err := rdbSubmits(e, ex)
+		if err != nil {
+			return err
+		}
+		if e.DB != db || len(batch)+len(submits) > upstreamBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			db = e.DB
+		}
+		batch = append(batch, submits...)
+		loaded++
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return err
+	}
+	if limit != nil {
+		if _, err := io.Copy(io.Discard, limit); err != nil {
+			return err
+		}
+	} else {
+		end := make([]byte, eofMarkSize)
+		if _, err := io.ReadFull(br, end); err != nil {
+			return err
+		}
+		if !bytes.Equal(end, mark) {
+			return errors.New("rdb eof mark mismatch")
+		}
+	}
+	logger.Infof(ctx, "loaded rdb from upstream %s, keys:%d skipped:%d", u.cfg.Addr, loaded, skipped)
+	return nil
+}
+
+// stream apply the commands of the master by the pseudo client of the upstream,
+// the offset is acked periodically and on REPLCONF GETACK
+func (u *upstream) stream(ctx context.Context, conn net.Conn, cr *countReader, br *bufio.Reader,
+	rd *protocol.Reader, wr *protocol.Writer, bw *bufio.Writer) error {
+	addr := upstreamAddr(u.cfg.Addr)
+	if u.client == nil {
+		u.client = &Client{
+			addr:    addr,
+			closed:  make(chan struct{}),
+			id:      atomic.AddUint64(&u.srv.nextClientID, 1),
+			created: time.Now(),
+		}
+		u.client.lastActive = u.client.created.UnixNano()
+		u.client.bw = bufio.NewWriter(replyLogger{ctx: ctx})
+		u.client.wr = protocol.NewWriter(u.client.bw)
+	}
+	u.srv.Lock()
+	u.srv.clients[addr.String()] = u.client
+	u.srv.Unlock()
+
+	// received the offset of the last complete command, sent the offset of the last command
+	// handled by the pseudo client, the offsets are guarded by mu
+	var mu sync.Mutex
+	var received, sent = u.offset, u.offset
+	// ack the applied offset, the commands not handled by the pseudo client are applied
+	// once all commands before them are
+	var ack = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		offset := atomic.LoadInt64(&u.client.offset)
+		if offset >= sent {
+			offset = received
+		}
+		wr.WriteArgs([]byte("REPLCONF"), []byte("ACK"), []byte(strconv.FormatInt(offset, 10)))
+		return bw.Flush()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(upstreamAckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				// stop replicating once the node is not the leader
+				if u.srv.kv.leader != u.srv.kv.nodeID || ack() != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	var start = cr.n - int64(br.Buffered())
+	var base = u.offset
+	for {
+		req, err := rd.ReadRequest(protocol.SliceParser)
+		if err != nil {
+			// the offset stays at the last complete command, so the partial resync starts from it
+			return err
+		}
+		end := base + cr.n - int64(br.Buffered()) - start
+		args, ok := req.([]interface{})
+		local := !ok || len(args) == 0
+		if !local {
+			if name, ok := args[0].([]byte); ok && strings.EqualFold(codec.BytesToString(name), "replconf") {
+				local = true
+			}
+		}
+		mu.Lock()
+		if !local {
+			sent = end
+		}
+		received = end
+		mu.Unlock()
+		u.offset = end
+		if !local {
+			u.srv.messageChan <- Message{
+				Addr:   addr,
+				args:   args,
+				offset: end,
+			}
+			continue
+		}
+		if len(args) > 1 {
+			if sub, ok := args[1].([]byte); ok && strings.EqualFold(codec.BytesToString(sub), "getack") {
+				if err := ack(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package gokv_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yixinin/gokv"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// fakeMaster the master side of a replication connection
+type fakeMaster struct {
+	t    *testing.T
+	port string
+	conn net.Conn
+	rd   *protocol.Reader
+}
+
+func (m *fakeMaster) read() []string {
+	m.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	req, err := m.rd.ReadRequest(protocol.SliceParser)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	var args []string
+	for _, arg := range req.([]interface{}) {
+		args = append(args, string(arg.([]byte)))
+	}
+	return args
+}
+
+func (m *fakeMaster) expect(reply string, want ...string) {
+	if args := m.read(); strings.Join(args, " ") != strings.Join(want, " ") {
+		m.t.Fatalf("master got %q, expect %q", args, want)
+	}
+	m.write(reply)
+}
+
+func (m *fakeMaster) write(data string) {
+	if _, err := m.conn.Write([]byte(data)); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// handshake accept a replica and reply the psync
+func (m *fakeMaster) handshake(lis net.Listener, psync ...string) {
+	conn, err := lis.Accept()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.conn, m.rd = conn, protocol.NewReader(conn)
+	m.expect("+OK\r\n", "AUTH", "secret")
+	m.expect("+PONG\r\n", "PING")
+	m.expect("+OK\r\n", "REPLCONF", "listening-port", m.port)
+	m.expect("+OK\r\n", "REPLCONF", "capa", "eof", "capa", "psync2")
+	if args := m.read(); strings.Join(args, " ") != strings.Join(append([]string{"PSYNC"}, psync...), " ") {
+		m.t.Fatalf("master got %q, expect psync %q", args, psync)
+	}
+}
+
+// waitAck wait until the replica acks the offset
+func (m *fakeMaster) waitAck(offset int) {
+	want := strconv.Itoa(offset)
+	for {
+		if args := m.read(); len(args) == 3 && args[1] == "ACK" && args[2] == want {
+			return
+		}
+	}
+}
+
+func command(args ...string) string {
+	s := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		s += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return s
+}
+
+func TestReplicateUpstream(t *testing.T) {
+	ctx := context.Background()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	cli := startServer(t, 17331, func(cfg *gokv.Config) {
+		cfg.UpstreamCfg.Addr = lis.Addr().String()
+		cfg.UpstreamCfg.Password = "secret"
+	})
+	db1 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17331", DB: 1})
+	defer db1.Close()
+	var wait = func(f func() bool) {
+		for i := 0; i < 50 && !f(); i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if !f() {
+			t.Fatal("timeout")
+		}
+	}
+
+	// full resync with a rdb ending with the eof mark, then the command stream
+	m := &fakeMaster{t: t, port: "17331"}
+	m.handshake(lis, "?", "-1")
+	mark := strings.Repeat("m", 40)
+	m.write("+FULLRESYNC 8de9a4e0b2c5e3c3a4b5e7d6f5e4d3c2b1a09f8e 100\r\n\n\n")
+	m.write("$EOF:" + mark + "\r\n" + string(testRDB()) + mark)
+	stream := command("SELECT", "1") + command("SET", "k1", "v1") +
+		command("SELECT", "0") + command("DEL", "list") + command("PING")
+	getack := command("REPLCONF", "GETACK", "*")
+	m.write(stream + getack)
+	offset := 100 + len(stream) + len(getack)
+	m.waitAck(offset)
+	wait(func() bool { return cli.Exists(ctx, "list").Val() == 0 })
+	if v := cli.Get(ctx, "str").Val(); v != "v" {
+		t.Errorf("str %q", v)
+	}
+	if n := cli.SCard(ctx, "set").Val(); n != 2 {
+		t.Errorf("set card %d", n)
+	}
+	if v := cli.HGet(ctx, "hash", "f2").Val(); v != "7" {
+		t.Errorf("hash f2 %q", v)
+	}
+	if v := db1.Get(ctx, "k1").Val(); v != "v1" {
+		t.Errorf("db 1 k1 %q", v)
+	}
+	if v := db1.Get(ctx, "str1").Val(); v != "42" {
+		t.Errorf("db 1 str1 %q", v)
+	}
+	m.conn.Close()
+
+	// partial resync continues from the acked offset in the selected db
+	m.handshake(lis, "8de9a4e0b2c5e3c3a4b5e7d6f5e4d3c2b1a09f8e", strconv.Itoa(offset+1))
+	m.write("+CONTINUE\r\n")
+	m.write(command("SET", "k2", "v2"))
+	wait(func() bool { return cli.Get(ctx, "k2").Val() == "v2" })
+	m.conn.Close()
+
+	// a full resync with the rdb length replaces the data, the reserved key is skipped
+	m.handshake(lis, "8de9a4e0b2c5e3c3a4b5e7d6f5e4d3c2b1a09f8e", strconv.Itoa(offset+len(command("SET", "k2", "v2"))+1))
+	file := bytes.Join([][]byte{
+		[]byte("REDIS0009"),
+		{0xfe, 0, 0, 3}, []byte("new"), {1}, []byte("1"),
+		{0, 2}, []byte("\xff#"), {1}, []byte("v"),
+		{0xff}, make([]byte, 8),
+	}, nil)
+	m.write(fmt.Sprintf("+FULLRESYNC 0000000000000000000000000000000000000000 0\r\n$%d\r\n%s", len(file), file))
+	m.write(command("SET", "after", "1"))
+	wait(func() bool { return cli.Get(ctx, "after").Val() == "1" })
+	if v := cli.Get(ctx, "new").Val(); v != "1" {
+		t.Errorf("new %q", v)
+	}
+	if n := cli.DBSize(ctx).Val(); n != 2 {
+		t.Errorf("dbsize %d", n)
+	}
+	if n := db1.DBSize(ctx).Val(); n != 0 {
+		t.Errorf("db 1 dbsize %d", n)
+	}
+	m.conn.Close()
+}
+
+func TestReplicateUpstreamTimeout(t *testing.T) {
+	ctx := context.Background()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	cli := startServer(t, 17761, func(cfg *gokv.Config) {
+		cfg.UpstreamCfg.Addr = lis.Addr().String()
+		cfg.UpstreamCfg.Password = "secret"
+		cfg.ServerCfg.Timeout = 1
+	})
+
+	cli.ConfigSet(ctx, "slowlog-log-slower-than", "0")
+
+	// the pseudo client of the upstream is never closed as idle
+	m := &fakeMaster{t: t, port: "17761"}
+	m.handshake(lis, "?", "-1")
+	file := bytes.Join([][]byte{[]byte("REDIS0009"), {0xff}, make([]byte, 8)}, nil)
+	m.write(fmt.Sprintf("+FULLRESYNC 8de9a4e0b2c5e3c3a4b5e7d6f5e4d3c2b1a09f8e 0\r\n$%d\r\n%s", len(file), file))
+	set := command("SET", "k1", "v1")
+	m.write(set)
+	m.waitAck(len(set))
+	time.Sleep(3 * time.Second)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:17761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	rd := bufio.NewReader(conn)
+	conn.Write([]byte(command("MONITOR")))
+	if line, _ := rd.ReadString('\n'); line != "+OK\r\n" {
+		t.Fatalf("monitor reply %q", line)
+	}
+	set2 := command("SET", "k2", "v2")
+	m.write(set2)
+	m.waitAck(len(set) + len(set2))
+	if line, _ := rd.ReadString('\n'); !strings.Contains(line, "[0 upstream:"+lis.Addr().String()+`] "SET" "k2" "v2"`) {
+		t.Errorf("monitor line %q", line)
+	}
+	for k, want := range map[string]string{"k1": "v1", "k2": "v2"} {
+		if v := cli.Get(ctx, k).Val(); v != want {
+			t.Errorf("%s %q", k, v)
+		}
+	}
+	list := cli.ClientList(ctx).Val()
+	if !regexp.MustCompile(`addr=upstream:` + regexp.QuoteMeta(lis.Addr().String()) + ` laddr= .* flags=M `).MatchString(list) {
+		t.Errorf("client list %q", list)
+	}
+	if n, _ := cli.Do(ctx, "CLIENT", "KILL", "ADDR", "upstream:"+lis.Addr().String()).Int(); n != 0 {
+		t.Errorf("killed the upstream client %v", n)
+	}
+	logs, _ := cli.SlowLogGet(ctx, -1).Result()
+	var upstream bool
+	for _, l := range logs {
+		upstream = upstream || l.ClientAddr == "upstream:"+lis.Addr().String()
+	}
+	if !upstream {
+		t.Errorf("slowlog %v without the upstream client", logs)
+	}
+	m.conn.Close()
+}
+
+func TestReplicateUpstreamResume(t *testing.T) {
+	ctx := context.Background()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	cli := startServer(t, 17771, func(cfg *gokv.Config) {
+		cfg.UpstreamCfg.Addr = lis.Addr().String()
+		cfg.UpstreamCfg.Password = "secret"
+	})
+	replID := "8de9a4e0b2c5e3c3a4b5e7d6f5e4d3c2b1a09f8e"
+	m := &fakeMaster{t: t, port: "17771"}
+	m.handshake(lis, "?", "-1")
+	file := bytes.Join([][]byte{[]byte("REDIS0009"), {0xff}, make([]byte, 8)}, nil)
+	m.write(fmt.Sprintf("+FULLRESYNC %s 0\r\n$%d\r\n%s", replID, len(file), file))
+	set1 := command("SET", "k1", "v1")
+	m.write(set1)
+	m.waitAck(len(set1))
+
+	// the commands held by a pause are received but not applied, they are not acked
+	if err := cli.Do(ctx, "CLIENT", "PAUSE", 10000).Err(); err != nil {
+		t.Fatal(err)
+	}
+	set2, getack := command("SET", "k2", "v2"), command("REPLCONF", "GETACK", "*")
+	m.write(set2 + getack)
+	if args := m.read(); len(args) != 3 || args[2] != strconv.Itoa(len(set1)) {
+		t.Errorf("ack %q while the command is held", args)
+	}
+	cli.Do(ctx, "CLIENT", "UNPAUSE")
+	offset := len(set1) + len(set2) + len(getack)
+	m.waitAck(offset)
+	if v := cli.Get(ctx, "k2").Val(); v != "v2" {
+		t.Errorf("k2 %q", v)
+	}
+
+	// the connection breaks in the middle of a command, it is resent by the partial resync
+	set3 := command("SET", "k3", "v3")
+	m.write(set3[:len(set3)/2])
+	time.Sleep(100 * time.Millisecond)
+	m.conn.Close()
+	m.handshake(lis, replID, strconv.Itoa(offset+1))
+	m.write("+CONTINUE\r\n" + set3)
+	m.waitAck(offset + len(set3))
+	if v := cli.Get(ctx, "k3").Val(); v != "v3" {
+		t.Errorf("k3 %q", v)
+	}
+	m.conn.Close()
+
+	// a stream fails the full resync, the next sync is a full resync again
+	m.handshake(lis, replID, strconv.Itoa(offset+len(set3)+1))
+	file = bytes.Join([][]byte{[]byte("REDIS0009"), {0xfe, 0, 15, 1}, []byte("s"), {0xff}, make([]byte, 8)}, nil)
+	m.write(fmt.Sprintf("+FULLRESYNC %s 0\r\n$%d\r\n%s", replID, len(file), file))
+	m.handshake(lis, "?", "-1")
+	m.conn.Close()
+}
@@ -0,0 +1,140 @@
+package gokv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yixinin/gokv"
+)
+
+// history the revisions of key as "rev:value" pairs
+func history(t *testing.T, cli *redis.Client, key string) (revs []int64, vals []string) {
+	reply, err := cli.Do(context.Background(), "HISTORY", key).Slice()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reply {
+		r := r.([]interface{})
+		revs = append(revs, r[0].(int64))
+		vals = append(vals, fmt.Sprint(r[1]))
+	}
+	return revs, vals
+}
+
+func TestRevisions(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17361, func(cfg *gokv.Config) {
+		cfg.ServerCfg.RevisionRetention = 1000
+	})
+	cli.Set(ctx, "cfg", "v1", 0)
+	cli.Set(ctx, "cfg", "v2", 0)
+	cli.Del(ctx, "cfg")
+	cli.Set(ctx, "cfg", "v3", 0)
+	revs, vals := history(t, cli, "cfg")
+	if fmt.Sprint(vals) != "[v1 v2 <nil> v3]" {
+		t.Fatalf("history %v %v", revs, vals)
+	}
+	for i, rev := range revs {
+		v, err := cli.Do(ctx, "GETREV", "cfg", rev).Text()
+		if i == 2 {
+			if err != redis.Nil {
+				t.Errorf("getrev of the deleted revision %q %v", v, err)
+			}
+			continue
+		}
+		if v != vals[i] {
+			t.Errorf("getrev %d %q %v", rev, v, err)
+		}
+	}
+	if err := cli.Do(ctx, "GETREV", "cfg", revs[0]-1).Err(); err != redis.Nil {
+		t.Errorf("getrev before the first revision %v", err)
+	}
+	if err := cli.Do(ctx, "GETREV", "cfg", revs[3]+1000).Err(); err == nil || err.Error() != "ERR required revision is a future revision" {
+		t.Errorf("getrev of a future revision %v", err)
+	}
+
+	// a string replaced by a list is deleted at the revision
+	cli.Set(ctx, "y", "s", 0)
+	cli.RPush(ctx, "list", "a")
+	cli.Rename(ctx, "list", "y")
+	cli.RPush(ctx, "y", "b")
+	if _, vals := history(t, cli, "y"); fmt.Sprint(vals) != "[s <nil>]" {
+		t.Errorf("history of the replaced string %v", vals)
+	}
+	if revs, _ := history(t, cli, "y"); len(revs) != 2 {
+		t.Errorf("revisions of the list %v", revs)
+	}
+
+	// the revisions before the compacted one are removed, so is the deleted one at it.
+	// the key set and deleted by startServer has 2 revisions too
+	if n, err := cli.Do(ctx, "COMPACT", revs[2]).Int(); err != nil || n != 5 {
+		t.Errorf("compact %d %v", n, err)
+	}
+	if kept, vals := history(t, cli, "cfg"); fmt.Sprint(vals) != "[v3]" || kept[0] != revs[3] {
+		t.Errorf("history after compact %v %v", kept, vals)
+	}
+	if err := cli.Do(ctx, "GETREV", "cfg", revs[1]).Err(); err == nil || err.Error() != "ERR required revision has been compacted" {
+		t.Errorf("getrev of a compacted revision %v", err)
+	}
+	if v := cli.Do(ctx, "GETREV", "cfg", revs[3]).Val(); v != "v3" {
+		t.Errorf("getrev after compact %v", v)
+	}
+
+	// COPY and MOVE record the values they write and delete
+	db1 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:17361", DB: 1})
+	defer db1.Close()
+	cli.Set(ctx, "src", "copied", 0)
+	cli.Set(ctx, "dst", "old", 0)
+	cli.Copy(ctx, "src", "dst", 0, true)
+	if _, vals := history(t, cli, "dst"); fmt.Sprint(vals) != "[old copied]" {
+		t.Errorf("history of the copy destination %v", vals)
+	}
+	cli.Move(ctx, "dst", 1)
+	if _, vals := history(t, cli, "dst"); fmt.Sprint(vals) != "[old copied <nil>]" {
+		t.Errorf("history of the moved key %v", vals)
+	}
+	if _, vals := history(t, db1, "dst"); fmt.Sprint(vals) != "[copied]" {
+		t.Errorf("history of the moved key in db 1 %v", vals)
+	}
+
+	// the revisions stay with their database, SWAPDB records the swapped values
+	cli.Set(ctx, "sw", "a", 0)
+	db1.Set(ctx, "sw", "b", 0)
+	cli.Set(ctx, "same", "s", 0)
+	db1.Set(ctx, "same", "s", 0)
+	cli.Do(ctx, "SWAPDB", 0, 1)
+	if _, vals := history(t, cli, "sw"); fmt.Sprint(vals) != "[a b]" {
+		t.Errorf("history of db 0 after swapdb %v", vals)
+	}
+	if _, vals := history(t, db1, "sw"); fmt.Sprint(vals) != "[b a]" {
+		t.Errorf("history of db 1 after swapdb %v", vals)
+	}
+	if _, vals := history(t, cli, "src"); fmt.Sprint(vals) != "[copied <nil>]" {
+		t.Errorf("history of the key swapped away %v", vals)
+	}
+	if _, vals := history(t, cli, "dst"); fmt.Sprint(vals) != "[old copied <nil> copied]" {
+		t.Errorf("history of the key swapped in %v", vals)
+	}
+	if _, vals := history(t, cli, "same"); fmt.Sprint(vals) != "[s]" {
+		t.Errorf("history of the unchanged key %v", vals)
+	}
+
+	// FLUSHDB keeps the revisions and records the deleted keys
+	revs, _ = history(t, cli, "sw")
+	cli.FlushDB(ctx)
+	if _, vals := history(t, cli, "sw"); fmt.Sprint(vals) != "[a b <nil>]" {
+		t.Errorf("history after flushdb %v", vals)
+	}
+	if v := cli.Do(ctx, "GETREV", "sw", revs[1]).Val(); v != "b" {
+		t.Errorf("getrev before flushdb %v", v)
+	}
+	if n := cli.DBSize(ctx).Val(); n != 0 {
+		t.Errorf("dbsize after flushdb %d", n)
+	}
+	cli.FlushAll(ctx)
+	if _, vals := history(t, db1, "sw"); fmt.Sprint(vals) != "[b a <nil>]" {
+		t.Errorf("history after flushall %v", vals)
+	}
+}
@@ -3,6 +3,7 @@ package gokv
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -10,10 +11,12 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yixinin/gokv/codec"
 	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
 	"github.com/yixinin/gokv/logger"
 	"github.com/yixinin/gokv/redis/protocol"
 )
@@ -25,6 +28,8 @@ const (
 type Message struct {
 	Addr net.Addr
 	args []interface{}
+	// offset the replication offset after the command, for the commands of the upstream
+	offset int64
 }
 
 type Server struct {
@@ -32,22 +37,83 @@ type Server struct {
 	lis         net.Listener
 	clients     map[string]*Client
 	messageChan chan Message
+	wakeChan    chan wakeEvent
+	watchChan   chan watchSignal
 	kv          *RaftKv
+	// started the time the server is created, for the uptime of INFO
+	started time.Time
+
+	// slowlog and latency the slow commands, only accessed by the receive loop
+	slowlog slowlog
+	latency latencyMonitor
+	// monitors the clients of MONITOR, only accessed by the receive loop
+	monitors []*Client
+	// blocked the blocked clients in the order they blocked, only accessed by the receive loop
+	blocked []*blockedClient
+
+	// nextClientID the id of the last connected client
+	nextClientID uint64
+	// pause the CLIENT PAUSE in effect, nil if not paused, only accessed by the receive loop
+	pause       *clientPause
+	unpauseChan chan *clientPause
 }
 
 type Client struct {
 	conn net.Conn
+	// addr the remote address, the address of the master for the pseudo client of the upstream
+	addr net.Addr
 	rd   *protocol.Reader
 	bw   *bufio.Writer
 	wr   *protocol.Writer
+	// offset the replication offset applied by the pseudo client of the upstream
+	offset int64
+
+	// blocked and queue are only accessed by the receive loop
+	blocked *blockedClient
+	queue   []Message
+	closed  chan struct{}
+
+	// watch the watcher of KVWATCH, only accessed by the receive loop
+	watch *watcher
+	// monitor whether the client is in the MONITOR context, only accessed by the receive loop
+	monitor bool
+
+	// db the selected database
+	db int
+
+	// lastActive the unix nano time of the last command read, for the idle timeout
+	lastActive int64
+	// netIn and netOut the bytes read from and written to the connection
+	netIn, netOut int64
+
+	// id the unique id of the client, created the time it is connected
+	id      uint64
+	created time.Time
+	// name, lastCmd, noEvict and held are only accessed by the receive loop
+	name    string
+	lastCmd string
+	noEvict bool
+	// held the number of the commands held by CLIENT PAUSE
+	held int
 }
 
 func NewServer(kv *RaftKv) *Server {
-	return &Server{
+	n := &Server{
 		clients:     make(map[string]*Client),
 		messageChan: make(chan Message, 1024),
+		wakeChan:    make(chan wakeEvent, 64),
+		watchChan:   make(chan watchSignal, 64),
 		kv:          kv,
+		started:     time.Now(),
+		latency:     make(latencyMonitor),
+		unpauseChan: make(chan *clientPause, 1),
 	}
+	kv.metrics.registry.NewGaugeFunc("gokv_connected_clients", "The number of connected clients.", "", func() map[string]float64 {
+		n.RLock()
+		defer n.RUnlock()
+		return single(float64(len(n.clients)))
+	})
+	return n
 }
 
 func (n *Server) Close(ctx context.Context) {
@@ -65,6 +131,12 @@ func (n *Server) Run(ctx context.Context, port uint32) error {
 	n.lis = lis
 
 	go n.receive(ctx)
+	if node := n.kv.node; node != nil && node.AdminPort > 0 {
+		go n.serveAdmin(ctx, node.AdminPort)
+	}
+	if n.kv.cfg.UpstreamCfg.Addr != "" {
+		go n.replicate(ctx, port)
+	}
 
 	for {
 		select {
@@ -92,15 +164,29 @@ func (n *Server) readAsync(ctx context.Context, conn net.Conn) {
 	// 	return
 	// }
 	c := &Client{
-		conn: conn,
-		rd:   protocol.NewReader(conn),
-		bw:   bufio.NewWriter(conn),
+		conn:    conn,
+		addr:    conn.RemoteAddr(),
+		closed:  make(chan struct{}),
+		id:      atomic.AddUint64(&n.nextClientID, 1),
+		created: time.Now(),
 	}
+	c.rd = protocol.NewReader(clientReader{r: conn, n: &c.netIn})
+	c.bw = bufio.NewWriter(clientWriter{w: conn, n: &c.netOut})
 	c.wr = protocol.NewWriter(c.bw)
+	c.lastActive = c.created.UnixNano()
+	n.kv.metrics.connections.Inc()
 	n.Lock()
+	if len(n.clients) >= n.kv.settings.MaxClients() {
+		n.Unlock()
+		c.wr.WriteError(kverror.ErrMaxClients)
+		c.bw.Flush()
+		conn.Close()
+		return
+	}
 	n.clients[conn.RemoteAddr().String()] = c
 	n.Unlock()
 	defer c.conn.Close()
+	defer close(c.closed)
 	defer func() {
 		n.Lock()
 		delete(n.clients, conn.RemoteAddr().String())
@@ -123,11 +209,12 @@ loop:
 				continue loop
 			}
 			if err != nil {
-				if err != io.EOF {
+				if err != io.EOF && !errors.Is(err, net.ErrClosed) {
 					logger.Errorf(ctx, "receive redis cmd error:%v, conn:%s will be disconnect", err, conn.RemoteAddr())
 				}
 				return
 			}
+			atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
 			switch cmd := cmd.(type) {
 			case []interface{}:
 				n.messageChan <- Message{
@@ -147,27 +234,61 @@ loop:
 }
 
 func (n *Server) receive(ctx context.Context) {
+	var ticker = time.NewTicker(time.Second)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			n.closeIdle(ctx)
+		case p := <-n.unpauseChan:
+			if n.pause == p {
+				n.unpause(ctx)
+			}
 		case cmd := <-n.messageChan:
 			ctx := context.Background()
 			// ctx = context.WithValue(context.Background(), trace.TraceKey, trace.GenTrace())
-			err := n.handleCmd(ctx, cmd.Addr, cmd.args)
+			err := n.handleCmd(ctx, cmd)
 			if err != nil {
 				logger.Errorf(ctx, "handleCmd error:%v", err)
 			}
+		case ev := <-n.wakeChan:
+			n.wake(context.Background(), ev)
+		case sig := <-n.watchChan:
+			n.push(context.Background(), sig)
+		}
+	}
+}
+
+// closeIdle close the clients idle longer than the timeout, blocked, watching and monitoring clients
+// and the pseudo client of the upstream are kept. it runs on the receive loop
+func (n *Server) closeIdle(ctx context.Context) {
+	timeout := n.kv.settings.Timeout()
+	if timeout <= 0 {
+		return
+	}
+	n.RLock()
+	defer n.RUnlock()
+	for addr, c := range n.clients {
+		if c.conn == nil || c.blocked != nil || c.watch != nil || c.monitor {
+			continue
+		}
+		if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastActive))) > timeout {
+			logger.Infof(ctx, "close idle client %s", addr)
+			c.conn.Close()
 		}
 	}
 }
 
-func (n *Server) handleCmd(ctx context.Context, addr net.Addr, args []interface{}) error {
+func (n *Server) handleCmd(ctx context.Context, msg Message) error {
+	addr, args := msg.Addr, msg.args
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Errorf(ctx, "handleCmd recovered from panic:%v, stacks:%s", r, debug.Stack())
 		}
 	}()
+	var start = time.Now()
 	n.RLock()
 	client, ok := n.clients[addr.String()]
 	n.RUnlock()
@@ -175,6 +296,19 @@ func (n *Server) handleCmd(ctx context.Context, addr net.Addr, args []interface{
 		logger.Info(ctx, "client disconnected", addr.String())
 		return nil
 	}
+	if client.blocked != nil {
+		client.queue = append(client.queue, msg)
+		return nil
+	}
+	// the command of the upstream is applied unless it is held
+	var held bool
+	if msg.offset > 0 {
+		defer func() {
+			if !held {
+				atomic.StoreInt64(&client.offset, msg.offset)
+			}
+		}()
+	}
 	base := protocol.Command(ctx, args)
 	if base.Err != nil {
 		return client.wr.WriteWrongArgs(args)
@@ -183,9 +317,36 @@ func (n *Server) handleCmd(ctx context.Context, addr net.Addr, args []interface{
 	if !ok {
 		return client.wr.WriteWrongArgs(args)
 	}
-	defer client.bw.Flush()
-
-	switch strings.ToLower(codec.BytesToString(cmd)) {
+	name := strings.ToLower(codec.BytesToString(cmd))
+	if n.pause != nil && n.pause.holds(client, name) {
+		n.hold(client, msg)
+		held = true
+		return nil
+	}
+	client.lastCmd = name
+	var timing = &cmdTiming{}
+	ctx = withTiming(kvstore.WithDB(ctx, client.db), timing)
+	var parsed = time.Now()
+	defer func() { n.finish(client, name, args, start, parsed, timing) }()
+	if client.watch != nil && name != "kvunwatch" && name != "ping" {
+		base.Err = kverror.ErrWatchContext
+		return base.Write(client.wr)
+	}
+	if client.monitor && name != "ping" {
+		base.Err = kverror.ErrMonitorContext
+		return base.Write(client.wr)
+	}
+	if len(n.monitors) > 0 {
+		n.feedMonitors(ctx, client, args)
+	}
+	// the keys starting with 0xff are the internal keys of the elements and counters
+	for _, key := range base.Keys() {
+		if isInternalKey(key) {
+			base.Err = kverror.ErrReservedKey
+			return base.Write(client.wr)
+		}
+	}
+	switch name {
 	case "ping":
 		cmd := &protocol.PingCommand{}
 		return cmd.Write(client.wr)
@@ -200,8 +361,14 @@ func (n *Server) handleCmd(ctx context.Context, addr net.Addr, args []interface{
 			return cmd.Write(client.wr)
 		}
 		ct := n.kv.Set(ctx, cmd)
+		if ct != nil && cmd.Lease > 0 {
+			ct = n.kv.Attach(ctx, cmd, ct)
+		}
 		if ct != nil {
 			cmd.OK, cmd.Err = submit(ct)
+			if !cmd.OK && cmd.Err == nil && cmd.Lease > 0 {
+				cmd.Err = kverror.ErrLeaseNotFound
+			}
 		}
 		return cmd.Write(client.wr)
 	case "get":
@@ -210,9 +377,9 @@ func (n *Server) handleCmd(ctx context.Context, addr net.Addr, args []interface{
 			return cmd.Write(client.wr)
 		}
 		submit := n.kv.Get(ctx, cmd)
-		n.kv.SubmitAsync(submit)
+		n.kv.SubmitAsync(ctx, submit)
 		return cmd.Write(client.wr)
-	case "del":
+	case "del", "unlink":
 		submit, ok := n.kv.StartSubmit(ctx)
 		if !ok {
 			return n.replyLeader(client.wr)
@@ -221,130 +388,1445 @@ func (n *Server) handleCmd(ctx context.Context, addr net.Addr, args []interface{
 		if cmd.Err != nil {
 			return cmd.Write(client.wr)
 		}
-		st := n.kv.Delete(ctx, cmd.BaseCmd)
-		if st != nil {
-			cmd.OK, cmd.Err = submit(st)
+		sts := n.kv.Del(ctx, cmd)
+		if len(sts) > 0 {
+			ok, err := submit(sts...)
+			if !ok {
+				cmd.Count = 0
+			}
+			cmd.Err = err
 		}
-
 		return cmd.Write(client.wr)
-	case "ttl":
-		cmd := protocol.NewTTLCmd(base)
+	case "exists", "touch":
+		var cmd *protocol.ExistsCmd
+		if name == "touch" {
+			cmd = protocol.NewTouchCmd(base)
+		} else {
+			cmd = protocol.NewExistsCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submits := n.kv.Exists(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submits...)
+		return cmd.Write(client.wr)
+	case "mget":
+		cmd := protocol.NewMGetCmd(base)
 		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submits := n.kv.MGet(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submits...)
+		return cmd.Write(client.wr)
+	case "mset", "msetnx":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
 			return n.replyLeader(client.wr)
 		}
-		submit := n.kv.TTL(ctx, cmd)
-		n.kv.SubmitAsync(submit)
+		var cmd *protocol.MSetCmd
+		if name == "msetnx" {
+			cmd = protocol.NewMSetNXCmd(base)
+		} else {
+			cmd = protocol.NewMSetCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.MSet(ctx, cmd)
+		if len(sts) > 0 {
+			cmd.OK, cmd.Err = submit(sts...)
+		}
 		return cmd.Write(client.wr)
-	case "expire":
+	case "append":
 		submit, ok := n.kv.StartSubmit(ctx)
 		if !ok {
 			return n.replyLeader(client.wr)
 		}
-		cmd := protocol.NewExpirecmd(base)
+		cmd := protocol.NewAppendCmd(base)
 		if cmd.Err != nil {
-			cmd.Write(client.wr)
+			return cmd.Write(client.wr)
 		}
-		ct := n.kv.ExpireAt(ctx, cmd)
+		ct := n.kv.Append(ctx, cmd)
 		if ct != nil {
-			cmd.OK, cmd.Err = submit(ct)
+			_, cmd.Err = submit(ct)
 		}
 		return cmd.Write(client.wr)
-	case "hset":
-		fallthrough
-	case "hget":
-		fallthrough
-	case "hgetall":
-		fallthrough
-	case "incrby":
+	case "setrange":
 		submit, ok := n.kv.StartSubmit(ctx)
 		if !ok {
 			return n.replyLeader(client.wr)
 		}
-		cmd := protocol.NewIncrByCmd(base)
+		cmd := protocol.NewSetRangeCmd(base)
 		if cmd.Err != nil {
 			return cmd.Write(client.wr)
 		}
-		ct := n.kv.Incr(ctx, cmd)
+		ct := n.kv.SetRange(ctx, cmd)
 		if ct != nil {
-			ok, err := submit(ct)
-			if !ok {
-				cmd.Val = 0
+			_, cmd.Err = submit(ct)
+		}
+		return cmd.Write(client.wr)
+	case "strlen":
+		cmd := protocol.NewStrLenCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.StrLen(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "getrange", "substr":
+		cmd := protocol.NewGetRangeCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.GetRange(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "getset":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewGetSetCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.GetSet(ctx, cmd)
+		if ct != nil {
+			if _, err := submit(ct); err != nil {
+				cmd.Err = err
 			}
-			cmd.Err = err
 		}
 		return cmd.Write(client.wr)
-	case "incr":
+	case "getdel":
 		submit, ok := n.kv.StartSubmit(ctx)
 		if !ok {
 			return n.replyLeader(client.wr)
 		}
-		cmd := protocol.NewIncrCmd(base)
+		cmd := protocol.NewGetCmd(base)
 		if cmd.Err != nil {
 			return cmd.Write(client.wr)
 		}
-		ct := n.kv.Incr(ctx, cmd)
+		ct := n.kv.GetDel(ctx, cmd)
 		if ct != nil {
-			ok, err := submit(ct)
-			if !ok {
-				cmd.Val = 0
+			if _, err := submit(ct); err != nil {
+				cmd.Err = err
 			}
-			cmd.Err = err
 		}
 		return cmd.Write(client.wr)
-	case "decrby":
+	case "getex":
 		submit, ok := n.kv.StartSubmit(ctx)
 		if !ok {
 			return n.replyLeader(client.wr)
 		}
-		cmd := protocol.NewDecrByCmd(base)
+		cmd := protocol.NewGetExCmd(base)
 		if cmd.Err != nil {
 			return cmd.Write(client.wr)
 		}
-		ct := n.kv.Incr(ctx, cmd)
+		ct := n.kv.GetEx(ctx, cmd)
 		if ct != nil {
-			ok, err := submit(ct)
-			if !ok {
-				cmd.Val = 0
+			if _, err := submit(ct); err != nil {
+				cmd.Err = err
 			}
-			cmd.Err = err
 		}
 		return cmd.Write(client.wr)
-	case "decr":
+	case "setbit":
 		submit, ok := n.kv.StartSubmit(ctx)
 		if !ok {
 			return n.replyLeader(client.wr)
 		}
-		cmd := protocol.NewDecrCmd(base)
+		cmd := protocol.NewSetBitCmd(base)
 		if cmd.Err != nil {
 			return cmd.Write(client.wr)
 		}
-		ct := n.kv.Incr(ctx, cmd)
+		ct := n.kv.SetBit(ctx, cmd)
 		if ct != nil {
-			ok, err := submit(ct)
-			if !ok {
-				cmd.Val = 0
+			_, cmd.Err = submit(ct)
+		}
+		return cmd.Write(client.wr)
+	case "getbit":
+		cmd := protocol.NewGetBitCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.GetBit(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "bitcount":
+		cmd := protocol.NewBitCountCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.BitCount(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "bitpos":
+		cmd := protocol.NewBitPosCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.BitPos(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "bitop":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewBitOpCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.BitOp(ctx, cmd)
+		if ct != nil {
+			_, cmd.Err = submit(ct)
+		}
+		return cmd.Write(client.wr)
+	case "bitfield":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewBitFieldCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.BitField(ctx, cmd)
+		if ct != nil {
+			_, cmd.Err = submit(ct)
+		}
+		return cmd.Write(client.wr)
+	case "bitfield_ro":
+		cmd := protocol.NewBitFieldROCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.BitField(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "sadd", "srem":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewSAddCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		var sts []*Submit
+		if name == "srem" {
+			sts = n.kv.SRem(ctx, cmd)
+		} else {
+			sts = n.kv.SAdd(ctx, cmd)
+		}
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
 			}
-			cmd.Err = err
 		}
 		return cmd.Write(client.wr)
-	case "keys":
-		cmd := protocol.NewKeysCmd(base)
+	case "scard":
+		cmd := protocol.NewSCardCmd(base)
 		if cmd.Err != nil {
 			return cmd.Write(client.wr)
 		}
-		submits := n.kv.Keys(ctx, cmd)
-		n.kv.SubmitAsync(submits...)
+		submit := n.kv.SCard(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
 		return cmd.Write(client.wr)
-	case "scan":
-		cmd := protocol.NewScanCmd(base)
+	case "sismember", "smismember":
+		var cmd *protocol.SIsMemberCmd
+		if name == "smismember" {
+			cmd = protocol.NewSMIsMemberCmd(base)
+		} else {
+			cmd = protocol.NewSIsMemberCmd(base)
+		}
 		if cmd.Err != nil {
 			return cmd.Write(client.wr)
 		}
-		submits := n.kv.Scan(ctx, cmd)
-		n.kv.SubmitAsync(submits...)
+		submit := n.kv.SIsMember(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
 		return cmd.Write(client.wr)
-	case "command":
-		cmd := protocol.NewCommandsInfoCmd(n.kv.leader == n.kv.nodeID)
+	case "smembers":
+		cmd := protocol.NewSMembersCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.SMembers(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "sinter", "sunion", "sdiff":
+		var cmd *protocol.SOpCmd
+		switch name {
+		case "sinter":
+			cmd = protocol.NewSInterCmd(base)
+		case "sunion":
+			cmd = protocol.NewSUnionCmd(base)
+		default:
+			cmd = protocol.NewSDiffCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.SOp(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "sinterstore", "sunionstore", "sdiffstore":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.SOpCmd
+		switch name {
+		case "sinterstore":
+			cmd = protocol.NewSInterStoreCmd(base)
+		case "sunionstore":
+			cmd = protocol.NewSUnionStoreCmd(base)
+		default:
+			cmd = protocol.NewSDiffStoreCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.SOp(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "spop":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewSPopCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.SPop(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "srandmember":
+		cmd := protocol.NewSRandMemberCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.SRandMember(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "sscan":
+		cmd := protocol.NewSScanCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.SScan(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "xadd":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewXAddCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.XAdd(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "xrange", "xrevrange":
+		var cmd *protocol.XRangeCmd
+		if name == "xrevrange" {
+			cmd = protocol.NewXRevRangeCmd(base)
+		} else {
+			cmd = protocol.NewXRangeCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.XRange(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "xlen":
+		cmd := protocol.NewXLenCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.XLen(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "xdel", "xtrim":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.XDelCmd
+		var sts []*Submit
+		if name == "xtrim" {
+			cmd = protocol.NewXTrimCmd(base)
+		} else {
+			cmd = protocol.NewXDelCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		if name == "xtrim" {
+			sts = n.kv.XTrim(ctx, cmd)
+		} else {
+			sts = n.kv.XDel(ctx, cmd)
+		}
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "xread":
+		cmd := protocol.NewXReadCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		if cmd.Block < 0 {
+			n.kv.XRead(ctx, cmd)
+			return cmd.Write(client.wr)
+		}
+		return n.block(ctx, client, cmd.Keys, time.Duration(cmd.Block)*time.Millisecond, func() (bool, error) {
+			cmd.Now = uint64(time.Now().Unix())
+			if !n.kv.XRead(ctx, cmd) && cmd.Err == nil {
+				return false, nil
+			}
+			return true, cmd.Write(client.wr)
+		}, func() error {
+			return cmd.Write(client.wr)
+		})
+	case "xreadgroup":
+		cmd := protocol.NewXReadGroupCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		var serve = func() (bool, error) {
+			submit, ok := n.kv.StartSubmit(ctx)
+			if !ok {
+				return true, n.replyLeader(client.wr)
+			}
+			cmd.Now = uint64(time.Now().Unix())
+			sts := n.kv.XReadGroup(ctx, cmd)
+			if len(sts) > 0 {
+				if _, err := submit(sts...); err != nil {
+					cmd.Err = err
+				}
+			}
+			if len(cmd.Results) == 0 && cmd.Err == nil && cmd.Block >= 0 {
+				return false, nil
+			}
+			return true, cmd.Write(client.wr)
+		}
+		if cmd.Block < 0 {
+			_, err := serve()
+			return err
+		}
+		return n.block(ctx, client, cmd.Keys, time.Duration(cmd.Block)*time.Millisecond, serve, func() error {
+			return cmd.Write(client.wr)
+		})
+	case "xgroup":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewXGroupCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.XGroup(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "xack":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewXAckCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.XAck(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "xclaim":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewXClaimCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.XClaim(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "xautoclaim":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewXAutoClaimCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.XClaim(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "xpending":
+		cmd := protocol.NewXPendingCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.XPending(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "lpush", "rpush", "lpushx", "rpushx":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.PushCmd
+		switch name {
+		case "lpush":
+			cmd = protocol.NewLPushCmd(base)
+		case "rpush":
+			cmd = protocol.NewRPushCmd(base)
+		case "lpushx":
+			cmd = protocol.NewLPushXCmd(base)
+		default:
+			cmd = protocol.NewRPushXCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.Push(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "lpop", "rpop":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.PopCmd
+		if name == "lpop" {
+			cmd = protocol.NewLPopCmd(base)
+		} else {
+			cmd = protocol.NewRPopCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.Pop(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "llen":
+		cmd := protocol.NewLLenCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.LLen(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "lrange":
+		cmd := protocol.NewLRangeCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.LRange(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "lindex":
+		cmd := protocol.NewLIndexCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.LIndex(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "lmove", "rpoplpush":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.LMoveCmd
+		if name == "lmove" {
+			cmd = protocol.NewLMoveCmd(base)
+		} else {
+			cmd = protocol.NewRPopLPushCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.LMove(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "blpop", "brpop":
+		var cmd *protocol.BPopCmd
+		if name == "blpop" {
+			cmd = protocol.NewBLPopCmd(base)
+		} else {
+			cmd = protocol.NewBRPopCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		return n.block(ctx, client, cmd.Keys, cmd.Timeout, func() (bool, error) {
+			submit, ok := n.kv.StartSubmit(ctx)
+			if !ok {
+				return true, n.replyLeader(client.wr)
+			}
+			cmd.Now = uint64(time.Now().Unix())
+			sts := n.kv.BPop(ctx, cmd)
+			if len(sts) > 0 {
+				if _, err := submit(sts...); err != nil {
+					cmd.Err = err
+				}
+			}
+			if cmd.Key == nil && cmd.Err == nil {
+				return false, nil
+			}
+			return true, cmd.Write(client.wr)
+		}, func() error {
+			return cmd.Write(client.wr)
+		})
+	case "blmove", "brpoplpush":
+		var cmd *protocol.LMoveCmd
+		if name == "blmove" {
+			cmd = protocol.NewBLMoveCmd(base)
+		} else {
+			cmd = protocol.NewBRPopLPushCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		return n.block(ctx, client, [][]byte{cmd.Src}, cmd.Timeout, func() (bool, error) {
+			submit, ok := n.kv.StartSubmit(ctx)
+			if !ok {
+				return true, n.replyLeader(client.wr)
+			}
+			cmd.Now = uint64(time.Now().Unix())
+			sts := n.kv.LMove(ctx, cmd)
+			if len(sts) > 0 {
+				if _, err := submit(sts...); err != nil {
+					cmd.Err = err
+				}
+			}
+			if cmd.Val == nil && cmd.Err == nil {
+				return false, nil
+			}
+			return true, cmd.Write(client.wr)
+		}, func() error {
+			return cmd.Write(client.wr)
+		})
+	case "zadd", "zincrby":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.ZAddCmd
+		if name == "zadd" {
+			cmd = protocol.NewZAddCmd(base)
+		} else {
+			cmd = protocol.NewZIncrByCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.ZAdd(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "zrem":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewZRemCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.ZRem(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "hset", "hmset", "hsetnx":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.HSetCmd
+		switch name {
+		case "hset":
+			cmd = protocol.NewHSetCmd(base)
+		case "hmset":
+			cmd = protocol.NewHMSetCmd(base)
+		default:
+			cmd = protocol.NewHSetNXCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.HSet(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "hdel":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewHDelCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.HDel(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "hget", "hmget":
+		var cmd *protocol.HGetCmd
+		if name == "hget" {
+			cmd = protocol.NewHGetCmd(base)
+		} else {
+			cmd = protocol.NewHMGetCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.HGet(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "hgetall", "hkeys", "hvals":
+		var cmd *protocol.HGetAllCmd
+		switch name {
+		case "hgetall":
+			cmd = protocol.NewHGetAllCmd(base)
+		case "hkeys":
+			cmd = protocol.NewHKeysCmd(base)
+		default:
+			cmd = protocol.NewHValsCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.HGetAll(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "hlen":
+		cmd := protocol.NewHLenCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.HLen(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "hexists":
+		cmd := protocol.NewHExistsCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.HExists(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "hincrby":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewHIncrByCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.HIncrBy(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "hincrbyfloat":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewHIncrByFloatCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.HIncrByFloat(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "zcard":
+		cmd := protocol.NewZCardCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.ZCard(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "zscore":
+		cmd := protocol.NewZScoreCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.ZScore(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "zrange", "zrevrange":
+		var cmd *protocol.ZRangeCmd
+		if name == "zrange" {
+			cmd = protocol.NewZRangeCmd(base)
+		} else {
+			cmd = protocol.NewZRevRangeCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.ZRange(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "zpopmin", "zpopmax":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.ZPopCmd
+		if name == "zpopmin" {
+			cmd = protocol.NewZPopMinCmd(base)
+		} else {
+			cmd = protocol.NewZPopMaxCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.ZPop(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "bzpopmin", "bzpopmax":
+		var cmd *protocol.BZPopCmd
+		if name == "bzpopmin" {
+			cmd = protocol.NewBZPopMinCmd(base)
+		} else {
+			cmd = protocol.NewBZPopMaxCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		return n.block(ctx, client, cmd.Keys, cmd.Timeout, func() (bool, error) {
+			submit, ok := n.kv.StartSubmit(ctx)
+			if !ok {
+				return true, n.replyLeader(client.wr)
+			}
+			cmd.Now = uint64(time.Now().Unix())
+			sts := n.kv.BZPop(ctx, cmd)
+			if len(sts) > 0 {
+				if _, err := submit(sts...); err != nil {
+					cmd.Err = err
+				}
+			}
+			if cmd.Key == nil && cmd.Err == nil {
+				return false, nil
+			}
+			return true, cmd.Write(client.wr)
+		}, func() error {
+			return cmd.Write(client.wr)
+		})
+	case "pfadd":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewPFAddCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		st := n.kv.PFAdd(ctx, cmd)
+		if st != nil {
+			if _, err := submit(st); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "pfcount":
+		cmd := protocol.NewPFCountCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submits := n.kv.PFCount(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submits...)
+		return cmd.Write(client.wr)
+	case "pfmerge":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewPFMergeCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		st := n.kv.PFMerge(ctx, cmd)
+		if st != nil {
+			cmd.OK, cmd.Err = submit(st)
+		}
+		return cmd.Write(client.wr)
+	case "geoadd":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewGeoAddCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.ZAdd(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "geopos":
+		cmd := protocol.NewGeoPosCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.GeoPos(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "geohash":
+		cmd := protocol.NewGeoHashCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.GeoHash(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "geodist":
+		cmd := protocol.NewGeoDistCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.GeoDist(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "geosearch", "geosearchstore", "georadius", "georadiusbymember":
+		var cmd *protocol.GeoSearchCmd
+		switch name {
+		case "geosearch":
+			cmd = protocol.NewGeoSearchCmd(base)
+		case "geosearchstore":
+			cmd = protocol.NewGeoSearchStoreCmd(base)
+		case "georadius":
+			cmd = protocol.NewGeoRadiusCmd(base)
+		default:
+			cmd = protocol.NewGeoRadiusByMemberCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		if cmd.Store == nil {
+			submit := n.kv.GeoSearch(ctx, cmd)
+			n.kv.SubmitAsync(ctx, submit)
+			return cmd.Write(client.wr)
+		}
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		sts := n.kv.GeoSearchStore(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "type":
+		cmd := protocol.NewTypeCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.Type(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "rename", "renamenx":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.RenameCmd
+		if name == "renamenx" {
+			cmd = protocol.NewRenameNXCmd(base)
+		} else {
+			cmd = protocol.NewRenameCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.Rename(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "copy":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewCopyCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.Copy(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "randomkey":
+		cmd := protocol.NewRandomKeyCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submits := n.kv.RandomKey(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submits...)
+		return cmd.Write(client.wr)
+	case "dbsize":
+		cmd := protocol.NewDBSizeCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		n.kv.DBSize(ctx, cmd)
+		return cmd.Write(client.wr)
+	case "flushdb", "flushall":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		var cmd *protocol.FlushCmd
+		if name == "flushall" {
+			cmd = protocol.NewFlushAllCmd(base)
+		} else {
+			cmd = protocol.NewFlushCmd(base)
+		}
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.Flush(ctx, cmd)
+		cmd.OK, cmd.Err = submit(ct)
+		return cmd.Write(client.wr)
+	case "select":
+		cmd := protocol.NewSelectCmd(base)
+		if cmd.Err == nil {
+			if cmd.DB < 0 || cmd.DB >= int64(n.kv.dbs.Databases()) {
+				cmd.Err = kverror.ErrDBIndex
+			} else {
+				client.db = int(cmd.DB)
+				cmd.OK = true
+			}
+		}
+		return cmd.Write(client.wr)
+	case "swapdb":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewSwapDBCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.SwapDB(ctx, cmd)
+		if ct != nil {
+			cmd.OK, cmd.Err = submit(ct)
+		}
+		return cmd.Write(client.wr)
+	case "move":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewMoveCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.Move(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "dump":
+		cmd := protocol.NewDumpCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submit := n.kv.Dump(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "restore":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewRestoreCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.Restore(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "migrate":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewMigrateCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		sts := n.kv.Migrate(ctx, cmd)
+		if len(sts) > 0 {
+			if _, err := submit(sts...); err != nil {
+				cmd.Err = err
+			}
+		}
+		return cmd.Write(client.wr)
+	case "getrev":
+		cmd := protocol.NewGetRevCmd(base)
+		if cmd.Err == nil {
+			n.kv.GetRev(ctx, cmd, n.kv.appliedIndex())
+		}
+		return cmd.Write(client.wr)
+	case "history":
+		cmd := protocol.NewHistoryCmd(base)
+		if cmd.Err == nil {
+			n.kv.History(ctx, cmd)
+		}
+		return cmd.Write(client.wr)
+	case "compact":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewCompactCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		if cmd.Rev > n.kv.appliedIndex() {
+			cmd.Err = kverror.ErrFutureRevision
+			return cmd.Write(client.wr)
+		}
+		for done := false; !done && cmd.Err == nil; {
+			var sts []*Submit
+			sts, done, cmd.Err = n.kv.compactSubmits(ctx, cmd.Rev, GC_EPOCH)
+			if len(sts) > 0 {
+				if _, err := submit(sts...); err != nil {
+					cmd.Err = err
+				}
+			}
+			for _, st := range sts {
+				if st.OP == CommitOPSubDel {
+					cmd.Removed++
+				}
+			}
+		}
+		return cmd.Write(client.wr)
+	case "cas":
+		if _, ok := n.kv.StartSubmit(ctx); !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewCASCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		r, err := n.kv.propose(ctx, n.kv.CAS(ctx, cmd))
+		cmd.Swapped, cmd.Err = r.ok, err
+		return cmd.Write(client.wr)
+	case "cad":
+		if _, ok := n.kv.StartSubmit(ctx); !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewCADCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		r, err := n.kv.propose(ctx, n.kv.CAD(ctx, cmd))
+		cmd.Deleted, cmd.Err = r.ok, err
+		return cmd.Write(client.wr)
+	case "lock":
+		if _, ok := n.kv.StartSubmit(ctx); !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewLockCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		r, err := n.kv.propose(ctx, n.kv.Lock(ctx, cmd))
+		if r.ok {
+			cmd.Token = r.index
+		}
+		cmd.Err = err
+		return cmd.Write(client.wr)
+	case "lease":
+		cmd := protocol.NewLeaseCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		st := n.kv.Lease(ctx, cmd)
+		if st == nil {
+			return cmd.Write(client.wr)
+		}
+		if _, ok := n.kv.StartSubmit(ctx); !ok {
+			return n.replyLeader(client.wr)
+		}
+		r, err := n.kv.propose(ctx, st)
+		switch {
+		case err != nil:
+			cmd.Err = err
+		case !r.ok:
+			cmd.Err = kverror.ErrLeaseNotFound
+		case cmd.Sub == protocol.LeaseGrant:
+			cmd.ID = r.index
+		case cmd.Sub == protocol.LeaseKeepAlive:
+			var ttl uint64
+			ttl, _, _, cmd.Err = n.kv.getLease(ctx, cmd.ID, cmd.Now)
+			cmd.TTL = int64(ttl)
+		}
+		return cmd.Write(client.wr)
+	case "kvwatch":
+		cmd := protocol.NewKVWatchCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		return n.watch(ctx, client, cmd)
+	case "kvunwatch":
+		cmd := protocol.NewKVUnwatchCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		return n.unwatch(client, cmd)
+	case "ttl":
+		cmd := protocol.NewTTLCmd(base)
+		if cmd.Err != nil {
+			return n.replyLeader(client.wr)
+		}
+		submit := n.kv.TTL(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submit)
+		return cmd.Write(client.wr)
+	case "expire":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewExpirecmd(base)
+		if cmd.Err != nil {
+			cmd.Write(client.wr)
+		}
+		ct := n.kv.ExpireAt(ctx, cmd)
+		if ct != nil {
+			cmd.OK, cmd.Err = submit(ct)
+		}
+		return cmd.Write(client.wr)
+	case "incrby":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewIncrByCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.Incr(ctx, cmd)
+		if ct != nil {
+			ok, err := submit(ct)
+			if !ok {
+				cmd.Val = 0
+			}
+			cmd.Err = err
+		}
+		return cmd.Write(client.wr)
+	case "incrbyfloat":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewIncrByFloatCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.IncrByFloat(ctx, cmd)
+		if ct != nil {
+			_, cmd.Err = submit(ct)
+		}
+		return cmd.Write(client.wr)
+	case "incr":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewIncrCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.Incr(ctx, cmd)
+		if ct != nil {
+			ok, err := submit(ct)
+			if !ok {
+				cmd.Val = 0
+			}
+			cmd.Err = err
+		}
+		return cmd.Write(client.wr)
+	case "decrby":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewDecrByCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.Incr(ctx, cmd)
+		if ct != nil {
+			ok, err := submit(ct)
+			if !ok {
+				cmd.Val = 0
+			}
+			cmd.Err = err
+		}
+		return cmd.Write(client.wr)
+	case "decr":
+		submit, ok := n.kv.StartSubmit(ctx)
+		if !ok {
+			return n.replyLeader(client.wr)
+		}
+		cmd := protocol.NewDecrCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		ct := n.kv.Incr(ctx, cmd)
+		if ct != nil {
+			ok, err := submit(ct)
+			if !ok {
+				cmd.Val = 0
+			}
+			cmd.Err = err
+		}
+		return cmd.Write(client.wr)
+	case "keys":
+		cmd := protocol.NewKeysCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submits := n.kv.Keys(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submits...)
+		return cmd.Write(client.wr)
+	case "scan":
+		cmd := protocol.NewScanCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		submits := n.kv.Scan(ctx, cmd)
+		n.kv.SubmitAsync(ctx, submits...)
+		return cmd.Write(client.wr)
+	case "command":
+		cmd := protocol.NewCommandsInfoCmd(n.kv.leader == n.kv.nodeID)
+		return cmd.Write(client.wr)
+	case "monitor":
+		cmd := protocol.NewMonitorCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		return n.monitor(client, cmd)
+	case "client":
+		cmd := protocol.NewClientCmd(base)
+		if cmd.Err != nil {
+			return cmd.Write(client.wr)
+		}
+		if n.client(ctx, client, cmd) {
+			cmd.Write(client.wr)
+			client.bw.Flush()
+			return client.conn.Close()
+		}
+		return cmd.Write(client.wr)
+	case "config":
+		cmd := protocol.NewConfigCmd(base)
+		if cmd.Err == nil {
+			n.config(ctx, cmd)
+		}
+		return cmd.Write(client.wr)
+	case "slowlog":
+		cmd := protocol.NewSlowlogCmd(base)
+		if cmd.Err == nil {
+			n.slowlogCmd(cmd)
+		}
+		return cmd.Write(client.wr)
+	case "latency":
+		cmd := protocol.NewLatencyCmd(base)
+		if cmd.Err == nil {
+			n.latencyCmd(cmd)
+		}
+		return cmd.Write(client.wr)
+	case "info":
+		cmd := protocol.NewInfoCmd(base)
+		n.info(ctx, cmd)
 		return cmd.Write(client.wr)
 	case "sentinel":
 		cmd := protocol.NewSentinelCmd(args)
@@ -377,6 +1859,8 @@ func (n *Server) handleCmd(ctx context.Context, addr net.Addr, args []interface{
 		}
 		return cmd.Write(client.wr)
 	default:
+		// unsupported commands are counted together
+		name = "unknown"
 		base.Err = kverror.ErrCommandNotSupport
 		return base.Write(client.wr)
 	}
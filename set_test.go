@@ -0,0 +1,119 @@
+package gokv_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sorted the members sorted
+func sorted(members []string) string {
+	sort.Strings(members)
+	return fmt.Sprint(members)
+}
+
+func TestSetType(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 18151)
+	if n := cli.SAdd(ctx, "s", "a", "b", "c", "a").Val(); n != 3 {
+		t.Errorf("sadd %d", n)
+	}
+	cli.SAdd(ctx, "s2", "b", "c", "d")
+
+	// a positive count returns distinct members, a negative count may repeat them
+	if v := cli.SRandMemberN(ctx, "s", 2).Val(); len(v) != 2 || v[0] == v[1] {
+		t.Errorf("srandmember 2 %v", v)
+	}
+	if v := cli.SRandMemberN(ctx, "s", 10).Val(); sorted(v) != "[a b c]" {
+		t.Errorf("srandmember over the card %v", v)
+	}
+	v := cli.SRandMemberN(ctx, "s", -10).Val()
+	if len(v) != 10 {
+		t.Errorf("srandmember -10 %v", v)
+	}
+	for _, m := range v {
+		if m != "a" && m != "b" && m != "c" {
+			t.Errorf("srandmember -10 member %q", m)
+		}
+	}
+	if v := cli.SRandMemberN(ctx, "nos", 3).Val(); len(v) != 0 {
+		t.Errorf("srandmember of a missing key %v", v)
+	}
+	if n := cli.SCard(ctx, "s").Val(); n != 3 {
+		t.Errorf("scard after srandmember %d", n)
+	}
+
+	// SPOP removes the members it returns
+	cli.SAdd(ctx, "p", "a", "b", "c", "d")
+	popped := cli.SPopN(ctx, "p", 3).Val()
+	if len(popped) != 3 {
+		t.Errorf("spop 3 %v", popped)
+	}
+	for _, m := range popped {
+		if cli.SIsMember(ctx, "p", m).Val() {
+			t.Errorf("popped %q is still a member", m)
+		}
+	}
+	if v := cli.SPopN(ctx, "p", 10).Val(); len(v) != 1 {
+		t.Errorf("spop over the card %v", v)
+	}
+	if n := cli.Exists(ctx, "p").Val(); n != 0 {
+		t.Error("the empty set is not deleted")
+	}
+	if err := cli.SPop(ctx, "p").Err(); err != redis.Nil {
+		t.Errorf("spop of a missing key %v", err)
+	}
+	if err := cli.Do(ctx, "SPOP", "s", -1).Err(); err == nil {
+		t.Error("spop of a negative count should fail")
+	}
+
+	// a missing key is an empty set
+	if v := cli.SInter(ctx, "s", "s2").Val(); sorted(v) != "[b c]" {
+		t.Errorf("sinter %v", v)
+	}
+	if v := cli.SInter(ctx, "s", "nos").Val(); len(v) != 0 {
+		t.Errorf("sinter with a missing key %v", v)
+	}
+	if v := cli.SUnion(ctx, "s", "nos", "s2").Val(); sorted(v) != "[a b c d]" {
+		t.Errorf("sunion with a missing key %v", v)
+	}
+	if v := cli.SDiff(ctx, "s", "nos", "s2").Val(); sorted(v) != "[a]" {
+		t.Errorf("sdiff with a missing key %v", v)
+	}
+	if v := cli.SDiff(ctx, "nos", "s").Val(); len(v) != 0 {
+		t.Errorf("sdiff of a missing key %v", v)
+	}
+	if n := cli.SInterStore(ctx, "dst", "s", "nos").Val(); n != 0 || cli.Exists(ctx, "dst").Val() != 0 {
+		t.Errorf("sinterstore of an empty result %d", n)
+	}
+	if n := cli.SUnionStore(ctx, "dst", "s", "s2").Val(); n != 4 {
+		t.Errorf("sunionstore %d", n)
+	}
+	cli.Set(ctx, "str", "v", 0)
+	if err := cli.SInter(ctx, "s", "str").Err(); err == nil {
+		t.Error("sinter with a string should fail")
+	}
+
+	// the members are internal keys starting with 0xff, the clients can not write them
+	for _, args := range [][]interface{}{
+		{"SET", "\xffs\x00\x00\x00\x01sz", ""},
+		{"MSET", "k", "v", "\xffs\x00\x00\x00\x01sz", ""},
+		{"SADD", "\xffs\x00\x00\x00\x01sz", "m"},
+		{"SUNIONSTORE", "\xffs\x00\x00\x00\x01sz", "s"},
+		{"RENAME", "str", "\xffs\x00\x00\x00\x01sz"},
+		{"XREAD", "STREAMS", "\xffx", "0"},
+	} {
+		if err := cli.Do(ctx, args...).Err(); err == nil || err.Error() != "ERR keys starting with 0xff are reserved" {
+			t.Errorf("%v %v", args, err)
+		}
+	}
+	if v := cli.SMembers(ctx, "s").Val(); sorted(v) != "[a b c]" || cli.SCard(ctx, "s").Val() != 3 {
+		t.Errorf("smembers %v after writing the reserved keys", v)
+	}
+	if cli.Exists(ctx, "k").Val() != 0 {
+		t.Error("mset of a reserved key sets the other keys")
+	}
+}
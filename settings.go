@@ -0,0 +1,247 @@
+package gokv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// settings the runtime settings of CONFIG GET / SET, they are read without locks on the hot paths
+type settings struct {
+	gcBatch           int64
+	requestTimeout    int64 // milliseconds
+	timeout           int64 // seconds
+	maxClients        int64
+	slowlogSlowerThan int64 // microseconds
+	slowlogMaxLen     int64
+}
+
+func newSettings(cfg ServerConfig) *settings {
+	return &settings{
+		gcBatch:           int64(cfg.GCBatchSize),
+		requestTimeout:    int64(cfg.RequestTimeout),
+		timeout:           int64(cfg.Timeout),
+		maxClients:        int64(cfg.MaxClients),
+		slowlogSlowerThan: int64(*cfg.SlowlogSlowerThan),
+		slowlogMaxLen:     int64(cfg.SlowlogMaxLen),
+	}
+}
+
+func (s *settings) GCBatch() int {
+	return int(atomic.LoadInt64(&s.gcBatch))
+}
+
+func (s *settings) RequestTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.requestTimeout)) * time.Millisecond
+}
+
+// Timeout the idle time to close a client after, 0 if never
+func (s *settings) Timeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.timeout)) * time.Second
+}
+
+func (s *settings) MaxClients() int {
+	return int(atomic.LoadInt64(&s.maxClients))
+}
+
+// SlowlogSlowerThan the duration of the commands to log, negative if the slowlog is disabled
+func (s *settings) SlowlogSlowerThan() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.slowlogSlowerThan)) * time.Microsecond
+}
+
+func (s *settings) SlowlogMaxLen() int {
+	return int(atomic.LoadInt64(&s.slowlogMaxLen))
+}
+
+// setting a setting of CONFIG, the name is the key of the [server] table, the alias the name of redis
+type setting struct {
+	name, alias string
+	// quoted whether the value is a toml string
+	quoted bool
+	get    func(s *settings) string
+	// parse validate the value, the returned func applies it
+	parse func(s *settings, v string) (func(), error)
+}
+
+// intSetting a setting stored in p, the value must be in [min, max]
+func intSetting(name, alias string, min, max int64, p func(s *settings) *int64) setting {
+	return setting{
+		name:  name,
+		alias: alias,
+		get: func(s *settings) string {
+			return strconv.FormatInt(atomic.LoadInt64(p(s)), 10)
+		},
+		parse: func(s *settings, v string) (func(), error) {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, configSetError(name, "argument couldn't be parsed into an integer")
+			}
+			if n < min || n > max {
+				return nil, configSetError(name, fmt.Sprintf("argument must be between %d and %d inclusive", min, max))
+			}
+			return func() { atomic.StoreInt64(p(s), n) }, nil
+		},
+	}
+}
+
+func configSetError(name, reason string) error {
+	return fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - %s", name, reason)
+}
+
+var runtimeSettings = []setting{
+	{
+		name:   "log-level",
+		alias:  "loglevel",
+		quoted: true,
+		get: func(s *settings) string {
+			return logger.GetLevel().String()
+		},
+		parse: func(s *settings, v string) (func(), error) {
+			level, err := logrus.ParseLevel(v)
+			if err != nil {
+				return nil, configSetError("log-level", "argument(s) must be one of the following: trace, debug, info, warning, error, fatal, panic")
+			}
+			return func() { logger.SetLevel(level) }, nil
+		},
+	},
+	intSetting("gc-batch-size", "", 1, 1<<20, func(s *settings) *int64 { return &s.gcBatch }),
+	intSetting("request-timeout", "", 1, int64(time.Hour/time.Millisecond), func(s *settings) *int64 { return &s.requestTimeout }),
+	intSetting("timeout", "", 0, int64(24*time.Hour/time.Second), func(s *settings) *int64 { return &s.timeout }),
+	intSetting("max-clients", "maxclients", 1, 1<<20, func(s *settings) *int64 { return &s.maxClients }),
+	intSetting("slowlog-log-slower-than", "", -1, int64(time.Hour/time.Microsecond), func(s *settings) *int64 { return &s.slowlogSlowerThan }),
+	intSetting("slowlog-max-len", "", 0, 1<<20, func(s *settings) *int64 { return &s.slowlogMaxLen }),
+}
+
+func findSetting(name string) *setting {
+	for i, st := range runtimeSettings {
+		if st.name == name || st.alias == name {
+			return &runtimeSettings[i]
+		}
+	}
+	return nil
+}
+
+// config CONFIG GET / SET / REWRITE, it runs on the receive loop
+func (n *Server) config(ctx context.Context, cmd *protocol.ConfigCmd) {
+	s := n.kv.settings
+	switch cmd.Sub {
+	case protocol.ConfigGet:
+		for _, st := range runtimeSettings {
+			for _, pattern := range cmd.Args {
+				if ok, _ := path.Match(pattern, st.name); ok {
+					cmd.Values = append(cmd.Values, st.name, st.get(s))
+					break
+				}
+				if ok, _ := path.Match(pattern, st.alias); ok && st.alias != "" {
+					cmd.Values = append(cmd.Values, st.alias, st.get(s))
+					break
+				}
+			}
+		}
+	case protocol.ConfigSet:
+		// all values are validated before any is applied
+		var applies []func()
+		for i := 0; i+1 < len(cmd.Args); i += 2 {
+			st := findSetting(cmd.Args[i])
+			if st == nil {
+				cmd.Err = fmt.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", cmd.Args[i])
+				return
+			}
+			apply, err := st.parse(s, cmd.Args[i+1])
+			if err != nil {
+				cmd.Err = err
+				return
+			}
+			applies = append(applies, apply)
+		}
+		for _, apply := range applies {
+			apply()
+		}
+		logger.Infof(ctx, "config set %v", cmd.Args)
+	case protocol.ConfigRewrite:
+		if n.kv.cfg.file == "" {
+			cmd.Err = kverror.ErrNoConfigFile
+			return
+		}
+		if err := rewriteConfig(n.kv.cfg.file, s); err != nil {
+			logger.Errorf(ctx, "rewrite config %s error:%v", n.kv.cfg.file, err)
+			cmd.Err = fmt.Errorf("ERR Rewriting config file: %v", err)
+		}
+	}
+}
+
+// rewriteConfig write the runtime settings to the [server] table of file,
+// the lines of the settings are replaced and the others are kept
+func rewriteConfig(file string, s *settings) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var values = make(map[string]string, len(runtimeSettings))
+	for _, st := range runtimeSettings {
+		v := st.get(s)
+		if st.quoted {
+			v = strconv.Quote(v)
+		}
+		values[st.name] = v
+	}
+
+	var lines []string
+	var table string
+	// end the line after the last key of the [server] table, -1 if there is no table
+	var end = -1
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			table = strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			if table == "server" {
+				end = len(lines) + 1
+			}
+		case table == "server" && trimmed != "" && !strings.HasPrefix(trimmed, "#"):
+			key := strings.TrimSpace(strings.SplitN(trimmed, "=", 2)[0])
+			if v, ok := values[key]; ok {
+				line = key + " = " + v
+				delete(values, key)
+			}
+			end = len(lines) + 1
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	// the settings not in the file are appended to the table
+	var missing []string
+	for _, st := range runtimeSettings {
+		if v, ok := values[st.name]; ok {
+			missing = append(missing, st.name+" = "+v)
+		}
+	}
+	if end < 0 {
+		lines = append(lines, "", "[server]")
+		end = len(lines)
+	}
+	lines = append(lines[:end], append(missing, lines[end:]...)...)
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,227 @@
+package gokv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+const (
+	// slowlogMaxArgs the args of a slowlog entry are truncated to the number
+	slowlogMaxArgs = 32
+	// slowlogMaxArgLen the args of a slowlog entry are truncated to the length
+	slowlogMaxArgLen = 128
+	// latencyHistoryLen the number of samples kept for each latency event
+	latencyHistoryLen = 160
+)
+
+// the latency events of the phases of slow commands
+const (
+	latencyCommand = "command"
+	latencyParse   = "command-parse"
+	latencyRead    = "command-read"
+	latencyPropose = "raft-propose"
+	latencyReply   = "command-reply"
+)
+
+type timingKey struct{}
+
+// cmdTiming the time a command spends in raft proposals, added by propose
+type cmdTiming struct {
+	propose time.Duration
+}
+
+// withTiming record the raft proposals made with ctx to t
+func withTiming(ctx context.Context, t *cmdTiming) context.Context {
+	return context.WithValue(ctx, timingKey{}, t)
+}
+
+// addProposeTime add the time of a proposal to the timing of ctx if it has one
+func addProposeTime(ctx context.Context, d time.Duration) {
+	if t, ok := ctx.Value(timingKey{}).(*cmdTiming); ok && t != nil {
+		t.propose += d
+	}
+}
+
+// slowlog the recent commands slower than slowlog-log-slower-than, only accessed by the receive loop
+type slowlog struct {
+	nextID  uint64
+	entries []protocol.SlowlogEntry
+}
+
+// add add a slow command, the oldest entries are dropped over max
+func (l *slowlog) add(e protocol.SlowlogEntry, max int) {
+	e.ID = l.nextID
+	l.nextID++
+	l.entries = append(l.entries, e)
+	l.trim(max)
+}
+
+func (l *slowlog) trim(max int) {
+	if over := len(l.entries) - max; over > 0 {
+		l.entries = append(l.entries[:0], l.entries[over:]...)
+	}
+}
+
+// get the newest count entries, all if count is negative
+func (l *slowlog) get(count int64) []protocol.SlowlogEntry {
+	if count < 0 || count > int64(len(l.entries)) {
+		count = int64(len(l.entries))
+	}
+	var entries = make([]protocol.SlowlogEntry, 0, count)
+	for i := len(l.entries) - 1; i >= len(l.entries)-int(count); i-- {
+		entries = append(entries, l.entries[i])
+	}
+	return entries
+}
+
+// slowlogArgs copy the args of a command, truncated like redis
+func slowlogArgs(args []interface{}) [][]byte {
+	var out = make([][]byte, 0, len(args))
+	for i, arg := range args {
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			out = append(out, []byte(fmt.Sprintf("... (%d more arguments)", len(args)-i)))
+			break
+		}
+		var b []byte
+		switch arg := arg.(type) {
+		case []byte:
+			b = arg
+		case string:
+			b = []byte(arg)
+		default:
+			b = []byte(fmt.Sprint(arg))
+		}
+		if len(b) > slowlogMaxArgLen {
+			b = append(b[:slowlogMaxArgLen:slowlogMaxArgLen], fmt.Sprintf("... (%d more bytes)", len(b)-slowlogMaxArgLen)...)
+		} else {
+			b = append([]byte{}, b...)
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// latencyEvent the samples of an event, a sample in milliseconds each second at most
+type latencyEvent struct {
+	samples []protocol.LatencySample
+	max     int64
+}
+
+// latencyMonitor the latency events of slow commands, only accessed by the receive loop
+type latencyMonitor map[string]*latencyEvent
+
+func (m latencyMonitor) add(event string, now int64, d time.Duration) {
+	ms := d.Milliseconds()
+	e, ok := m[event]
+	if !ok {
+		e = &latencyEvent{}
+		m[event] = e
+	}
+	if ms > e.max {
+		e.max = ms
+	}
+	if n := len(e.samples); n > 0 && e.samples[n-1].Time == now {
+		if ms > e.samples[n-1].Latency {
+			e.samples[n-1].Latency = ms
+		}
+		return
+	}
+	e.samples = append(e.samples, protocol.LatencySample{Time: now, Latency: ms})
+	if over := len(e.samples) - latencyHistoryLen; over > 0 {
+		e.samples = append(e.samples[:0], e.samples[over:]...)
+	}
+}
+
+// finish flush the reply of a command and record it to the metrics, and the slowlog if it is slow.
+// it runs on the receive loop after each command
+func (n *Server) finish(client *Client, name string, args []interface{}, start, parsed time.Time, timing *cmdTiming) {
+	n.kv.metrics.command(name, start)
+	replied := time.Now()
+	client.bw.Flush()
+	end := time.Now()
+
+	threshold := n.kv.settings.SlowlogSlowerThan()
+	duration := end.Sub(start)
+	if threshold < 0 || duration < threshold {
+		return
+	}
+	parse, reply := parsed.Sub(start), end.Sub(replied)
+	read := replied.Sub(parsed) - timing.propose
+	if read < 0 {
+		read = 0
+	}
+	n.slowlog.add(protocol.SlowlogEntry{
+		Time:     end.Unix(),
+		Duration: duration.Microseconds(),
+		Args:     slowlogArgs(args),
+		Addr:     client.addr.String(),
+		Name:     client.name,
+		Phases: fmt.Sprintf("parse=%d read=%d propose=%d reply=%d",
+			parse.Microseconds(), read.Microseconds(), timing.propose.Microseconds(), reply.Microseconds()),
+	}, n.kv.settings.SlowlogMaxLen())
+
+	now := end.Unix()
+	n.latency.add(latencyCommand, now, duration)
+	for _, phase := range []struct {
+		event string
+		d     time.Duration
+	}{
+		{latencyParse, parse},
+		{latencyRead, read},
+		{latencyPropose, timing.propose},
+		{latencyReply, reply},
+	} {
+		if phase.d >= time.Millisecond {
+			n.latency.add(phase.event, now, phase.d)
+		}
+	}
+}
+
+// slowlogCmd SLOWLOG GET / LEN / RESET
+func (n *Server) slowlogCmd(cmd *protocol.SlowlogCmd) {
+	n.slowlog.trim(n.kv.settings.SlowlogMaxLen())
+	switch cmd.Sub {
+	case protocol.SlowlogGet:
+		cmd.Entries = n.slowlog.get(cmd.Count)
+	case protocol.SlowlogLen:
+		cmd.Len = int64(len(n.slowlog.entries))
+	case protocol.SlowlogReset:
+		n.slowlog.entries = nil
+	}
+}
+
+// latencyCmd LATENCY LATEST / HISTORY / RESET
+func (n *Server) latencyCmd(cmd *protocol.LatencyCmd) {
+	switch cmd.Sub {
+	case protocol.LatencyLatest:
+		var names = make([]string, 0, len(n.latency))
+		for name := range n.latency {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			e := n.latency[name]
+			cmd.Latest = append(cmd.Latest, protocol.LatencyEvent{Name: name, Latest: e.samples[len(e.samples)-1], Max: e.max})
+		}
+	case protocol.LatencyHistory:
+		if e, ok := n.latency[cmd.Events[0]]; ok {
+			cmd.History = append(cmd.History, e.samples...)
+		}
+	case protocol.LatencyReset:
+		if len(cmd.Events) == 0 {
+			cmd.Reset = int64(len(n.latency))
+			n.latency = make(latencyMonitor)
+			return
+		}
+		for _, event := range cmd.Events {
+			if _, ok := n.latency[event]; ok {
+				delete(n.latency, event)
+				cmd.Reset++
+			}
+		}
+	}
+}
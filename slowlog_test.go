@@ -0,0 +1,57 @@
+package gokv_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSlowlog(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17731)
+	if n, _ := cli.Do(ctx, "SLOWLOG", "LEN").Int(); n != 0 {
+		t.Errorf("slowlog len %d with the default threshold", n)
+	}
+
+	cli.ConfigSet(ctx, "slowlog-log-slower-than", "0")
+	cli.Set(ctx, "k", strings.Repeat("v", 200), 0)
+	logs, err := cli.SlowLogGet(ctx, 1).Result()
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("slowlog get %v %v", logs, err)
+	}
+	if args := fmt.Sprint(logs[0].Args); args != "[set k "+strings.Repeat("v", 128)+"... (72 more bytes)]" {
+		t.Errorf("slowlog args %s", args)
+	}
+	entries, _ := cli.Do(ctx, "SLOWLOG", "GET", 1).Slice()
+	phases, _ := entries[0].([]interface{})[6].(string)
+	if !strings.HasPrefix(phases, "parse=") || !strings.Contains(phases, " propose=") {
+		t.Errorf("slowlog phases %q", phases)
+	}
+	if n, _ := cli.Do(ctx, "SLOWLOG", "LEN").Int(); n < 3 {
+		t.Errorf("slowlog len %d", n)
+	}
+	cli.ConfigSet(ctx, "slowlog-max-len", "2")
+	if n, _ := cli.Do(ctx, "SLOWLOG", "LEN").Int(); n != 2 {
+		t.Errorf("slowlog len %d over max len", n)
+	}
+	cli.Do(ctx, "SLOWLOG", "RESET")
+	if n, _ := cli.Do(ctx, "SLOWLOG", "LEN").Int(); n != 1 {
+		t.Errorf("slowlog len %d after reset", n)
+	}
+
+	latest, err := cli.Do(ctx, "LATENCY", "LATEST").Slice()
+	if err != nil || len(latest) == 0 || latest[0].([]interface{})[0] != "command" {
+		t.Errorf("latency latest %v %v", latest, err)
+	}
+	if history, _ := cli.Do(ctx, "LATENCY", "HISTORY", "command").Slice(); len(history) == 0 {
+		t.Error("latency history is empty")
+	}
+	cli.ConfigSet(ctx, "slowlog-log-slower-than", "-1")
+	if n, _ := cli.Do(ctx, "LATENCY", "RESET").Int(); n == 0 {
+		t.Error("latency reset nothing")
+	}
+	if latest, _ := cli.Do(ctx, "LATENCY", "LATEST").Slice(); len(latest) != 0 {
+		t.Errorf("latency latest %v after reset", latest)
+	}
+}
@@ -0,0 +1,113 @@
+package gokv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/raft/proto"
+)
+
+// snapshotBlockSize the size of the key blocks of a snapshot
+const snapshotBlockSize = 1 << 20
+
+var errSnapshot = errors.New("invalid snapshot")
+
+// storeSnapshot a raft snapshot of all databases, the first block is the applied index
+// and the others are keys and values of the store:
+//
+//	(uvarint len(key) | key | uvarint len(value) | value)*
+type storeSnapshot struct {
+	index uint64
+	iter  kvstore.Iterator
+	head  bool
+}
+
+func (s *storeSnapshot) ApplyIndex() uint64 {
+	return s.index
+}
+
+func (s *storeSnapshot) Next() ([]byte, error) {
+	if !s.head {
+		s.head = true
+		return codec.Uint642Bytes(s.index), nil
+	}
+	var b []byte
+	for len(b) < snapshotBlockSize && s.iter.Next() {
+		b = codec.AppendBytes(b, s.iter.Key())
+		b = codec.AppendBytes(b, s.iter.Value())
+	}
+	if err := s.iter.Error(); err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, io.EOF
+	}
+	return b, nil
+}
+
+func (s *storeSnapshot) Close() {
+	s.iter.Release()
+}
+
+// Snapshot implement raft.StateMachine
+func (s *RaftKv) Snapshot() (proto.Snapshot, error) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	iter, err := s.dbs.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &storeSnapshot{index: s.applied, iter: iter}, nil
+}
+
+// ApplySnapshot implement raft.StateMachine
+func (s *RaftKv) ApplySnapshot(peers []proto.Peer, iter proto.SnapIterator) error {
+	ctx := context.Background()
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	head, err := iter.Next()
+	if err != nil {
+		return err
+	}
+	if len(head) != 8 {
+		return errSnapshot
+	}
+	index := binary.BigEndian.Uint64(head)
+	var block []byte
+	err = s.dbs.Restore(ctx, func() (key, val []byte, err error) {
+		for len(block) == 0 {
+			if block, err = iter.Next(); err != nil {
+				return nil, nil, err
+			}
+		}
+		var ok bool
+		if key, block, ok = codec.ReadBytes(block); ok {
+			val, block, ok = codec.ReadBytes(block)
+		}
+		if !ok {
+			return nil, nil, errSnapshot
+		}
+		return key, val, nil
+	})
+	if err != nil {
+		logger.Errorf(ctx, "apply snapshot at index %d error:%v", index, err)
+		return err
+	}
+	s.loadKeyCounts(ctx)
+	s.feed.snapshot(ctx, index)
+	s.watches.reset(index)
+	atomic.StoreUint64(&s.applied, index)
+	s.updateAppliedIndex(index)
+	for db := 0; db < s.dbs.Databases(); db++ {
+		s.waits.TouchDB(db)
+	}
+	logger.Infof(ctx, "applied snapshot at index %d", index)
+	return nil
+}
@@ -0,0 +1,149 @@
+package gokv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ids the ids of msgs
+func ids(msgs []redis.XMessage) []string {
+	var ids = make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	kv, cli, _ := startNode(t, nodeConfig(t, 18101), 18101)
+	var xadd = func(id string) (string, error) {
+		return cli.XAdd(ctx, &redis.XAddArgs{Stream: "s", ID: id, Values: []string{"f", id}}).Result()
+	}
+
+	// XADD ids only increase
+	for _, c := range []struct{ id, want, err string }{
+		{"0-0", "", "ERR The ID specified in XADD must be greater than 0-0"},
+		{"1-1", "1-1", ""},
+		{"1-1", "", "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		{"0-5", "", "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		{"1-*", "1-2", ""},
+		{"2-*", "2-0", ""},
+		{"2", "", "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		{"3", "3-0", ""},
+		{"x-1", "", "ERR Invalid stream ID specified as stream command argument"},
+	} {
+		id, err := xadd(c.id)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("xadd %s %v", c.id, err)
+			}
+			continue
+		}
+		if err != nil || id != c.want {
+			t.Errorf("xadd %s %s %v", c.id, id, err)
+		}
+	}
+	if id, err := xadd("*"); err != nil || id == "" {
+		t.Errorf("xadd * %s %v", id, err)
+	}
+	if n := cli.XLen(ctx, "s").Val(); n != 5 {
+		t.Errorf("xlen %d", n)
+	}
+	cli.XDel(ctx, "s", cli.XRevRangeN(ctx, "s", "+", "-", 1).Val()[0].ID)
+	if err := cli.XAdd(ctx, &redis.XAddArgs{Stream: "nos", NoMkStream: true, Values: []string{"f", "v"}}).Err(); err != redis.Nil {
+		t.Errorf("xadd nomkstream %v", err)
+	}
+
+	// XREADGROUP delivers the new entries and adds them to the pending list of the consumer
+	if err := cli.XGroupCreate(ctx, "s", "g", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.XGroupCreate(ctx, "s", "g", "0").Err(); err == nil || err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		t.Errorf("create an existing group %v", err)
+	}
+	var read = func(consumer, id string, count int64) []string {
+		t.Helper()
+		streams, err := cli.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "g", Consumer: consumer, Streams: []string{"s", id}, Count: count, Block: -1}).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids(streams[0].Messages)
+	}
+	if got := fmt.Sprint(read("c1", ">", 2)); got != "[1-1 1-2]" {
+		t.Errorf("xreadgroup %s", got)
+	}
+	if got := fmt.Sprint(read("c2", ">", 1)); got != "[2-0]" {
+		t.Errorf("xreadgroup of c2 %s", got)
+	}
+	// the history of a consumer is its pending entries
+	if got := fmt.Sprint(read("c1", "0", 10)); got != "[1-1 1-2]" {
+		t.Errorf("xreadgroup history %s", got)
+	}
+	p := cli.XPending(ctx, "s", "g").Val()
+	if p.Count != 3 || p.Lower != "1-1" || p.Higher != "2-0" || p.Consumers["c1"] != 2 || p.Consumers["c2"] != 1 {
+		t.Errorf("xpending %+v", p)
+	}
+	if err := cli.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "nog", Consumer: "c1", Streams: []string{"s", ">"}, Block: -1}).Err(); err == nil || err.Error() != "NOGROUP No such key or consumer group" {
+		t.Errorf("xreadgroup of a missing group %v", err)
+	}
+
+	// XACK removes the entries from the pending list
+	if n := cli.XAck(ctx, "s", "g", "1-1", "9-9").Val(); n != 1 {
+		t.Errorf("xack %d", n)
+	}
+	if n := cli.XAck(ctx, "s", "g", "1-1").Val(); n != 0 {
+		t.Errorf("xack of an acked entry %d", n)
+	}
+	if got := fmt.Sprint(read("c1", "0", 10)); got != "[1-2]" {
+		t.Errorf("xreadgroup history after xack %s", got)
+	}
+
+	// XCLAIM takes only the entries idle for min-idle-time
+	var claim = func(minIdle time.Duration) []string {
+		t.Helper()
+		return ids(cli.XClaim(ctx, &redis.XClaimArgs{Stream: "s", Group: "g", Consumer: "c2", MinIdle: minIdle, Messages: []string{"1-2"}}).Val())
+	}
+	if got := claim(time.Hour); len(got) != 0 {
+		t.Errorf("xclaim of a recent entry %v", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := fmt.Sprint(claim(10 * time.Millisecond)); got != "[1-2]" {
+		t.Errorf("xclaim %s", got)
+	}
+	// the deliveries of the history count too
+	pending := cli.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: "s", Group: "g", Start: "-", End: "+", Count: 10}).Val()
+	if len(pending) != 2 || pending[0].ID != "1-2" || pending[0].Consumer != "c2" || pending[0].RetryCount != 4 {
+		t.Errorf("xpending after xclaim %+v", pending)
+	}
+	// the claim resets the idle time
+	if got := claim(10 * time.Millisecond); len(got) != 0 {
+		t.Errorf("xclaim of a claimed entry %v", got)
+	}
+
+	// the groups are restored from a snapshot
+	snap, err := kv.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, cli, _ := startNode(t, nodeConfig(t, 18111), 18111)
+	err = restored.ApplySnapshot(nil, snap)
+	snap.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = cli.XPending(ctx, "s", "g").Val()
+	if p.Count != 2 || p.Lower != "1-2" || p.Consumers["c2"] != 2 {
+		t.Errorf("xpending after the snapshot %+v", p)
+	}
+	if got := fmt.Sprint(read("c1", ">", 10)); got != "[3-0]" {
+		t.Errorf("xreadgroup after the snapshot %s", got)
+	}
+}
@@ -13,6 +13,31 @@ const (
 	CommitOPSet   CommitOP = 1
 	CommitOPDel   CommitOP = 2
 	CommitOPExDel CommitOP = 3
+	CommitOPSAdd  CommitOP = 4
+	CommitOPSRem  CommitOP = 5
+
+	// CommitOPSubSet/CommitOPSubDel write element keys of composite values as is
+	CommitOPSubSet CommitOP = 6
+	CommitOPSubDel CommitOP = 7
+
+	// CommitOPFlush delete the key range with the prefix in one write
+	CommitOPFlush CommitOP = 8
+
+	// CommitOPFlushAll/CommitOPSwapDB/CommitOPCopy work across databases
+	CommitOPFlushAll CommitOP = 9
+	CommitOPSwapDB   CommitOP = 10
+	CommitOPCopy     CommitOP = 11
+
+	// CommitOPCAS/CommitOPCAD set or delete a key if it matches the condition when applied,
+	// the value is encoded by encodeCompare
+	CommitOPCAS CommitOP = 12
+	CommitOPCAD CommitOP = 13
+
+	// CommitOPLease grant, keep alive, attach to or revoke a lease, the value is encoded by encodeLeaseOP
+	CommitOPLease CommitOP = 14
+
+	// CommitOPMSetNX set the keys if none of them exists when applied, the value is encoded by encodeMSetNX
+	CommitOPMSetNX CommitOP = 15
 )
 
 func (t CommitOP) String() string {
@@ -23,13 +48,38 @@ func (t CommitOP) String() string {
 		return "del"
 	case CommitOPExDel:
 		return "exdel"
+	case CommitOPSAdd:
+		return "sadd"
+	case CommitOPSRem:
+		return "srem"
+	case CommitOPSubSet:
+		return "subset"
+	case CommitOPSubDel:
+		return "subdel"
+	case CommitOPFlush:
+		return "flush"
+	case CommitOPFlushAll:
+		return "flushall"
+	case CommitOPSwapDB:
+		return "swapdb"
+	case CommitOPCopy:
+		return "copy"
+	case CommitOPCAS:
+		return "cas"
+	case CommitOPCAD:
+		return "cad"
+	case CommitOPLease:
+		return "lease"
+	case CommitOPMSetNX:
+		return "msetnx"
 	}
 	return strconv.Itoa(int(t))
 }
 
-// Command a raft op command
+// Command a raft op command, DB is the database of the client
 type Submit struct {
 	OP    CommitOP `json:"op"`
+	DB    int      `json:"db,omitempty"`
 	Key   []byte   `json:"k"`
 	Value []byte   `json:"v,omitempty"`
 }
@@ -42,6 +92,30 @@ func (c *Submit) String() string {
 		return fmt.Sprintf("Delete %s", c.Key)
 	case CommitOPExDel:
 		return fmt.Sprintf("ExDel %s", c.Key)
+	case CommitOPSAdd:
+		return fmt.Sprintf("SAdd %s %s", c.Key, c.Value)
+	case CommitOPSRem:
+		return fmt.Sprintf("SRem %s %s", c.Key, c.Value)
+	case CommitOPSubSet:
+		return fmt.Sprintf("SubSet %q %q", c.Key, c.Value)
+	case CommitOPSubDel:
+		return fmt.Sprintf("SubDel %q", c.Key)
+	case CommitOPFlush:
+		return fmt.Sprintf("Flush %q", c.Key)
+	case CommitOPFlushAll:
+		return "FlushAll"
+	case CommitOPSwapDB:
+		return fmt.Sprintf("SwapDB %d %d", codec.Bytes2Int64(c.Key), codec.Bytes2Int64(c.Value))
+	case CommitOPCopy:
+		return fmt.Sprintf("Copy %q %q", c.Key, c.Value)
+	case CommitOPCAS:
+		return fmt.Sprintf("CAS %q %q", c.Key, c.Value)
+	case CommitOPCAD:
+		return fmt.Sprintf("CAD %q %q", c.Key, c.Value)
+	case CommitOPLease:
+		return fmt.Sprintf("Lease %q %q", c.Key, c.Value)
+	case CommitOPMSetNX:
+		return fmt.Sprintf("MSetNX %q %q", c.Key, c.Value)
 	default:
 		return "<Invalid>"
 	}
@@ -53,7 +127,27 @@ func (c *Submit) Valid() bool {
 	if c == nil {
 		return false
 	}
-	if c.Key == nil || (c.OP != CommitOPDel && c.OP != CommitOPSet) {
+	switch c.OP {
+	case CommitOPFlush, CommitOPFlushAll, CommitOPSwapDB:
+		return true
+	}
+	if c.Key == nil {
+		return false
+	}
+	switch c.OP {
+	case CommitOPSet, CommitOPDel, CommitOPSAdd, CommitOPSRem, CommitOPCopy:
+	case CommitOPCAS, CommitOPCAD:
+		_, ok := decodeCompare(c.Value)
+		return ok
+	case CommitOPLease:
+		_, ok := decodeLeaseOP(c.Value)
+		return ok
+	case CommitOPMSetNX:
+		_, _, _, ok := decodeMSetNX(c.Value)
+		return ok
+	case CommitOPSubSet, CommitOPSubDel:
+		return isInternalKey(c.Key)
+	default:
 		return false
 	}
 	return true
@@ -64,7 +158,7 @@ func NewSetSubmit(key, val []byte, ex ...uint64) *Submit {
 		OP:  CommitOPSet,
 		Key: key,
 	}
-	data := codec.Encode(val, ex...)
+	data := codec.EncodeString(val, ex...)
 	ct.Value = data.Raw()
 	return ct
 }
@@ -89,3 +183,71 @@ func NewExDelSubmit(key []byte) *Submit {
 		Key: key,
 	}
 }
+
+// NewSAddSubmit add member to set key, the cardinality is maintained when applied
+func NewSAddSubmit(key, member []byte) *Submit {
+	return &Submit{
+		OP:    CommitOPSAdd,
+		Key:   key,
+		Value: member,
+	}
+}
+
+// NewSRemSubmit remove member from set key, the set is deleted when it becomes empty
+func NewSRemSubmit(key, member []byte) *Submit {
+	return &Submit{
+		OP:    CommitOPSRem,
+		Key:   key,
+		Value: member,
+	}
+}
+
+// NewSubSetSubmit set an element key of a composite value
+func NewSubSetSubmit(subKey, val []byte) *Submit {
+	return &Submit{
+		OP:    CommitOPSubSet,
+		Key:   subKey,
+		Value: val,
+	}
+}
+
+// NewSubDelSubmit delete an element key of a composite value
+func NewSubDelSubmit(subKey []byte) *Submit {
+	return &Submit{
+		OP:  CommitOPSubDel,
+		Key: subKey,
+	}
+}
+
+// NewFlushSubmit delete all keys with prefix, an empty prefix deletes everything
+func NewFlushSubmit(prefix []byte) *Submit {
+	return &Submit{
+		OP:  CommitOPFlush,
+		Key: prefix,
+	}
+}
+
+// NewFlushAllSubmit delete the keys of all databases
+func NewFlushAllSubmit() *Submit {
+	return &Submit{
+		OP: CommitOPFlushAll,
+	}
+}
+
+// NewSwapDBSubmit swap the data of two databases
+func NewSwapDBSubmit(db1, db2 int) *Submit {
+	return &Submit{
+		OP:    CommitOPSwapDB,
+		Key:   codec.Int642Bytes(int64(db1)),
+		Value: codec.Int642Bytes(int64(db2)),
+	}
+}
+
+// NewCopySubmit replace dst of database db with key and its element keys
+func NewCopySubmit(key []byte, db int, dst []byte) *Submit {
+	return &Submit{
+		OP:    CommitOPCopy,
+		Key:   key,
+		Value: append(codec.Int642Bytes(int64(db)), dst...),
+	}
+}
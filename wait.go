@@ -0,0 +1,294 @@
+package gokv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+)
+
+// waitRegistry the clients blocked on keys, woken when a write to a watched key is applied
+type waitRegistry struct {
+	sync.Mutex
+	keys map[waitKey]map[*waiter]struct{}
+	// held the waiters touched while held, they are signaled by Release
+	held map[*waiter]struct{}
+}
+
+type waitKey struct {
+	db  int
+	key string
+}
+
+// waiter watch a set of keys of a database, C is signaled once for any number of writes until it is received
+type waiter struct {
+	db   int
+	keys [][]byte
+	C    chan struct{}
+}
+
+func newWaitRegistry() *waitRegistry {
+	return &waitRegistry{
+		keys: make(map[waitKey]map[*waiter]struct{}),
+	}
+}
+
+func (r *waitRegistry) Watch(db int, keys [][]byte) *waiter {
+	w := &waiter{
+		db:   db,
+		keys: keys,
+		C:    make(chan struct{}, 1),
+	}
+	r.Lock()
+	defer r.Unlock()
+	for _, key := range keys {
+		k := waitKey{db: db, key: string(key)}
+		ws, ok := r.keys[k]
+		if !ok {
+			ws = make(map[*waiter]struct{}, 1)
+			r.keys[k] = ws
+		}
+		ws[w] = struct{}{}
+	}
+	return w
+}
+
+func (r *waitRegistry) Unwatch(w *waiter) {
+	r.Lock()
+	defer r.Unlock()
+	for _, key := range w.keys {
+		k := waitKey{db: w.db, key: string(key)}
+		ws := r.keys[k]
+		delete(ws, w)
+		if len(ws) == 0 {
+			delete(r.keys, k)
+		}
+	}
+}
+
+// Hold hold the signals until Release, the waiters are woken after the writes of a raft entry are committed
+func (r *waitRegistry) Hold() {
+	r.Lock()
+	defer r.Unlock()
+	r.held = make(map[*waiter]struct{})
+}
+
+// Release signal the waiters touched since Hold
+func (r *waitRegistry) Release() {
+	r.Lock()
+	defer r.Unlock()
+	for w := range r.held {
+		w.signal()
+	}
+	r.held = nil
+}
+
+// Touch wake up the waiters of key
+func (r *waitRegistry) Touch(db int, key []byte) {
+	r.Lock()
+	defer r.Unlock()
+	for w := range r.keys[waitKey{db: db, key: string(key)}] {
+		r.wake(w)
+	}
+}
+
+func (r *waitRegistry) wake(w *waiter) {
+	if r.held != nil {
+		r.held[w] = struct{}{}
+		return
+	}
+	w.signal()
+}
+
+// TouchDB wake up all waiters of a database
+func (r *waitRegistry) TouchDB(db int) {
+	r.Lock()
+	defer r.Unlock()
+	for k, ws := range r.keys {
+		if k.db != db {
+			continue
+		}
+		for w := range ws {
+			r.wake(w)
+		}
+	}
+}
+
+// shares whether w and o watch a same key of a database
+func (w *waiter) shares(o *waiter) bool {
+	if w.db != o.db {
+		return false
+	}
+	for _, k := range w.keys {
+		for _, ok := range o.keys {
+			if string(k) == string(ok) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (w *waiter) signal() {
+	select {
+	case w.C <- struct{}{}:
+	default:
+	}
+}
+
+const (
+	wakeKey = iota
+	wakeTimeout
+	wakeClosed
+)
+
+// blockedClient a client parked by a blocking command, its later commands are queued until it is served
+type blockedClient struct {
+	client *Client
+	waiter *waiter
+	// serve retry the command, ok is true if the reply is written
+	serve func() (bool, error)
+	// timeout write the reply of timeout
+	timeout  func() error
+	deadline time.Time
+	done     chan struct{}
+}
+
+type wakeEvent struct {
+	b      *blockedClient
+	reason int
+}
+
+// wait forward the signals of a blocked client to the receive loop until it is done
+func (b *blockedClient) wait(wakes chan<- wakeEvent) {
+	var timeout <-chan time.Time
+	if !b.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(b.deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var post = func(reason int) {
+		select {
+		case wakes <- wakeEvent{b: b, reason: reason}:
+		case <-b.done:
+		}
+	}
+	for {
+		select {
+		case <-b.waiter.C:
+			post(wakeKey)
+		case <-timeout:
+			post(wakeTimeout)
+			return
+		case <-b.client.closed:
+			post(wakeClosed)
+			return
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// block serve a blocking command now, or park the client until one of keys is written or timeout.
+// the keys are watched before the first try so a write between the try and the parking is not missed.
+func (n *Server) block(ctx context.Context, client *Client, keys [][]byte, timeout time.Duration, serve func() (bool, error), onTimeout func() error) error {
+	w := n.kv.waits.Watch(kvstore.DBFromContext(ctx), keys)
+	ok, err := serve()
+	if ok || err != nil {
+		n.kv.waits.Unwatch(w)
+		return err
+	}
+	b := &blockedClient{
+		client:  client,
+		waiter:  w,
+		serve:   serve,
+		timeout: onTimeout,
+		done:    make(chan struct{}),
+	}
+	if timeout > 0 {
+		b.deadline = time.Now().Add(timeout)
+	}
+	client.blocked = b
+	n.blocked = append(n.blocked, b)
+	go b.wait(n.wakeChan)
+	return nil
+}
+
+// wake handle a signal of a blocked client on the receive loop. the signals of the clients blocked
+// on the same key race to the loop, so the clients blocked earlier on a key of b are served first
+func (n *Server) wake(ctx context.Context, ev wakeEvent) {
+	b := ev.b
+	if b.client.blocked != b {
+		return
+	}
+	var err error
+	switch ev.reason {
+	case wakeKey:
+		var earlier []*blockedClient
+		for _, e := range n.blocked {
+			if e == b {
+				break
+			}
+			if e.waiter.shares(b.waiter) {
+				earlier = append(earlier, e)
+			}
+		}
+		for _, e := range append(earlier, b) {
+			if e.client.blocked == e {
+				n.serveBlocked(ctx, e)
+			}
+		}
+		return
+	case wakeTimeout:
+		err = b.timeout()
+	case wakeClosed:
+		n.unblock(b)
+		return
+	}
+	if err != nil {
+		logger.Errorf(ctx, "serve blocked client error:%v", err)
+	}
+	n.unblock(b)
+	b.client.bw.Flush()
+	n.replay(ctx, b.client)
+}
+
+// serveBlocked retry the command of a blocked client, it stays blocked if the command has nothing to serve
+func (n *Server) serveBlocked(ctx context.Context, b *blockedClient) {
+	ok, err := b.serve()
+	if !ok && err == nil {
+		return
+	}
+	if err != nil {
+		logger.Errorf(ctx, "serve blocked client error:%v", err)
+	}
+	n.unblock(b)
+	b.client.bw.Flush()
+	n.replay(ctx, b.client)
+}
+
+func (n *Server) unblock(b *blockedClient) {
+	n.kv.waits.Unwatch(b.waiter)
+	close(b.done)
+	b.client.blocked = nil
+	for i, e := range n.blocked {
+		if e == b {
+			n.blocked = append(n.blocked[:i:i], n.blocked[i+1:]...)
+			break
+		}
+	}
+}
+
+// replay handle the commands queued while the client was blocked, until it blocks again
+func (n *Server) replay(ctx context.Context, client *Client) {
+	for len(client.queue) > 0 && client.blocked == nil {
+		msg := client.queue[0]
+		client.queue = client.queue[1:]
+		err := n.handleCmd(ctx, msg)
+		if err != nil {
+			logger.Errorf(ctx, "handleCmd error:%v", err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package gokv
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/yixinin/gokv/codec"
+	"github.com/yixinin/gokv/kverror"
+	"github.com/yixinin/gokv/kvstore"
+	"github.com/yixinin/gokv/logger"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+const (
+	watchPut    = "put"
+	watchDelete = "delete"
+	// watchFlush all keys of the database are changed by flushdb, flushall, swapdb or a snapshot,
+	// the key of the change is nil and watchers read the keys again
+	watchFlush = "flush"
+)
+
+// watchAllDB the database of the changes to all databases
+const watchAllDB = -1
+
+// watchEvent a change of a key applied at index
+type watchEvent struct {
+	db int
+	protocol.ChangeEvent
+}
+
+// watchHub keep a bounded history of the applied changes and push them to the watchers of KVWATCH.
+// it is fed by Apply, so watchers on followers see the changes applied locally
+type watchHub struct {
+	sync.Mutex
+	// history the ring of the recent changes, head is the oldest one
+	history    []watchEvent
+	head, size int
+	// compacted the changes at and before the index are not in the history
+	compacted uint64
+	watchers  map[*watcher]struct{}
+}
+
+// watcher watch the keys with prefix of a database, the changes are queued in pending and
+// C is signaled once for any number of changes until it is received
+type watcher struct {
+	db      int
+	prefix  []byte
+	pending []watchEvent
+	// lagged the pending changes exceed the history, the watcher is closed
+	lagged bool
+	// last the index of the last change taken
+	last uint64
+	C    chan struct{}
+	done chan struct{}
+}
+
+func newWatchHub(size int, index uint64) *watchHub {
+	return &watchHub{
+		history:   make([]watchEvent, size),
+		compacted: index,
+		watchers:  make(map[*watcher]struct{}),
+	}
+}
+
+func (w *watcher) match(e *watchEvent) bool {
+	if e.db != watchAllDB && e.db != w.db {
+		return false
+	}
+	return e.Key == nil || bytes.HasPrefix(e.Key, w.prefix)
+}
+
+func (w *watcher) signal() {
+	select {
+	case w.C <- struct{}{}:
+	default:
+	}
+}
+
+// publish add the changes applied at an index to the history and queue them to the watchers
+func (h *watchHub) publish(events []watchEvent) {
+	if h == nil || len(events) == 0 {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	for i := range events {
+		e := &events[i]
+		if len(h.history) > 0 {
+			if h.size == len(h.history) {
+				h.compacted = h.history[h.head].Index
+				h.head = (h.head + 1) % len(h.history)
+				h.size--
+			}
+			h.history[(h.head+h.size)%len(h.history)] = *e
+			h.size++
+		}
+		for w := range h.watchers {
+			if w.lagged || !w.match(e) {
+				continue
+			}
+			if len(w.pending) >= len(h.history) {
+				w.lagged, w.pending = true, nil
+			} else {
+				w.pending = append(w.pending, *e)
+			}
+			w.signal()
+		}
+	}
+}
+
+// reset drop the history when a snapshot is applied at index, all keys are changed
+func (h *watchHub) reset(index uint64) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	h.head, h.size = 0, 0
+	h.compacted = index
+	h.Unlock()
+	h.publish([]watchEvent{{db: watchAllDB, ChangeEvent: protocol.ChangeEvent{Index: index, OP: watchFlush}}})
+}
+
+// Watch watch the keys with prefix, the changes in the history at and after from are queued first.
+// from 0 watches the changes applied from now on
+func (h *watchHub) Watch(db int, prefix []byte, from uint64) (*watcher, error) {
+	w := &watcher{
+		db:     db,
+		prefix: prefix,
+		C:      make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	h.Lock()
+	defer h.Unlock()
+	if from > 0 {
+		if from <= h.compacted {
+			return nil, kverror.ErrWatchCompacted
+		}
+		for i := 0; i < h.size; i++ {
+			e := &h.history[(h.head+i)%len(h.history)]
+			if e.Index >= from && w.match(e) {
+				w.pending = append(w.pending, *e)
+			}
+		}
+		if len(w.pending) > 0 {
+			w.signal()
+		}
+	}
+	h.watchers[w] = struct{}{}
+	return w, nil
+}
+
+func (h *watchHub) Unwatch(w *watcher) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.watchers, w)
+}
+
+// take the pending changes of w
+func (h *watchHub) take(w *watcher) (events []watchEvent, lagged bool) {
+	h.Lock()
+	defer h.Unlock()
+	events, w.pending = w.pending, nil
+	if len(events) > 0 {
+		w.last = events[len(events)-1].Index
+	}
+	return events, w.lagged
+}
+
+// changes the watch changes of a submit applied to the store, existed is whether its key
+// was stored before
+func (s *RaftKv) changes(ctx context.Context, st *Submit, index uint64, existed bool) []watchEvent {
+	var change = func(db int, op string, key, val []byte) []watchEvent {
+		return []watchEvent{{db: db, ChangeEvent: protocol.ChangeEvent{Index: index, OP: op, Key: key, Value: val}}}
+	}
+	switch st.OP {
+	case CommitOPSet:
+		if v := codec.Decode(st.Value); v.IsString() {
+			return change(st.DB, watchPut, st.Key, v.StringVal())
+		}
+		return change(st.DB, watchPut, st.Key, nil)
+	case CommitOPSAdd, CommitOPSRem:
+		if !s.keyExists(ctx, st.Key) {
+			return change(st.DB, watchDelete, st.Key, nil)
+		}
+		return change(st.DB, watchPut, st.Key, nil)
+	case CommitOPDel, CommitOPExDel:
+		if existed && !s.keyExists(ctx, st.Key) {
+			return change(st.DB, watchDelete, st.Key, nil)
+		}
+	case CommitOPCopy:
+		if len(st.Value) < codec.NumberSize {
+			return nil
+		}
+		db, dst := int(codec.Bytes2Int64(st.Value[:codec.NumberSize])), st.Value[codec.NumberSize:]
+		data, err := s.db.Get(kvstore.WithDB(ctx, db), dst)
+		if err != nil {
+			return nil
+		}
+		if v := codec.Decode(data); v.IsString() {
+			return change(db, watchPut, dst, v.StringVal())
+		}
+		return change(db, watchPut, dst, nil)
+	case CommitOPFlush:
+		return change(st.DB, watchFlush, nil, nil)
+	case CommitOPFlushAll:
+		return change(watchAllDB, watchFlush, nil, nil)
+	case CommitOPSwapDB:
+		return append(change(int(codec.Bytes2Int64(st.Key)), watchFlush, nil, nil),
+			change(int(codec.Bytes2Int64(st.Value)), watchFlush, nil, nil)...)
+	}
+	return nil
+}
+
+// watchSignal the changes of a watching client are pending
+type watchSignal struct {
+	client *Client
+	w      *watcher
+}
+
+// forward the signals of a watcher to the receive loop until it is unwatched or the client is closed
+func (n *Server) forward(client *Client, w *watcher) {
+	for {
+		select {
+		case <-w.C:
+			select {
+			case n.watchChan <- watchSignal{client: client, w: w}:
+			case <-w.done:
+				return
+			case <-client.closed:
+				n.kv.watches.Unwatch(w)
+				return
+			}
+		case <-w.done:
+			return
+		case <-client.closed:
+			n.kv.watches.Unwatch(w)
+			return
+		}
+	}
+}
+
+// watch put the client in the watch context, the changes are pushed until KVUNWATCH
+func (n *Server) watch(ctx context.Context, client *Client, cmd *protocol.KVWatchCmd) error {
+	if client.watch != nil {
+		cmd.Err = kverror.ErrWatching
+		return cmd.Write(client.wr)
+	}
+	w, err := n.kv.watches.Watch(client.db, append([]byte{}, cmd.Prefix...), cmd.From)
+	if err != nil {
+		cmd.Err = err
+		return cmd.Write(client.wr)
+	}
+	cmd.Index = n.kv.appliedIndex()
+	client.watch = w
+	go n.forward(client, w)
+	return cmd.Write(client.wr)
+}
+
+func (n *Server) unwatch(client *Client, cmd *protocol.KVUnwatchCmd) error {
+	if w := n.stopWatch(client); w != nil {
+		cmd.Prefix, cmd.Index = w.prefix, w.last
+	}
+	return cmd.Write(client.wr)
+}
+
+// stopWatch leave the watch context, it returns the watcher of the client if it is watching
+func (n *Server) stopWatch(client *Client) *watcher {
+	w := client.watch
+	if w == nil {
+		return nil
+	}
+	n.kv.watches.Unwatch(w)
+	close(w.done)
+	client.watch = nil
+	return w
+}
+
+// push write the pending changes of a watching client on the receive loop
+func (n *Server) push(ctx context.Context, sig watchSignal) {
+	client := sig.client
+	if client.watch != sig.w {
+		return
+	}
+	events, lagged := n.kv.watches.take(sig.w)
+	for i := range events {
+		events[i].Write(client.wr)
+	}
+	if lagged {
+		// the client watches again from the index of the last change it has got
+		n.stopWatch(client)
+		(&protocol.ErrResp{Err: kverror.ErrWatchLagged}).Write(client.wr)
+	}
+	if err := client.bw.Flush(); err != nil {
+		logger.Errorf(ctx, "push changes to watching client error:%v", err)
+	}
+}
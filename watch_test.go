@@ -0,0 +1,126 @@
+package gokv_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yixinin/gokv"
+	"github.com/yixinin/gokv/redis/protocol"
+)
+
+// watchConn a connection reading the pushed changes
+type watchConn struct {
+	t    *testing.T
+	conn net.Conn
+	rd   *protocol.Reader
+}
+
+func dialWatch(t *testing.T, addr string) *watchConn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &watchConn{t: t, conn: conn, rd: protocol.NewReader(conn)}
+}
+
+// do send a command and read the reply, errors are returned as the reply
+func (c *watchConn) do(args ...string) string {
+	if _, err := c.conn.Write([]byte(command(args...))); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.read()
+}
+
+// read a reply as a string, nil as "nil" and items of arrays joined by spaces
+func (c *watchConn) read() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := c.rd.ReadRequest(protocol.SliceParser)
+	if err != nil {
+		if _, ok := err.(protocol.RedisError); ok {
+			return err.Error()
+		}
+		c.t.Fatal(err)
+	}
+	var format func(v interface{}) string
+	format = func(v interface{}) string {
+		switch v := v.(type) {
+		case nil:
+			return "nil"
+		case []byte:
+			return string(v)
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				items = append(items, format(item))
+			}
+			return strings.Join(items, " ")
+		}
+		return v.(string)
+	}
+	return format(reply)
+}
+
+func TestKVWatch(t *testing.T) {
+	ctx := context.Background()
+	cli := startServer(t, 17351, func(cfg *gokv.Config) {
+		cfg.ServerCfg.WatchHistory = 3
+	})
+	w := dialWatch(t, "127.0.0.1:17351")
+	reply := w.do("KVWATCH", "cfg/")
+	if !strings.HasPrefix(reply, "kvwatch cfg/ ") {
+		t.Fatalf("kvwatch %q", reply)
+	}
+	if reply := w.do("GET", "cfg/a"); reply != "ERR only KVUNWATCH / PING are allowed in this context" {
+		t.Errorf("get in watch context %q", reply)
+	}
+
+	cli.Set(ctx, "cfg/a", "1", 0)
+	cli.Set(ctx, "other", "2", 0)
+	cli.Del(ctx, "cfg/a")
+	cli.RPush(ctx, "cfg/list", "x")
+	var index = make([]int, 3)
+	for i, expect := range []string{"put cfg/a 1", "delete cfg/a nil", "put cfg/list nil"} {
+		fields := strings.SplitN(w.read(), " ", 3)
+		if fields[0] != "change" || fields[2] != expect {
+			t.Fatalf("change %q, expect %q", fields, expect)
+		}
+		index[i], _ = strconv.Atoi(fields[1])
+	}
+	if reply := w.do("KVUNWATCH"); reply != "kvunwatch cfg/ "+strconv.Itoa(index[2]) {
+		t.Errorf("kvunwatch %q", reply)
+	}
+	if reply := w.do("GET", "other"); reply != "2" {
+		t.Errorf("get after kvunwatch %q", reply)
+	}
+
+	// resume from an index in the history, the older ones are compacted
+	if reply := w.do("KVWATCH", "cfg/", "FROM", strconv.Itoa(index[0])); reply != "ERR required index has been compacted" {
+		t.Errorf("kvwatch from a compacted index %q", reply)
+	}
+	w.do("KVWATCH", "cfg/", "FROM", strconv.Itoa(index[1]))
+	for _, expect := range []string{"delete cfg/a nil", "put cfg/list nil"} {
+		if change := w.read(); !strings.HasSuffix(change, expect) {
+			t.Errorf("replayed change %q, expect %q", change, expect)
+		}
+	}
+	cli.FlushDB(ctx)
+	if change := w.read(); !strings.HasSuffix(change, "flush nil nil") {
+		t.Errorf("flushdb change %q", change)
+	}
+
+	// changes beyond the history close the watch
+	cli.MSet(ctx, "cfg/1", "1", "cfg/2", "2", "cfg/3", "3", "cfg/4", "4")
+	if reply := w.read(); reply != "ERR watch lagged behind the changes, watch again" {
+		t.Errorf("lagged watch %q", reply)
+	}
+	if reply := w.do("PING"); reply != "PONG" {
+		t.Errorf("ping after lagged %q", reply)
+	}
+}